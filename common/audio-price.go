@@ -0,0 +1,40 @@
+package common
+
+import "encoding/json"
+
+// DefaultModelAudioPrice 语音转文字模型按音频时长计费的价格，单位为美元/秒
+// https://openai.com/pricing
+var DefaultModelAudioPrice = map[string]float64{
+	"whisper-1": 0.0001, // $0.006 / minute
+}
+
+// ModelAudioPrice 转录和翻译请求按音频时长计费，未配置的模型按识别结果的 token 数计费
+var ModelAudioPrice = map[string]float64{}
+
+func ModelAudioPrice2JSONString() string {
+	if len(ModelAudioPrice) == 0 {
+		ModelAudioPrice = DefaultModelAudioPrice
+	}
+	jsonBytes, err := json.Marshal(ModelAudioPrice)
+	if err != nil {
+		SysError("error marshalling model audio price: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelAudioPriceByJSONString(jsonStr string) error {
+	ModelAudioPrice = make(map[string]float64)
+	return json.Unmarshal([]byte(jsonStr), &ModelAudioPrice)
+}
+
+// GetModelAudioPrice 返回模型每秒音频的价格，未配置时返回 -1
+func GetModelAudioPrice(name string) float64 {
+	if len(ModelAudioPrice) == 0 {
+		ModelAudioPrice = DefaultModelAudioPrice
+	}
+	price, ok := ModelAudioPrice[name]
+	if !ok {
+		return -1
+	}
+	return price
+}
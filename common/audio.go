@@ -0,0 +1,619 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// audioMaxByteRates 各格式音频数据的最大码率（字节/秒）。
+// 时长读取自客户端上传的文件头，可以伪造，所以时长至少为文件大小除以格式的最大码率，按合法码率编码的文件不受影响。
+// mp4 和 webm 可能包含视频轨道，没有上限
+var audioMaxByteRates = map[string]float64{
+	"wav":  1536000, // 32 位 192kHz 立体声 PCM
+	"flac": 1536000,
+	"ogg":  64000, // Opus 和 Vorbis 的最大码率约为 512kbps
+	"mp3":  56000, // MPEG-1 Layer I 的最大码率 448kbps
+}
+
+// GetAudioDuration 读取音频文件的时长（秒），支持 wav、mp3、m4a、ogg、webm 和 flac，按文件头识别格式。
+// 只解析容器和帧头中的信息，不解码音频数据
+func GetAudioDuration(r io.ReadSeeker) (float64, error) {
+	header := make([]byte, 12)
+	n, err := io.ReadFull(r, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, err
+	}
+	header = header[:n]
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var format string
+	var duration float64
+	switch {
+	case len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+		format = "wav"
+		duration, err = wavDuration(r)
+	case len(header) >= 4 && string(header[0:4]) == "fLaC":
+		format = "flac"
+		duration, err = flacDuration(r)
+	case len(header) >= 4 && string(header[0:4]) == "OggS":
+		format = "ogg"
+		duration, err = oggDuration(r)
+	case len(header) >= 4 && bytes.Equal(header[0:4], []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		format = "webm"
+		duration, err = webmDuration(r)
+	case len(header) >= 8 && string(header[4:8]) == "ftyp":
+		format = "mp4"
+		duration, err = mp4Duration(r)
+	case len(header) >= 3 && string(header[0:3]) == "ID3",
+		len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0:
+		format = "mp3"
+		duration, err = mp3Duration(r)
+	default:
+		return 0, errors.New("unsupported audio format")
+	}
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(duration) || math.IsInf(duration, 0) {
+		return 0, errors.New("invalid audio duration")
+	}
+	if maxByteRate, ok := audioMaxByteRates[format]; ok {
+		size, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		duration = math.Max(duration, float64(size)/maxByteRate)
+	}
+	if duration <= 0 {
+		return 0, errors.New("invalid audio duration")
+	}
+	return duration, nil
+}
+
+// wavDuration 时长为 data 块的字节数除以 fmt 块中的每秒字节数
+func wavDuration(r io.ReadSeeker) (float64, error) {
+	if _, err := r.Seek(12, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var byteRate uint32
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunkHeader); err != nil {
+			return 0, fmt.Errorf("wav data chunk not found: %w", err)
+		}
+		chunkId := string(chunkHeader[0:4])
+		chunkSize := int64(binary.LittleEndian.Uint32(chunkHeader[4:8]))
+		switch chunkId {
+		case "fmt ":
+			if chunkSize < 16 {
+				return 0, errors.New("invalid wav fmt chunk")
+			}
+			format := make([]byte, 16)
+			if _, err := io.ReadFull(r, format); err != nil {
+				return 0, err
+			}
+			byteRate = binary.LittleEndian.Uint32(format[8:12])
+			if _, err := r.Seek(chunkSize-16+chunkSize%2, io.SeekCurrent); err != nil {
+				return 0, err
+			}
+		case "data":
+			if byteRate == 0 {
+				return 0, errors.New("wav fmt chunk not found")
+			}
+			// 流式写入的 wav 文件 data 块长度可能为 0 或最大值，此时使用到文件末尾的长度
+			if chunkSize == 0 || chunkSize == math.MaxUint32 {
+				current, err := r.Seek(0, io.SeekCurrent)
+				if err != nil {
+					return 0, err
+				}
+				end, err := r.Seek(0, io.SeekEnd)
+				if err != nil {
+					return 0, err
+				}
+				chunkSize = end - current
+			}
+			return float64(chunkSize) / float64(byteRate), nil
+		default:
+			if _, err := r.Seek(chunkSize+chunkSize%2, io.SeekCurrent); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+// flacDuration 时长为 STREAMINFO 块中的总采样数除以采样率
+func flacDuration(r io.ReadSeeker) (float64, error) {
+	if _, err := r.Seek(4, io.SeekStart); err != nil {
+		return 0, err
+	}
+	blockHeader := make([]byte, 4)
+	if _, err := io.ReadFull(r, blockHeader); err != nil {
+		return 0, err
+	}
+	if blockHeader[0]&0x7F != 0 {
+		return 0, errors.New("flac streaminfo block not found")
+	}
+	streamInfo := make([]byte, 34)
+	if _, err := io.ReadFull(r, streamInfo); err != nil {
+		return 0, err
+	}
+	// 采样率 20 位、声道数 3 位、位深 5 位、总采样数 36 位
+	value := binary.BigEndian.Uint64(streamInfo[10:18])
+	sampleRate := value >> 44
+	totalSamples := value & (1<<36 - 1)
+	if sampleRate == 0 || totalSamples == 0 {
+		return 0, errors.New("flac total samples unknown")
+	}
+	return float64(totalSamples) / float64(sampleRate), nil
+}
+
+// oggMaxPageSize Ogg 页的最大长度，最后一页一定在文件末尾的这个范围内
+const oggMaxPageSize = 27 + 255 + 255*255
+
+// oggDuration 时长为最后一页的 granule position 除以采样率，采样率从第一页的 Vorbis 或 Opus 头中读取
+func oggDuration(r io.ReadSeeker) (float64, error) {
+	firstPage := make([]byte, 27+255+64)
+	n, err := io.ReadFull(r, firstPage)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, err
+	}
+	firstPage = firstPage[:n]
+	if len(firstPage) < 28 {
+		return 0, errors.New("invalid ogg page")
+	}
+	packetStart := 27 + int(firstPage[26])
+	if len(firstPage) < packetStart+19 {
+		return 0, errors.New("invalid ogg page")
+	}
+	packet := firstPage[packetStart:]
+	var sampleRate float64
+	var preSkip int64
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		sampleRate = float64(binary.LittleEndian.Uint32(packet[12:16]))
+	case bytes.HasPrefix(packet, []byte("OpusHead")):
+		// Opus 的 granule position 总是以 48kHz 计数
+		sampleRate = 48000
+		preSkip = int64(binary.LittleEndian.Uint16(packet[10:12]))
+	default:
+		return 0, errors.New("unsupported ogg codec")
+	}
+	if sampleRate == 0 {
+		return 0, errors.New("invalid ogg sample rate")
+	}
+
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	start := end - oggMaxPageSize
+	if start < 0 {
+		start = 0
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	tail, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	for i := bytes.LastIndex(tail, []byte("OggS")); i >= 0; i = bytes.LastIndex(tail[:i], []byte("OggS")) {
+		if len(tail) < i+14 {
+			continue
+		}
+		granule := int64(binary.LittleEndian.Uint64(tail[i+6 : i+14]))
+		if granule > 0 {
+			return float64(granule-preSkip) / sampleRate, nil
+		}
+	}
+	return 0, errors.New("ogg granule position not found")
+}
+
+// mp4Duration 时长为 moov/mvhd 中的 duration 除以 timescale
+func mp4Duration(r io.ReadSeeker) (float64, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	moovStart, moovEnd, err := findMp4Box(r, 0, end, "moov")
+	if err != nil {
+		return 0, err
+	}
+	mvhdStart, _, err := findMp4Box(r, moovStart, moovEnd, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(mvhdStart, io.SeekStart); err != nil {
+		return 0, err
+	}
+	mvhd := make([]byte, 32)
+	if _, err := io.ReadFull(r, mvhd); err != nil {
+		return 0, err
+	}
+	var timescale uint32
+	var duration uint64
+	if mvhd[0] == 1 {
+		// version 1：创建时间和修改时间为 8 字节，duration 为 8 字节
+		timescale = binary.BigEndian.Uint32(mvhd[20:24])
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		timescale = binary.BigEndian.Uint32(mvhd[12:16])
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+	if timescale == 0 {
+		return 0, errors.New("invalid mp4 timescale")
+	}
+	return float64(duration) / float64(timescale), nil
+}
+
+// findMp4Box 在 [start, end) 范围内查找指定类型的 box，返回 box 内容的起止位置
+func findMp4Box(r io.ReadSeeker, start int64, end int64, boxType string) (int64, int64, error) {
+	header := make([]byte, 8)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		if _, err := io.ReadFull(r, header); err != nil {
+			return 0, 0, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			largeSize := make([]byte, 8)
+			if _, err := io.ReadFull(r, largeSize); err != nil {
+				return 0, 0, err
+			}
+			size = int64(binary.BigEndian.Uint64(largeSize))
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > end {
+			return 0, 0, errors.New("invalid mp4 box size")
+		}
+		if string(header[4:8]) == boxType {
+			return offset + headerSize, offset + size, nil
+		}
+		offset += size
+	}
+	return 0, 0, fmt.Errorf("mp4 box %s not found", boxType)
+}
+
+const (
+	ebmlIdSegment       = 0x18538067
+	ebmlIdInfo          = 0x1549A966
+	ebmlIdTimecodeScale = 0x2AD7B1
+	ebmlIdDuration      = 0x4489
+	ebmlIdCluster       = 0x1F43B675
+	ebmlIdTimecode      = 0xE7
+	ebmlIdBlockGroup    = 0xA0
+	ebmlIdBlock         = 0xA1
+	ebmlIdSimpleBlock   = 0xA3
+)
+
+// webmDuration 优先使用 Segment/Info 中的 Duration。浏览器 MediaRecorder 录制的文件通常没有 Duration，
+// 此时遍历所有 Cluster，取最后一个块的时间戳作为时长
+func webmDuration(r io.ReadSeeker) (float64, error) {
+	reader := bufio.NewReader(r)
+	// 跳过 EBML 头
+	if _, err := readEbmlId(reader); err != nil {
+		return 0, err
+	}
+	size, err := readEbmlSize(reader)
+	if err != nil {
+		return 0, err
+	}
+	if err := discardEbml(reader, size); err != nil {
+		return 0, err
+	}
+
+	timecodeScale := uint64(1000000)
+	var duration float64
+	var clusterTimecode uint64
+	var lastTimecode int64
+	for {
+		id, err := readEbmlId(reader)
+		if err != nil {
+			break
+		}
+		size, err := readEbmlSize(reader)
+		if err != nil {
+			break
+		}
+		switch id {
+		case ebmlIdSegment, ebmlIdInfo, ebmlIdCluster, ebmlIdBlockGroup:
+			// 容器元素，继续读取其中的子元素，长度可能未知
+			continue
+		case ebmlIdTimecodeScale:
+			value, err := readEbmlUint(reader, size)
+			if err != nil {
+				return 0, err
+			}
+			if value > 0 {
+				timecodeScale = value
+			}
+		case ebmlIdDuration:
+			value, err := readEbmlFloat(reader, size)
+			if err != nil {
+				return 0, err
+			}
+			duration = value
+		case ebmlIdTimecode:
+			clusterTimecode, err = readEbmlUint(reader, size)
+			if err != nil {
+				return 0, err
+			}
+		case ebmlIdSimpleBlock, ebmlIdBlock:
+			// 块的开头为轨道号和相对于 Cluster 的 16 位时间戳
+			trackSize, err := readVint(reader, false)
+			if err != nil {
+				return 0, err
+			}
+			timecode := make([]byte, 2)
+			if _, err := io.ReadFull(reader, timecode); err != nil {
+				return 0, err
+			}
+			blockTimecode := int64(clusterTimecode) + int64(int16(binary.BigEndian.Uint16(timecode)))
+			if blockTimecode > lastTimecode {
+				lastTimecode = blockTimecode
+			}
+			if size < uint64(trackSize.length+2) {
+				return 0, errors.New("invalid webm block size")
+			}
+			if err := discardEbml(reader, size-uint64(trackSize.length+2)); err != nil {
+				return 0, err
+			}
+		default:
+			if err := discardEbml(reader, size); err != nil {
+				return 0, err
+			}
+		}
+		if duration > 0 {
+			break
+		}
+	}
+	if duration == 0 {
+		duration = float64(lastTimecode)
+	}
+	return duration * float64(timecodeScale) / 1e9, nil
+}
+
+// ebmlUnknownSize 长度未知的元素（如直播录制的 Segment 和 Cluster）
+const ebmlUnknownSize = math.MaxUint64
+
+type vint struct {
+	value  uint64
+	length int
+}
+
+// readVint 读取 EBML 变长整数，keepMarker 为 true 时保留长度标记位（元素 ID），否则去掉（元素长度）
+func readVint(reader *bufio.Reader, keepMarker bool) (vint, error) {
+	first, err := reader.ReadByte()
+	if err != nil {
+		return vint{}, err
+	}
+	length := 1
+	for mask := byte(0x80); mask != 0 && first&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return vint{}, errors.New("invalid ebml vint")
+	}
+	value := uint64(first)
+	if !keepMarker {
+		value &= uint64(0xFF >> length)
+	}
+	allOnes := value == uint64(0xFF>>length)
+	for i := 1; i < length; i++ {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return vint{}, err
+		}
+		value = value<<8 | uint64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+	if !keepMarker && allOnes {
+		value = ebmlUnknownSize
+	}
+	return vint{value: value, length: length}, nil
+}
+
+func readEbmlId(reader *bufio.Reader) (uint64, error) {
+	id, err := readVint(reader, true)
+	return id.value, err
+}
+
+func readEbmlSize(reader *bufio.Reader) (uint64, error) {
+	size, err := readVint(reader, false)
+	return size.value, err
+}
+
+func readEbmlUint(reader *bufio.Reader, size uint64) (uint64, error) {
+	if size > 8 {
+		return 0, errors.New("invalid ebml uint size")
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return 0, err
+	}
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value, nil
+}
+
+func readEbmlFloat(reader *bufio.Reader, size uint64) (float64, error) {
+	if size != 4 && size != 8 {
+		return 0, errors.New("invalid ebml float size")
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return 0, err
+	}
+	if size == 4 {
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), nil
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+}
+
+// ebmlMaxSkipSize 跳过的元素长度上限，超过时视为文件损坏（包括长度未知的非容器元素）
+const ebmlMaxSkipSize = math.MaxInt32
+
+// discardEbml 跳过元素的内容
+func discardEbml(reader *bufio.Reader, size uint64) error {
+	if size > ebmlMaxSkipSize {
+		return errors.New("invalid webm element size")
+	}
+	_, err := reader.Discard(int(size))
+	return err
+}
+
+var (
+	mp3SampleRates = [4][3]int{
+		{11025, 12000, 8000},  // MPEG 2.5
+		{0, 0, 0},             // 保留
+		{22050, 24000, 16000}, // MPEG 2
+		{44100, 48000, 32000}, // MPEG 1
+	}
+	// mp3Bitrates 按 [MPEG 1 或 2][层] 索引，单位 kbps
+	mp3Bitrates = [2][3][16]int{
+		{
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		},
+		{
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		},
+	}
+)
+
+type mp3FrameHeader struct {
+	sampleRate      int
+	samplesPerFrame int
+	frameLength     int
+	mpeg1           bool
+	mono            bool
+}
+
+func parseMp3FrameHeader(header []byte) (*mp3FrameHeader, error) {
+	if header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return nil, errors.New("invalid mp3 frame sync")
+	}
+	version := (header[1] >> 3) & 0x03
+	layer := (header[1] >> 1) & 0x03
+	bitrateIndex := header[2] >> 4
+	sampleRateIndex := (header[2] >> 2) & 0x03
+	padding := int((header[2] >> 1) & 0x01)
+	if version == 1 || layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return nil, errors.New("invalid mp3 frame header")
+	}
+	mpeg1 := version == 3
+	versionIndex := 1
+	if mpeg1 {
+		versionIndex = 0
+	}
+	layerIndex := 3 - int(layer) // 0: Layer I, 1: Layer II, 2: Layer III
+	bitrate := mp3Bitrates[versionIndex][layerIndex][bitrateIndex] * 1000
+	sampleRate := mp3SampleRates[version][sampleRateIndex]
+	frame := &mp3FrameHeader{
+		sampleRate: sampleRate,
+		mpeg1:      mpeg1,
+		mono:       header[3]>>6 == 3,
+	}
+	switch {
+	case layerIndex == 0:
+		frame.samplesPerFrame = 384
+		frame.frameLength = (12*bitrate/sampleRate + padding) * 4
+	case layerIndex == 2 && !mpeg1:
+		frame.samplesPerFrame = 576
+		frame.frameLength = 72*bitrate/sampleRate + padding
+	default:
+		frame.samplesPerFrame = 1152
+		frame.frameLength = 144*bitrate/sampleRate + padding
+	}
+	return frame, nil
+}
+
+// mp3Duration 优先使用第一帧中 Xing/Info 或 VBRI 头记录的总帧数，没有时逐帧累加采样数
+func mp3Duration(r io.ReadSeeker) (float64, error) {
+	reader := bufio.NewReader(r)
+	// 跳过 ID3v2 标签
+	if tag, err := reader.Peek(10); err == nil && string(tag[0:3]) == "ID3" {
+		tagSize := int(tag[6]&0x7F)<<21 | int(tag[7]&0x7F)<<14 | int(tag[8]&0x7F)<<7 | int(tag[9]&0x7F)
+		if tag[5]&0x10 != 0 {
+			tagSize += 10
+		}
+		if _, err := reader.Discard(10 + tagSize); err != nil {
+			return 0, err
+		}
+	}
+	// 查找第一个帧头
+	var first *mp3FrameHeader
+	for {
+		header, err := reader.Peek(4)
+		if err != nil {
+			return 0, errors.New("mp3 frame not found")
+		}
+		if first, err = parseMp3FrameHeader(header); err == nil {
+			break
+		}
+		_, _ = reader.Discard(1)
+	}
+	if frames := mp3VbrFrames(reader, first); frames > 0 {
+		return float64(frames) * float64(first.samplesPerFrame) / float64(first.sampleRate), nil
+	}
+	var samples int64
+	for {
+		header, err := reader.Peek(4)
+		if err != nil {
+			break
+		}
+		frame, err := parseMp3FrameHeader(header)
+		if err != nil {
+			// 文件末尾的 ID3v1 等标签
+			break
+		}
+		if _, err := reader.Discard(frame.frameLength); err != nil {
+			break
+		}
+		samples += int64(frame.samplesPerFrame)
+	}
+	return float64(samples) / float64(first.sampleRate), nil
+}
+
+// mp3VbrFrames 读取第一帧中 Xing/Info 或 VBRI 头记录的总帧数，不存在时返回 0
+func mp3VbrFrames(reader *bufio.Reader, frame *mp3FrameHeader) int64 {
+	data, _ := reader.Peek(frame.frameLength)
+	sideInfoSize := 32
+	switch {
+	case frame.mpeg1 && frame.mono:
+		sideInfoSize = 17
+	case !frame.mpeg1 && !frame.mono:
+		sideInfoSize = 17
+	case !frame.mpeg1 && frame.mono:
+		sideInfoSize = 9
+	}
+	offset := 4 + sideInfoSize
+	if len(data) >= offset+12 {
+		tag := string(data[offset : offset+4])
+		flags := binary.BigEndian.Uint32(data[offset+4 : offset+8])
+		if (tag == "Xing" || tag == "Info") && flags&0x01 != 0 {
+			return int64(binary.BigEndian.Uint32(data[offset+8 : offset+12]))
+		}
+	}
+	if len(data) >= 36+18 && string(data[36:40]) == "VBRI" {
+		return int64(binary.BigEndian.Uint32(data[36+14 : 36+18]))
+	}
+	return 0
+}
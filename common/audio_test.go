@@ -0,0 +1,235 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// concat 拼接测试文件的各个部分
+func concat(elements ...[]byte) []byte {
+	return bytes.Join(elements, nil)
+}
+
+var (
+	webmEbmlHeader = []byte{0x1A, 0x45, 0xDF, 0xA3, 0x80}
+	// Segment 和 Cluster 使用未知长度，与 MediaRecorder 录制的文件相同
+	webmSegment = []byte{0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	webmCluster = []byte{0x1F, 0x43, 0xB6, 0x75, 0xFF}
+)
+
+func webmDurationElement(milliseconds float64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, math.Float64bits(milliseconds))
+	return append([]byte{0x44, 0x89, 0x88}, data...)
+}
+
+func TestGetAudioDurationWebm(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want float64
+	}{
+		{
+			name: "info duration",
+			data: concat(webmEbmlHeader, webmSegment,
+				[]byte{0x15, 0x49, 0xA9, 0x66, 0x8F},
+				[]byte{0x2A, 0xD7, 0xB1, 0x83, 0x0F, 0x42, 0x40},
+				webmDurationElement(1500)),
+			want: 1.5,
+		},
+		{
+			name: "last block timecode",
+			data: concat(webmEbmlHeader, webmSegment, webmCluster,
+				[]byte{0xE7, 0x81, 0x00},
+				[]byte{0xA3, 0x85, 0x81, 0x03, 0xE8, 0x80, 0x00},
+				[]byte{0xA3, 0x85, 0x81, 0x0B, 0xB8, 0x80, 0x00}),
+			want: 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := GetAudioDuration(bytes.NewReader(test.data))
+			if err != nil {
+				t.Fatalf("GetAudioDuration() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("GetAudioDuration() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetAudioDurationMalformedWebm(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{
+			// Duration 的长度为 2^49，不能按这个长度分配内存
+			name: "huge float size",
+			data: concat(webmEbmlHeader, []byte{0x44, 0x89, 0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}),
+		},
+		{
+			name: "invalid float size",
+			data: concat(webmEbmlHeader, []byte{0x44, 0x89, 0x85, 0x00, 0x00, 0x00, 0x00, 0x00}),
+		},
+		{
+			name: "huge header size",
+			data: []byte{0x1A, 0x45, 0xDF, 0xA3, 0x01, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE},
+		},
+		{
+			name: "unknown header size",
+			data: []byte{0x1A, 0x45, 0xDF, 0xA3, 0xFF},
+		},
+		{
+			name: "huge element size",
+			data: concat(webmEbmlHeader, webmSegment, []byte{0xEC, 0x01, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE}),
+		},
+		{
+			name: "unknown element size",
+			data: concat(webmEbmlHeader, webmSegment, []byte{0xEC, 0xFF}),
+		},
+		{
+			name: "block smaller than its header",
+			data: concat(webmEbmlHeader, webmSegment, webmCluster, []byte{0xA3, 0x81, 0x81, 0x00, 0x10}),
+		},
+		{
+			name: "huge uint size",
+			data: concat(webmEbmlHeader, webmSegment, []byte{0x2A, 0xD7, 0xB1, 0x89, 0x00}),
+		},
+		{
+			name: "truncated",
+			data: concat(webmEbmlHeader, webmSegment, []byte{0x44, 0x89, 0x88, 0x40}),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if duration, err := GetAudioDuration(bytes.NewReader(test.data)); err == nil {
+				t.Errorf("GetAudioDuration() = %v, want error", duration)
+			}
+		})
+	}
+}
+
+// mp3Frame 返回一个 MPEG-1 Layer III 128kbps 44.1kHz 立体声的帧，长度 417 字节，payload 写在帧头之后
+func mp3Frame(payload []byte) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	copy(frame[4:], payload)
+	return frame
+}
+
+func mp3Frames(count int) []byte {
+	return bytes.Repeat(mp3Frame(nil), count)
+}
+
+// mp3XingFrame 返回第一帧中记录了总帧数的 Xing 头，立体声的边信息为 32 字节
+func mp3XingFrame(frames uint32) []byte {
+	payload := make([]byte, 32+12)
+	copy(payload[32:], "Xing")
+	binary.BigEndian.PutUint32(payload[36:40], 0x01)
+	binary.BigEndian.PutUint32(payload[40:44], frames)
+	return mp3Frame(payload)
+}
+
+// oggPage 返回只有一个数据段的 Ogg 页，不计算校验和
+func oggPage(granule uint64, packet []byte) []byte {
+	page := make([]byte, 27, 28+len(packet))
+	copy(page, "OggS")
+	binary.LittleEndian.PutUint64(page[6:14], granule)
+	page[26] = 1
+	page = append(page, byte(len(packet)))
+	return append(page, packet...)
+}
+
+func opusHead(preSkip uint16) []byte {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1
+	head[9] = 1
+	binary.LittleEndian.PutUint16(head[10:12], preSkip)
+	binary.LittleEndian.PutUint32(head[12:16], 48000)
+	return head
+}
+
+// wavFile 返回 16kHz 16 位单声道的 wav 文件，fmt 块中的每秒字节数为 byteRate
+func wavFile(byteRate uint32, dataSize int) []byte {
+	file := make([]byte, 44+dataSize)
+	copy(file, "RIFF")
+	binary.LittleEndian.PutUint32(file[4:8], uint32(36+dataSize))
+	copy(file[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(file[16:20], 16)
+	binary.LittleEndian.PutUint16(file[20:22], 1)
+	binary.LittleEndian.PutUint16(file[22:24], 1)
+	binary.LittleEndian.PutUint32(file[24:28], 16000)
+	binary.LittleEndian.PutUint32(file[28:32], byteRate)
+	binary.LittleEndian.PutUint16(file[32:34], 2)
+	binary.LittleEndian.PutUint16(file[34:36], 16)
+	copy(file[36:], "data")
+	binary.LittleEndian.PutUint32(file[40:44], uint32(dataSize))
+	return file
+}
+
+func TestGetAudioDurationForgedHeader(t *testing.T) {
+	mp3FrameDuration := 1152.0 / 44100
+	tests := []struct {
+		name string
+		data []byte
+		want float64
+	}{
+		{
+			name: "mp3 cbr",
+			data: mp3Frames(500),
+			want: 500 * mp3FrameDuration,
+		},
+		{
+			name: "mp3 xing frames",
+			data: concat(mp3XingFrame(500), mp3Frames(499)),
+			want: 500 * mp3FrameDuration,
+		},
+		{
+			// 时长不能少于文件大小除以 mp3 的最大码率
+			name: "mp3 forged xing frames",
+			data: concat(mp3XingFrame(1), mp3Frames(999)),
+			want: 1000 * 417 / 56000.0,
+		},
+		{
+			name: "mp3 junk after the first frame",
+			data: concat(mp3Frames(1), make([]byte, 1000), mp3Frames(999)),
+			want: (1000*417 + 1000) / 56000.0,
+		},
+		{
+			name: "ogg opus",
+			data: concat(oggPage(0, opusHead(312)), make([]byte, 1000), oggPage(312+48000*3, nil)),
+			want: 3,
+		},
+		{
+			name: "ogg forged granule position",
+			data: concat(oggPage(0, opusHead(312)), make([]byte, 128000), oggPage(312+48, nil)),
+			want: float64(28+19+128000+28) / 64000,
+		},
+		{
+			name: "wav",
+			data: wavFile(32000, 96000),
+			want: 3,
+		},
+		{
+			name: "wav forged byte rate",
+			data: wavFile(0xFFFFFFFF, 96000),
+			want: float64(44+96000) / 1536000,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := GetAudioDuration(bytes.NewReader(test.data))
+			if err != nil {
+				t.Fatalf("GetAudioDuration() error = %v", err)
+			}
+			if math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("GetAudioDuration() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
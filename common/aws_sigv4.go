@@ -0,0 +1,130 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSUnsignedPayload 不对请求体签名时使用的 payload 摘要（仅 S3 支持）
+const AWSUnsignedPayload = "UNSIGNED-PAYLOAD"
+
+func awsHmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func AWSSha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// awsUriEncode 按照 AWS 的规则进行 URI 编码，只保留非保留字符，encodeSlash 为 false 时保留 '/'
+func awsUriEncode(s string, encodeSlash bool) string {
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || (ch == '/' && !encodeSlash) {
+			builder.WriteByte(ch)
+		} else {
+			builder.WriteString(fmt.Sprintf("%%%02X", ch))
+		}
+	}
+	return builder.String()
+}
+
+// SignAWSRequestV4 使用 AWS Signature Version 4 为请求签名。
+// payloadHash 为请求体的 SHA256 十六进制摘要，S3 可以传入 AWSUnsignedPayload 以流式上传请求体。
+func SignAWSRequestV4(req *http.Request, payloadHash string, accessKeyId string, secretAccessKey string, region string, service string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	// 统一请求路径在网络上的编码方式，保证与签名时的规范路径一致
+	encodedPath := awsUriEncode(req.URL.Path, false)
+	if encodedPath == "" {
+		encodedPath = "/"
+	}
+	req.URL.RawPath = encodedPath
+	canonicalURI := encodedPath
+	if service != "s3" {
+		// 除 S3 外的服务需要对路径进行两次编码
+		canonicalURI = awsUriEncode(encodedPath, false)
+	}
+
+	query := req.URL.Query()
+	queryKeys := make([]string, 0, len(query))
+	for key := range query {
+		queryKeys = append(queryKeys, key)
+	}
+	sort.Strings(queryKeys)
+	queryParts := make([]string, 0, len(queryKeys))
+	for _, key := range queryKeys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			queryParts = append(queryParts, awsUriEncode(key, true)+"="+awsUriEncode(value, true))
+		}
+	}
+	canonicalQuery := strings.Join(queryParts, "&")
+	req.URL.RawQuery = canonicalQuery
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host": host,
+	}
+	for key, values := range req.Header {
+		lowerKey := strings.ToLower(key)
+		if strings.HasPrefix(lowerKey, "x-amz-") || lowerKey == "content-type" {
+			headers[lowerKey] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	headerKeys := make([]string, 0, len(headers))
+	for key := range headers {
+		headerKeys = append(headerKeys, key)
+	}
+	sort.Strings(headerKeys)
+	var canonicalHeaders strings.Builder
+	for _, key := range headerKeys {
+		canonicalHeaders.WriteString(key + ":" + headers[key] + "\n")
+	}
+	signedHeaders := strings.Join(headerKeys, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		AWSSha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := awsHmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	signingKey = awsHmacSHA256(signingKey, region)
+	signingKey = awsHmacSHA256(signingKey, service)
+	signingKey = awsHmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(awsHmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyId, scope, signedHeaders, signature))
+}
@@ -0,0 +1,28 @@
+package common
+
+import "encoding/json"
+
+// ModelCacheTTL 按模型启用响应缓存，键为模型名称，值为缓存有效期（秒），未配置的模型不缓存
+var ModelCacheTTL = map[string]int{}
+
+func ModelCacheTTL2JSONString() string {
+	jsonBytes, err := json.Marshal(ModelCacheTTL)
+	if err != nil {
+		SysError("error marshalling model cache ttl: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelCacheTTLByJSONString(jsonStr string) error {
+	ModelCacheTTL = make(map[string]int)
+	return json.Unmarshal([]byte(jsonStr), &ModelCacheTTL)
+}
+
+// GetModelCacheTTL 返回模型的响应缓存有效期，未启用缓存时返回 0
+func GetModelCacheTTL(name string) int {
+	ttl, ok := ModelCacheTTL[name]
+	if !ok || ttl < 0 {
+		return 0
+	}
+	return ttl
+}
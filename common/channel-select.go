@@ -0,0 +1,44 @@
+package common
+
+import "encoding/json"
+
+// 同一优先级的渠道之间的选择策略
+const (
+	ChannelSelectWeightedRandom  = "weighted_random"   // 按权重随机选择，默认
+	ChannelSelectLeastInFlight   = "least_in_flight"   // 选择进行中请求最少的渠道
+	ChannelSelectEWMALatency     = "ewma_latency"      // 选择平均延迟最低的渠道，流式请求按首字时间计算，错误率折算为额外的延迟
+	ChannelSelectLowestErrorRate = "lowest_error_rate" // 选择平均错误率最低的渠道
+)
+
+// ChannelSelectStrategy 按分组和模型设置渠道选择策略，键为 "分组/模型"，分组和模型都可以写作 *，
+// 比如 "default/gpt-4o"、"vip/*"、"*/gpt-4o"、"*"，越具体的配置优先
+var ChannelSelectStrategy = map[string]string{}
+
+func ChannelSelectStrategy2JSONString() string {
+	jsonBytes, err := json.Marshal(ChannelSelectStrategy)
+	if err != nil {
+		SysError("error marshalling channel select strategy: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateChannelSelectStrategyByJSONString(jsonStr string) error {
+	ChannelSelectStrategy = make(map[string]string)
+	return json.Unmarshal([]byte(jsonStr), &ChannelSelectStrategy)
+}
+
+// GetChannelSelectStrategy 返回分组和模型的渠道选择策略，未配置或配置无效时返回 ChannelSelectWeightedRandom
+func GetChannelSelectStrategy(group string, model string) string {
+	for _, key := range []string{group + "/" + model, group + "/*", "*/" + model, "*"} {
+		strategy, ok := ChannelSelectStrategy[key]
+		if !ok {
+			continue
+		}
+		switch strategy {
+		case ChannelSelectLeastInFlight, ChannelSelectEWMALatency, ChannelSelectLowestErrorRate:
+			return strategy
+		}
+		return ChannelSelectWeightedRandom
+	}
+	return ChannelSelectWeightedRandom
+}
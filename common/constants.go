@@ -98,6 +98,17 @@ var QuotaForInvitee = 0
 var ChannelDisableThreshold = 5.0
 var AutomaticDisableChannelEnabled = false
 var AutomaticEnableChannelEnabled = false
+
+// 渠道熔断，按渠道和模型统计，代替自动禁用渠道
+var ChannelBreakerEnabled = false
+var ChannelBreakerWindow = 60             // 滑动窗口，单位秒
+var ChannelBreakerMinRequests = 10        // 窗口内请求数达到该值后才按错误率熔断
+var ChannelBreakerErrorRate = 0.5         // 熔断的错误率
+var ChannelBreakerConsecutiveFailures = 5 // 熔断的连续失败次数，0 表示不按连续失败熔断
+var ChannelBreakerCooldown = 30           // 熔断后进入半开状态前的冷却时间，单位秒
+var ChannelBreakerHalfOpenRatio = 0.1     // 半开状态下放行的请求比例
+var ChannelBreakerHalfOpenSuccesses = 3   // 半开状态下恢复所需的连续成功次数
+
 var QuotaRemindThreshold = 1000
 var PreConsumedQuota = 500
 
@@ -107,6 +118,9 @@ var RootUserEmail = ""
 
 var IsMasterNode = os.Getenv("NODE_TYPE") != "slave"
 
+// IsMultiNode 设置了 NODE_TYPE 时视为多节点部署
+var IsMultiNode = os.Getenv("NODE_TYPE") != ""
+
 var requestInterval, _ = strconv.Atoi(os.Getenv("POLLING_INTERVAL"))
 var RequestInterval = time.Duration(requestInterval) * time.Second
 
@@ -116,11 +130,42 @@ var BatchUpdateEnabled = false
 var BatchUpdateInterval = GetOrDefault("BATCH_UPDATE_INTERVAL", 5)
 
 var RelayTimeout = GetOrDefault("RELAY_TIMEOUT", 0) // unit is second
+// 流式请求等待第一个数据块、两个数据块之间的默认超时时间，0 表示不限制，渠道可以单独设置
+var RelayFirstTokenTimeout = GetOrDefault("RELAY_FIRST_TOKEN_TIMEOUT", 0) // unit is second
+var RelayIdleTimeout = GetOrDefault("RELAY_IDLE_TIMEOUT", 0)              // unit is second
+
+// 流式响应超过该时间没有数据时向客户端发送心跳注释，避免连接被中间代理断开，0 表示不发送
+var StreamKeepAliveInterval = GetOrDefault("STREAM_KEEPALIVE_INTERVAL", 15) // unit is second
 
 var GeminiSafetySetting = GetOrDefaultString("GEMINI_SAFETY_SETTING", "BLOCK_NONE")
 
+// 文件存储：local 保存在本地磁盘 FILE_STORAGE_PATH 目录下，s3 保存在 S3 兼容的对象存储中
+var FileStorageType = GetOrDefaultString("FILE_STORAGE", "local")
+var FileStoragePath = GetOrDefaultString("FILE_STORAGE_PATH", "./files")
+
+// 多节点部署时文件可能在任一节点上传，而批处理任务只在主节点处理，文件必须保存在所有节点都能读取的位置：
+// 使用 s3，或者将 FILE_STORAGE_PATH 设为所有节点共享的目录（如 NFS）并设置 FILE_STORAGE_SHARED=true
+var FileStorageShared = os.Getenv("FILE_STORAGE_SHARED") == "true"
+var MaxFileSize = GetOrDefault("MAX_FILE_SIZE", 512) // unit is MB
+var S3Endpoint = GetOrDefaultString("S3_ENDPOINT", "")
+var S3Region = GetOrDefaultString("S3_REGION", "us-east-1")
+var S3Bucket = GetOrDefaultString("S3_BUCKET", "")
+var S3AccessKeyId = GetOrDefaultString("S3_ACCESS_KEY_ID", "")
+var S3SecretAccessKey = GetOrDefaultString("S3_SECRET_ACCESS_KEY", "")
+
+// BatchRatio 批处理请求的计费倍率
+var BatchRatio = 0.5
+var BatchPollInterval = GetOrDefault("BATCH_POLL_INTERVAL", 10) // unit is second
+var BatchConcurrency = GetOrDefault("BATCH_CONCURRENCY", 4)     // 同时处理的批处理任务数量
+
+// CacheHitRatio 命中响应缓存的请求的计费倍率
+var CacheHitRatio = 0.1
+var ResponseCacheDefaultTTL = GetOrDefault("RESPONSE_CACHE_TTL", 3600)          // unit is second
+var ResponseCacheMaxEntries = GetOrDefault("RESPONSE_CACHE_MAX_ENTRIES", 10000) // 未启用 Redis 时内存缓存的最大条数
+
 const (
-	RequestIdKey = "X-Oneapi-Request-Id"
+	RequestIdKey        = "X-Oneapi-Request-Id"
+	ChannelIdsHeaderKey = "X-Oneapi-Channel-Ids" // 本次请求尝试过的渠道 ID，逗号分隔
 )
 
 const (
@@ -183,6 +228,12 @@ const (
 	ChannelStatusAutoDisabled     = 3
 )
 
+// 多密钥渠道选择密钥的方式
+const (
+	ChannelMultiKeyModeRoundRobin = "round_robin" // 轮询，默认
+	ChannelMultiKeyModeRandom     = "random"      // 随机
+)
+
 const (
 	ChannelTypeUnknown        = 0
 	ChannelTypeOpenAI         = 1
@@ -212,6 +263,9 @@ const (
 	ChannelTypeMoonshot       = 25
 	ChannelTypeZhipu_v4       = 26
 	ChannelTypePerplexity     = 27
+	ChannelTypeAwsBedrock     = 28
+	ChannelTypeVertexAi       = 29
+	ChannelTypeCohere         = 30
 )
 
 var ChannelBaseURLs = []string{
@@ -243,4 +297,7 @@ var ChannelBaseURLs = []string{
 	"https://api.moonshot.cn",                   //25
 	"https://open.bigmodel.cn",                  //26
 	"https://api.perplexity.ai",                 //27
+	"",                                          //28
+	"",                                          //29
+	"https://api.cohere.ai",                     //30
 }
@@ -5,8 +5,40 @@ import (
 	"encoding/json"
 	"github.com/gin-gonic/gin"
 	"io"
+	"mime/multipart"
 )
 
+const KeyRequestBody = "key_request_body"
+
+// MultipartMemoryLimit 解析 multipart 请求时文件内容在内存中保存的最大字节数，超出的部分写入临时文件
+const MultipartMemoryLimit = 1 << 20
+
+// GetRequestBody 读取并缓存请求体，同一个请求多次调用时直接返回缓存内容，
+// 以便在渠道重试时能够重新发送原始请求体。
+func GetRequestBody(c *gin.Context) ([]byte, error) {
+	requestBody, _ := c.Get(KeyRequestBody)
+	if requestBody != nil {
+		return requestBody.([]byte), nil
+	}
+	requestBody, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = c.Request.Body.Close()
+	c.Set(KeyRequestBody, requestBody)
+	return requestBody.([]byte), nil
+}
+
+// ResetRequestBody 使用缓存的请求体重置 c.Request.Body，使其可以被再次读取。
+func ResetRequestBody(c *gin.Context) error {
+	requestBody, err := GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	return nil
+}
+
 // UnmarshalBodyReusable 用于解析请求体，并且允许请求体在解析后能够被再次使用。
 // 参数:
 // - c *gin.Context: Gin框架的上下文对象，用于访问HTTP请求和其他相关数据。
@@ -14,14 +46,8 @@ import (
 // 返回值:
 // - error: 如果在读取请求体、关闭请求体或解析JSON过程中发生错误，则返回相应的错误信息；否则返回nil。
 func UnmarshalBodyReusable(c *gin.Context, v any) error {
-	// 读取请求体
-	requestBody, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		return err
-	}
-
-	// 关闭请求体，释放资源
-	err = c.Request.Body.Close()
+	// 读取请求体（已读取过则使用缓存）
+	requestBody, err := GetRequestBody(c)
 	if err != nil {
 		return err
 	}
@@ -36,3 +62,15 @@ func UnmarshalBodyReusable(c *gin.Context, v any) error {
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 	return nil
 }
+
+// ParseMultipartFormReusable 解析 multipart 请求体，较大的文件写入临时文件，不会整个读入内存。
+// 解析结果缓存在 c.Request.MultipartForm 中，渠道重试时可以再次读取；临时文件在请求结束后由 net/http 删除
+func ParseMultipartFormReusable(c *gin.Context) (*multipart.Form, error) {
+	if c.Request.MultipartForm == nil {
+		err := c.Request.ParseMultipartForm(MultipartMemoryLimit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.Request.MultipartForm, nil
+}
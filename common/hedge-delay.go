@@ -0,0 +1,29 @@
+package common
+
+import "encoding/json"
+
+// ModelHedgeDelay 按模型启用对冲请求，键为模型名称，值为等待第一个渠道响应的时间（毫秒），
+// 超过这个时间没有响应时向另一个渠道发送相同的请求，未配置的模型不启用
+var ModelHedgeDelay = map[string]int{}
+
+func ModelHedgeDelay2JSONString() string {
+	jsonBytes, err := json.Marshal(ModelHedgeDelay)
+	if err != nil {
+		SysError("error marshalling model hedge delay: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelHedgeDelayByJSONString(jsonStr string) error {
+	ModelHedgeDelay = make(map[string]int)
+	return json.Unmarshal([]byte(jsonStr), &ModelHedgeDelay)
+}
+
+// GetModelHedgeDelay 返回模型的对冲延迟（毫秒），未启用对冲请求时返回 0
+func GetModelHedgeDelay(name string) int {
+	delay, ok := ModelHedgeDelay[name]
+	if !ok || delay < 0 {
+		return 0
+	}
+	return delay
+}
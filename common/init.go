@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // 定义全局命令行标志。
@@ -26,7 +27,10 @@ func printHelp() {
 
 // init 初始化程序，处理命令行参数。
 func init() {
-	flag.Parse()
+	// go test 编译出的测试程序会传入 -test.* 参数，这些参数由 testing 包解析
+	if !strings.HasSuffix(os.Args[0], ".test") {
+		flag.Parse()
+	}
 
 	// 处理打印版本信息的请求。
 	if *PrintVersion {
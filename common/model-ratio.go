@@ -93,6 +93,28 @@ var DefaultModelRatio = map[string]float64{
 	"embedding_s1_v1":           0.0715, // ¥0.001 / 1k tokens
 	"semantic_similarity_s1_v1": 0.0715, // ¥0.001 / 1k tokens
 	"hunyuan":                   7.143,  // ¥0.1 / 1k tokens  // https://cloud.tencent.com/document/product/1729/97731#e0e6be58-60c8-469f-bdeb-6c264ce3b4d0
+
+	// 实时会话的文本和音频 token 分别计费，音频 token 的倍率以 "模型名称-audio" 配置
+	"gpt-4o-realtime-preview":                  2.5, // $5 / 1M text tokens
+	"gpt-4o-realtime-preview-2024-10-01":       2.5, // $5 / 1M text tokens
+	"gpt-4o-realtime-preview-audio":            50,  // $100 / 1M audio tokens
+	"gpt-4o-realtime-preview-2024-10-01-audio": 50,  // $100 / 1M audio tokens
+
+	"command-r":                     0.25, // $0.5 / 1M tokens
+	"command-r-plus":                1.5,  // $3 / 1M tokens
+	"command":                       0.5,  // $1 / 1M tokens
+	"command-light":                 0.15, // $0.3 / 1M tokens
+	"embed-english-v3.0":            0.05, // $0.1 / 1M tokens
+	"embed-multilingual-v3.0":       0.05, // $0.1 / 1M tokens
+	"embed-english-light-v3.0":      0.05, // $0.1 / 1M tokens
+	"embed-multilingual-light-v3.0": 0.05, // $0.1 / 1M tokens
+
+	// 图片模型的倍率与 dall-e 相同，按 1024x1024 尺寸每张的价格换算
+	"wanx-v1":                      8.8, // ￥0.16 / 张
+	"cogview-3":                    5.6, // ￥0.1 / 张
+	"cogview-3-plus":               3.3, // ￥0.06 / 张
+	"imagen-3.0-generate-002":      16,  // $0.04 / 张
+	"imagen-3.0-fast-generate-001": 8,   // $0.02 / 张
 }
 
 var DefaultModelPrice = map[string]float64{
@@ -112,6 +134,12 @@ var DefaultModelPrice = map[string]float64{
 	"mj_describe":       0.05,
 	"mj_upscale":        0.05,
 	"swap_face":         0.05,
+
+	// rerank 模型按文档数计费，价格为每个文档的价格
+	"rerank-english-v3.0":      0.00002, // $2 / 1K searches，每次搜索最多 100 个文档
+	"rerank-multilingual-v3.0": 0.00002,
+	"rerank-english-v2.0":      0.00002,
+	"rerank-multilingual-v2.0": 0.00002,
 }
 
 var ModelPrice = map[string]float64{}
@@ -181,6 +209,17 @@ func GetModelRatio(name string) float64 {
 	return ratio
 }
 
+// GetAudioRatio 返回模型音频 token 的倍率，在 ModelRatio 中以 "模型名称-audio" 配置，没有配置时使用文本倍率
+func GetAudioRatio(name string) float64 {
+	if len(ModelRatio) == 0 {
+		ModelRatio = DefaultModelRatio
+	}
+	if ratio, ok := ModelRatio[name+"-audio"]; ok {
+		return ratio
+	}
+	return GetModelRatio(name)
+}
+
 func GetCompletionRatio(name string) float64 {
 	if strings.HasPrefix(name, "gpt-3.5") {
 		if strings.HasSuffix(name, "0125") {
@@ -200,12 +239,23 @@ func GetCompletionRatio(name string) float64 {
 		}
 		return 1.333333
 	}
+	if strings.HasPrefix(name, "gpt-4o-realtime") {
+		// 文本输出 $20 / 1M tokens，音频输出 $200 / 1M tokens，均为输入的 4 倍
+		return 4
+	}
 	if strings.HasPrefix(name, "gpt-4") {
 		if strings.HasSuffix(name, "preview") {
 			return 3
 		}
 		return 2
 	}
+	if strings.HasPrefix(name, "command-r-plus") {
+		return 5
+	} else if strings.HasPrefix(name, "command-r") {
+		return 3
+	} else if strings.HasPrefix(name, "command") {
+		return 2
+	}
 	if strings.HasPrefix(name, "claude-instant-1") {
 		return 3
 	} else if strings.HasPrefix(name, "claude-2") {
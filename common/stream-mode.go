@@ -0,0 +1,35 @@
+package common
+
+import "encoding/json"
+
+// 渠道和模型的上游流式模式
+const (
+	StreamModeDefault   = ""           // 按客户端的请求决定
+	StreamModeNonStream = "non_stream" // 总是向上游发送非流式请求，客户端要求流式时由网关拆分为数据块（伪流式）
+	StreamModeStream    = "stream"     // 总是向上游发送流式请求，客户端要求非流式时由网关合并数据块
+)
+
+// ModelStreamMode 按模型设置上游流式模式，键为模型名称，值为 non_stream 或 stream，渠道设置优先
+var ModelStreamMode = map[string]string{}
+
+func ModelStreamMode2JSONString() string {
+	jsonBytes, err := json.Marshal(ModelStreamMode)
+	if err != nil {
+		SysError("error marshalling model stream mode: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelStreamModeByJSONString(jsonStr string) error {
+	ModelStreamMode = make(map[string]string)
+	return json.Unmarshal([]byte(jsonStr), &ModelStreamMode)
+}
+
+// GetModelStreamMode 返回模型的上游流式模式，未配置或配置无效时返回 StreamModeDefault
+func GetModelStreamMode(name string) string {
+	switch mode := ModelStreamMode[name]; mode {
+	case StreamModeNonStream, StreamModeStream:
+		return mode
+	}
+	return StreamModeDefault
+}
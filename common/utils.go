@@ -230,6 +230,24 @@ func StringsContains(strs []string, str string) bool {
 	return false
 }
 
+func IntsContains(ints []int, i int) bool {
+	for _, v := range ints {
+		if v == i {
+			return true
+		}
+	}
+	return false
+}
+
+// IntsToString 将整数切片以逗号连接为字符串，如 [1 2 3] -> "1,2,3"
+func IntsToString(ints []int) string {
+	strs := make([]string, 0, len(ints))
+	for _, i := range ints {
+		strs = append(strs, strconv.Itoa(i))
+	}
+	return strings.Join(strs, ",")
+}
+
 // StringToByteSlice []byte only read, panic on append
 func StringToByteSlice(s string) []byte {
 	tmp1 := (*[2]uintptr)(unsafe.Pointer(&s))
@@ -0,0 +1,546 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/middleware"
+	"one-api/model"
+	"one-api/service"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var batchEndpoints = []string{"/v1/chat/completions", "/v1/embeddings", "/v1/completions"}
+
+// 批处理输入文件校验时最多记录的错误数量
+const maxBatchValidationErrors = 100
+
+func optionalTimestamp(timestamp int64) *int64 {
+	if timestamp == 0 {
+		return nil
+	}
+	return &timestamp
+}
+
+func optionalString(str string) *string {
+	if str == "" {
+		return nil
+	}
+	return &str
+}
+
+func batchObject(batch *model.Batch) dto.BatchObject {
+	object := dto.BatchObject{
+		Id:               batch.Id,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     optionalString(batch.OutputFileId),
+		ErrorFileId:      optionalString(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     optionalTimestamp(batch.InProgressAt),
+		ExpiresAt:        optionalTimestamp(batch.ExpiresAt),
+		FinalizingAt:     optionalTimestamp(batch.FinalizingAt),
+		CompletedAt:      optionalTimestamp(batch.CompletedAt),
+		FailedAt:         optionalTimestamp(batch.FailedAt),
+		ExpiredAt:        optionalTimestamp(batch.ExpiredAt),
+		CancellingAt:     optionalTimestamp(batch.CancellingAt),
+		CancelledAt:      optionalTimestamp(batch.CancelledAt),
+		RequestCounts: dto.BatchRequestCounts{
+			Total:     batch.TotalCount,
+			Completed: batch.CompletedCount,
+			Failed:    batch.FailedCount,
+		},
+	}
+	if batch.Errors != "" {
+		var batchErrors []dto.BatchError
+		err := json.Unmarshal([]byte(batch.Errors), &batchErrors)
+		if err != nil {
+			batchErrors = []dto.BatchError{{Code: "batch_failed", Message: batch.Errors}}
+		}
+		object.Errors = &dto.BatchErrors{
+			Object: "list",
+			Data:   batchErrors,
+		}
+	}
+	if batch.Metadata != "" {
+		_ = json.Unmarshal([]byte(batch.Metadata), &object.Metadata)
+	}
+	return object
+}
+
+func CreateBatch(c *gin.Context) {
+	var request dto.BatchCreateRequest
+	err := c.ShouldBindJSON(&request)
+	if err != nil {
+		abortWithFileApiError(c, http.StatusBadRequest, "invalid_request", "无效的请求, "+err.Error())
+		return
+	}
+	if !common.StringsContains(batchEndpoints, request.Endpoint) {
+		abortWithFileApiError(c, http.StatusBadRequest, "invalid_endpoint", "不支持的 endpoint: "+request.Endpoint)
+		return
+	}
+	if request.CompletionWindow != "24h" {
+		abortWithFileApiError(c, http.StatusBadRequest, "invalid_completion_window", "completion_window 只支持 24h")
+		return
+	}
+	userId := c.GetInt("id")
+	inputFile, err := model.GetUserFileById(request.InputFileId, userId)
+	if err != nil {
+		abortWithFileApiError(c, http.StatusBadRequest, "file_not_found", "输入文件不存在: "+request.InputFileId)
+		return
+	}
+	if inputFile.Purpose != "batch" {
+		abortWithFileApiError(c, http.StatusBadRequest, "invalid_file", "输入文件的 purpose 必须为 batch")
+		return
+	}
+	// 批处理任务在主节点处理，输入文件和输出文件都需要保存在所有节点都能读取的存储中
+	if _, err := service.GetFileStorage(inputFile.Storage); err != nil {
+		abortWithFileApiError(c, http.StatusInternalServerError, "file_storage_unavailable", err.Error())
+		return
+	}
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		Id:               "batch_" + common.GetUUID(),
+		UserId:           userId,
+		TokenId:          c.GetInt("token_id"),
+		Endpoint:         request.Endpoint,
+		InputFileId:      request.InputFileId,
+		CompletionWindow: request.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		CreatedAt:        now,
+		ExpiresAt:        now + 24*60*60,
+	}
+	if len(request.Metadata) > 0 {
+		metadata, _ := json.Marshal(request.Metadata)
+		batch.Metadata = string(metadata)
+	}
+	err = batch.Insert()
+	if err != nil {
+		abortWithFileApiError(c, http.StatusInternalServerError, "create_batch_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, batchObject(batch))
+}
+
+func RetrieveBatch(c *gin.Context) {
+	batch, err := model.GetUserBatchById(c.Param("id"), c.GetInt("id"))
+	if err != nil {
+		abortWithFileApiError(c, http.StatusNotFound, "batch_not_found", "批处理任务不存在: "+c.Param("id"))
+		return
+	}
+	c.JSON(http.StatusOK, batchObject(batch))
+}
+
+func CancelBatch(c *gin.Context) {
+	batch, err := model.GetUserBatchById(c.Param("id"), c.GetInt("id"))
+	if err != nil {
+		abortWithFileApiError(c, http.StatusNotFound, "batch_not_found", "批处理任务不存在: "+c.Param("id"))
+		return
+	}
+	err = model.CancelBatch(batch)
+	if err != nil {
+		abortWithFileApiError(c, http.StatusInternalServerError, "cancel_batch_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, batchObject(batch))
+}
+
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	batches, err := model.GetUserBatches(c.GetInt("id"), c.Query("after"), limit+1)
+	if err != nil {
+		abortWithFileApiError(c, http.StatusBadRequest, "list_batches_failed", err.Error())
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	data := make([]dto.BatchObject, 0, len(batches))
+	for _, batch := range batches {
+		data = append(data, batchObject(batch))
+	}
+	response := dto.ListResponse{
+		Object:  "list",
+		Data:    data,
+		HasMore: hasMore,
+	}
+	if len(data) > 0 {
+		response.FirstId = data[0].Id
+		response.LastId = data[len(data)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// pickBatch 从等待处理的任务中选出下一个：优先选择正在处理的任务最少的用户，
+// 同样多时按创建时间先后，避免一个用户提交大量任务时其他用户的任务长时间等待
+func pickBatch(batches []*model.Batch, running map[int]int) *model.Batch {
+	var picked *model.Batch
+	for _, batch := range batches {
+		if picked == nil || running[batch.UserId] < running[picked.UserId] {
+			picked = batch
+		}
+	}
+	return picked
+}
+
+// RunBatchWorker 后台处理批处理任务，最多同时处理 BatchConcurrency 个任务，有空闲时按 pickBatch 选择下一个任务
+func RunBatchWorker() {
+	err := model.FailInterruptedBatches()
+	if err != nil {
+		common.SysError("failed to reset interrupted batches: " + err.Error())
+	}
+	concurrency := common.BatchConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	var lock sync.Mutex
+	running := make(map[int]int)
+	for {
+		slots <- struct{}{}
+		batches, err := model.GetValidatingBatches(100)
+		if err != nil {
+			common.SysError("failed to get validating batches: " + err.Error())
+		}
+		lock.Lock()
+		batch := pickBatch(batches, running)
+		lock.Unlock()
+		if batch == nil {
+			<-slots
+			time.Sleep(time.Duration(common.BatchPollInterval) * time.Second)
+			continue
+		}
+		claimed, err := model.ClaimBatch(batch)
+		if err != nil {
+			common.SysError("failed to claim batch: " + err.Error())
+		}
+		if !claimed {
+			// 已被其他节点处理或者已取消，稍后重新选择
+			<-slots
+			if err != nil {
+				time.Sleep(time.Duration(common.BatchPollInterval) * time.Second)
+			}
+			continue
+		}
+		lock.Lock()
+		running[batch.UserId]++
+		lock.Unlock()
+		go func() {
+			defer func() {
+				lock.Lock()
+				running[batch.UserId]--
+				if running[batch.UserId] == 0 {
+					delete(running, batch.UserId)
+				}
+				lock.Unlock()
+				<-slots
+			}()
+			processBatch(batch)
+		}()
+	}
+}
+
+func failBatch(batch *model.Batch, batchErrors []dto.BatchError) {
+	errorsJson, _ := json.Marshal(batchErrors)
+	batch.Status = model.BatchStatusFailed
+	batch.FailedAt = common.GetTimestamp()
+	batch.Errors = string(errorsJson)
+	err := batch.Update()
+	if err != nil {
+		common.SysError("failed to update batch: " + err.Error())
+	}
+}
+
+// readBatchInput 逐行读取输入文件，handle 返回 false 时停止读取
+func readBatchInput(file *model.File, handle func(lineNum int, line []byte) bool) error {
+	reader, err := openUserFile(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	bufReader := bufio.NewReader(reader)
+	lineNum := 0
+	for {
+		line, err := bufReader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			lineNum++
+			if !handle(lineNum, bytes.TrimSpace(line)) {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// validateBatchInput 校验输入文件的每一行，返回请求总数和校验错误
+func validateBatchInput(batch *model.Batch, file *model.File) (int, []dto.BatchError, error) {
+	total := 0
+	batchErrors := make([]dto.BatchError, 0)
+	customIds := make(map[string]bool)
+	err := readBatchInput(file, func(lineNum int, line []byte) bool {
+		total++
+		var input dto.BatchRequestInput
+		var message string
+		if err := json.Unmarshal(line, &input); err != nil {
+			message = "无效的 JSON: " + err.Error()
+		} else if input.CustomId == "" {
+			message = "custom_id 不能为空"
+		} else if customIds[input.CustomId] {
+			message = "custom_id 重复: " + input.CustomId
+		} else if input.Method != http.MethodPost {
+			message = "method 只支持 POST"
+		} else if input.Url != batch.Endpoint {
+			message = fmt.Sprintf("url 必须与批处理任务的 endpoint %s 一致", batch.Endpoint)
+		} else if input.Body == nil {
+			message = "body 不能为空"
+		}
+		customIds[input.CustomId] = true
+		if message != "" {
+			line := lineNum
+			batchErrors = append(batchErrors, dto.BatchError{
+				Code:    "invalid_request",
+				Message: message,
+				Line:    &line,
+			})
+		}
+		return len(batchErrors) < maxBatchValidationErrors
+	})
+	return total, batchErrors, err
+}
+
+// runBatchRequest 让一行批处理请求按普通请求的流程（鉴权、渠道选择、转发、计费、日志）执行，
+// 返回状态码和响应体。ctx 在批处理任务过期时取消，中断正在进行的上游请求
+func runBatchRequest(ctx context.Context, batch *model.Batch, token *model.Token, input *dto.BatchRequestInput) (int, []byte, string) {
+	body, _ := json.Marshal(input.Body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, input.Url, bytes.NewReader(body))
+	if err != nil {
+		return http.StatusInternalServerError, nil, ""
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-"+token.Key)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = req
+	c.Set("batch_id", batch.Id)
+	handlers := []gin.HandlerFunc{middleware.RequestId(), middleware.TokenAuth(), middleware.Distribute(), Relay}
+	for _, handler := range handlers {
+		handler(c)
+		if c.IsAborted() {
+			break
+		}
+	}
+	return recorder.Code, recorder.Body.Bytes(), c.GetString(common.RequestIdKey)
+}
+
+func writeBatchOutput(writer io.Writer, output dto.BatchRequestOutput) {
+	data, _ := json.Marshal(output)
+	_, _ = writer.Write(append(data, '\n'))
+}
+
+// writeBatchExpiredOutput 记录因任务过期没有执行完成的请求
+func writeBatchExpiredOutput(batch *model.Batch, errorFile io.Writer, input dto.BatchRequestInput) {
+	batch.FailedCount++
+	writeBatchOutput(errorFile, dto.BatchRequestOutput{
+		Id:       "batch_req_" + common.GetUUID(),
+		CustomId: input.CustomId,
+		Error: &dto.BatchError{
+			Code:    "batch_expired",
+			Message: "批处理任务在完成时间窗口内未能执行此请求",
+		},
+	})
+}
+
+// saveBatchOutputFile 将临时文件保存为用户文件，没有内容时返回空字符串
+func saveBatchOutputFile(batch *model.Batch, tmpFile *os.File, filename string) (string, error) {
+	info, err := tmpFile.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Size() == 0 {
+		return "", nil
+	}
+	_, err = tmpFile.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	file, err := saveUserFile(batch.UserId, filename, "batch_output", tmpFile, info.Size())
+	if err != nil {
+		return "", err
+	}
+	return file.Id, nil
+}
+
+func processBatch(batch *model.Batch) {
+	common.SysLog(fmt.Sprintf("processing batch %s", batch.Id))
+	defer func() {
+		if r := recover(); r != nil {
+			common.SysError(fmt.Sprintf("batch %s panic: %v", batch.Id, r))
+			failBatch(batch, []dto.BatchError{{Code: "server_error", Message: fmt.Sprintf("%v", r)}})
+		}
+	}()
+	if common.GetTimestamp() > batch.ExpiresAt {
+		batch.Status = model.BatchStatusExpired
+		batch.ExpiredAt = common.GetTimestamp()
+		_ = batch.Update()
+		return
+	}
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		failBatch(batch, []dto.BatchError{{Code: "token_not_found", Message: "创建批处理任务的令牌不存在"}})
+		return
+	}
+	inputFile, err := model.GetUserFileById(batch.InputFileId, batch.UserId)
+	if err != nil {
+		failBatch(batch, []dto.BatchError{{Code: "file_not_found", Message: "输入文件不存在: " + batch.InputFileId}})
+		return
+	}
+	total, batchErrors, err := validateBatchInput(batch, inputFile)
+	if err != nil {
+		failBatch(batch, []dto.BatchError{{Code: "read_file_failed", Message: "读取输入文件失败: " + err.Error()}})
+		return
+	}
+	if len(batchErrors) > 0 {
+		failBatch(batch, batchErrors)
+		return
+	}
+	if total == 0 {
+		failBatch(batch, []dto.BatchError{{Code: "empty_file", Message: "输入文件为空"}})
+		return
+	}
+	batch.TotalCount = total
+	err = model.UpdateBatchCounts(batch)
+	if err != nil {
+		common.SysError("failed to update batch counts: " + err.Error())
+	}
+
+	outputFile, err := os.CreateTemp("", "batch-output-*.jsonl")
+	if err != nil {
+		failBatch(batch, []dto.BatchError{{Code: "server_error", Message: err.Error()}})
+		return
+	}
+	defer os.Remove(outputFile.Name())
+	defer outputFile.Close()
+	errorFile, err := os.CreateTemp("", "batch-error-*.jsonl")
+	if err != nil {
+		failBatch(batch, []dto.BatchError{{Code: "server_error", Message: err.Error()}})
+		return
+	}
+	defer os.Remove(errorFile.Name())
+	defer errorFile.Close()
+
+	// 每一行执行前重新检查任务是否已取消或过期，过期后剩余的请求不再执行，记录到错误文件中
+	ctx, cancel := context.WithDeadline(context.Background(), time.Unix(batch.ExpiresAt, 0))
+	defer cancel()
+	cancelled, expired := false, false
+	err = readBatchInput(inputFile, func(lineNum int, line []byte) bool {
+		var input dto.BatchRequestInput
+		_ = json.Unmarshal(line, &input)
+		if !expired {
+			latest, err := model.GetBatchById(batch.Id)
+			if err == nil && latest.Status == model.BatchStatusCancelling {
+				batch.CancellingAt = latest.CancellingAt
+				cancelled = true
+				return false
+			}
+			expired = ctx.Err() != nil
+		}
+		if expired {
+			writeBatchExpiredOutput(batch, errorFile, input)
+			return true
+		}
+		statusCode, body, requestId := runBatchRequest(ctx, batch, token, &input)
+		if ctx.Err() != nil {
+			expired = true
+			writeBatchExpiredOutput(batch, errorFile, input)
+			return true
+		}
+		output := dto.BatchRequestOutput{
+			Id:       "batch_req_" + common.GetUUID(),
+			CustomId: input.CustomId,
+			Response: &dto.BatchResponse{
+				StatusCode: statusCode,
+				RequestId:  requestId,
+				Body:       json.RawMessage(body),
+			},
+		}
+		if !json.Valid(body) {
+			output.Response.Body = string(body)
+		}
+		if statusCode == http.StatusOK {
+			batch.CompletedCount++
+			writeBatchOutput(outputFile, output)
+		} else {
+			batch.FailedCount++
+			output.Error = &dto.BatchError{
+				Code:    strconv.Itoa(statusCode),
+				Message: http.StatusText(statusCode),
+			}
+			var errorResponse struct {
+				Error *dto.OpenAIError `json:"error"`
+			}
+			if json.Unmarshal(body, &errorResponse) == nil && errorResponse.Error != nil {
+				output.Error.Message = errorResponse.Error.Message
+			}
+			writeBatchOutput(errorFile, output)
+		}
+		err = model.UpdateBatchCounts(batch)
+		if err != nil {
+			common.SysError("failed to update batch counts: " + err.Error())
+		}
+		return true
+	})
+	if err != nil {
+		failBatch(batch, []dto.BatchError{{Code: "read_file_failed", Message: "读取输入文件失败: " + err.Error()}})
+		return
+	}
+
+	batch.Status = model.BatchStatusFinalizing
+	batch.FinalizingAt = common.GetTimestamp()
+	_ = batch.Update()
+	batch.OutputFileId, err = saveBatchOutputFile(batch, outputFile, batch.Id+"_output.jsonl")
+	if err == nil {
+		batch.ErrorFileId, err = saveBatchOutputFile(batch, errorFile, batch.Id+"_error.jsonl")
+	}
+	if err != nil {
+		failBatch(batch, []dto.BatchError{{Code: "save_file_failed", Message: "保存输出文件失败: " + err.Error()}})
+		return
+	}
+	if cancelled {
+		batch.Status = model.BatchStatusCancelled
+		batch.CancelledAt = common.GetTimestamp()
+	} else if expired {
+		batch.Status = model.BatchStatusExpired
+		batch.ExpiredAt = common.GetTimestamp()
+	} else {
+		batch.Status = model.BatchStatusCompleted
+		batch.CompletedAt = common.GetTimestamp()
+	}
+	err = batch.Update()
+	if err != nil {
+		common.SysError("failed to update batch: " + err.Error())
+	}
+	common.SysLog(fmt.Sprintf("batch %s %s, completed %d, failed %d", batch.Id, batch.Status, batch.CompletedCount, batch.FailedCount))
+}
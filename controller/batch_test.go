@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"one-api/model"
+	"testing"
+)
+
+func TestPickBatch(t *testing.T) {
+	// 按创建时间先后排列
+	batches := []*model.Batch{
+		{Id: "batch_1", UserId: 1},
+		{Id: "batch_2", UserId: 1},
+		{Id: "batch_3", UserId: 2},
+		{Id: "batch_4", UserId: 3},
+	}
+	tests := []struct {
+		name    string
+		batches []*model.Batch
+		running map[int]int
+		want    string
+	}{
+		{name: "no batches", batches: nil, running: map[int]int{}, want: ""},
+		{name: "oldest first", batches: batches, running: map[int]int{}, want: "batch_1"},
+		{name: "skip busy user", batches: batches, running: map[int]int{1: 1}, want: "batch_3"},
+		{name: "least busy user", batches: batches, running: map[int]int{1: 2, 2: 1, 3: 1}, want: "batch_3"},
+		{name: "only busy user", batches: batches[:2], running: map[int]int{1: 3}, want: "batch_1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ""
+			if batch := pickBatch(test.batches, test.running); batch != nil {
+				got = batch.Id
+			}
+			if got != test.want {
+				t.Errorf("pickBatch() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
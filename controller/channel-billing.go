@@ -201,6 +201,10 @@ func updateChannelAIGC2DBalance(channel *model.Channel) (float64, error) {
 }
 
 func updateChannelBalance(channel *model.Channel) (float64, error) {
+	if channel.IsMultiKey() {
+		// 余额属于单个密钥，多密钥渠道没有统一的余额
+		return 0, errors.New("多密钥渠道不支持查询余额")
+	}
 	baseURL := common.ChannelBaseURLs[channel.Type]
 	if channel.GetBaseURL() == "" {
 		channel.BaseURL = &baseURL
@@ -24,6 +24,12 @@ import (
 )
 
 func testChannel(channel *model.Channel, testModel string) (err error, openaiErr *dto.OpenAIError) {
+	key, _ := channel.SelectKey()
+	return testChannelKey(channel, key, testModel)
+}
+
+// testChannelKey 使用渠道中指定的密钥发送测试请求
+func testChannelKey(channel *model.Channel, key string, testModel string) (err error, openaiErr *dto.OpenAIError) {
 	if channel.Type == common.ChannelTypeMidjourney {
 		return errors.New("midjourney channel test is not supported"), nil
 	}
@@ -36,7 +42,7 @@ func testChannel(channel *model.Channel, testModel string) (err error, openaiErr
 		Body:   nil,
 		Header: make(http.Header),
 	}
-	c.Request.Header.Set("Authorization", "Bearer "+channel.Key)
+	c.Request.Header.Set("Authorization", "Bearer "+key)
 	c.Request.Header.Set("Content-Type", "application/json")
 	c.Set("channel", channel.Type)
 	c.Set("base_url", channel.GetBaseURL())
@@ -183,6 +189,11 @@ func testAllChannels(notify bool) error {
 	go func() {
 		for _, channel := range channels {
 			isChannelEnabled := channel.Status == common.ChannelStatusEnabled
+			if channel.IsMultiKey() {
+				testChannelKeys(channel, disableThreshold)
+				time.Sleep(common.RequestInterval)
+				continue
+			}
 			tik := time.Now()
 			err, openaiErr := testChannel(channel, "")
 			tok := time.Now()
@@ -223,6 +234,53 @@ func testAllChannels(notify bool) error {
 	return nil
 }
 
+// testChannelKeys 逐个测试多密钥渠道中的密钥：失败的密钥按自动禁用的规则禁用，
+// 自动禁用的密钥测试成功后重新启用，有可用密钥时重新启用被自动禁用的渠道
+func testChannelKeys(channel *model.Channel, disableThreshold int64) {
+	ban := channel.AutoBan == nil || *channel.AutoBan != 0
+	keys := channel.GetKeys()
+	keyInfos := channel.GetKeyInfos()
+	hasEnabledKey := false
+	var responseTime int64
+	for i, key := range keys {
+		if keyInfos[i].Status == common.ChannelStatusManuallyDisabled {
+			continue
+		}
+		tik := time.Now()
+		err, openaiErr := testChannelKey(channel, key, "")
+		milliseconds := time.Since(tik).Milliseconds()
+		if responseTime == 0 {
+			responseTime = milliseconds
+		}
+		keyBan := false
+		if milliseconds > disableThreshold {
+			err = errors.New(fmt.Sprintf("响应时间 %.2fs 超过阈值 %.2fs", float64(milliseconds)/1000.0, float64(disableThreshold)/1000.0))
+			keyBan = true
+		}
+		if openaiErr != nil {
+			err = errors.New(fmt.Sprintf("type %s, code %v, message %s", openaiErr.Type, openaiErr.Code, openaiErr.Message))
+			keyBan = true
+		}
+		isKeyEnabled := keyInfos[i].Status == common.ChannelStatusEnabled
+		if err != nil {
+			service.RecordChannelKeyError(channel.Id, channel.Name, i, err.Error(), isKeyEnabled && service.ShouldDisableChannel(openaiErr, -1) && keyBan && ban)
+		} else if !isKeyEnabled && service.ShouldEnableChannel(err, openaiErr) {
+			if err := model.UpdateChannelKeyStatus(channel.Id, i, common.ChannelStatusEnabled); err != nil {
+				common.SysError(fmt.Sprintf("failed to enable channel #%d key %d: %s", channel.Id, i, err.Error()))
+			}
+			isKeyEnabled = true
+		}
+		if err == nil && isKeyEnabled {
+			hasEnabledKey = true
+		}
+		time.Sleep(common.RequestInterval)
+	}
+	if channel.Status == common.ChannelStatusAutoDisabled && hasEnabledKey && common.AutomaticEnableChannelEnabled {
+		service.EnableChannel(channel.Id, channel.Name)
+	}
+	channel.UpdateResponseTime(responseTime)
+}
+
 func TestAllChannels(c *gin.Context) {
 	err := testAllChannels(true)
 	if err != nil {
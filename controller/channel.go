@@ -1,10 +1,12 @@
 package controller
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"one-api/common"
 	"one-api/model"
+	"one-api/relay/channel/ollama"
 	"strconv"
 	"strings"
 )
@@ -108,17 +110,11 @@ func AddChannel(c *gin.Context) {
 		return
 	}
 	channel.CreatedTime = common.GetTimestamp()
-	keys := strings.Split(channel.Key, "\n")
-	channels := make([]model.Channel, 0, len(keys))
-	for _, key := range keys {
-		if key == "" {
-			continue
-		}
-		localChannel := channel
-		localChannel.Key = key
-		channels = append(channels, localChannel)
+	// 一行一个的多个密钥保存在同一个渠道中，请求时按渠道设置的方式轮询或随机使用
+	if channel.IsMultiKey() {
+		channel.Key = strings.Join(channel.GetKeys(), "\n")
 	}
-	err = model.BatchInsertChannels(channels)
+	err = channel.Insert()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -208,6 +204,9 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if channel.IsMultiKey() {
+		channel.Key = strings.Join(channel.GetKeys(), "\n")
+	}
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -223,3 +222,165 @@ func UpdateChannel(c *gin.Context) {
 	})
 	return
 }
+
+// FetchChannelModels 从渠道上游获取可用的模型列表并写入渠道的模型字段，目前只支持 Ollama
+func FetchChannelModels(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if channel.Type != common.ChannelTypeOllama {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该渠道类型不支持获取模型列表",
+		})
+		return
+	}
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = common.ChannelBaseURLs[channel.Type]
+	}
+	models, err := ollama.FetchModels(baseURL)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "获取模型列表失败：" + err.Error(),
+		})
+		return
+	}
+	if len(models) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "上游没有可用的模型",
+		})
+		return
+	}
+	channel.Models = strings.Join(models, ",")
+	err = channel.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    models,
+	})
+	return
+}
+
+// GetChannelKeys 返回多密钥渠道中各个密钥的健康状态，密钥只显示首尾几位
+func GetChannelKeys(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"multi_key_mode": channel.GetMultiKeyMode(),
+			"keys":           channel.GetKeyInfos(),
+		},
+	})
+	return
+}
+
+type channelKeyStatusRequest struct {
+	Index  int `json:"index"`
+	Status int `json:"status"`
+}
+
+// UpdateChannelKeyStatus 手动启用或禁用多密钥渠道中的一个密钥
+func UpdateChannelKeyStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var request channelKeyStatusRequest
+	err = c.ShouldBindJSON(&request)
+	if err == nil && request.Status != common.ChannelStatusEnabled && request.Status != common.ChannelStatusManuallyDisabled {
+		err = errors.New("无效的密钥状态")
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = model.UpdateChannelKeyStatus(id, request.Index, request.Status)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+// GetChannelScores 返回分组和模型下各渠道的实时指标，以及在当前选择策略下的得分
+func GetChannelScores(c *gin.Context) {
+	group := c.DefaultQuery("group", "default")
+	modelName := c.Query("model")
+	if modelName == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "模型不能为空",
+		})
+		return
+	}
+	strategy, scores, err := model.GetChannelScores(group, modelName)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"strategy": strategy,
+			"channels": scores,
+		},
+	})
+	return
+}
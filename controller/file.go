@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/service"
+	"strconv"
+)
+
+var filePurposes = []string{"batch", "batch_output", "assistants", "fine-tune", "vision", "user_data"}
+
+func abortWithFileApiError(c *gin.Context, statusCode int, code string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": dto.OpenAIError{
+			Message: common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
+
+func fileObject(file *model.File) dto.FileObject {
+	return dto.FileObject{
+		Id:        file.Id,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    "processed",
+	}
+}
+
+func fileStorageKey(file *model.File) string {
+	return fmt.Sprintf("%d/%s", file.UserId, file.Id)
+}
+
+// saveUserFile 将文件内容保存到存储后端并记录到数据库
+func saveUserFile(userId int, filename string, purpose string, reader io.Reader, size int64) (*model.File, error) {
+	storage, err := service.GetFileStorage("")
+	if err != nil {
+		return nil, err
+	}
+	file := &model.File{
+		Id:        "file-" + common.GetUUID(),
+		UserId:    userId,
+		Bytes:     size,
+		CreatedAt: common.GetTimestamp(),
+		Filename:  filename,
+		Purpose:   purpose,
+		Storage:   common.FileStorageType,
+	}
+	err = storage.Save(fileStorageKey(file), reader, size)
+	if err != nil {
+		return nil, err
+	}
+	err = file.Insert()
+	if err != nil {
+		_ = storage.Delete(fileStorageKey(file))
+		return nil, err
+	}
+	return file, nil
+}
+
+// openUserFile 打开文件内容，调用方负责关闭
+func openUserFile(file *model.File) (io.ReadCloser, error) {
+	storage, err := service.GetFileStorage(file.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Open(fileStorageKey(file))
+}
+
+func UploadFile(c *gin.Context) {
+	maxFileSize := int64(common.MaxFileSize) << 20
+	// 额外预留 1MB 给 multipart 的其它字段
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFileSize+1<<20)
+	purpose := c.PostForm("purpose")
+	if !common.StringsContains(filePurposes, purpose) {
+		abortWithFileApiError(c, http.StatusBadRequest, "invalid_purpose", "无效的 purpose: "+purpose)
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		abortWithFileApiError(c, http.StatusBadRequest, "invalid_file", "无效的文件, "+err.Error())
+		return
+	}
+	if fileHeader.Size > maxFileSize {
+		abortWithFileApiError(c, http.StatusBadRequest, "file_too_large", fmt.Sprintf("文件大小不能超过 %d MB", common.MaxFileSize))
+		return
+	}
+	src, err := fileHeader.Open()
+	if err != nil {
+		abortWithFileApiError(c, http.StatusBadRequest, "invalid_file", "无效的文件, "+err.Error())
+		return
+	}
+	defer src.Close()
+	file, err := saveUserFile(c.GetInt("id"), fileHeader.Filename, purpose, src, fileHeader.Size)
+	if err != nil {
+		common.LogError(c.Request.Context(), "save file failed: "+err.Error())
+		abortWithFileApiError(c, http.StatusInternalServerError, "save_file_failed", "保存文件失败")
+		return
+	}
+	c.JSON(http.StatusOK, fileObject(file))
+}
+
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	files, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"), c.Query("after"), limit+1)
+	if err != nil {
+		abortWithFileApiError(c, http.StatusBadRequest, "list_files_failed", err.Error())
+		return
+	}
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	data := make([]dto.FileObject, 0, len(files))
+	for _, file := range files {
+		data = append(data, fileObject(file))
+	}
+	response := dto.ListResponse{
+		Object:  "list",
+		Data:    data,
+		HasMore: hasMore,
+	}
+	if len(data) > 0 {
+		response.FirstId = data[0].Id
+		response.LastId = data[len(data)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func RetrieveFile(c *gin.Context) {
+	file, err := model.GetUserFileById(c.Param("id"), c.GetInt("id"))
+	if err != nil {
+		abortWithFileApiError(c, http.StatusNotFound, "file_not_found", "文件不存在: "+c.Param("id"))
+		return
+	}
+	c.JSON(http.StatusOK, fileObject(file))
+}
+
+func DeleteFile(c *gin.Context) {
+	file, err := model.GetUserFileById(c.Param("id"), c.GetInt("id"))
+	if err != nil {
+		abortWithFileApiError(c, http.StatusNotFound, "file_not_found", "文件不存在: "+c.Param("id"))
+		return
+	}
+	storage, err := service.GetFileStorage(file.Storage)
+	if err == nil {
+		err = storage.Delete(fileStorageKey(file))
+	}
+	if err != nil {
+		common.LogError(c.Request.Context(), "delete file failed: "+err.Error())
+		abortWithFileApiError(c, http.StatusInternalServerError, "delete_file_failed", "删除文件失败")
+		return
+	}
+	err = file.Delete()
+	if err != nil {
+		abortWithFileApiError(c, http.StatusInternalServerError, "delete_file_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, dto.FileDeleteResponse{
+		Id:      file.Id,
+		Object:  "file",
+		Deleted: true,
+	})
+}
+
+func GetFileContent(c *gin.Context) {
+	file, err := model.GetUserFileById(c.Param("id"), c.GetInt("id"))
+	if err != nil {
+		abortWithFileApiError(c, http.StatusNotFound, "file_not_found", "文件不存在: "+c.Param("id"))
+		return
+	}
+	reader, err := openUserFile(file)
+	if err != nil {
+		common.LogError(c.Request.Context(), "open file failed: "+err.Error())
+		abortWithFileApiError(c, http.StatusInternalServerError, "open_file_failed", "读取文件失败")
+		return
+	}
+	defer reader.Close()
+	c.DataFromReader(http.StatusOK, file.Bytes, "application/octet-stream", reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", file.Filename),
+	})
+}
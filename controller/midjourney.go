@@ -18,6 +18,12 @@ import (
 	"time"
 )
 
+// midjourneyTaskKey 任务只能通过提交它的密钥查询，按渠道和密钥分组批量查询
+type midjourneyTaskKey struct {
+	channelId int
+	keyIndex  int
+}
+
 func UpdateMidjourneyTaskBulk() {
 	//imageModel := "midjourney"
 	ctx := context.TODO()
@@ -30,7 +36,7 @@ func UpdateMidjourneyTaskBulk() {
 		}
 
 		common.LogInfo(ctx, fmt.Sprintf("检测到未完成的任务数有: %v", len(tasks)))
-		taskChannelM := make(map[int][]string)
+		taskChannelM := make(map[midjourneyTaskKey][]string)
 		taskM := make(map[string]*model.Midjourney)
 		nullTaskIds := make([]int, 0)
 		for _, task := range tasks {
@@ -40,7 +46,8 @@ func UpdateMidjourneyTaskBulk() {
 				continue
 			}
 			taskM[task.MjId] = task
-			taskChannelM[task.ChannelId] = append(taskChannelM[task.ChannelId], task.MjId)
+			taskKey := midjourneyTaskKey{channelId: task.ChannelId, keyIndex: task.KeyIndex}
+			taskChannelM[taskKey] = append(taskChannelM[taskKey], task.MjId)
 		}
 		if len(nullTaskIds) > 0 {
 			err := model.MjBulkUpdateByTaskIds(nullTaskIds, map[string]any{
@@ -57,8 +64,9 @@ func UpdateMidjourneyTaskBulk() {
 			continue
 		}
 
-		for channelId, taskIds := range taskChannelM {
-			common.LogInfo(ctx, fmt.Sprintf("渠道 #%d 未完成的任务有: %d", channelId, len(taskIds)))
+		for taskKey, taskIds := range taskChannelM {
+			channelId := taskKey.channelId
+			common.LogInfo(ctx, fmt.Sprintf("渠道 #%d 第 %d 个密钥未完成的任务有: %d", channelId, taskKey.keyIndex+1, len(taskIds)))
 			if len(taskIds) == 0 {
 				continue
 			}
@@ -91,7 +99,8 @@ func UpdateMidjourneyTaskBulk() {
 			// 使用带有超时的 context 创建新的请求
 			req = req.WithContext(ctx)
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("mj-api-secret", midjourneyChannel.Key)
+			key, _ := midjourneyChannel.GetKey(taskKey.keyIndex)
+			req.Header.Set("mj-api-secret", key)
 			resp, err := service.GetHttpClient().Do(req)
 			if err != nil {
 				common.LogError(ctx, fmt.Sprintf("Get Task Do req error: %v", err))
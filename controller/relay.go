@@ -7,26 +7,21 @@ import (
 	"net/http"
 	"one-api/common"
 	"one-api/dto"
+	"one-api/middleware"
+	"one-api/model"
 	"one-api/relay"
 	"one-api/relay/constant"
 	relayconstant "one-api/relay/constant"
 	"one-api/service"
-	"strconv"
+	"time"
 )
 
-// Relay 是一个处理中继请求的函数。
-// 它根据请求的URL路径来决定是处理图像生成、音频处理还是文本处理，并在处理过程中进行错误处理和重试逻辑。
-//
-// 参数:
-// - c *gin.Context: Gin框架的上下文对象，用于处理HTTP请求和响应。
-func Relay(c *gin.Context) {
-	// 根据请求URL的路径，确定中继模式。
-	relayMode := constant.Path2RelayMode(c.Request.URL.Path)
-	var err *dto.OpenAIErrorWithStatusCode
+// relayRequest 根据中继模式将请求交给对应的 helper 处理。
+func relayRequest(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 	switch relayMode {
 	case relayconstant.RelayModeImagesGenerations:
 		// 处理图像生成的请求。
-		err = relay.RelayImageHelper(c, relayMode)
+		return relay.RelayImageHelper(c, relayMode)
 	case relayconstant.RelayModeAudioSpeech:
 		// 处理音频转文本的请求，此模式下会自动继续处理音频翻译和转录。
 		fallthrough
@@ -34,41 +29,230 @@ func Relay(c *gin.Context) {
 		fallthrough
 	case relayconstant.RelayModeAudioTranscription:
 		// 音频处理的通用逻辑。
-		err = relay.AudioHelper(c, relayMode)
+		return relay.AudioHelper(c, relayMode)
+	case relayconstant.RelayModeRerank:
+		// 处理 rerank 请求
+		return relay.RerankHelper(c)
+	case relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations:
+		// 处理 multipart 格式的图片编辑和变体请求
+		return relay.RelayImageEditHelper(c, relayMode)
 	default:
 		// 默认处理文本相关的请求。
-		err = relay.TextHelper(c)
+		return relay.TextHelper(c)
 	}
-	if err != nil {
-		// 错误处理逻辑。
-		requestId := c.GetString(common.RequestIdKey)
-		retryTimesStr := c.Query("retry")
-		retryTimes, _ := strconv.Atoi(retryTimesStr)
-		if retryTimesStr == "" {
-			retryTimes = common.RetryTimes
+}
+
+// Relay 是一个处理中继请求的函数。
+// 它根据请求的URL路径来决定是处理图像生成、音频处理还是文本处理。
+// 请求失败时会在进程内更换渠道重试（跳过已尝试过的渠道），而不是让客户端重定向重试，
+// 所有尝试过的渠道 ID 会通过 X-Oneapi-Channel-Ids 响应头返回。
+//
+// 参数:
+// - c *gin.Context: Gin框架的上下文对象，用于处理HTTP请求和响应。
+func Relay(c *gin.Context) {
+	// 根据请求URL的路径，确定中继模式。
+	relayMode := constant.Path2RelayMode(c.Request.URL.Path)
+	requestId := c.GetString(common.RequestIdKey)
+	group := c.GetString("group")
+	originalModel := c.GetString("original_model")
+
+	// 缓存请求体，以便重试时重新发送。multipart 请求已经解析为表单，重试时直接使用表单，不缓存请求体
+	cacheRequestBody := !isMultipartRelayMode(relayMode)
+	if cacheRequestBody {
+		if _, err := common.GetRequestBody(c); err != nil {
+			openaiErr := service.OpenAIErrorWrapperLocal(err, "read_request_body_failed", http.StatusBadRequest)
+			c.JSON(openaiErr.StatusCode, gin.H{
+				"error": openaiErr.Error,
+			})
+			return
 		}
-		// 实施重试逻辑。
-		if retryTimes > 0 {
-			c.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s?retry=%d", c.Request.URL.Path, retryTimes-1))
-		} else {
-			// 当请求被限制过多时，进行特定处理。
-			if err.StatusCode == http.StatusTooManyRequests {
-				// 请求过多的处理逻辑。
+	}
+
+	var openaiErr *dto.OpenAIErrorWithStatusCode
+	triedChannelIds := make([]int, 0)
+	for i := 0; i <= common.RetryTimes; i++ {
+		if i > 0 {
+			// 从剩余渠道中重新选择，优先级最高的渠道用尽后会使用次一级优先级的渠道
+			channel, err := model.CacheGetRandomSatisfiedChannel(group, originalModel, triedChannelIds)
+			if err != nil || channel == nil {
+				common.LogInfo(c.Request.Context(), fmt.Sprintf("no more channels to retry, tried channels: %v", triedChannelIds))
+				break
 			}
-			// 错误响应格式化。
-			err.Error.Message = common.MessageWithRequestId(err.Error.Message, requestId)
-			c.JSON(err.StatusCode, gin.H{
-				"error": err.Error,
-			})
+			middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+			common.LogInfo(c.Request.Context(), fmt.Sprintf("retry %d, using channel #%d", i, channel.Id))
 		}
 		channelId := c.GetInt("channel_id")
-		autoBan := c.GetBool("auto_ban")
-		// 记录错误日志，并在特定条件下禁用频道。
-		common.LogError(c.Request.Context(), fmt.Sprintf("relay error (channel #%d): %s", channelId, err.Error.Message))
-		if service.ShouldDisableChannel(&err.Error, err.StatusCode) && autoBan {
-			service.DisableChannel(channelId, c.GetString("channel_name"), err.Error.Message)
+		triedChannelIds = append(triedChannelIds, channelId)
+		c.Header(common.ChannelIdsHeaderKey, common.IntsToString(triedChannelIds))
+
+		if cacheRequestBody {
+			if err := common.ResetRequestBody(c); err != nil {
+				openaiErr = service.OpenAIErrorWrapperLocal(err, "read_request_body_failed", http.StatusBadRequest)
+				break
+			}
+		}
+		model.ChannelRequestStarted(channelId, originalModel)
+		c.Set("first_response_time", time.Time{})
+		startTime := time.Now()
+		openaiErr = relayRequest(c, relayMode)
+		// 触发了对冲请求时，对冲渠道同样计入已尝试的渠道，错误记到实际返回响应的渠道上
+		hedged := false
+		if hedgeChannelId := c.GetInt("hedge_channel_id"); hedgeChannelId != 0 {
+			c.Set("hedge_channel_id", 0)
+			triedChannelIds = append(triedChannelIds, hedgeChannelId)
+			c.Header(common.ChannelIdsHeaderKey, common.IntsToString(triedChannelIds))
+			hedged = true
+		}
+		// 对冲请求胜出时第一个渠道落败，它的延迟在对冲时已经记录
+		primaryLost := hedged && c.GetInt("channel_id") != channelId
+		recordChannelMetrics(c, channelId, originalModel, startTime, primaryLost, openaiErr)
+		if hedged {
+			channelId = c.GetInt("channel_id")
+		}
+		if openaiErr == nil {
+			// 命中响应缓存时没有请求渠道，不计入熔断器
+			if c.GetBool("auto_ban") && !c.GetBool("cache_hit") {
+				model.RecordChannelBreakerResult(channelId, originalModel, true)
+			}
+			return
+		}
+		if c.Request.Context().Err() != nil {
+			// 客户端已经断开连接，不是渠道的问题，也不需要再重试
+			common.LogInfo(c.Request.Context(), fmt.Sprintf("client cancelled the request on channel #%d", channelId))
+			break
+		}
+		processChannelError(c, channelId, openaiErr)
+		if !shouldRetry(c, openaiErr) {
+			break
 		}
 	}
+
+	// 所有尝试均失败，归还预扣的额度
+	relay.ReturnPreConsumedQuota(c)
+	if c.Writer.Written() {
+		// 响应已经开始写出（例如流式响应中途失败），无法再返回错误信息
+		return
+	}
+	if openaiErr.StatusCode == http.StatusTooManyRequests {
+		// 请求过多的处理逻辑。
+	}
+	// 错误响应格式化。
+	openaiErr.Error.Message = common.MessageWithRequestId(openaiErr.Error.Message, requestId)
+	switch relayconstant.Path2RelayFormat(c.Request.URL.Path) {
+	case relayconstant.RelayFormatClaude:
+		c.JSON(openaiErr.StatusCode, gin.H{
+			"type": "error",
+			"error": gin.H{
+				"type":    openaiErr.Error.Type,
+				"message": openaiErr.Error.Message,
+			},
+		})
+	case relayconstant.RelayFormatGemini:
+		c.JSON(openaiErr.StatusCode, gin.H{
+			"error": gin.H{
+				"code":    openaiErr.StatusCode,
+				"message": openaiErr.Error.Message,
+				"status":  geminiErrorStatus(openaiErr.StatusCode),
+			},
+		})
+	default:
+		c.JSON(openaiErr.StatusCode, gin.H{
+			"error": openaiErr.Error,
+		})
+	}
+}
+
+// geminiErrorStatus 将 HTTP 状态码转换为 Gemini 错误响应中的 status 字段
+func geminiErrorStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	default:
+		return "INTERNAL"
+	}
+}
+
+// isMultipartRelayMode 判断请求是否为 multipart 格式的图片编辑或语音转文字请求，这类请求在分发时已经解析为表单
+func isMultipartRelayMode(relayMode int) bool {
+	switch relayMode {
+	case relayconstant.RelayModeImagesEdits, relayconstant.RelayModeImagesVariations,
+		relayconstant.RelayModeAudioTranscription, relayconstant.RelayModeAudioTranslation:
+		return true
+	}
+	return false
+}
+
+// shouldRetry 判断一次失败的请求是否应该更换渠道重试
+func shouldRetry(c *gin.Context, openaiErr *dto.OpenAIErrorWithStatusCode) bool {
+	if openaiErr == nil || openaiErr.LocalError {
+		return false
+	}
+	// 已经向客户端写出了数据，无法重试
+	if c.Writer.Written() {
+		return false
+	}
+	// 指定了渠道的请求不重试
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	if openaiErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if openaiErr.StatusCode/100 == 5 {
+		return true
+	}
+	if openaiErr.StatusCode == http.StatusBadRequest {
+		return false
+	}
+	if openaiErr.StatusCode/100 == 2 {
+		return false
+	}
+	return true
+}
+
+// recordChannelMetrics 记录一次尝试的延迟和结果，供按负载、延迟和错误率选择渠道的策略使用。
+// 客户端取消、请求本身有误、命中响应缓存和在对冲中落败的尝试只结束计数，不计入延迟和错误率
+func recordChannelMetrics(c *gin.Context, channelId int, modelName string, startTime time.Time, hedgeLost bool, openaiErr *dto.OpenAIErrorWithStatusCode) {
+	if hedgeLost || c.GetBool("cache_hit") || c.Request.Context().Err() != nil || (openaiErr != nil && (openaiErr.LocalError || openaiErr.StatusCode == http.StatusBadRequest)) {
+		model.ChannelRequestAborted(channelId, modelName)
+		return
+	}
+	latency := time.Since(startTime)
+	if firstResponseTime := c.GetTime("first_response_time"); !firstResponseTime.IsZero() {
+		latency = firstResponseTime.Sub(startTime)
+	}
+	model.ChannelRequestFinished(channelId, modelName, latency, openaiErr == nil)
+}
+
+// processChannelError 记录渠道错误日志，并在特定条件下禁用渠道。
+// 多密钥渠道只禁用出错的密钥，并记录密钥的错误次数。
+func processChannelError(c *gin.Context, channelId int, openaiErr *dto.OpenAIErrorWithStatusCode) {
+	autoBan := c.GetBool("auto_ban")
+	common.LogError(c.Request.Context(), fmt.Sprintf("relay error (channel #%d): %s", channelId, openaiErr.Error.Message))
+	shouldDisable := service.ShouldDisableChannel(&openaiErr.Error, openaiErr.StatusCode) && autoBan
+	// 本地错误和上游返回的 400 是请求本身的问题，不计入熔断器
+	if autoBan && !openaiErr.LocalError && openaiErr.StatusCode != http.StatusBadRequest {
+		model.RecordChannelBreakerResult(channelId, c.GetString("original_model"), false)
+	}
+	// 启用熔断时由熔断器暂时跳过出错的渠道，冷却后自动恢复，不再永久禁用渠道或密钥
+	shouldDisable = shouldDisable && !common.ChannelBreakerEnabled
+	if c.GetBool("channel_multi_key") {
+		service.RecordChannelKeyError(channelId, c.GetString("channel_name"), c.GetInt("channel_key_index"), openaiErr.Error.Message, shouldDisable)
+	} else if shouldDisable {
+		service.DisableChannel(channelId, c.GetString("channel_name"), openaiErr.Error.Message)
+	}
 }
 
 // RelayMidjourney 处理中继的中途任务。
@@ -106,6 +290,20 @@ func RelayMidjourney(c *gin.Context) {
 	}
 }
 
+// RelayRealtime 处理 /v1/realtime 的 WebSocket 请求。
+// 升级为 WebSocket 之前失败时返回普通的错误响应，之后会话的结束由 relay.RealtimeHelper 处理。
+func RelayRealtime(c *gin.Context) {
+	openaiErr := relay.RealtimeHelper(c)
+	if openaiErr == nil {
+		return
+	}
+	processChannelError(c, c.GetInt("channel_id"), openaiErr)
+	openaiErr.Error.Message = common.MessageWithRequestId(openaiErr.Error.Message, c.GetString(common.RequestIdKey))
+	c.JSON(openaiErr.StatusCode, gin.H{
+		"error": openaiErr.Error,
+	})
+}
+
 // RelayNotImplemented 处理未实现的API请求。
 // 返回一个提示信息，说明API尚未实现。
 // 参数 c 是Gin框架的上下文对象，用于返回HTTP响应。
@@ -134,6 +134,8 @@ func AddToken(c *gin.Context) {
 		UnlimitedQuota:     token.UnlimitedQuota,
 		ModelLimitsEnabled: token.ModelLimitsEnabled,
 		ModelLimits:        token.ModelLimits,
+		CacheEnabled:       token.CacheEnabled,
+		CacheTTL:           token.CacheTTL,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -221,6 +223,8 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.UnlimitedQuota = token.UnlimitedQuota
 		cleanToken.ModelLimitsEnabled = token.ModelLimitsEnabled
 		cleanToken.ModelLimits = token.ModelLimits
+		cleanToken.CacheEnabled = token.CacheEnabled
+		cleanToken.CacheTTL = token.CacheTTL
 	}
 	err = cleanToken.Update()
 	if err != nil {
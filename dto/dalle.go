@@ -1,5 +1,7 @@
 package dto
 
+import "mime/multipart"
+
 type ImageRequest struct {
 	Model          string `json:"model"`
 	Prompt         string `json:"prompt" binding:"required"`
@@ -12,9 +14,24 @@ type ImageRequest struct {
 }
 
 type ImageResponse struct {
-	Created int `json:"created"`
-	Data    []struct {
-		Url     string `json:"url"`
-		B64Json string `json:"b64_json"`
-	}
+	Created int         `json:"created"`
+	Data    []ImageData `json:"data"`
+}
+
+type ImageData struct {
+	Url           string `json:"url,omitempty"`
+	B64Json       string `json:"b64_json,omitempty"`
+	RevisedPrompt string `json:"revised_prompt,omitempty"`
+}
+
+// ImageEditRequest /v1/images/edits 和 /v1/images/variations 的 multipart 请求，上传的图片保留为表单中的文件
+type ImageEditRequest struct {
+	Model          string                  `form:"model"`
+	Prompt         string                  `form:"prompt"`
+	N              int                     `form:"n"`
+	Size           string                  `form:"size"`
+	ResponseFormat string                  `form:"response_format"`
+	User           string                  `form:"user"`
+	Image          []*multipart.FileHeader `form:"image"`
+	Mask           *multipart.FileHeader   `form:"mask"`
 }
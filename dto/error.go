@@ -10,6 +10,7 @@ type OpenAIError struct {
 type OpenAIErrorWithStatusCode struct {
 	Error      OpenAIError `json:"error"`
 	StatusCode int         `json:"status_code"`
+	LocalError bool        `json:"-"` // 网关本地产生的错误（如参数校验、额度不足），不需要更换渠道重试
 }
 
 type GeneralErrorResponse struct {
@@ -0,0 +1,33 @@
+package dto
+
+// RealtimeEvent 实时会话中的事件，只解析计费需要的字段
+type RealtimeEvent struct {
+	Type       string            `json:"type"`
+	Response   *RealtimeResponse `json:"response,omitempty"`
+	ResponseId string            `json:"response_id,omitempty"`
+	Delta      string            `json:"delta,omitempty"`
+	Session    *RealtimeSession  `json:"session,omitempty"`
+}
+
+type RealtimeSession struct {
+	OutputAudioFormat string `json:"output_audio_format,omitempty"`
+}
+
+type RealtimeResponse struct {
+	Id    string         `json:"id"`
+	Usage *RealtimeUsage `json:"usage,omitempty"`
+}
+
+type RealtimeUsage struct {
+	TotalTokens        int                  `json:"total_tokens"`
+	InputTokens        int                  `json:"input_tokens"`
+	OutputTokens       int                  `json:"output_tokens"`
+	InputTokenDetails  RealtimeTokenDetails `json:"input_token_details"`
+	OutputTokenDetails RealtimeTokenDetails `json:"output_token_details"`
+}
+
+type RealtimeTokenDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+	TextTokens   int `json:"text_tokens"`
+	AudioTokens  int `json:"audio_tokens"`
+}
@@ -0,0 +1,44 @@
+package dto
+
+// RerankRequest Jina / Cohere 格式的 rerank 请求，documents 可以是字符串或 {"text": "..."} 对象
+type RerankRequest struct {
+	Model           string `json:"model"`
+	Query           string `json:"query"`
+	Documents       []any  `json:"documents"`
+	TopN            int    `json:"top_n,omitempty"`
+	ReturnDocuments *bool  `json:"return_documents,omitempty"`
+	MaxChunksPerDoc int    `json:"max_chunks_per_doc,omitempty"`
+}
+
+// DocumentTexts 返回所有文档的文本，用于估算 token 数
+func (r RerankRequest) DocumentTexts() []string {
+	texts := make([]string, 0, len(r.Documents))
+	for _, document := range r.Documents {
+		switch document := document.(type) {
+		case string:
+			texts = append(texts, document)
+		case map[string]any:
+			if text, ok := document["text"].(string); ok {
+				texts = append(texts, text)
+			}
+		}
+	}
+	return texts
+}
+
+type RerankDocument struct {
+	Text string `json:"text"`
+}
+
+type RerankResult struct {
+	Index          int             `json:"index"`
+	RelevanceScore float64         `json:"relevance_score"`
+	Document       *RerankDocument `json:"document,omitempty"`
+}
+
+// RerankResponse Jina 格式的 rerank 响应
+type RerankResponse struct {
+	Model   string         `json:"model"`
+	Results []RerankResult `json:"results"`
+	Usage   Usage          `json:"usage"`
+}
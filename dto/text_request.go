@@ -6,11 +6,16 @@ type ResponseFormat struct {
 	Type string `json:"type,omitempty"`
 }
 
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage,omitempty"`
+}
+
 type GeneralOpenAIRequest struct {
 	Model            string          `json:"model,omitempty"`
 	Messages         []Message       `json:"messages,omitempty"`
 	Prompt           any             `json:"prompt,omitempty"`
 	Stream           bool            `json:"stream,omitempty"`
+	StreamOptions    *StreamOptions  `json:"stream_options,omitempty"`
 	MaxTokens        uint            `json:"max_tokens,omitempty"`
 	Temperature      float64         `json:"temperature,omitempty"`
 	TopP             float64         `json:"top_p,omitempty"`
@@ -32,6 +37,25 @@ type GeneralOpenAIRequest struct {
 	TopLogProbs      int             `json:"top_logprobs,omitempty"`
 }
 
+// ParseTools 将 Tools 解析为 OpenAITool 列表
+func (r GeneralOpenAIRequest) ParseTools() []OpenAITool {
+	if r.Tools == nil {
+		return nil
+	}
+	if tools, ok := r.Tools.([]OpenAITool); ok {
+		return tools
+	}
+	var tools []OpenAITool
+	data, err := json.Marshal(r.Tools)
+	if err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &tools); err != nil {
+		return nil
+	}
+	return tools
+}
+
 func (r GeneralOpenAIRequest) ParseInput() []string {
 	if r.Input == nil {
 		return nil
@@ -59,6 +83,29 @@ type Message struct {
 	ToolCallId string          `json:"tool_call_id,omitempty"`
 }
 
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"` // stream only
+	Id       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+type OpenAITool struct {
+	Type     string         `json:"type"`
+	Function OpenAIFunction `json:"function"`
+}
+
+type OpenAIFunction struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
 type MediaMessage struct {
 	Type     string `json:"type"`
 	Text     string `json:"text"`
@@ -83,6 +130,30 @@ func (m Message) StringContent() string {
 	return string(m.Content)
 }
 
+// ParseToolCalls 将 ToolCalls 解析为 ToolCall 列表
+func (m Message) ParseToolCalls() []ToolCall {
+	return ParseToolCalls(m.ToolCalls)
+}
+
+// ParseToolCalls 将任意结构（通常是反序列化得到的 []any）的 tool_calls 解析为 ToolCall 列表
+func ParseToolCalls(toolCalls any) []ToolCall {
+	if toolCalls == nil {
+		return nil
+	}
+	if calls, ok := toolCalls.([]ToolCall); ok {
+		return calls
+	}
+	var calls []ToolCall
+	data, err := json.Marshal(toolCalls)
+	if err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &calls); err != nil {
+		return nil
+	}
+	return calls
+}
+
 func (m Message) IsStringContent() bool {
 	var stringContent string
 	if err := json.Unmarshal(m.Content, &stringContent); err == nil {
@@ -122,6 +122,18 @@ func main() {
 	// 初始化令牌编码器
 	service.InitTokenEncoders()
 
+	// 主节点启动批处理任务的后台处理
+	if common.FileStorageType == service.FileStorageLocal {
+		if err := service.CheckLocalFileStorage(); err != nil {
+			common.SysError("files and batches api are unavailable: " + err.Error())
+		}
+	}
+	if common.IsMasterNode {
+		common.SafeGoroutine(func() {
+			controller.RunBatchWorker()
+		})
+	}
+
 	// 初始化HTTP服务器，配置恢复中间件、请求ID中间件、日志中间件和会话中间件
 	server := gin.New()
 	server.Use(gin.CustomRecovery(func(c *gin.Context, err any) {
@@ -3,6 +3,7 @@ package middleware
 import (
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"net/http"
 	"one-api/common"
 	"one-api/model"
@@ -85,6 +86,25 @@ func RootAuth() func(c *gin.Context) {
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		key := c.Request.Header.Get("Authorization")
+		if key == "" && c.Request.Header.Get("x-api-key") != "" {
+			// Anthropic SDK 使用 x-api-key 传递令牌
+			key = c.Request.Header.Get("x-api-key")
+		}
+		if key == "" && strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
+			// 浏览器无法为 WebSocket 设置请求头，Realtime API 通过 openai-insecure-api-key.{key} 子协议传递令牌
+			for _, protocol := range websocket.Subprotocols(c.Request) {
+				if strings.HasPrefix(protocol, "openai-insecure-api-key.") {
+					key = strings.TrimPrefix(protocol, "openai-insecure-api-key.")
+				}
+			}
+		}
+		if key == "" && strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+			// Google SDK 使用 x-goog-api-key 请求头或 ?key= 查询参数传递令牌
+			key = c.Request.Header.Get("x-goog-api-key")
+			if key == "" {
+				key = c.Query("key")
+			}
+		}
 		parts := make([]string, 0)
 		key = strings.TrimPrefix(key, "Bearer ")
 		if key == "" || key == "midjourney-proxy" {
@@ -125,6 +145,8 @@ func TokenAuth() func(c *gin.Context) {
 		} else {
 			c.Set("token_model_limit_enabled", false)
 		}
+		c.Set("token_cache_enabled", token.CacheEnabled)
+		c.Set("token_cache_ttl", token.CacheTTL)
 		if len(parts) > 1 {
 			if model.IsAdmin(token.UserId) {
 				c.Set("channelId", parts[1])
@@ -39,6 +39,9 @@ func Distribute() func(c *gin.Context) {
 				abortWithOpenAiMessage(c, http.StatusForbidden, "该渠道已被禁用")
 				return
 			}
+			// 指定了渠道的请求不进行渠道重试
+			c.Set("specific_channel_id", channel.Id)
+			SetupContextForSelectedChannel(c, channel, "")
 		} else {
 			shouldSelectChannel := true
 			// Select a channel for the user
@@ -75,13 +78,35 @@ func Distribute() func(c *gin.Context) {
 					modelRequest.Model = midjourneyModel
 				}
 				c.Set("relay_mode", relayMode)
-			} else if !strings.HasPrefix(c.Request.URL.Path, "/v1/audio/transcriptions") {
+			} else if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
+				// Realtime API 的 WebSocket 请求没有请求体，模型名称在查询参数中
+				modelRequest.Model = c.Query("model")
+			} else if strings.HasPrefix(c.Request.URL.Path, "/v1/images/edits") || strings.HasPrefix(c.Request.URL.Path, "/v1/images/variations") {
+				// 图片编辑请求为 multipart 格式，上传的图片写入临时文件，不读入内存
+				_, err = common.ParseMultipartFormReusable(c)
+				if err == nil {
+					modelRequest.Model = c.Request.FormValue("model")
+					if modelRequest.Model == "" {
+						modelRequest.Model = "dall-e-2"
+					}
+				}
+			} else if strings.HasPrefix(c.Request.URL.Path, "/v1/audio/transcriptions") || strings.HasPrefix(c.Request.URL.Path, "/v1/audio/translations") {
+				// 语音转文字请求同样为 multipart 格式，未指定模型时在下面使用 whisper-1
+				_, err = common.ParseMultipartFormReusable(c)
+				if err == nil {
+					modelRequest.Model = c.Request.FormValue("model")
+				}
+			} else {
 				err = common.UnmarshalBodyReusable(c, &modelRequest)
 			}
 			if err != nil {
 				abortWithOpenAiMessage(c, http.StatusBadRequest, "无效的请求, "+err.Error())
 				return
 			}
+			if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+				// Gemini 格式的请求体中没有模型字段，模型名称在路径中
+				modelRequest.Model, _ = relayconstant.GetGeminiModelAndAction(c.Request.URL.Path)
+			}
 			if strings.HasPrefix(c.Request.URL.Path, "/v1/moderations") {
 				if modelRequest.Model == "" {
 					modelRequest.Model = "text-moderation-stable"
@@ -131,7 +156,11 @@ func Distribute() func(c *gin.Context) {
 			userGroup, _ := model.CacheGetUserGroup(userId)
 			c.Set("group", userGroup)
 			if shouldSelectChannel {
-				channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model)
+				if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
+					channel, err = getRealtimeChannel(userGroup, modelRequest.Model)
+				} else {
+					channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, modelRequest.Model, nil)
+				}
 				if err != nil {
 					message := fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道", userGroup, modelRequest.Model)
 					// 如果错误，但是渠道不为空，说明是数据库一致性问题
@@ -147,36 +176,76 @@ func Distribute() func(c *gin.Context) {
 					abortWithOpenAiMessage(c, http.StatusServiceUnavailable, fmt.Sprintf("当前分组 %s 下对于模型 %s 无可用渠道（数据库一致性已被破坏）", userGroup, modelRequest.Model))
 					return
 				}
-				c.Set("channel", channel.Type)
-				c.Set("channel_id", channel.Id)
-				c.Set("channel_name", channel.Name)
-				ban := true
-				// parse *int to bool
-				if channel.AutoBan != nil && *channel.AutoBan == 0 {
-					ban = false
-				}
-				if nil != channel.OpenAIOrganization {
-					c.Set("channel_organization", *channel.OpenAIOrganization)
-				}
-				c.Set("auto_ban", ban)
-				c.Set("model_mapping", channel.GetModelMapping())
-				c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
-				c.Set("base_url", channel.GetBaseURL())
-				// TODO: api_version统一
-				switch channel.Type {
-				case common.ChannelTypeAzure:
-					c.Set("api_version", channel.Other)
-				case common.ChannelTypeXunfei:
-					c.Set("api_version", channel.Other)
-				//case common.ChannelTypeAIProxyLibrary:
-				//	c.Set("library_id", channel.Other)
-				case common.ChannelTypeGemini:
-					c.Set("api_version", channel.Other)
-				case common.ChannelTypeAli:
-					c.Set("plugin", channel.Other)
-				}
+				SetupContextForSelectedChannel(c, channel, modelRequest.Model)
 			}
 		}
 		c.Next()
 	}
 }
+
+// getRealtimeChannel 随机选择一个支持 Realtime API 的渠道，只有 OpenAI 和 Azure 渠道支持
+func getRealtimeChannel(group string, modelName string) (*model.Channel, error) {
+	excludeChannelIds := make([]int, 0)
+	for {
+		channel, err := model.CacheGetRandomSatisfiedChannel(group, modelName, excludeChannelIds)
+		if err != nil || channel == nil {
+			return channel, err
+		}
+		if channel.Type == common.ChannelTypeOpenAI || channel.Type == common.ChannelTypeAzure {
+			return channel, nil
+		}
+		excludeChannelIds = append(excludeChannelIds, channel.Id)
+	}
+}
+
+// SetupContextForSelectedChannel 将选中渠道的信息写入上下文，供后续的 relay 使用。
+// 渠道重试时也会调用此函数切换到新的渠道。
+func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) {
+	if modelName != "" {
+		c.Set("original_model", modelName)
+	}
+	c.Set("channel", channel.Type)
+	c.Set("channel_id", channel.Id)
+	c.Set("channel_name", channel.Name)
+	ban := true
+	// parse *int to bool
+	if channel.AutoBan != nil && *channel.AutoBan == 0 {
+		ban = false
+	}
+	if nil != channel.OpenAIOrganization {
+		c.Set("channel_organization", *channel.OpenAIOrganization)
+	} else {
+		c.Set("channel_organization", "")
+	}
+	c.Set("auto_ban", ban)
+	c.Set("model_mapping", channel.GetModelMapping())
+	// 多密钥渠道按渠道设置的方式选择一个启用的密钥，出错时按序号记录到对应的密钥上
+	key, keyIndex := channel.SelectKey()
+	c.Set("channel_multi_key", channel.IsMultiKey())
+	c.Set("channel_key_index", keyIndex)
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
+	c.Set("base_url", channel.GetBaseURL())
+	c.Set("first_token_timeout", channel.GetFirstTokenTimeout())
+	c.Set("idle_timeout", channel.GetIdleTimeout())
+	c.Set("total_timeout", channel.GetTotalTimeout())
+	c.Set("stream_mode", channel.GetStreamMode())
+	// 重试切换渠道时，清除上一个渠道遗留的设置
+	c.Set("api_version", "")
+	c.Set("plugin", "")
+	c.Set("region", "")
+	// TODO: api_version统一
+	switch channel.Type {
+	case common.ChannelTypeAzure:
+		c.Set("api_version", channel.Other)
+	case common.ChannelTypeXunfei:
+		c.Set("api_version", channel.Other)
+	//case common.ChannelTypeAIProxyLibrary:
+	//	c.Set("library_id", channel.Other)
+	case common.ChannelTypeGemini:
+		c.Set("api_version", channel.Other)
+	case common.ChannelTypeAli:
+		c.Set("plugin", channel.Other)
+	case common.ChannelTypeVertexAi:
+		c.Set("region", channel.Other)
+	}
+}
@@ -27,7 +27,13 @@ func GetGroupModels(group string) []string {
 	return models
 }
 
-func GetRandomSatisfiedChannel(group string, model string) (*Channel, error) {
+func GetRandomSatisfiedChannel(group string, model string, excludedChannelIds []int) (*Channel, error) {
+	return getRandomSatisfiedChannel(group, model, model, excludedChannelIds)
+}
+
+// getRandomSatisfiedChannel 在最高优先级的渠道中按分组和模型设置的策略选出得分最低的渠道，再按权重随机选择，
+// 渠道的实时指标按 requestModel 统计
+func getRandomSatisfiedChannel(group string, model string, requestModel string, excludedChannelIds []int) (*Channel, error) {
 	var abilities []Ability
 	groupCol := "`group`"
 	trueVal := "1"
@@ -38,7 +44,13 @@ func GetRandomSatisfiedChannel(group string, model string) (*Channel, error) {
 
 	var err error = nil
 	maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
-	channelQuery := DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal+" and priority = (?)", group, model, maxPrioritySubQuery)
+	channelQuery := DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
+	if len(excludedChannelIds) > 0 {
+		// 排除已尝试过的渠道，最高优先级的渠道都被排除后会落到次一级优先级
+		maxPrioritySubQuery = maxPrioritySubQuery.Where("channel_id NOT IN (?)", excludedChannelIds)
+		channelQuery = channelQuery.Where("channel_id NOT IN (?)", excludedChannelIds)
+	}
+	channelQuery = channelQuery.Where("priority = (?)", maxPrioritySubQuery)
 	if common.UsingSQLite || common.UsingPostgreSQL {
 		err = channelQuery.Order("weight DESC").Find(&abilities).Error
 	} else {
@@ -47,6 +59,17 @@ func GetRandomSatisfiedChannel(group string, model string) (*Channel, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(abilities) > 1 {
+		channelIds := make([]int, 0, len(abilities))
+		for _, ability_ := range abilities {
+			channelIds = append(channelIds, ability_.ChannelId)
+		}
+		candidates := make([]Ability, 0, len(abilities))
+		for _, i := range selectChannelsByStrategy(common.GetChannelSelectStrategy(group, requestModel), channelIds, requestModel) {
+			candidates = append(candidates, abilities[i])
+		}
+		abilities = candidates
+	}
 	channel := Channel{}
 	if len(abilities) > 0 {
 		// Randomly choose one
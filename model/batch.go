@@ -0,0 +1,139 @@
+package model
+
+import (
+	"errors"
+	"one-api/common"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+type Batch struct {
+	Id               string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id"`
+	Endpoint         string `json:"endpoint"`
+	InputFileId      string `json:"input_file_id"`
+	CompletionWindow string `json:"completion_window"`
+	Status           string `json:"status" gorm:"type:varchar(20);index"`
+	OutputFileId     string `json:"output_file_id"`
+	ErrorFileId      string `json:"error_file_id"`
+	Errors           string `json:"errors"` // 批处理整体失败时的错误信息
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint"`
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint"`
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint"`
+	TotalCount       int    `json:"total_count"`
+	CompletedCount   int    `json:"completed_count"`
+	FailedCount      int    `json:"failed_count"`
+	Metadata         string `json:"metadata"`
+}
+
+// GetUserBatches 按创建时间倒序列出用户的批处理任务，after 为上一页最后一个任务的 id
+func GetUserBatches(userId int, after string, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	query := DB.Where("user_id = ?", userId)
+	if after != "" {
+		afterBatch, err := GetUserBatchById(after, userId)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", afterBatch.CreatedAt, afterBatch.CreatedAt, afterBatch.Id)
+	}
+	err := query.Order("created_at desc, id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+func GetUserBatchById(id string, userId int) (*Batch, error) {
+	if id == "" {
+		return nil, errors.New("id 为空！")
+	}
+	batch := Batch{}
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&batch).Error
+	return &batch, err
+}
+
+func GetBatchById(id string) (*Batch, error) {
+	if id == "" {
+		return nil, errors.New("id 为空！")
+	}
+	batch := Batch{}
+	err := DB.Where("id = ?", id).First(&batch).Error
+	return &batch, err
+}
+
+// GetValidatingBatches 获取等待处理的批处理任务，按创建时间先后排列
+func GetValidatingBatches(limit int) ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status = ?", BatchStatusValidating).Order("created_at asc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// ClaimBatch 将等待处理的批处理任务标记为处理中，返回是否抢占成功，多个节点同时处理时只有一个会成功
+func ClaimBatch(batch *Batch) (bool, error) {
+	now := common.GetTimestamp()
+	result := DB.Model(&Batch{}).Where("id = ? AND status = ?", batch.Id, BatchStatusValidating).
+		Updates(map[string]any{"status": BatchStatusInProgress, "in_progress_at": now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	batch.Status = BatchStatusInProgress
+	batch.InProgressAt = now
+	return true, nil
+}
+
+// CancelBatch 将批处理任务标记为取消中，未开始处理的任务直接取消
+func CancelBatch(batch *Batch) error {
+	now := common.GetTimestamp()
+	err := DB.Model(&Batch{}).Where("id = ? AND status = ?", batch.Id, BatchStatusValidating).
+		Updates(map[string]any{"status": BatchStatusCancelled, "cancelling_at": now, "cancelled_at": now}).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Model(&Batch{}).Where("id = ? AND status = ?", batch.Id, BatchStatusInProgress).
+		Updates(map[string]any{"status": BatchStatusCancelling, "cancelling_at": now}).Error
+	if err != nil {
+		return err
+	}
+	return DB.Where("id = ?", batch.Id).First(batch).Error
+}
+
+// UpdateBatchCounts 更新批处理任务的请求数量，只更新这几列以免覆盖同时发生的取消操作
+func UpdateBatchCounts(batch *Batch) error {
+	return DB.Model(&Batch{}).Where("id = ?", batch.Id).Updates(map[string]any{
+		"total_count":     batch.TotalCount,
+		"completed_count": batch.CompletedCount,
+		"failed_count":    batch.FailedCount,
+	}).Error
+}
+
+// FailInterruptedBatches 将服务重启前未处理完的批处理任务标记为失败
+func FailInterruptedBatches() error {
+	now := common.GetTimestamp()
+	return DB.Model(&Batch{}).Where("status IN ?", []string{BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling}).
+		Updates(map[string]any{"status": BatchStatusFailed, "failed_at": now, "errors": "批处理任务因服务重启中断"}).Error
+}
+
+func (batch *Batch) Insert() error {
+	return DB.Create(batch).Error
+}
+
+func (batch *Batch) Update() error {
+	return DB.Save(batch).Error
+}
@@ -265,20 +265,42 @@ func SyncChannelCache(frequency int) {
 	}
 }
 
-func CacheGetRandomSatisfiedChannel(group string, model string) (*Channel, error) {
+// CacheGetRandomSatisfiedChannel 按优先级和分组、模型设置的选择策略选择一个满足条件的渠道，默认按权重随机选择，
+// excludedChannelIds 中的渠道（如重试时已尝试过的渠道）会被跳过，
+// 当最高优先级的渠道全部被排除后，会继续从次一级优先级中选择。
+func CacheGetRandomSatisfiedChannel(group string, model string, excludedChannelIds []int) (*Channel, error) {
+	// 熔断器和渠道的实时指标按请求的模型统计
+	requestModel := model
 	if strings.HasPrefix(model, "gpt-4-gizmo") {
 		model = "gpt-4-gizmo-*"
 	}
 
 	// if memory cache is disabled, get channel directly from database
 	if !common.MemoryCacheEnabled {
-		return GetRandomSatisfiedChannel(group, model)
+		return getRandomSatisfiedChannelWithBreaker(group, model, requestModel, excludedChannelIds)
 	}
+	for {
+		channel, probing, err := cacheGetRandomSatisfiedChannel(group, model, requestModel, excludedChannelIds)
+		if err != nil || !probing || startChannelBreakerProbe(channel.Id, requestModel) {
+			return channel, err
+		}
+		// 半开状态的渠道的试探名额已被其他请求占用，重新选择
+		excludedChannelIds = append(excludedChannelIds[:len(excludedChannelIds):len(excludedChannelIds)], channel.Id)
+	}
+}
+
+// cacheGetRandomSatisfiedChannel 从内存缓存中选择渠道，同时返回选中的渠道是否为需要占用试探名额的半开渠道
+func cacheGetRandomSatisfiedChannel(group string, model string, requestModel string, excludedChannelIds []int) (*Channel, bool, error) {
 	channelSyncLock.RLock()
 	defer channelSyncLock.RUnlock()
-	channels := group2model2channels[group][model]
+	channels := filterExcludedChannels(group2model2channels[group][model], excludedChannelIds)
+	if len(channels) == 0 {
+		return nil, false, errors.New("channel not found")
+	}
+	// 跳过熔断器不放行的渠道
+	channels, probing := filterChannelBreaker(channels, requestModel)
 	if len(channels) == 0 {
-		return nil, errors.New("channel not found")
+		return nil, false, errChannelBreakerOpen
 	}
 	endIdx := len(channels)
 	// choose by priority
@@ -291,12 +313,26 @@ func CacheGetRandomSatisfiedChannel(group string, model string) (*Channel, error
 			}
 		}
 	}
+	channels = channels[:endIdx]
+
+	// 按分组和模型设置的策略选出得分最低的渠道，再在其中按权重随机选择
+	channelIds := make([]int, 0, len(channels))
+	for _, channel := range channels {
+		channelIds = append(channelIds, channel.Id)
+	}
+	if indexes := selectChannelsByStrategy(common.GetChannelSelectStrategy(group, requestModel), channelIds, requestModel); len(indexes) < len(channels) {
+		candidates := make([]*Channel, 0, len(indexes))
+		for _, i := range indexes {
+			candidates = append(candidates, channels[i])
+		}
+		channels = candidates
+	}
 
 	// 平滑系数
 	smoothingFactor := 10
-	// Calculate the total weight of all channels up to endIdx
+	// Calculate the total weight of all channels
 	totalWeight := 0
-	for _, channel := range channels[:endIdx] {
+	for _, channel := range channels {
 		totalWeight += channel.GetWeight() + smoothingFactor
 	}
 
@@ -309,14 +345,67 @@ func CacheGetRandomSatisfiedChannel(group string, model string) (*Channel, error
 	randomWeight := rand.Intn(totalWeight)
 
 	// Find a channel based on its weight
-	for _, channel := range channels[:endIdx] {
+	for _, channel := range channels {
 		randomWeight -= channel.GetWeight() + smoothingFactor
 		if randomWeight < 0 {
-			return channel, nil
+			return channel, probing[channel.Id], nil
 		}
 	}
 	// return null if no channel is not found
-	return nil, errors.New("channel not found")
+	return nil, false, errors.New("channel not found")
+}
+
+// getRandomSatisfiedChannelWithBreaker 从数据库中选择渠道，跳过熔断器不放行的渠道，规则与 filterChannelBreaker 相同。
+// 所有渠道都被熔断时返回第一次选中的渠道
+func getRandomSatisfiedChannelWithBreaker(group string, model string, requestModel string, excludedChannelIds []int) (*Channel, error) {
+	channel, err := getRandomSatisfiedChannel(group, model, requestModel, excludedChannelIds)
+	if err != nil || !common.ChannelBreakerEnabled {
+		return channel, err
+	}
+	excluded := append([]int{}, excludedChannelIds...)
+	// probes 有试探名额但没有按比例放行的半开渠道
+	var probes []*Channel
+	halfOpen := false
+	for candidate := channel; err == nil; candidate, err = getRandomSatisfiedChannel(group, model, requestModel, excluded) {
+		now := time.Now().Unix()
+		breaker := getChannelBreaker(candidate.Id, requestModel)
+		if breaker == nil || breaker.currentState(now) == channelBreakerClosed {
+			return candidate, nil
+		}
+		if breaker.currentState(now) == channelBreakerHalfOpen {
+			halfOpen = true
+			if breaker.canProbe(now) {
+				if rand.Float64() < common.ChannelBreakerHalfOpenRatio && startChannelBreakerProbe(candidate.Id, requestModel) {
+					return candidate, nil
+				}
+				probes = append(probes, candidate)
+			}
+		}
+		excluded = append(excluded, candidate.Id)
+	}
+	for _, probe := range probes {
+		if startChannelBreakerProbe(probe.Id, requestModel) {
+			return probe, nil
+		}
+	}
+	if !halfOpen {
+		return channel, nil
+	}
+	return nil, errChannelBreakerOpen
+}
+
+// filterExcludedChannels 返回去除了被排除渠道后的渠道列表，保持原有的优先级顺序
+func filterExcludedChannels(channels []*Channel, excludedChannelIds []int) []*Channel {
+	if len(excludedChannelIds) == 0 {
+		return channels
+	}
+	filtered := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if !common.IntsContains(excludedChannelIds, channel.Id) {
+			filtered = append(filtered, channel)
+		}
+	}
+	return filtered
 }
 
 func CacheGetChannel(id int) (*Channel, error) {
@@ -0,0 +1,390 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"one-api/common"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 熔断器状态
+const (
+	channelBreakerClosed   = iota // 正常放行
+	channelBreakerOpen            // 熔断中，不再选择该渠道
+	channelBreakerHalfOpen        // 冷却时间已过，放行一小部分请求试探
+)
+
+// channelBreakerBuckets 滑动窗口划分的桶数
+const channelBreakerBuckets = 10
+
+type channelBreakerBucket struct {
+	Time      int64 `json:"t"`
+	Successes int   `json:"s"`
+	Failures  int   `json:"f"`
+}
+
+// errChannelBreakerOpen 没有熔断器放行的渠道，半开状态的渠道试探名额已满
+var errChannelBreakerOpen = errors.New("all channels are open or probing by circuit breakers")
+
+// channelBreaker 一个渠道在一个模型上的熔断器。关闭状态下按滑动窗口统计请求结果，
+// 错误率或连续失败次数达到阈值时熔断；冷却时间过后进入半开状态，试探请求连续成功后恢复，失败则重新熔断。
+// 半开状态下同时进行的试探请求不超过恢复所需的成功次数
+type channelBreaker struct {
+	State               int                    `json:"state"`
+	OpenedAt            int64                  `json:"opened_at"`
+	ConsecutiveFailures int                    `json:"consecutive_failures"`
+	HalfOpenSuccesses   int                    `json:"half_open_successes"`
+	Buckets             []channelBreakerBucket `json:"buckets"`
+	// Probes 半开状态下进行中的试探请求的开始时间，超过冷却时间还没有结果的试探不再占用名额
+	Probes []int64 `json:"probes,omitempty"`
+}
+
+// currentState 返回当前的状态，熔断超过冷却时间后视为半开
+func (b *channelBreaker) currentState(now int64) int {
+	if b.State == channelBreakerOpen && now-b.OpenedAt >= int64(common.ChannelBreakerCooldown) {
+		return channelBreakerHalfOpen
+	}
+	return b.State
+}
+
+// canProbe 返回半开状态下是否还有试探名额
+func (b *channelBreaker) canProbe(now int64) bool {
+	if b.currentState(now) != channelBreakerHalfOpen {
+		return false
+	}
+	probes := 0
+	for _, startedAt := range b.Probes {
+		if now-startedAt < int64(common.ChannelBreakerCooldown) {
+			probes++
+		}
+	}
+	maxProbes := common.ChannelBreakerHalfOpenSuccesses
+	if maxProbes < 1 {
+		maxProbes = 1
+	}
+	return probes < maxProbes
+}
+
+// startProbe 占用一个试探名额，返回是否可以向渠道发送请求。关闭状态下总是可以，熔断中或者试探名额已满时不可以
+func (b *channelBreaker) startProbe(now int64) bool {
+	switch b.currentState(now) {
+	case channelBreakerClosed:
+		return true
+	case channelBreakerHalfOpen:
+		if !b.canProbe(now) {
+			return false
+		}
+		probes := b.Probes[:0]
+		for _, startedAt := range b.Probes {
+			if now-startedAt < int64(common.ChannelBreakerCooldown) {
+				probes = append(probes, startedAt)
+			}
+		}
+		b.Probes = append(probes, now)
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *channelBreaker) open(now int64) {
+	*b = channelBreaker{State: channelBreakerOpen, OpenedAt: now}
+}
+
+// record 记录一次请求的结果，返回记录前后的状态
+func (b *channelBreaker) record(success bool, now int64) (int, int) {
+	state := b.currentState(now)
+	switch state {
+	case channelBreakerOpen:
+		// 熔断前发出的请求的结果，忽略
+		return state, state
+	case channelBreakerHalfOpen:
+		b.State = channelBreakerHalfOpen
+		if len(b.Probes) > 0 {
+			b.Probes = b.Probes[1:]
+		}
+		if !success {
+			b.open(now)
+		} else {
+			b.HalfOpenSuccesses++
+			if b.HalfOpenSuccesses >= common.ChannelBreakerHalfOpenSuccesses {
+				*b = channelBreaker{State: channelBreakerClosed}
+			}
+		}
+		return state, b.State
+	}
+
+	window := int64(common.ChannelBreakerWindow)
+	bucketSize := window / channelBreakerBuckets
+	if bucketSize <= 0 {
+		bucketSize = 1
+	}
+	bucketTime := now / bucketSize * bucketSize
+	buckets := b.Buckets[:0]
+	for _, bucket := range b.Buckets {
+		if bucket.Time > now-window {
+			buckets = append(buckets, bucket)
+		}
+	}
+	if len(buckets) == 0 || buckets[len(buckets)-1].Time != bucketTime {
+		buckets = append(buckets, channelBreakerBucket{Time: bucketTime})
+	}
+	current := &buckets[len(buckets)-1]
+	if success {
+		current.Successes++
+		b.ConsecutiveFailures = 0
+	} else {
+		current.Failures++
+		b.ConsecutiveFailures++
+	}
+	b.Buckets = buckets
+	if success {
+		return state, b.State
+	}
+
+	total, failures := 0, 0
+	for _, bucket := range buckets {
+		total += bucket.Successes + bucket.Failures
+		failures += bucket.Failures
+	}
+	consecutiveTripped := common.ChannelBreakerConsecutiveFailures > 0 && b.ConsecutiveFailures >= common.ChannelBreakerConsecutiveFailures
+	errorRateTripped := total >= common.ChannelBreakerMinRequests && float64(failures) >= common.ChannelBreakerErrorRate*float64(total)
+	if consecutiveTripped || errorRateTripped {
+		b.open(now)
+	}
+	return state, b.State
+}
+
+// channelBreakerStore 保存熔断器状态。启用 Redis 时保存在 Redis 中，多个节点共享同一个熔断器
+type channelBreakerStore interface {
+	get(keys []string) map[string]*channelBreaker
+	update(key string, fn func(breaker *channelBreaker)) error
+}
+
+type memoryChannelBreakerStore struct {
+	lock     sync.Mutex
+	breakers map[string]*channelBreaker
+}
+
+func (s *memoryChannelBreakerStore) get(keys []string) map[string]*channelBreaker {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	breakers := make(map[string]*channelBreaker, len(keys))
+	for _, key := range keys {
+		if breaker, ok := s.breakers[key]; ok {
+			// 切片在 update 中会被原地修改，需要复制
+			breakerCopy := *breaker
+			breakerCopy.Buckets = append([]channelBreakerBucket(nil), breaker.Buckets...)
+			breakerCopy.Probes = append([]int64(nil), breaker.Probes...)
+			breakers[key] = &breakerCopy
+		}
+	}
+	return breakers
+}
+
+func (s *memoryChannelBreakerStore) update(key string, fn func(breaker *channelBreaker)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	breaker, ok := s.breakers[key]
+	if !ok {
+		breaker = &channelBreaker{}
+		s.breakers[key] = breaker
+	}
+	fn(breaker)
+	return nil
+}
+
+type redisChannelBreakerStore struct{}
+
+func (s redisChannelBreakerStore) get(keys []string) map[string]*channelBreaker {
+	breakers := make(map[string]*channelBreaker, len(keys))
+	if len(keys) == 0 {
+		return breakers
+	}
+	values, err := common.RDB.MGet(context.Background(), keys...).Result()
+	if err != nil {
+		common.SysError("failed to get channel breakers from redis: " + err.Error())
+		return breakers
+	}
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		breaker := &channelBreaker{}
+		if err := json.Unmarshal([]byte(data), breaker); err == nil {
+			breakers[keys[i]] = breaker
+		}
+	}
+	return breakers
+}
+
+// update 使用 WATCH 实现乐观锁，多个节点同时修改同一个熔断器时重试
+func (s redisChannelBreakerStore) update(key string, fn func(breaker *channelBreaker)) error {
+	ctx := context.Background()
+	expiration := time.Duration(common.ChannelBreakerWindow+common.ChannelBreakerCooldown) * 2 * time.Second
+	var err error
+	for i := 0; i < 3; i++ {
+		err = common.RDB.Watch(ctx, func(tx *redis.Tx) error {
+			breaker := &channelBreaker{}
+			data, err := tx.Get(ctx, key).Result()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			if data != "" {
+				_ = json.Unmarshal([]byte(data), breaker)
+			}
+			fn(breaker)
+			jsonBytes, err := json.Marshal(breaker)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, string(jsonBytes), expiration)
+				return nil
+			})
+			return err
+		}, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return err
+}
+
+var memoryChannelBreakers = &memoryChannelBreakerStore{breakers: make(map[string]*channelBreaker)}
+
+func getChannelBreakerStore() channelBreakerStore {
+	if common.RedisEnabled {
+		return redisChannelBreakerStore{}
+	}
+	return memoryChannelBreakers
+}
+
+func channelBreakerKey(channelId int, model string) string {
+	return fmt.Sprintf("channel_breaker:%d:%s", channelId, model)
+}
+
+// filterChannelBreaker 去除熔断器不放行的渠道，返回可以选择的渠道和其中需要占用试探名额的半开渠道。
+// 半开状态的渠道在有试探名额时按比例放行，没有关闭状态的渠道时不再按比例；
+// 所有渠道都熔断时仍从全部渠道中选择，避免请求全部失败，但有半开状态的渠道时不选择熔断中的渠道
+func filterChannelBreaker(channels []*Channel, model string) ([]*Channel, map[int]bool) {
+	if !common.ChannelBreakerEnabled || len(channels) == 0 {
+		return channels, nil
+	}
+	keys := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		keys = append(keys, channelBreakerKey(channel.Id, model))
+	}
+	breakers := getChannelBreakerStore().get(keys)
+	now := time.Now().Unix()
+	allowed := make([]*Channel, 0, len(channels))
+	probes := make([]*Channel, 0)
+	probing := make(map[int]bool)
+	halfOpen := false
+	for i, channel := range channels {
+		breaker, ok := breakers[keys[i]]
+		if !ok {
+			allowed = append(allowed, channel)
+			continue
+		}
+		switch breaker.currentState(now) {
+		case channelBreakerClosed:
+			allowed = append(allowed, channel)
+		case channelBreakerHalfOpen:
+			halfOpen = true
+			if !breaker.canProbe(now) {
+				continue
+			}
+			probing[channel.Id] = true
+			probes = append(probes, channel)
+			if rand.Float64() < common.ChannelBreakerHalfOpenRatio {
+				allowed = append(allowed, channel)
+			}
+		}
+	}
+	if len(allowed) == 0 {
+		allowed = probes
+	}
+	if len(allowed) == 0 && !halfOpen {
+		return channels, nil
+	}
+	return allowed, probing
+}
+
+// startChannelBreakerProbe 为选中的半开渠道占用一个试探名额，名额已满或者渠道重新熔断时返回 false
+func startChannelBreakerProbe(channelId int, model string) bool {
+	started := false
+	err := getChannelBreakerStore().update(channelBreakerKey(channelId, model), func(breaker *channelBreaker) {
+		started = breaker.startProbe(time.Now().Unix())
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to start probe of channel #%d model %s: %s", channelId, model, err.Error()))
+		return false
+	}
+	return started
+}
+
+var channelBreakerStateNames = map[int]string{
+	channelBreakerClosed:   "closed",
+	channelBreakerOpen:     "open",
+	channelBreakerHalfOpen: "half_open",
+}
+
+// getChannelBreakerStates 返回渠道在模型上的熔断器状态，未启用熔断时返回空
+func getChannelBreakerStates(channelIds []int, model string) map[int]string {
+	states := make(map[int]string, len(channelIds))
+	if !common.ChannelBreakerEnabled {
+		return states
+	}
+	keys := make([]string, 0, len(channelIds))
+	for _, channelId := range channelIds {
+		keys = append(keys, channelBreakerKey(channelId, model))
+	}
+	breakers := getChannelBreakerStore().get(keys)
+	now := time.Now().Unix()
+	for i, channelId := range channelIds {
+		state := channelBreakerClosed
+		if breaker, ok := breakers[keys[i]]; ok {
+			state = breaker.currentState(now)
+		}
+		states[channelId] = channelBreakerStateNames[state]
+	}
+	return states
+}
+
+// getChannelBreaker 返回渠道在模型上的熔断器，没有记录时返回 nil
+func getChannelBreaker(channelId int, model string) *channelBreaker {
+	key := channelBreakerKey(channelId, model)
+	return getChannelBreakerStore().get([]string{key})[key]
+}
+
+// RecordChannelBreakerResult 记录渠道在模型上的一次请求结果，熔断器状态变化时记录日志
+func RecordChannelBreakerResult(channelId int, model string, success bool) {
+	if !common.ChannelBreakerEnabled {
+		return
+	}
+	var from, to int
+	err := getChannelBreakerStore().update(channelBreakerKey(channelId, model), func(breaker *channelBreaker) {
+		from, to = breaker.record(success, time.Now().Unix())
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to update breaker of channel #%d model %s: %s", channelId, model, err.Error()))
+		return
+	}
+	if from == to {
+		return
+	}
+	switch to {
+	case channelBreakerOpen:
+		common.SysLog(fmt.Sprintf("channel #%d model %s circuit breaker opened", channelId, model))
+	case channelBreakerClosed:
+		common.SysLog(fmt.Sprintf("channel #%d model %s circuit breaker closed", channelId, model))
+	}
+}
@@ -0,0 +1,426 @@
+package model
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"one-api/common"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// setChannelBreakerOptions 设置测试使用的熔断参数，返回恢复原有参数的函数
+func setChannelBreakerOptions(halfOpenRatio float64) func() {
+	enabled, redisEnabled := common.ChannelBreakerEnabled, common.RedisEnabled
+	window, minRequests, errorRate := common.ChannelBreakerWindow, common.ChannelBreakerMinRequests, common.ChannelBreakerErrorRate
+	consecutiveFailures, cooldown := common.ChannelBreakerConsecutiveFailures, common.ChannelBreakerCooldown
+	ratio, successes := common.ChannelBreakerHalfOpenRatio, common.ChannelBreakerHalfOpenSuccesses
+	common.ChannelBreakerEnabled, common.RedisEnabled = true, false
+	common.ChannelBreakerWindow, common.ChannelBreakerMinRequests, common.ChannelBreakerErrorRate = 60, 10, 0.5
+	common.ChannelBreakerConsecutiveFailures, common.ChannelBreakerCooldown = 5, 30
+	common.ChannelBreakerHalfOpenRatio, common.ChannelBreakerHalfOpenSuccesses = halfOpenRatio, 3
+	return func() {
+		common.ChannelBreakerEnabled, common.RedisEnabled = enabled, redisEnabled
+		common.ChannelBreakerWindow, common.ChannelBreakerMinRequests, common.ChannelBreakerErrorRate = window, minRequests, errorRate
+		common.ChannelBreakerConsecutiveFailures, common.ChannelBreakerCooldown = consecutiveFailures, cooldown
+		common.ChannelBreakerHalfOpenRatio, common.ChannelBreakerHalfOpenSuccesses = ratio, successes
+	}
+}
+
+type channelBreakerResult struct {
+	at      int64
+	success bool
+}
+
+// channelBreakerResults 返回在 at 时刻按 pattern 记录的结果，S 为成功，F 为失败
+func channelBreakerResults(at int64, pattern string) []channelBreakerResult {
+	results := make([]channelBreakerResult, 0, len(pattern))
+	for _, result := range pattern {
+		results = append(results, channelBreakerResult{at: at, success: result == 'S'})
+	}
+	return results
+}
+
+func joinChannelBreakerResults(results ...[]channelBreakerResult) []channelBreakerResult {
+	var joined []channelBreakerResult
+	for _, result := range results {
+		joined = append(joined, result...)
+	}
+	return joined
+}
+
+func TestChannelBreakerRecord(t *testing.T) {
+	defer setChannelBreakerOptions(0.1)()
+	tests := []struct {
+		name    string
+		results []channelBreakerResult
+		at      int64
+		want    int
+	}{
+		{name: "error rate over the window", results: channelBreakerResults(0, "SFSFSFSFSF"), at: 1, want: channelBreakerOpen},
+		{name: "below min requests", results: channelBreakerResults(0, "SFSFFSF"), at: 1, want: channelBreakerClosed},
+		{name: "consecutive failures", results: channelBreakerResults(0, "FFFFF"), at: 1, want: channelBreakerOpen},
+		{name: "success resets consecutive failures", results: channelBreakerResults(0, "FFFFSFFFF"), at: 1, want: channelBreakerClosed},
+		{
+			name:    "failures outside the window",
+			results: joinChannelBreakerResults(channelBreakerResults(0, "SFSFSFSFS"), channelBreakerResults(100, "F")),
+			at:      101,
+			want:    channelBreakerClosed,
+		},
+		{name: "open during cooldown", results: channelBreakerResults(0, "FFFFF"), at: 29, want: channelBreakerOpen},
+		{name: "half-open after cooldown", results: channelBreakerResults(0, "FFFFF"), at: 30, want: channelBreakerHalfOpen},
+		{
+			name:    "results while open are ignored",
+			results: joinChannelBreakerResults(channelBreakerResults(0, "FFFFF"), channelBreakerResults(10, "SSS")),
+			at:      30,
+			want:    channelBreakerHalfOpen,
+		},
+		{
+			name:    "half-open successes close",
+			results: joinChannelBreakerResults(channelBreakerResults(0, "FFFFF"), channelBreakerResults(30, "SSS")),
+			at:      31,
+			want:    channelBreakerClosed,
+		},
+		{
+			name:    "half-open needs enough successes",
+			results: joinChannelBreakerResults(channelBreakerResults(0, "FFFFF"), channelBreakerResults(30, "SS")),
+			at:      31,
+			want:    channelBreakerHalfOpen,
+		},
+		{
+			name:    "half-open failure reopens",
+			results: joinChannelBreakerResults(channelBreakerResults(0, "FFFFF"), channelBreakerResults(30, "SF")),
+			at:      59,
+			want:    channelBreakerOpen,
+		},
+		{
+			name:    "reopened breaker cools down again",
+			results: joinChannelBreakerResults(channelBreakerResults(0, "FFFFF"), channelBreakerResults(30, "SF")),
+			at:      60,
+			want:    channelBreakerHalfOpen,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker := &channelBreaker{}
+			for _, result := range test.results {
+				breaker.record(result.success, result.at)
+			}
+			if got := breaker.currentState(test.at); got != test.want {
+				t.Errorf("state = %s, want %s", channelBreakerStateNames[got], channelBreakerStateNames[test.want])
+			}
+		})
+	}
+}
+
+func TestChannelBreakerProbes(t *testing.T) {
+	defer setChannelBreakerOptions(0.1)()
+	breaker := &channelBreaker{}
+	if !breaker.startProbe(0) {
+		t.Error("startProbe() on a closed breaker = false, want true")
+	}
+	breaker.open(0)
+	if breaker.startProbe(10) {
+		t.Error("startProbe() on an open breaker = true, want false")
+	}
+	// 半开状态下同时进行的试探不超过恢复所需的成功次数
+	for i := 0; i < 3; i++ {
+		if !breaker.startProbe(30) {
+			t.Fatalf("startProbe() %d = false, want true", i)
+		}
+	}
+	if breaker.canProbe(30) || breaker.startProbe(30) {
+		t.Error("fourth probe started, want probes limited to 3")
+	}
+	// 试探有结果后释放名额
+	breaker.record(true, 31)
+	if !breaker.startProbe(31) {
+		t.Error("startProbe() after a probe finished = false, want true")
+	}
+	if breaker.startProbe(31) {
+		t.Error("startProbe() = true, want probes limited to 3")
+	}
+	// 超过冷却时间还没有结果的试探不再占用名额
+	if !breaker.startProbe(61) {
+		t.Error("startProbe() after stale probes = false, want true")
+	}
+}
+
+func TestFilterChannelBreaker(t *testing.T) {
+	now := time.Now().Unix()
+	open := func() *channelBreaker {
+		return &channelBreaker{State: channelBreakerOpen, OpenedAt: now}
+	}
+	halfOpen := func(probes ...int64) *channelBreaker {
+		return &channelBreaker{State: channelBreakerOpen, OpenedAt: now - 30, Probes: probes}
+	}
+	tests := []struct {
+		name          string
+		halfOpenRatio float64
+		breakers      map[int]*channelBreaker
+		want          []int
+		wantProbing   []int
+	}{
+		{name: "no breakers", breakers: map[int]*channelBreaker{}, want: []int{1, 2, 3}},
+		{name: "skip open", breakers: map[int]*channelBreaker{1: open()}, want: []int{2, 3}},
+		{name: "all open", breakers: map[int]*channelBreaker{1: open(), 2: open(), 3: open()}, want: []int{1, 2, 3}},
+		{
+			name:          "half-open not drawn",
+			halfOpenRatio: 0,
+			breakers:      map[int]*channelBreaker{2: halfOpen(), 3: open()},
+			want:          []int{1},
+			wantProbing:   []int{2},
+		},
+		{
+			name:          "half-open drawn",
+			halfOpenRatio: 1,
+			breakers:      map[int]*channelBreaker{2: halfOpen(), 3: open()},
+			want:          []int{1, 2},
+			wantProbing:   []int{2},
+		},
+		{
+			// 其他渠道都熔断时，半开的渠道不再按比例放行，也不选择熔断中的渠道
+			name:          "half-open among open",
+			halfOpenRatio: 0,
+			breakers:      map[int]*channelBreaker{1: open(), 2: halfOpen(), 3: open()},
+			want:          []int{2},
+			wantProbing:   []int{2},
+		},
+		{
+			name:          "half-open probes full",
+			halfOpenRatio: 1,
+			breakers:      map[int]*channelBreaker{1: open(), 2: halfOpen(now, now, now), 3: open()},
+			want:          []int{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer setChannelBreakerOptions(test.halfOpenRatio)()
+			memoryChannelBreakers = &memoryChannelBreakerStore{breakers: make(map[string]*channelBreaker)}
+			for channelId, breaker := range test.breakers {
+				memoryChannelBreakers.breakers[channelBreakerKey(channelId, "gpt-4o")] = breaker
+			}
+			channels := []*Channel{{Id: 1}, {Id: 2}, {Id: 3}}
+			allowed, probing := filterChannelBreaker(channels, "gpt-4o")
+			got := make([]int, 0, len(allowed))
+			for _, channel := range allowed {
+				got = append(got, channel.Id)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("allowed = %v, want %v", got, test.want)
+			}
+			gotProbing := make([]int, 0)
+			for _, channel := range channels {
+				if probing[channel.Id] {
+					gotProbing = append(gotProbing, channel.Id)
+				}
+			}
+			if len(gotProbing) != 0 || len(test.wantProbing) != 0 {
+				if !reflect.DeepEqual(gotProbing, test.wantProbing) {
+					t.Errorf("probing = %v, want %v", gotProbing, test.wantProbing)
+				}
+			}
+		})
+	}
+}
+
+// fakeRedis 只实现熔断器用到的命令的 Redis 服务。beforeExec 在执行 EXEC 之前调用，
+// 可以在这里修改被 WATCH 的键，模拟其他节点同时修改
+type fakeRedis struct {
+	listener   net.Listener
+	lock       sync.Mutex
+	values     map[string]string
+	versions   map[string]int
+	beforeExec func(r *fakeRedis)
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{listener: listener, values: make(map[string]string), versions: make(map[string]int)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) set(key string, value string) {
+	r.values[key] = value
+	r.versions[key]++
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	watched := make(map[string]int)
+	var queued [][]string
+	inMulti := false
+	for {
+		args, err := readRedisCommand(reader)
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(args[0])
+		if inMulti && command != "EXEC" {
+			queued = append(queued, args)
+			_, _ = conn.Write([]byte("+QUEUED\r\n"))
+			continue
+		}
+		r.lock.Lock()
+		switch command {
+		case "WATCH":
+			for _, key := range args[1:] {
+				watched[key] = r.versions[key]
+			}
+			_, _ = conn.Write([]byte("+OK\r\n"))
+		case "UNWATCH":
+			watched = make(map[string]int)
+			_, _ = conn.Write([]byte("+OK\r\n"))
+		case "MULTI":
+			inMulti = true
+			_, _ = conn.Write([]byte("+OK\r\n"))
+		case "GET":
+			_, _ = conn.Write([]byte(redisBulk(r.values, args[1])))
+		case "MGET":
+			reply := fmt.Sprintf("*%d\r\n", len(args)-1)
+			for _, key := range args[1:] {
+				reply += redisBulk(r.values, key)
+			}
+			_, _ = conn.Write([]byte(reply))
+		case "SET":
+			r.set(args[1], args[2])
+			_, _ = conn.Write([]byte("+OK\r\n"))
+		case "EXEC":
+			if r.beforeExec != nil {
+				r.beforeExec(r)
+			}
+			conflict := false
+			for key, version := range watched {
+				if r.versions[key] != version {
+					conflict = true
+				}
+			}
+			if conflict {
+				_, _ = conn.Write([]byte("*-1\r\n"))
+			} else {
+				reply := fmt.Sprintf("*%d\r\n", len(queued))
+				for _, args := range queued {
+					r.set(args[1], args[2])
+					reply += "+OK\r\n"
+				}
+				_, _ = conn.Write([]byte(reply))
+			}
+			inMulti, queued, watched = false, nil, make(map[string]int)
+		default:
+			_, _ = conn.Write([]byte("-ERR unknown command\r\n"))
+		}
+		r.lock.Unlock()
+	}
+}
+
+func redisBulk(values map[string]string, key string) string {
+	value, ok := values[key]
+	if !ok {
+		return "$-1\r\n"
+	}
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+}
+
+func readRedisCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args = append(args, string(data[:size]))
+	}
+	return args, nil
+}
+
+func TestRedisChannelBreakerStoreUpdate(t *testing.T) {
+	defer setChannelBreakerOptions(0.1)()
+	server := newFakeRedis(t)
+	defer server.listener.Close()
+	rdb := common.RDB
+	common.RedisEnabled = true
+	common.RDB = redis.NewClient(&redis.Options{Addr: server.listener.Addr().String()})
+	defer func() {
+		_ = common.RDB.Close()
+		common.RDB = rdb
+	}()
+	key := channelBreakerKey(1, "gpt-4o")
+	concurrent, _ := json.Marshal(channelBreaker{ConsecutiveFailures: 4})
+
+	tests := []struct {
+		name string
+		// conflicts 前几次 EXEC 之前其他节点写入了熔断器
+		conflicts int
+		wantErr   bool
+		wantState int
+	}{
+		// 重试时基于其他节点写入的状态记录失败，连续失败次数达到 5 次后熔断
+		{name: "retry after a concurrent write", conflicts: 1, wantState: channelBreakerOpen},
+		{name: "give up after three conflicts", conflicts: 3, wantErr: true, wantState: channelBreakerClosed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server.lock.Lock()
+			server.values, server.versions = make(map[string]string), make(map[string]int)
+			conflicts := test.conflicts
+			server.beforeExec = func(r *fakeRedis) {
+				if conflicts > 0 {
+					conflicts--
+					r.set(key, string(concurrent))
+				}
+			}
+			server.lock.Unlock()
+
+			err := redisChannelBreakerStore{}.update(key, func(breaker *channelBreaker) {
+				breaker.record(false, time.Now().Unix())
+			})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("update() error = %v, wantErr %v", err, test.wantErr)
+			}
+			breaker := getChannelBreaker(1, "gpt-4o")
+			if breaker == nil {
+				t.Fatal("breaker not found in redis")
+			}
+			if got := breaker.currentState(time.Now().Unix()); got != test.wantState {
+				t.Errorf("state = %s, want %s", channelBreakerStateNames[got], channelBreakerStateNames[test.wantState])
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"one-api/common"
+	"strings"
+	"sync"
+)
+
+// ChannelKeyStatus 多密钥渠道中一个密钥的状态。按密钥的指纹保存，编辑渠道调整密钥顺序后状态不会错位
+type ChannelKeyStatus struct {
+	Status        int    `json:"status"`
+	ErrorCount    int    `json:"error_count"`
+	LastError     string `json:"last_error"`
+	LastErrorTime int64  `json:"last_error_time"`
+}
+
+// ChannelKeyInfo 管理接口中一个密钥的健康状态，密钥只显示首尾几位
+type ChannelKeyInfo struct {
+	Index int    `json:"index"`
+	Key   string `json:"key"`
+	ChannelKeyStatus
+}
+
+var (
+	// channelKeyLock 保护渠道对象的 KeyStatus 字段和轮询位置，内存缓存中的渠道对象会被多个请求共享
+	channelKeyLock    sync.RWMutex
+	channelKeyCursors = make(map[int]int)
+	// channelKeyUpdateLocks 每个渠道一个锁，同一个渠道的密钥状态按顺序读取、修改和保存，避免并发修改互相覆盖
+	channelKeyUpdateLocks sync.Map
+)
+
+// GetKeys 返回渠道的所有密钥。密钥一行一个，Vertex AI 的服务账号密钥本身包含换行，总是作为一个密钥
+func (channel *Channel) GetKeys() []string {
+	if channel.Type == common.ChannelTypeVertexAi {
+		return []string{channel.Key}
+	}
+	keys := make([]string, 0, 1)
+	for _, key := range strings.Split(channel.Key, "\n") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// IsMultiKey 判断渠道是否配置了多个密钥
+func (channel *Channel) IsMultiKey() bool {
+	return len(channel.GetKeys()) > 1
+}
+
+func (channel *Channel) GetMultiKeyMode() string {
+	if channel.MultiKeyMode == nil || *channel.MultiKeyMode == "" {
+		return common.ChannelMultiKeyModeRoundRobin
+	}
+	return *channel.MultiKeyMode
+}
+
+func channelKeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func parseChannelKeyStatus(keyStatus string) map[string]*ChannelKeyStatus {
+	statuses := make(map[string]*ChannelKeyStatus)
+	if keyStatus != "" {
+		err := json.Unmarshal([]byte(keyStatus), &statuses)
+		if err != nil {
+			common.SysError("failed to unmarshal channel key status: " + err.Error())
+		}
+	}
+	return statuses
+}
+
+func (channel *Channel) getKeyStatuses() map[string]*ChannelKeyStatus {
+	channelKeyLock.RLock()
+	keyStatus := channel.KeyStatus
+	channelKeyLock.RUnlock()
+	return parseChannelKeyStatus(keyStatus)
+}
+
+// SelectKey 按渠道设置的方式从启用的密钥中选择一个，返回密钥和它的序号。
+// 所有密钥都被禁用时（此时渠道本身也会被禁用）从全部密钥中选择
+func (channel *Channel) SelectKey() (string, int) {
+	keys := channel.GetKeys()
+	if len(keys) <= 1 {
+		return strings.TrimSpace(channel.Key), 0
+	}
+	statuses := channel.getKeyStatuses()
+	enabled := make([]int, 0, len(keys))
+	for i, key := range keys {
+		status, ok := statuses[channelKeyFingerprint(key)]
+		if !ok || status.Status == common.ChannelStatusEnabled {
+			enabled = append(enabled, i)
+		}
+	}
+	if len(enabled) == 0 {
+		for i := range keys {
+			enabled = append(enabled, i)
+		}
+	}
+	var index int
+	if channel.GetMultiKeyMode() == common.ChannelMultiKeyModeRandom {
+		index = enabled[rand.Intn(len(enabled))]
+	} else {
+		channelKeyLock.Lock()
+		cursor := channelKeyCursors[channel.Id]
+		channelKeyCursors[channel.Id] = cursor + 1
+		channelKeyLock.Unlock()
+		index = enabled[cursor%len(enabled)]
+	}
+	return keys[index], index
+}
+
+// GetKey 返回指定序号的密钥，用于后续请求必须使用提交任务时同一个密钥的场景。
+// 渠道的密钥被修改后序号不存在时按渠道设置的方式重新选择
+func (channel *Channel) GetKey(index int) (string, int) {
+	keys := channel.GetKeys()
+	if index >= 0 && index < len(keys) {
+		return keys[index], index
+	}
+	return channel.SelectKey()
+}
+
+// GetKeyInfos 返回渠道中所有密钥的健康状态
+func (channel *Channel) GetKeyInfos() []ChannelKeyInfo {
+	keys := channel.GetKeys()
+	statuses := channel.getKeyStatuses()
+	infos := make([]ChannelKeyInfo, 0, len(keys))
+	for i, key := range keys {
+		info := ChannelKeyInfo{
+			Index:            i,
+			Key:              maskChannelKey(key),
+			ChannelKeyStatus: ChannelKeyStatus{Status: common.ChannelStatusEnabled},
+		}
+		if status, ok := statuses[channelKeyFingerprint(key)]; ok {
+			info.ChannelKeyStatus = *status
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func maskChannelKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
+
+// updateChannelKeyStatus 修改渠道中一个密钥的状态并保存，同时更新内存缓存中的渠道对象，修改立即对之后的请求生效。
+// 返回修改后是否所有密钥都已被禁用
+func updateChannelKeyStatus(channelId int, keyIndex int, update func(status *ChannelKeyStatus)) (bool, error) {
+	// 读写数据库时只锁住当前渠道，不阻塞其他渠道选择密钥
+	updateLock, _ := channelKeyUpdateLocks.LoadOrStore(channelId, &sync.Mutex{})
+	updateLock.(*sync.Mutex).Lock()
+	defer updateLock.(*sync.Mutex).Unlock()
+	channel, err := GetChannelById(channelId, true)
+	if err != nil {
+		return false, err
+	}
+	keys := channel.GetKeys()
+	if keyIndex < 0 || keyIndex >= len(keys) {
+		return false, errors.New(fmt.Sprintf("渠道 #%d 不存在序号为 %d 的密钥", channelId, keyIndex))
+	}
+	statuses := parseChannelKeyStatus(channel.KeyStatus)
+	fingerprint := channelKeyFingerprint(keys[keyIndex])
+	status, ok := statuses[fingerprint]
+	if !ok {
+		status = &ChannelKeyStatus{Status: common.ChannelStatusEnabled}
+		statuses[fingerprint] = status
+	}
+	update(status)
+
+	// 只保留现有密钥的状态，删除已经从渠道中移除的密钥
+	allDisabled := true
+	keyStatuses := make(map[string]*ChannelKeyStatus, len(keys))
+	for _, key := range keys {
+		fingerprint := channelKeyFingerprint(key)
+		keyStatus, ok := statuses[fingerprint]
+		if ok {
+			keyStatuses[fingerprint] = keyStatus
+		}
+		if !ok || keyStatus.Status == common.ChannelStatusEnabled {
+			allDisabled = false
+		}
+	}
+	jsonBytes, err := json.Marshal(keyStatuses)
+	if err != nil {
+		return false, err
+	}
+	err = DB.Model(&Channel{}).Where("id = ?", channelId).Update("key_status", string(jsonBytes)).Error
+	if err != nil {
+		return false, err
+	}
+	if common.MemoryCacheEnabled {
+		channelSyncLock.RLock()
+		if cachedChannel, ok := channelsIDM[channelId]; ok {
+			channelKeyLock.Lock()
+			cachedChannel.KeyStatus = string(jsonBytes)
+			channelKeyLock.Unlock()
+		}
+		channelSyncLock.RUnlock()
+	}
+	return allDisabled, nil
+}
+
+// RecordChannelKeyError 记录多密钥渠道中一个密钥的错误，disable 为 true 时同时自动禁用该密钥。
+// 返回是否所有密钥都已被禁用
+func RecordChannelKeyError(channelId int, keyIndex int, message string, disable bool) (bool, error) {
+	return updateChannelKeyStatus(channelId, keyIndex, func(status *ChannelKeyStatus) {
+		status.ErrorCount++
+		status.LastError = message
+		status.LastErrorTime = common.GetTimestamp()
+		if disable {
+			status.Status = common.ChannelStatusAutoDisabled
+		}
+	})
+}
+
+// UpdateChannelKeyStatus 手动启用或禁用多密钥渠道中的一个密钥，启用时清空错误计数
+func UpdateChannelKeyStatus(channelId int, keyIndex int, status int) error {
+	_, err := updateChannelKeyStatus(channelId, keyIndex, func(keyStatus *ChannelKeyStatus) {
+		keyStatus.Status = status
+		if status == common.ChannelStatusEnabled {
+			keyStatus.ErrorCount = 0
+		}
+	})
+	return err
+}
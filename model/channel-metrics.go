@@ -0,0 +1,285 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"one-api/common"
+	"strings"
+	"sync"
+	"time"
+)
+
+// channelMetricsAlpha 指数加权移动平均中新样本的权重
+const channelMetricsAlpha = 0.3
+
+// channelMetricsExpiration 超过这个时间没有新样本时，延迟和错误率视为未知，
+// 按延迟或错误率选择时未知的渠道优先，长时间没有被选中的渠道因此会重新得到请求
+const channelMetricsExpiration = 60 * time.Second
+
+// channelMetricsErrorPenalty 按延迟选择时错误率折算的延迟（毫秒），相当于每次失败额外花费的时间，
+// 失败的请求需要更换渠道重试，错误率高的渠道即使返回很快也会排到后面
+const channelMetricsErrorPenalty = 10000.0
+
+type channelMetricsKey struct {
+	channelId int
+	model     string
+}
+
+// channelMetrics 渠道在一个模型上的实时指标，只保存在当前节点的内存中
+type channelMetrics struct {
+	inFlight   int
+	latency    float64 // 毫秒
+	hasLatency bool    // 当前样本窗口内是否有成功请求的延迟
+	errorRate  float64
+	requests   int64
+	lastSample time.Time
+}
+
+var (
+	channelMetricsLock sync.Mutex
+	channelMetricsMap  = make(map[channelMetricsKey]*channelMetrics)
+)
+
+func getChannelMetrics(channelId int, model string) *channelMetrics {
+	key := channelMetricsKey{channelId: channelId, model: model}
+	metrics, ok := channelMetricsMap[key]
+	if !ok {
+		metrics = &channelMetrics{}
+		channelMetricsMap[key] = metrics
+	}
+	return metrics
+}
+
+// ChannelRequestStarted 记录渠道开始处理一个请求
+func ChannelRequestStarted(channelId int, model string) {
+	channelMetricsLock.Lock()
+	defer channelMetricsLock.Unlock()
+	getChannelMetrics(channelId, model).inFlight++
+}
+
+// ChannelRequestFinished 记录渠道处理完一个请求，成功的请求计入延迟，所有请求计入错误率
+func ChannelRequestFinished(channelId int, model string, latency time.Duration, success bool) {
+	channelMetricsLock.Lock()
+	defer channelMetricsLock.Unlock()
+	metrics := getChannelMetrics(channelId, model)
+	if metrics.inFlight > 0 {
+		metrics.inFlight--
+	}
+	metrics.record(latency, success)
+}
+
+// ChannelRequestObserved 记录渠道一个请求的延迟和结果，但不结束计数。
+// 用于对冲请求中落败的请求，它的计数由发起请求的一方结束
+func ChannelRequestObserved(channelId int, model string, latency time.Duration, success bool) {
+	channelMetricsLock.Lock()
+	defer channelMetricsLock.Unlock()
+	getChannelMetrics(channelId, model).record(latency, success)
+}
+
+// record 将一个样本计入延迟和错误率的指数加权移动平均，超过样本窗口时重新开始计算
+func (metrics *channelMetrics) record(latency time.Duration, success bool) {
+	now := time.Now()
+	expired := now.Sub(metrics.lastSample) > channelMetricsExpiration
+	errorValue := 0.0
+	if !success {
+		errorValue = 1
+	}
+	if expired {
+		metrics.errorRate = errorValue
+	} else {
+		metrics.errorRate += channelMetricsAlpha * (errorValue - metrics.errorRate)
+	}
+	if success {
+		latencyValue := float64(latency.Milliseconds())
+		if expired || !metrics.hasLatency {
+			metrics.latency = latencyValue
+		} else {
+			metrics.latency += channelMetricsAlpha * (latencyValue - metrics.latency)
+		}
+		metrics.hasLatency = true
+	} else if expired {
+		metrics.latency = 0
+		metrics.hasLatency = false
+	}
+	metrics.requests++
+	metrics.lastSample = now
+}
+
+// latencyScore 按延迟选择时的得分：延迟加上错误率折算的延迟。
+// 样本窗口内只有失败的请求时没有延迟可比较，得分最差，否则只返回错误的渠道会因为延迟为 0 而总是被优先选择
+func (metrics *channelMetrics) latencyScore() float64 {
+	if !metrics.hasLatency {
+		return math.MaxFloat64
+	}
+	return metrics.latency + metrics.errorRate*channelMetricsErrorPenalty
+}
+
+// ChannelRequestAborted 记录渠道的请求结束但结果不计入指标，比如客户端取消或者请求本身有误
+func ChannelRequestAborted(channelId int, model string) {
+	channelMetricsLock.Lock()
+	defer channelMetricsLock.Unlock()
+	metrics := getChannelMetrics(channelId, model)
+	if metrics.inFlight > 0 {
+		metrics.inFlight--
+	}
+}
+
+// channelStrategyScores 返回渠道在选择策略下的得分，得分越低越优先。按权重随机选择时返回 nil
+func channelStrategyScores(strategy string, channelIds []int, model string) []float64 {
+	if strategy == common.ChannelSelectWeightedRandom {
+		return nil
+	}
+	channelMetricsLock.Lock()
+	defer channelMetricsLock.Unlock()
+	now := time.Now()
+	scores := make([]float64, len(channelIds))
+	for i, channelId := range channelIds {
+		metrics, ok := channelMetricsMap[channelMetricsKey{channelId: channelId, model: model}]
+		if !ok {
+			continue
+		}
+		switch strategy {
+		case common.ChannelSelectLeastInFlight:
+			scores[i] = float64(metrics.inFlight)
+		case common.ChannelSelectEWMALatency:
+			if now.Sub(metrics.lastSample) <= channelMetricsExpiration {
+				scores[i] = metrics.latencyScore()
+			}
+		case common.ChannelSelectLowestErrorRate:
+			if now.Sub(metrics.lastSample) <= channelMetricsExpiration {
+				scores[i] = metrics.errorRate
+			}
+		}
+	}
+	return scores
+}
+
+// selectChannelsByStrategy 返回按选择策略应当从中选择的渠道下标，即得分最低的渠道，得分相同的渠道之间再按权重随机选择。
+// 按权重随机选择时返回所有渠道
+func selectChannelsByStrategy(strategy string, channelIds []int, model string) []int {
+	indexes := make([]int, 0, len(channelIds))
+	scores := channelStrategyScores(strategy, channelIds, model)
+	for i := range channelIds {
+		switch {
+		case scores == nil || len(indexes) == 0 || scores[i] == scores[indexes[0]]:
+			indexes = append(indexes, i)
+		case scores[i] < scores[indexes[0]]:
+			indexes = append(indexes[:0], i)
+		}
+	}
+	return indexes
+}
+
+// ChannelScore 管理接口中渠道的实时指标和在当前选择策略下的得分
+type ChannelScore struct {
+	ChannelId    int     `json:"channel_id"`
+	ChannelName  string  `json:"channel_name"`
+	Priority     int64   `json:"priority"`
+	Weight       uint    `json:"weight"`
+	InFlight     int     `json:"in_flight"`
+	Latency      float64 `json:"latency"`
+	ErrorRate    float64 `json:"error_rate"`
+	Requests     int64   `json:"requests"`
+	BreakerState string  `json:"breaker_state"`
+	// Score 按权重随机选择时为权重，其他策略下为比较的指标，越低越优先
+	Score float64 `json:"score"`
+	// Candidate 当前是否会从该渠道中选择：属于可用的最高优先级，并且在选择策略下得分最低
+	Candidate bool `json:"candidate"`
+}
+
+// GetChannelScores 返回分组和模型下所有启用渠道的实时指标和得分，按优先级从高到低排列
+func GetChannelScores(group string, model string) (string, []ChannelScore, error) {
+	strategy := common.GetChannelSelectStrategy(group, model)
+	abilityModel := model
+	if strings.HasPrefix(abilityModel, "gpt-4-gizmo") {
+		abilityModel = "gpt-4-gizmo-*"
+	}
+	groupCol := "`group`"
+	trueVal := "1"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+		trueVal = "true"
+	}
+	var abilities []Ability
+	err := DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, abilityModel).Order("priority DESC").Find(&abilities).Error
+	if err != nil {
+		return strategy, nil, err
+	}
+	if len(abilities) == 0 {
+		return strategy, nil, errors.New("channel not found")
+	}
+	channelIds := make([]int, 0, len(abilities))
+	for _, ability := range abilities {
+		channelIds = append(channelIds, ability.ChannelId)
+	}
+	var channels []*Channel
+	err = DB.Where("id in (?)", channelIds).Find(&channels).Error
+	if err != nil {
+		return strategy, nil, err
+	}
+	channelNames := make(map[int]string, len(channels))
+	for _, channel := range channels {
+		channelNames[channel.Id] = channel.Name
+	}
+
+	breakerStates := getChannelBreakerStates(channelIds, model)
+	scores := make([]ChannelScore, 0, len(abilities))
+	channelMetricsLock.Lock()
+	now := time.Now()
+	for _, ability := range abilities {
+		score := ChannelScore{
+			ChannelId:    ability.ChannelId,
+			ChannelName:  channelNames[ability.ChannelId],
+			Weight:       ability.Weight,
+			BreakerState: breakerStates[ability.ChannelId],
+		}
+		if ability.Priority != nil {
+			score.Priority = *ability.Priority
+		}
+		if metrics, ok := channelMetricsMap[channelMetricsKey{channelId: ability.ChannelId, model: model}]; ok {
+			score.InFlight = metrics.inFlight
+			score.Requests = metrics.requests
+			if now.Sub(metrics.lastSample) <= channelMetricsExpiration {
+				score.Latency = metrics.latency
+				score.ErrorRate = metrics.errorRate
+			}
+		}
+		scores = append(scores, score)
+	}
+	channelMetricsLock.Unlock()
+
+	// 与选择渠道时相同：跳过熔断中的渠道（全部熔断时不跳过），在最高优先级中按策略选出得分最低的渠道
+	available := make([]int, 0, len(scores))
+	for i := range scores {
+		if scores[i].BreakerState != channelBreakerStateNames[channelBreakerOpen] {
+			available = append(available, i)
+		}
+	}
+	if len(available) == 0 {
+		for i := range scores {
+			available = append(available, i)
+		}
+	}
+	topPriority := scores[available[0]].Priority
+	topIds := make([]int, 0, len(available))
+	topIndexes := make([]int, 0, len(available))
+	for _, i := range available {
+		// 内存缓存中最高优先级不大于 0 时不区分优先级
+		if scores[i].Priority == topPriority || (common.MemoryCacheEnabled && topPriority <= 0) {
+			topIds = append(topIds, scores[i].ChannelId)
+			topIndexes = append(topIndexes, i)
+		}
+	}
+	for _, i := range selectChannelsByStrategy(strategy, topIds, model) {
+		scores[topIndexes[i]].Candidate = true
+	}
+	strategyScores := channelStrategyScores(strategy, channelIds, model)
+	for i := range scores {
+		if strategyScores == nil {
+			scores[i].Score = float64(scores[i].Weight)
+		} else {
+			scores[i].Score = strategyScores[i]
+		}
+	}
+	return strategy, scores, nil
+}
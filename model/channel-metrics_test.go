@@ -0,0 +1,95 @@
+package model
+
+import (
+	"one-api/common"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type channelMetricsSample struct {
+	channelId int
+	latency   time.Duration
+	success   bool
+	// expired 记录这个样本时上一个样本已经超过样本窗口
+	expired bool
+}
+
+func TestSelectChannelsByEWMALatency(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []channelMetricsSample
+		want    []int
+	}{
+		{
+			name: "fast errors only",
+			samples: []channelMetricsSample{
+				{channelId: 1, latency: 5 * time.Millisecond},
+				{channelId: 2, latency: 800 * time.Millisecond, success: true},
+			},
+			want: []int{1},
+		},
+		{
+			name: "failure after the sample window expired",
+			samples: []channelMetricsSample{
+				{channelId: 1, latency: 100 * time.Millisecond, success: true},
+				{channelId: 2, latency: 800 * time.Millisecond, success: true},
+				{channelId: 1, latency: 5 * time.Millisecond, expired: true},
+			},
+			want: []int{1},
+		},
+		{
+			name: "error rate outweighs latency",
+			samples: []channelMetricsSample{
+				{channelId: 1, latency: 100 * time.Millisecond, success: true},
+				{channelId: 1, latency: 100 * time.Millisecond},
+				{channelId: 2, latency: 800 * time.Millisecond, success: true},
+			},
+			want: []int{1},
+		},
+		{
+			name: "lower latency wins",
+			samples: []channelMetricsSample{
+				{channelId: 1, latency: 100 * time.Millisecond, success: true},
+				{channelId: 2, latency: 800 * time.Millisecond, success: true},
+			},
+			want: []int{0},
+		},
+		{
+			name: "unknown channel is tried first",
+			samples: []channelMetricsSample{
+				{channelId: 1, latency: 100 * time.Millisecond, success: true},
+			},
+			want: []int{1},
+		},
+		{
+			name: "all channels failing",
+			samples: []channelMetricsSample{
+				{channelId: 1, latency: 5 * time.Millisecond},
+				{channelId: 2, latency: 5 * time.Millisecond},
+			},
+			want: []int{0, 1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			channelMetricsLock.Lock()
+			channelMetricsMap = make(map[channelMetricsKey]*channelMetrics)
+			channelMetricsLock.Unlock()
+			for _, sample := range test.samples {
+				ChannelRequestStarted(sample.channelId, "gpt-4o")
+				if sample.expired {
+					channelMetricsLock.Lock()
+					getChannelMetrics(sample.channelId, "gpt-4o").lastSample = time.Now().Add(-2 * channelMetricsExpiration)
+					channelMetricsLock.Unlock()
+				}
+				ChannelRequestFinished(sample.channelId, "gpt-4o", sample.latency, sample.success)
+			}
+			// 下标 0 为渠道 1，下标 1 为渠道 2
+			got := selectChannelsByStrategy(common.ChannelSelectEWMALatency, []int{1, 2}, "gpt-4o")
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("selectChannelsByStrategy() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
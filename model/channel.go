@@ -26,6 +26,12 @@ type Channel struct {
 	ModelMapping       *string `json:"model_mapping" gorm:"type:varchar(1024);default:''"`
 	Priority           *int64  `json:"priority" gorm:"bigint;default:0"`
 	AutoBan            *int    `json:"auto_ban" gorm:"default:1"`
+	FirstTokenTimeout  *int    `json:"first_token_timeout" gorm:"default:0"` // 流式请求等待第一个数据块的超时时间，单位秒，0 表示使用默认值
+	IdleTimeout        *int    `json:"idle_timeout" gorm:"default:0"`        // 流式响应两个数据块之间的超时时间，单位秒，0 表示使用默认值
+	TotalTimeout       *int    `json:"total_timeout" gorm:"default:0"`       // 整个请求的超时时间，单位秒，0 表示使用默认值
+	StreamMode         *string `json:"stream_mode" gorm:"default:''"`        // 上游流式模式，参见 common.StreamModeNonStream，为空时使用模型的设置
+	MultiKeyMode       *string `json:"multi_key_mode" gorm:"default:''"`     // 多密钥渠道选择密钥的方式，参见 common.ChannelMultiKeyModeRandom，为空时轮询
+	KeyStatus          string  `json:"-" gorm:"type:text"`                   // 多密钥渠道中各个密钥的状态，为 JSON 文本，参见 ChannelKeyStatus
 }
 
 func GetAllChannels(startIdx int, num int, selectAll bool, idSort bool) ([]*Channel, error) {
@@ -89,21 +95,6 @@ func GetChannelById(id int, selectAll bool) (*Channel, error) {
 	return &channel, err
 }
 
-func BatchInsertChannels(channels []Channel) error {
-	var err error
-	err = DB.Create(&channels).Error
-	if err != nil {
-		return err
-	}
-	for _, channel_ := range channels {
-		err = channel_.AddAbilities()
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func BatchDeleteChannels(ids []int) error {
 	//使用事务 删除channel表和channel_ability表
 	tx := DB.Begin()
@@ -138,6 +129,38 @@ func (channel *Channel) GetWeight() int {
 	return int(*channel.Weight)
 }
 
+// GetFirstTokenTimeout 返回渠道的首个数据块超时时间（秒），未设置时返回默认值
+func (channel *Channel) GetFirstTokenTimeout() int {
+	if channel.FirstTokenTimeout == nil || *channel.FirstTokenTimeout <= 0 {
+		return common.RelayFirstTokenTimeout
+	}
+	return *channel.FirstTokenTimeout
+}
+
+// GetIdleTimeout 返回渠道的流式响应空闲超时时间（秒），未设置时返回默认值
+func (channel *Channel) GetIdleTimeout() int {
+	if channel.IdleTimeout == nil || *channel.IdleTimeout <= 0 {
+		return common.RelayIdleTimeout
+	}
+	return *channel.IdleTimeout
+}
+
+// GetTotalTimeout 返回渠道的请求总超时时间（秒），未设置时返回默认值 RELAY_TIMEOUT
+func (channel *Channel) GetTotalTimeout() int {
+	if channel.TotalTimeout == nil || *channel.TotalTimeout <= 0 {
+		return common.RelayTimeout
+	}
+	return *channel.TotalTimeout
+}
+
+// GetStreamMode 返回渠道的上游流式模式，未设置时返回 StreamModeDefault
+func (channel *Channel) GetStreamMode() string {
+	if channel.StreamMode == nil {
+		return common.StreamModeDefault
+	}
+	return *channel.StreamMode
+}
+
 func (channel *Channel) GetBaseURL() string {
 	if channel.BaseURL == nil {
 		return ""
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"errors"
+)
+
+type File struct {
+	Id        string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose" gorm:"type:varchar(32);index"`
+	Storage   string `json:"storage" gorm:"type:varchar(16)"` // 文件所在的存储后端，local 或 s3
+}
+
+// GetUserFiles 按创建时间倒序列出用户的文件，after 为上一页最后一个文件的 id
+func GetUserFiles(userId int, purpose string, after string, limit int) ([]*File, error) {
+	var files []*File
+	query := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		afterFile, err := GetUserFileById(after, userId)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", afterFile.CreatedAt, afterFile.CreatedAt, afterFile.Id)
+	}
+	err := query.Order("created_at desc, id desc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+func GetUserFileById(id string, userId int) (*File, error) {
+	if id == "" {
+		return nil, errors.New("id 为空！")
+	}
+	file := File{}
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&file).Error
+	return &file, err
+}
+
+func (file *File) Insert() error {
+	return DB.Create(file).Error
+}
+
+func (file *File) Delete() error {
+	return DB.Delete(file).Error
+}
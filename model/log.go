@@ -9,21 +9,24 @@ import (
 )
 
 type Log struct {
-	Id               int    `json:"id" gorm:"index:idx_created_at_id,priority:1"`
-	UserId           int    `json:"user_id" gorm:"index"`
-	CreatedAt        int64  `json:"created_at" gorm:"bigint;index:idx_created_at_id,priority:2;index:idx_created_at_type"`
-	Type             int    `json:"type" gorm:"index:idx_created_at_type"`
-	Content          string `json:"content"`
-	Username         string `json:"username" gorm:"index:index_username_model_name,priority:2;default:''"`
-	TokenName        string `json:"token_name" gorm:"index;default:''"`
-	ModelName        string `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
-	Quota            int    `json:"quota" gorm:"default:0"`
-	PromptTokens     int    `json:"prompt_tokens" gorm:"default:0"`
-	CompletionTokens int    `json:"completion_tokens" gorm:"default:0"`
-	UseTime          int    `json:"use_time" gorm:"default:0"`
-	IsStream         bool   `json:"is_stream" gorm:"default:false"`
-	ChannelId        int    `json:"channel" gorm:"index"`
-	TokenId          int    `json:"token_id" gorm:"default:0;index"`
+	Id               int     `json:"id" gorm:"index:idx_created_at_id,priority:1"`
+	UserId           int     `json:"user_id" gorm:"index"`
+	CreatedAt        int64   `json:"created_at" gorm:"bigint;index:idx_created_at_id,priority:2;index:idx_created_at_type"`
+	Type             int     `json:"type" gorm:"index:idx_created_at_type"`
+	Content          string  `json:"content"`
+	Username         string  `json:"username" gorm:"index:index_username_model_name,priority:2;default:''"`
+	TokenName        string  `json:"token_name" gorm:"index;default:''"`
+	ModelName        string  `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
+	Quota            int     `json:"quota" gorm:"default:0"`
+	PromptTokens     int     `json:"prompt_tokens" gorm:"default:0"`
+	CompletionTokens int     `json:"completion_tokens" gorm:"default:0"`
+	UseTime          int     `json:"use_time" gorm:"default:0"`
+	IsStream         bool    `json:"is_stream" gorm:"default:false"`
+	ChannelId        int     `json:"channel" gorm:"index"`
+	TokenId          int     `json:"token_id" gorm:"default:0;index"`
+	CacheHit         bool    `json:"cache_hit" gorm:"default:false"`
+	ClientCancelled  bool    `json:"client_cancelled" gorm:"default:false"`
+	AudioDuration    float64 `json:"audio_duration" gorm:"default:0"`
 }
 
 const (
@@ -57,7 +60,14 @@ func RecordLog(userId int, logType int, content string) {
 	}
 }
 
-func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptTokens int, completionTokens int, modelName string, tokenName string, quota int, content string, tokenId int, userQuota int, useTimeSeconds int, isStream bool) {
+// ConsumeLogExtra 消费日志中只有部分请求才会记录的信息
+type ConsumeLogExtra struct {
+	CacheHit        bool    // 响应来自缓存
+	ClientCancelled bool    // 客户端在响应完成前断开
+	AudioDuration   float64 // 按音频时长计费时的时长（秒）
+}
+
+func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptTokens int, completionTokens int, modelName string, tokenName string, quota int, content string, tokenId int, userQuota int, useTimeSeconds int, isStream bool, extra ConsumeLogExtra) {
 	common.LogInfo(ctx, fmt.Sprintf("record consume log: userId=%d, 用户调用前余额=%d, channelId=%d, promptTokens=%d, completionTokens=%d, modelName=%s, tokenName=%s, quota=%d, content=%s", userId, userQuota, channelId, promptTokens, completionTokens, modelName, tokenName, quota, content))
 	if !common.LogConsumeEnabled {
 		return
@@ -78,6 +88,9 @@ func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptToke
 		TokenId:          tokenId,
 		UseTime:          useTimeSeconds,
 		IsStream:         isStream,
+		CacheHit:         extra.CacheHit,
+		ClientCancelled:  extra.ClientCancelled,
+		AudioDuration:    extra.AudioDuration,
 	}
 	err := DB.Create(log).Error
 	if err != nil {
@@ -43,6 +43,14 @@ func InitOptionMap() {
 	common.OptionMap["DrawingEnabled"] = strconv.FormatBool(common.DrawingEnabled)
 	common.OptionMap["DataExportEnabled"] = strconv.FormatBool(common.DataExportEnabled)
 	common.OptionMap["ChannelDisableThreshold"] = strconv.FormatFloat(common.ChannelDisableThreshold, 'f', -1, 64)
+	common.OptionMap["ChannelBreakerEnabled"] = strconv.FormatBool(common.ChannelBreakerEnabled)
+	common.OptionMap["ChannelBreakerWindow"] = strconv.Itoa(common.ChannelBreakerWindow)
+	common.OptionMap["ChannelBreakerMinRequests"] = strconv.Itoa(common.ChannelBreakerMinRequests)
+	common.OptionMap["ChannelBreakerErrorRate"] = strconv.FormatFloat(common.ChannelBreakerErrorRate, 'f', -1, 64)
+	common.OptionMap["ChannelBreakerConsecutiveFailures"] = strconv.Itoa(common.ChannelBreakerConsecutiveFailures)
+	common.OptionMap["ChannelBreakerCooldown"] = strconv.Itoa(common.ChannelBreakerCooldown)
+	common.OptionMap["ChannelBreakerHalfOpenRatio"] = strconv.FormatFloat(common.ChannelBreakerHalfOpenRatio, 'f', -1, 64)
+	common.OptionMap["ChannelBreakerHalfOpenSuccesses"] = strconv.Itoa(common.ChannelBreakerHalfOpenSuccesses)
 	common.OptionMap["EmailDomainRestrictionEnabled"] = strconv.FormatBool(common.EmailDomainRestrictionEnabled)
 	common.OptionMap["EmailDomainWhitelist"] = strings.Join(common.EmailDomainWhitelist, ",")
 	common.OptionMap["SMTPServer"] = ""
@@ -80,12 +88,19 @@ func InitOptionMap() {
 	common.OptionMap["PreConsumedQuota"] = strconv.Itoa(common.PreConsumedQuota)
 	common.OptionMap["ModelRatio"] = common.ModelRatio2JSONString()
 	common.OptionMap["ModelPrice"] = common.ModelPrice2JSONString()
+	common.OptionMap["ModelAudioPrice"] = common.ModelAudioPrice2JSONString()
 	common.OptionMap["GroupRatio"] = common.GroupRatio2JSONString()
 	common.OptionMap["TopUpLink"] = common.TopUpLink
 	common.OptionMap["ChatLink"] = common.ChatLink
 	common.OptionMap["ChatLink2"] = common.ChatLink2
 	common.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(common.QuotaPerUnit, 'f', -1, 64)
 	common.OptionMap["RetryTimes"] = strconv.Itoa(common.RetryTimes)
+	common.OptionMap["BatchRatio"] = strconv.FormatFloat(common.BatchRatio, 'f', -1, 64)
+	common.OptionMap["CacheHitRatio"] = strconv.FormatFloat(common.CacheHitRatio, 'f', -1, 64)
+	common.OptionMap["ModelCacheTTL"] = common.ModelCacheTTL2JSONString()
+	common.OptionMap["ModelHedgeDelay"] = common.ModelHedgeDelay2JSONString()
+	common.OptionMap["ModelStreamMode"] = common.ModelStreamMode2JSONString()
+	common.OptionMap["ChannelSelectStrategy"] = common.ChannelSelectStrategy2JSONString()
 	common.OptionMap["DataExportInterval"] = strconv.Itoa(common.DataExportInterval)
 	common.OptionMap["DataExportDefaultTime"] = common.DataExportDefaultTime
 	common.OptionMap["DefaultCollapseSidebar"] = strconv.FormatBool(common.DefaultCollapseSidebar)
@@ -175,6 +190,8 @@ func updateOptionMap(key string, value string) (err error) {
 			common.EmailDomainRestrictionEnabled = boolValue
 		case "AutomaticDisableChannelEnabled":
 			common.AutomaticDisableChannelEnabled = boolValue
+		case "ChannelBreakerEnabled":
+			common.ChannelBreakerEnabled = boolValue
 		case "AutomaticEnableChannelEnabled":
 			common.AutomaticEnableChannelEnabled = boolValue
 		case "LogConsumeEnabled":
@@ -277,6 +294,8 @@ func updateOptionMap(key string, value string) (err error) {
 		err = common.UpdateGroupRatioByJSONString(value)
 	case "ModelPrice":
 		err = common.UpdateModelPriceByJSONString(value)
+	case "ModelAudioPrice":
+		err = common.UpdateModelAudioPriceByJSONString(value)
 	case "TopUpLink":
 		common.TopUpLink = value
 	case "ChatLink":
@@ -285,8 +304,34 @@ func updateOptionMap(key string, value string) (err error) {
 		common.ChatLink2 = value
 	case "ChannelDisableThreshold":
 		common.ChannelDisableThreshold, _ = strconv.ParseFloat(value, 64)
+	case "ChannelBreakerWindow":
+		common.ChannelBreakerWindow, _ = strconv.Atoi(value)
+	case "ChannelBreakerMinRequests":
+		common.ChannelBreakerMinRequests, _ = strconv.Atoi(value)
+	case "ChannelBreakerErrorRate":
+		common.ChannelBreakerErrorRate, _ = strconv.ParseFloat(value, 64)
+	case "ChannelBreakerConsecutiveFailures":
+		common.ChannelBreakerConsecutiveFailures, _ = strconv.Atoi(value)
+	case "ChannelBreakerCooldown":
+		common.ChannelBreakerCooldown, _ = strconv.Atoi(value)
+	case "ChannelBreakerHalfOpenRatio":
+		common.ChannelBreakerHalfOpenRatio, _ = strconv.ParseFloat(value, 64)
+	case "ChannelBreakerHalfOpenSuccesses":
+		common.ChannelBreakerHalfOpenSuccesses, _ = strconv.Atoi(value)
 	case "QuotaPerUnit":
 		common.QuotaPerUnit, _ = strconv.ParseFloat(value, 64)
+	case "BatchRatio":
+		common.BatchRatio, _ = strconv.ParseFloat(value, 64)
+	case "CacheHitRatio":
+		common.CacheHitRatio, _ = strconv.ParseFloat(value, 64)
+	case "ModelCacheTTL":
+		err = common.UpdateModelCacheTTLByJSONString(value)
+	case "ModelHedgeDelay":
+		err = common.UpdateModelHedgeDelayByJSONString(value)
+	case "ModelStreamMode":
+		err = common.UpdateModelStreamModeByJSONString(value)
+	case "ChannelSelectStrategy":
+		err = common.UpdateChannelSelectStrategyByJSONString(value)
 	case "SensitiveWords":
 		constant.SensitiveWordsFromString(value)
 	case "StreamCacheQueueLength":
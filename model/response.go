@@ -0,0 +1,28 @@
+package model
+
+import (
+	"errors"
+)
+
+// Response 保存 /v1/responses 的对话状态，之后的请求通过 previous_response_id 继续对话
+type Response struct {
+	Id                 string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId             int    `json:"user_id" gorm:"index"`
+	PreviousResponseId string `json:"previous_response_id" gorm:"type:varchar(64)"`
+	Model              string `json:"model"`
+	Messages           string `json:"messages"` // 截至本次响应的完整对话，为 OpenAI 格式的 messages 的 JSON 文本，不包含 instructions
+	CreatedAt          int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func GetUserResponseById(id string, userId int) (*Response, error) {
+	if id == "" {
+		return nil, errors.New("id 为空！")
+	}
+	response := Response{}
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&response).Error
+	return &response, err
+}
+
+func (response *Response) Insert() error {
+	return DB.Create(response).Error
+}
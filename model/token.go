@@ -23,6 +23,8 @@ type Token struct {
 	ModelLimitsEnabled bool           `json:"model_limits_enabled" gorm:"default:false"`
 	ModelLimits        string         `json:"model_limits" gorm:"type:varchar(1024);default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
+	CacheEnabled       bool           `json:"cache_enabled" gorm:"default:false"`
+	CacheTTL           int            `json:"cache_ttl" gorm:"default:0"` // 响应缓存有效期（秒），0 表示使用默认值
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -124,7 +126,7 @@ func (token *Token) Insert() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (token *Token) Update() error {
 	var err error
-	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "model_limits_enabled", "model_limits").Updates(token).Error
+	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "model_limits_enabled", "model_limits", "cache_enabled", "cache_ttl").Updates(token).Error
 	return err
 }
 
@@ -19,3 +19,20 @@ type Adaptor interface {
 	GetModelList() []string
 	GetChannelName() string
 }
+
+// RerankAdaptor 支持 /v1/rerank 请求的适配器实现的接口，DoResponse 中按 RelayModeRerank 处理响应
+type RerankAdaptor interface {
+	ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error)
+}
+
+// ImageAdaptor 支持 /v1/images/generations 请求的适配器实现的接口，DoResponse 中按 RelayModeImagesGenerations 处理响应，
+// 返回 OpenAI 格式的图片响应。没有实现该接口的渠道按 OpenAI 格式原样转发
+type ImageAdaptor interface {
+	ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error)
+}
+
+// ImageEditAdaptor 支持 /v1/images/edits 和 /v1/images/variations 请求的适配器实现的接口，返回以流的方式生成的请求体，
+// DoResponse 中按 RelayModeImagesEdits 和 RelayModeImagesVariations 处理响应
+type ImageEditAdaptor interface {
+	ConvertImageEditRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageEditRequest) (io.ReadCloser, error)
+}
@@ -13,6 +13,7 @@ import (
 )
 
 type Adaptor struct {
+	ImageResponseFormat string
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo, request dto.GeneralOpenAIRequest) {
@@ -21,8 +22,11 @@ func (a *Adaptor) Init(info *relaycommon.RelayInfo, request dto.GeneralOpenAIReq
 
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 	fullRequestURL := fmt.Sprintf("%s/api/v1/services/aigc/text-generation/generation", info.BaseUrl)
-	if info.RelayMode == constant.RelayModeEmbeddings {
+	switch info.RelayMode {
+	case constant.RelayModeEmbeddings:
 		fullRequestURL = fmt.Sprintf("%s/api/v1/services/embeddings/text-embedding/text-embedding", info.BaseUrl)
+	case constant.RelayModeImagesGenerations:
+		fullRequestURL = fmt.Sprintf("%s/api/v1/services/aigc/text2image/image-synthesis", info.BaseUrl)
 	}
 	return fullRequestURL, nil
 }
@@ -33,6 +37,9 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, info *re
 	if info.IsStream {
 		req.Header.Set("X-DashScope-SSE", "enable")
 	}
+	if info.RelayMode == constant.RelayModeImagesGenerations {
+		req.Header.Set("X-DashScope-Async", "enable")
+	}
 	if c.GetString("plugin") != "" {
 		req.Header.Set("X-DashScope-Plugin", c.GetString("plugin"))
 	}
@@ -53,17 +60,24 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *dto.Gen
 	}
 }
 
+func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
+	a.ImageResponseFormat = request.ResponseFormat
+	return imageRequestOpenAI2Ali(request), nil
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	return channel.DoApiRequest(a, c, info, requestBody)
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode, sensitiveResp *dto.SensitiveResponse) {
 	if info.IsStream {
-		err, usage = aliStreamHandler(c, resp)
+		err, usage = aliStreamHandler(c, resp, info)
 	} else {
 		switch info.RelayMode {
 		case constant.RelayModeEmbeddings:
 			err, usage = aliEmbeddingHandler(c, resp)
+		case constant.RelayModeImagesGenerations:
+			err, usage = aliImageHandler(c, resp, info, a.ImageResponseFormat)
 		default:
 			err, usage = aliHandler(c, resp)
 		}
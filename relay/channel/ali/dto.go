@@ -1,8 +1,12 @@
 package ali
 
+import "one-api/dto"
+
 type AliMessage struct {
-	Content string `json:"content"`
-	Role    string `json:"role"`
+	Content   string         `json:"content"`
+	Role      string         `json:"role"`
+	Name      string         `json:"name,omitempty"`
+	ToolCalls []dto.ToolCall `json:"tool_calls,omitempty"`
 }
 
 type AliInput struct {
@@ -17,6 +21,9 @@ type AliParameters struct {
 	Seed              uint64  `json:"seed,omitempty"`
 	EnableSearch      bool    `json:"enable_search,omitempty"`
 	IncrementalOutput bool    `json:"incremental_output,omitempty"`
+	ResultFormat      string  `json:"result_format,omitempty"`
+	Tools             any     `json:"tools,omitempty"`
+	ToolChoice        any     `json:"tool_choice,omitempty"`
 }
 
 type AliChatRequest struct {
@@ -60,9 +67,15 @@ type AliUsage struct {
 	TotalTokens  int `json:"total_tokens"`
 }
 
+type AliChoice struct {
+	FinishReason string     `json:"finish_reason"`
+	Message      AliMessage `json:"message"`
+}
+
 type AliOutput struct {
-	Text         string `json:"text"`
-	FinishReason string `json:"finish_reason"`
+	Text         string      `json:"text"`
+	FinishReason string      `json:"finish_reason"`
+	Choices      []AliChoice `json:"choices,omitempty"` // result_format 为 message 时返回
 }
 
 type AliChatResponse struct {
@@ -70,3 +83,41 @@ type AliChatResponse struct {
 	Usage  AliUsage  `json:"usage"`
 	AliError
 }
+
+type AliImageInput struct {
+	Prompt         string `json:"prompt"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+}
+
+type AliImageParameters struct {
+	Size  string `json:"size,omitempty"`
+	N     int    `json:"n,omitempty"`
+	Style string `json:"style,omitempty"`
+}
+
+type AliImageRequest struct {
+	Model      string             `json:"model"`
+	Input      AliImageInput      `json:"input"`
+	Parameters AliImageParameters `json:"parameters,omitempty"`
+}
+
+type AliImageResult struct {
+	Url     string `json:"url,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// AliTaskResponse 创建异步任务和查询任务状态的响应
+type AliTaskResponse struct {
+	Output struct {
+		TaskId     string           `json:"task_id"`
+		TaskStatus string           `json:"task_status"`
+		Results    []AliImageResult `json:"results,omitempty"`
+		Code       string           `json:"code,omitempty"`
+		Message    string           `json:"message,omitempty"`
+	} `json:"output"`
+	Usage struct {
+		ImageCount int `json:"image_count"`
+	} `json:"usage"`
+	AliError
+}
@@ -0,0 +1,146 @@
+package ali
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"one-api/dto"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+	"strings"
+	"time"
+)
+
+// https://help.aliyun.com/zh/dashscope/developer-reference/api-details-9
+
+const (
+	aliImageTaskPollInterval = time.Second
+	aliImageTaskTimeout      = 5 * time.Minute
+)
+
+func imageRequestOpenAI2Ali(request dto.ImageRequest) *AliImageRequest {
+	return &AliImageRequest{
+		Model: request.Model,
+		Input: AliImageInput{
+			Prompt: request.Prompt,
+		},
+		Parameters: AliImageParameters{
+			// 通义万相的尺寸格式为 1024*1024
+			Size: strings.Replace(request.Size, "x", "*", 1),
+			N:    request.N,
+		},
+	}
+}
+
+// aliImageHandler 通义万相只支持异步调用：创建任务后轮询任务状态，任务完成后返回 OpenAI 格式的图片响应
+func aliImageHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo, responseFormat string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	var aliResponse AliTaskResponse
+	err := json.NewDecoder(resp.Body).Decode(&aliResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if aliResponse.Code != "" {
+		return aliErrorWrapper(aliResponse.AliError, resp.StatusCode), nil
+	}
+	if aliResponse.Output.TaskId == "" {
+		return service.OpenAIErrorWrapper(errors.New("task id is empty"), "invalid_response", http.StatusInternalServerError), nil
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), aliImageTaskTimeout)
+	defer cancel()
+	taskResponse, err := waitAliTask(ctx, info, aliResponse.Output.TaskId)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "get_task_result_failed", http.StatusInternalServerError), nil
+	}
+	if taskResponse.Output.TaskStatus != "SUCCEEDED" {
+		return aliErrorWrapper(AliError{
+			Code:      taskResponse.Output.Code,
+			Message:   taskResponse.Output.Message,
+			RequestId: taskResponse.RequestId,
+		}, http.StatusInternalServerError), nil
+	}
+	urls := make([]string, 0, len(taskResponse.Output.Results))
+	for _, result := range taskResponse.Output.Results {
+		if result.Url != "" {
+			urls = append(urls, result.Url)
+		}
+	}
+	imageResponse, err := channel.ImageUrls2Response(urls, responseFormat)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "download_image_failed", http.StatusInternalServerError), nil
+	}
+	jsonResponse, err := json.Marshal(imageResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, _ = c.Writer.Write(jsonResponse)
+	return nil, nil
+}
+
+func aliErrorWrapper(aliError AliError, statusCode int) *dto.OpenAIErrorWithStatusCode {
+	return &dto.OpenAIErrorWithStatusCode{
+		Error: dto.OpenAIError{
+			Message: aliError.Message,
+			Type:    aliError.Code,
+			Param:   aliError.RequestId,
+			Code:    aliError.Code,
+		},
+		StatusCode: statusCode,
+	}
+}
+
+// waitAliTask 轮询任务状态直到任务结束（SUCCEEDED、FAILED 等）或超时
+func waitAliTask(ctx context.Context, info *relaycommon.RelayInfo, taskId string) (*AliTaskResponse, error) {
+	url := fmt.Sprintf("%s/api/v1/tasks/%s", info.BaseUrl, taskId)
+	ticker := time.NewTicker(aliImageTaskPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("wait for task %s: %w", taskId, ctx.Err())
+		case <-ticker.C:
+		}
+		taskResponse, err := getAliTask(ctx, url, info.ApiKey)
+		if err != nil {
+			return nil, err
+		}
+		switch taskResponse.Output.TaskStatus {
+		case "PENDING", "RUNNING":
+			continue
+		default:
+			return taskResponse, nil
+		}
+	}
+}
+
+func getAliTask(ctx context.Context, url string, apiKey string) (*AliTaskResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, err := service.GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var taskResponse AliTaskResponse
+	err = json.NewDecoder(resp.Body).Decode(&taskResponse)
+	if err != nil {
+		return nil, err
+	}
+	if taskResponse.Code != "" {
+		return nil, fmt.Errorf("%s: %s", taskResponse.Code, taskResponse.Message)
+	}
+	return &taskResponse, nil
+}
@@ -1,13 +1,14 @@
 package ali
 
 import (
-	"bufio"
 	"encoding/json"
 	"github.com/gin-gonic/gin"
 	"io"
 	"net/http"
 	"one-api/common"
 	"one-api/dto"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
 	"one-api/service"
 	"strings"
 )
@@ -18,13 +19,19 @@ const EnableSearchModelSuffix = "-internet"
 
 func requestOpenAI2Ali(request dto.GeneralOpenAIRequest) *AliChatRequest {
 	messages := make([]AliMessage, 0, len(request.Messages))
+	toolCallNames := channel.ToolCallNames(request.Messages)
 	//prompt := ""
 	for i := 0; i < len(request.Messages); i++ {
 		message := request.Messages[i]
-		messages = append(messages, AliMessage{
-			Content: message.StringContent(),
-			Role:    strings.ToLower(message.Role),
-		})
+		aliMessage := AliMessage{
+			Content:   message.StringContent(),
+			Role:      strings.ToLower(message.Role),
+			ToolCalls: message.ParseToolCalls(),
+		}
+		if aliMessage.Role == "tool" {
+			aliMessage.Name = toolCallNames[message.ToolCallId]
+		}
+		messages = append(messages, aliMessage)
 	}
 	enableSearch := false
 	aliModel := request.Model
@@ -32,7 +39,7 @@ func requestOpenAI2Ali(request dto.GeneralOpenAIRequest) *AliChatRequest {
 		enableSearch = true
 		aliModel = strings.TrimSuffix(aliModel, EnableSearchModelSuffix)
 	}
-	return &AliChatRequest{
+	aliRequest := AliChatRequest{
 		Model: request.Model,
 		Input: AliInput{
 			//Prompt:  prompt,
@@ -44,6 +51,13 @@ func requestOpenAI2Ali(request dto.GeneralOpenAIRequest) *AliChatRequest {
 			EnableSearch:      enableSearch,
 		},
 	}
+	// 工具调用只在 message 格式的结果中返回
+	if tools := channel.ParseTools(request); len(tools) > 0 {
+		aliRequest.Parameters.ResultFormat = "message"
+		aliRequest.Parameters.Tools = tools
+		aliRequest.Parameters.ToolChoice = request.ToolChoice
+	}
+	return &aliRequest
 }
 
 func embeddingRequestOpenAI2Ali(request dto.GeneralOpenAIRequest) *AliEmbeddingRequest {
@@ -110,15 +124,31 @@ func embeddingResponseAli2OpenAI(response *AliEmbeddingResponse) *dto.OpenAIEmbe
 	return &openAIEmbeddingResponse
 }
 
+// aliOutputMessage 返回结果中的回复消息，兼容 text 和 message 两种结果格式
+func aliOutputMessage(output *AliOutput) (*AliMessage, string) {
+	if len(output.Choices) > 0 {
+		return &output.Choices[0].Message, output.Choices[0].FinishReason
+	}
+	return &AliMessage{Role: "assistant", Content: output.Text}, output.FinishReason
+}
+
 func responseAli2OpenAI(response *AliChatResponse) *dto.OpenAITextResponse {
-	content, _ := json.Marshal(response.Output.Text)
+	message, finishReason := aliOutputMessage(&response.Output)
+	content, _ := json.Marshal(message.Content)
 	choice := dto.OpenAITextResponseChoice{
 		Index: 0,
 		Message: dto.Message{
 			Role:    "assistant",
 			Content: content,
 		},
-		FinishReason: response.Output.FinishReason,
+		FinishReason: channel.FinishReasonWithToolCalls(finishReason, len(message.ToolCalls) > 0),
+	}
+	if len(message.ToolCalls) > 0 {
+		toolCalls := make([]dto.ToolCall, 0, len(message.ToolCalls))
+		for _, toolCall := range message.ToolCalls {
+			toolCalls = append(toolCalls, channel.NewToolCall(toolCall.Id, toolCall.Function.Name, toolCall.Function.Arguments))
+		}
+		choice.Message.ToolCalls = toolCalls
 	}
 	fullTextResponse := dto.OpenAITextResponse{
 		Id:      response.RequestId,
@@ -134,11 +164,15 @@ func responseAli2OpenAI(response *AliChatResponse) *dto.OpenAITextResponse {
 	return &fullTextResponse
 }
 
-func streamResponseAli2OpenAI(aliResponse *AliChatResponse) *dto.ChatCompletionsStreamResponse {
+func streamResponseAli2OpenAI(aliResponse *AliChatResponse, toolCallStream *channel.ToolCallStream) *dto.ChatCompletionsStreamResponse {
 	var choice dto.ChatCompletionsStreamResponseChoice
-	choice.Delta.Content = aliResponse.Output.Text
-	if aliResponse.Output.FinishReason != "null" {
-		finishReason := aliResponse.Output.FinishReason
+	message, finishReason := aliOutputMessage(&aliResponse.Output)
+	choice.Delta.Content = message.Content
+	if len(message.ToolCalls) > 0 {
+		choice.Delta.ToolCalls = toolCallStream.Append(message.ToolCalls)
+	}
+	if finishReason != "" && finishReason != "null" {
+		finishReason = toolCallStream.FinishReason(finishReason)
 		choice.FinishReason = &finishReason
 	}
 	response := dto.ChatCompletionsStreamResponse{
@@ -151,73 +185,32 @@ func streamResponseAli2OpenAI(aliResponse *AliChatResponse) *dto.ChatCompletions
 	return &response
 }
 
-func aliStreamHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
-	var usage dto.Usage
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		if atEOF && len(data) == 0 {
-			return 0, nil, nil
-		}
-		if i := strings.Index(string(data), "\n"); i >= 0 {
-			return i + 1, data[0:i], nil
-		}
-		if atEOF {
-			return len(data), data, nil
-		}
-		return 0, nil, nil
-	})
-	dataChan := make(chan string)
-	stopChan := make(chan bool)
-	go func() {
-		for scanner.Scan() {
-			data := scanner.Text()
-			if len(data) < 5 { // ignore blank line or wrong format
-				continue
-			}
-			if data[:5] != "data:" {
-				continue
-			}
-			data = data[5:]
-			dataChan <- data
-		}
-		stopChan <- true
-	}()
-	service.SetEventStreamHeaders(c)
+func aliStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
 	lastResponseText := ""
-	c.Stream(func(w io.Writer) bool {
-		select {
-		case data := <-dataChan:
-			var aliResponse AliChatResponse
-			err := json.Unmarshal([]byte(data), &aliResponse)
-			if err != nil {
-				common.SysError("error unmarshalling stream response: " + err.Error())
-				return true
-			}
-			if aliResponse.Usage.OutputTokens != 0 {
-				usage.PromptTokens = aliResponse.Usage.InputTokens
-				usage.CompletionTokens = aliResponse.Usage.OutputTokens
-				usage.TotalTokens = aliResponse.Usage.InputTokens + aliResponse.Usage.OutputTokens
-			}
-			response := streamResponseAli2OpenAI(&aliResponse)
-			response.Choices[0].Delta.Content = strings.TrimPrefix(response.Choices[0].Delta.Content, lastResponseText)
-			lastResponseText = aliResponse.Output.Text
-			jsonResponse, err := json.Marshal(response)
-			if err != nil {
-				common.SysError("error marshalling stream response: " + err.Error())
-				return true
+	var toolCallStream channel.ToolCallStream
+	stream := relaycommon.NewStream(c, info, relaycommon.NewSSEDecoder(resp.Body))
+	usage := stream.Run(func(event relaycommon.StreamEvent) error {
+		var aliResponse AliChatResponse
+		err := json.Unmarshal([]byte(event.Data), &aliResponse)
+		if err != nil {
+			return err
+		}
+		// 通义千问在每个数据块中返回累计用量，直接使用最后的用量
+		if aliResponse.Usage.OutputTokens != 0 {
+			stream.Usage = &dto.Usage{
+				PromptTokens:     aliResponse.Usage.InputTokens,
+				CompletionTokens: aliResponse.Usage.OutputTokens,
+				TotalTokens:      aliResponse.Usage.InputTokens + aliResponse.Usage.OutputTokens,
 			}
-			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonResponse)})
-			return true
-		case <-stopChan:
-			c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
-			return false
 		}
+		response := streamResponseAli2OpenAI(&aliResponse, &toolCallStream)
+		// 通义千问返回的是累计文本，只输出新增的部分
+		responseText := response.Choices[0].Delta.Content
+		response.Choices[0].Delta.Content = strings.TrimPrefix(responseText, lastResponseText)
+		lastResponseText = responseText
+		return stream.SendResponse(response)
 	})
-	err := resp.Body.Close()
-	if err != nil {
-		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
-	}
-	return nil, &usage
+	return nil, usage
 }
 
 func aliHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
@@ -0,0 +1,223 @@
+package ali
+
+import (
+	"encoding/json"
+	"one-api/dto"
+	"one-api/relay/channel"
+	"strings"
+	"testing"
+)
+
+func TestRequestOpenAI2AliTools(t *testing.T) {
+	tests := []struct {
+		name             string
+		request          string
+		wantResultFormat string
+		wantTools        int
+		wantToolChoice   string
+	}{
+		{
+			name:             "tools",
+			request:          `{"model":"qwen-max","stream":true,"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"get_weather"}}],"tool_choice":"auto"}`,
+			wantResultFormat: "message",
+			wantTools:        1,
+			wantToolChoice:   `"auto"`,
+		},
+		{
+			name:             "function tool choice",
+			request:          `{"model":"qwen-max","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"get_weather"}}],"tool_choice":{"type":"function","function":{"name":"get_weather"}}}`,
+			wantResultFormat: "message",
+			wantTools:        1,
+			wantToolChoice:   `{"function":{"name":"get_weather"},"type":"function"}`,
+		},
+		{
+			name:           "no tools",
+			request:        `{"model":"qwen-max","messages":[{"role":"user","content":"hi"}]}`,
+			wantToolChoice: `null`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var request dto.GeneralOpenAIRequest
+			if err := json.Unmarshal([]byte(test.request), &request); err != nil {
+				t.Fatal(err)
+			}
+			aliRequest := requestOpenAI2Ali(request)
+			if aliRequest.Parameters.ResultFormat != test.wantResultFormat {
+				t.Errorf("result_format = %q, want %q", aliRequest.Parameters.ResultFormat, test.wantResultFormat)
+			}
+			var tools []dto.ToolCall
+			if aliRequest.Parameters.Tools != nil {
+				data, _ := json.Marshal(aliRequest.Parameters.Tools)
+				if err := json.Unmarshal(data, &tools); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(tools) != test.wantTools {
+				t.Errorf("tools = %+v, want %d tools", tools, test.wantTools)
+			}
+			toolChoice, _ := json.Marshal(aliRequest.Parameters.ToolChoice)
+			if string(toolChoice) != test.wantToolChoice {
+				t.Errorf("tool_choice = %s, want %s", toolChoice, test.wantToolChoice)
+			}
+		})
+	}
+}
+
+func TestRequestOpenAI2AliToolMessages(t *testing.T) {
+	var request dto.GeneralOpenAIRequest
+	err := json.Unmarshal([]byte(`{"model":"qwen-max","messages":[
+		{"role":"user","content":"What is the weather in Paris?"},
+		{"role":"assistant","content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},
+		{"role":"tool","tool_call_id":"call_1","content":"{\"temperature\":20}"}
+	]}`), &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := requestOpenAI2Ali(request).Input.Messages
+	if toolCalls := messages[1].ToolCalls; len(toolCalls) != 1 || toolCalls[0].Id != "call_1" || toolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("assistant tool_calls = %+v", toolCalls)
+	}
+	if messages[2].Role != "tool" || messages[2].Name != "get_weather" || messages[2].Content != `{"temperature":20}` {
+		t.Errorf("tool message = %+v, want tool message named get_weather", messages[2])
+	}
+}
+
+func TestResponseAli2OpenAIToolCalls(t *testing.T) {
+	tests := []struct {
+		name             string
+		response         string
+		wantFinishReason string
+		wantContent      string
+		wantToolCallId   string
+	}{
+		{
+			name:             "message format with tool calls",
+			response:         `{"request_id":"r1","output":{"choices":[{"finish_reason":"tool_calls","message":{"role":"assistant","content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}}]},"usage":{"input_tokens":10,"output_tokens":5}}`,
+			wantFinishReason: channel.ToolCallsFinishReason,
+			wantToolCallId:   "call_1",
+		},
+		{
+			name:             "tool call without id",
+			response:         `{"request_id":"r1","output":{"choices":[{"finish_reason":"stop","message":{"role":"assistant","content":"","tool_calls":[{"type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}}]},"usage":{"input_tokens":10,"output_tokens":5}}`,
+			wantFinishReason: channel.ToolCallsFinishReason,
+			wantToolCallId:   "call_",
+		},
+		{
+			name:             "text format",
+			response:         `{"request_id":"r1","output":{"text":"It is sunny.","finish_reason":"stop"},"usage":{"input_tokens":10,"output_tokens":5}}`,
+			wantFinishReason: "stop",
+			wantContent:      "It is sunny.",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var aliResponse AliChatResponse
+			if err := json.Unmarshal([]byte(test.response), &aliResponse); err != nil {
+				t.Fatal(err)
+			}
+			response := responseAli2OpenAI(&aliResponse)
+			choice := response.Choices[0]
+			if choice.FinishReason != test.wantFinishReason {
+				t.Errorf("finish_reason = %q, want %q", choice.FinishReason, test.wantFinishReason)
+			}
+			if content := choice.Message.StringContent(); content != test.wantContent {
+				t.Errorf("content = %q, want %q", content, test.wantContent)
+			}
+			if response.Usage.TotalTokens != 15 {
+				t.Errorf("total_tokens = %d, want 15", response.Usage.TotalTokens)
+			}
+			toolCalls := choice.Message.ParseToolCalls()
+			if test.wantToolCallId == "" {
+				if len(toolCalls) != 0 {
+					t.Errorf("tool_calls = %+v, want none", toolCalls)
+				}
+				return
+			}
+			if len(toolCalls) != 1 || !strings.HasPrefix(toolCalls[0].Id, test.wantToolCallId) || toolCalls[0].Function.Name != "get_weather" || toolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+				t.Errorf("tool_calls = %+v", toolCalls)
+			}
+		})
+	}
+}
+
+func TestStreamResponseAli2OpenAIToolCalls(t *testing.T) {
+	tests := []struct {
+		name          string
+		chunks        []string
+		wantIds       []string
+		wantNames     []string
+		wantArguments []string
+	}{
+		{
+			name: "incremental argument chunks",
+			chunks: []string{
+				`{"request_id":"r1","output":{"choices":[{"finish_reason":"null","message":{"role":"assistant","content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}}`,
+				`{"request_id":"r1","output":{"choices":[{"finish_reason":"null","message":{"role":"assistant","content":"","tool_calls":[{"type":"function","function":{"arguments":"{\"city\":"}}]}}]}}`,
+				`{"request_id":"r1","output":{"choices":[{"finish_reason":"null","message":{"role":"assistant","content":"","tool_calls":[{"type":"function","function":{"arguments":"\"Paris\"}"}}]}}]}}`,
+				`{"request_id":"r1","output":{"choices":[{"finish_reason":"tool_calls","message":{"role":"assistant","content":""}}]},"usage":{"input_tokens":10,"output_tokens":5}}`,
+			},
+			wantIds:       []string{"call_1"},
+			wantNames:     []string{"get_weather"},
+			wantArguments: []string{`{"city":"Paris"}`},
+		},
+		{
+			name: "second call starts a new index",
+			chunks: []string{
+				`{"request_id":"r1","output":{"choices":[{"finish_reason":"null","message":{"role":"assistant","content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{}"}}]}}]}}`,
+				`{"request_id":"r1","output":{"choices":[{"finish_reason":"null","message":{"role":"assistant","content":"","tool_calls":[{"id":"call_2","type":"function","function":{"name":"get_time","arguments":"{"}}]}}]}}`,
+				`{"request_id":"r1","output":{"choices":[{"finish_reason":"null","message":{"role":"assistant","content":"","tool_calls":[{"type":"function","function":{"arguments":"}"}}]}}]}}`,
+				`{"request_id":"r1","output":{"choices":[{"finish_reason":"stop","message":{"role":"assistant","content":""}}]}}`,
+			},
+			wantIds:       []string{"call_1", "call_2"},
+			wantNames:     []string{"get_weather", "get_time"},
+			wantArguments: []string{"{}", "{}"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var toolCallStream channel.ToolCallStream
+			ids := make(map[int]string)
+			names := make(map[int]string)
+			arguments := make(map[int]string)
+			finishReason := ""
+			for i, chunk := range test.chunks {
+				var aliResponse AliChatResponse
+				if err := json.Unmarshal([]byte(chunk), &aliResponse); err != nil {
+					t.Fatal(err)
+				}
+				choice := streamResponseAli2OpenAI(&aliResponse, &toolCallStream).Choices[0]
+				if choice.FinishReason != nil {
+					if i != len(test.chunks)-1 {
+						t.Errorf("chunk %d has finish_reason %q", i, *choice.FinishReason)
+					}
+					finishReason = *choice.FinishReason
+				}
+				for _, toolCall := range dto.ParseToolCalls(choice.Delta.ToolCalls) {
+					if toolCall.Index == nil {
+						t.Fatalf("tool call %+v has no index", toolCall)
+					}
+					index := *toolCall.Index
+					if toolCall.Id != "" {
+						ids[index] = toolCall.Id
+					}
+					if toolCall.Function.Name != "" {
+						names[index] = toolCall.Function.Name
+					}
+					arguments[index] += toolCall.Function.Arguments
+				}
+			}
+			if len(arguments) != len(test.wantIds) {
+				t.Fatalf("got %d tool calls, want %d", len(arguments), len(test.wantIds))
+			}
+			for i := range test.wantIds {
+				if ids[i] != test.wantIds[i] || names[i] != test.wantNames[i] || arguments[i] != test.wantArguments[i] {
+					t.Errorf("tool call %d = %s %s %s, want %s %s %s", i, ids[i], names[i], arguments[i], test.wantIds[i], test.wantNames[i], test.wantArguments[i])
+				}
+			}
+			if finishReason != channel.ToolCallsFinishReason {
+				t.Errorf("finish_reason = %q, want %q", finishReason, channel.ToolCallsFinishReason)
+			}
+		})
+	}
+}
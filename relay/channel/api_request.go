@@ -1,6 +1,8 @@
 package channel
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -23,23 +25,75 @@ func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 	if err != nil {
 		return nil, fmt.Errorf("get request url failed: %w", err)
 	}
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+	// 使用客户端请求的上下文，请求被取消时（如对冲请求落败）同时中断上游请求；
+	// 上下文在响应体关闭时释放
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if info.TotalTimeout > 0 {
+		ctx, cancel = context.WithTimeout(c.Request.Context(), info.TotalTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(c.Request.Context())
+	}
+	var streamTimeout *common.StreamTimeout
+	if info.IsStream && (info.FirstTokenTimeout > 0 || info.IdleTimeout > 0) {
+		ctx, streamTimeout = common.NewStreamTimeout(ctx, cancel, info.FirstTokenTimeout, info.IdleTimeout)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
 	err = a.SetupRequestHeader(c, req, info)
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("setup request header failed: %w", err)
 	}
 	resp, err := doRequest(c, req)
 	if err != nil {
+		cancel()
+		if streamTimeout != nil && streamTimeout.Err() != nil {
+			return nil, streamTimeout.Err()
+		}
 		return nil, fmt.Errorf("do request failed: %w", err)
 	}
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	if streamTimeout != nil {
+		resp.Body = streamTimeout.Body(resp.Body)
+		if resp.StatusCode == http.StatusOK {
+			// 等到第一个数据块到达，首个数据块超时时还没有向客户端写出任何内容，可以更换渠道重试
+			reader := bufio.NewReader(resp.Body)
+			if _, err := reader.Peek(1); err != nil && err != io.EOF {
+				_ = resp.Body.Close()
+				if errors.Is(err, common.ErrFirstTokenTimeout) {
+					return nil, err
+				}
+				return nil, fmt.Errorf("read response failed: %w", err)
+			}
+			resp.Body = &bufferedBody{Reader: reader, Closer: resp.Body}
+		}
+	}
 	return resp, nil
 }
 
+// cancelOnCloseBody 关闭响应体时释放请求的上下文
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+type bufferedBody struct {
+	io.Reader
+	io.Closer
+}
+
 func doRequest(c *gin.Context, req *http.Request) (*http.Response, error) {
-	resp, err := service.GetHttpClient().Do(req)
+	resp, err := service.GetRelayHttpClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
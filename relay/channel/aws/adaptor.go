@@ -0,0 +1,105 @@
+package aws
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/relay/channel"
+	"one-api/relay/channel/claude"
+	relaycommon "one-api/relay/common"
+	"strings"
+	"time"
+)
+
+type Adaptor struct {
+	accessKeyId     string
+	secretAccessKey string
+	region          string
+	payloadHash     string
+}
+
+func (a *Adaptor) Init(info *relaycommon.RelayInfo, request dto.GeneralOpenAIRequest) {
+}
+
+// parseKey 解析渠道密钥，格式为 AccessKeyId|SecretAccessKey|Region
+func (a *Adaptor) parseKey(key string) error {
+	parts := strings.Split(key, "|")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return errors.New("invalid aws key, format should be AccessKeyId|SecretAccessKey|Region")
+	}
+	a.accessKeyId, a.secretAccessKey, a.region = parts[0], parts[1], parts[2]
+	return nil
+}
+
+func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	if err := a.parseKey(info.ApiKey); err != nil {
+		return "", err
+	}
+	baseUrl := info.BaseUrl
+	if baseUrl == "" {
+		baseUrl = fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", a.region)
+	}
+	modelId, ok := awsModelIDMap[info.UpstreamModelName]
+	if !ok {
+		modelId = info.UpstreamModelName
+	}
+	action := "invoke"
+	if info.IsStream {
+		action = "invoke-with-response-stream"
+	}
+	return fmt.Sprintf("%s/model/%s/%s", baseUrl, modelId, action), nil
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.RelayInfo) error {
+	req.Header.Set("Content-Type", "application/json")
+	if info.IsStream {
+		req.Header.Set("Accept", "application/vnd.amazon.eventstream")
+	} else {
+		req.Header.Set("Accept", "application/json")
+	}
+	common.SignAWSRequestV4(req, a.payloadHash, a.accessKeyId, a.secretAccessKey, a.region, "bedrock-runtime", time.Now())
+	return nil
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *dto.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	claudeRequest, err := claude.RequestOpenAI2ClaudeMessage(*request)
+	if err != nil {
+		return nil, err
+	}
+	return copyRequest(claudeRequest), nil
+}
+
+func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
+	// 签名需要请求体的摘要，先读出整个请求体
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("read request body failed: %w", err)
+	}
+	a.payloadHash = common.AWSSha256Hex(body)
+	return channel.DoApiRequest(a, c, info, bytes.NewReader(body))
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode, sensitiveResp *dto.SensitiveResponse) {
+	if info.IsStream {
+		err, usage = claude.ClaudeStreamHandler(claude.RequestModeMessage, c, newEventStreamDecoder(resp.Body), info)
+	} else {
+		err, usage = claude.ClaudeHandler(claude.RequestModeMessage, c, resp, info.PromptTokens, info.UpstreamModelName)
+	}
+	return
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return ChannelName
+}
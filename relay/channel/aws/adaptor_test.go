@@ -0,0 +1,155 @@
+package aws
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	relaycommon "one-api/relay/common"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testAccessKeyId     = "AKIDEXAMPLE"
+	testSecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRegion          = "us-east-1"
+)
+
+var authorizationPattern = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=([^/]+)/(\d{8})/([^/]+)/bedrock-runtime/aws4_request, SignedHeaders=([^,]+), Signature=([0-9a-f]{64})$`)
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// expectedSignature 按 SigV4 文档独立计算签名，bedrock-runtime 的规范路径为线上路径再编码一次
+func expectedSignature(r *http.Request, canonicalURI string, signedHeaders string, payloadHash string) string {
+	var canonicalHeaders strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + value + "\n")
+	}
+	canonicalRequest := strings.Join([]string{r.Method, canonicalURI, r.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	amzDate := r.Header.Get("X-Amz-Date")
+	scope := fmt.Sprintf("%s/%s/bedrock-runtime/aws4_request", amzDate[:8], testRegion)
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(hash[:])}, "\n")
+	key := hmacSHA256([]byte("AWS4"+testSecretAccessKey), amzDate[:8])
+	key = hmacSHA256(key, testRegion)
+	key = hmacSHA256(key, "bedrock-runtime")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func TestAdaptorSignsRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name         string
+		model        string
+		isStream     bool
+		wirePath     string
+		canonicalURI string
+	}{
+		{
+			name:         "model id with colon",
+			model:        "anthropic.claude-v2:1",
+			wirePath:     "/model/anthropic.claude-v2%3A1/invoke",
+			canonicalURI: "/model/anthropic.claude-v2%253A1/invoke",
+		},
+		{
+			name:         "mapped model stream",
+			model:        "claude-3-haiku-20240307",
+			isStream:     true,
+			wirePath:     "/model/anthropic.claude-3-haiku-20240307-v1%3A0/invoke-with-response-stream",
+			canonicalURI: "/model/anthropic.claude-3-haiku-20240307-v1%253A0/invoke-with-response-stream",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requestBody := []byte(`{"anthropic_version":"bedrock-2023-05-31","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`)
+			var verifyErr error
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				verifyErr = verifySignedRequest(r, test.wirePath, test.canonicalURI, requestBody)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			info := &relaycommon.RelayInfo{
+				BaseUrl:           server.URL,
+				ApiKey:            testAccessKeyId + "|" + testSecretAccessKey + "|" + testRegion,
+				UpstreamModelName: test.model,
+				IsStream:          test.isStream,
+			}
+			adaptor := &Adaptor{}
+			resp, err := adaptor.DoRequest(c, info, bytes.NewReader(requestBody))
+			if err != nil {
+				t.Fatalf("DoRequest() error = %v", err)
+			}
+			_ = resp.Body.Close()
+			if verifyErr != nil {
+				t.Error(verifyErr)
+			}
+		})
+	}
+}
+
+func verifySignedRequest(r *http.Request, wirePath string, canonicalURI string, requestBody []byte) error {
+	if r.URL.EscapedPath() != wirePath {
+		return fmt.Errorf("path = %s, want %s", r.URL.EscapedPath(), wirePath)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(body, requestBody) {
+		return fmt.Errorf("body = %s, want %s", body, requestBody)
+	}
+	payloadHash := common.AWSSha256Hex(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != payloadHash {
+		return fmt.Errorf("x-amz-content-sha256 = %s, want %s", r.Header.Get("X-Amz-Content-Sha256"), payloadHash)
+	}
+	authorization := r.Header.Get("Authorization")
+	match := authorizationPattern.FindStringSubmatch(authorization)
+	if match == nil {
+		return fmt.Errorf("malformed authorization header %q", authorization)
+	}
+	accessKeyId, date, region, signedHeaders, signature := match[1], match[2], match[3], match[4], match[5]
+	if accessKeyId != testAccessKeyId || region != testRegion || signedHeaders != "content-type;host;x-amz-content-sha256;x-amz-date" {
+		return fmt.Errorf("unexpected credential or signed headers in %q", authorization)
+	}
+	if want := expectedSignature(r, canonicalURI, signedHeaders, payloadHash); signature != want {
+		return fmt.Errorf("signature = %s, want %s", signature, want)
+	}
+
+	// 用相同的时间和请求重新签名，结果应当与收到的 Authorization 一致
+	signTime, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil || signTime.Format("20060102") != date {
+		return fmt.Errorf("invalid x-amz-date %q", r.Header.Get("X-Amz-Date"))
+	}
+	resigned, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.EscapedPath(), nil)
+	if err != nil {
+		return err
+	}
+	resigned.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+	common.SignAWSRequestV4(resigned, payloadHash, testAccessKeyId, testSecretAccessKey, testRegion, "bedrock-runtime", signTime)
+	if resigned.Header.Get("Authorization") != authorization {
+		return fmt.Errorf("re-signed authorization = %s, want %s", resigned.Header.Get("Authorization"), authorization)
+	}
+	return nil
+}
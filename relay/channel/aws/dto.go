@@ -0,0 +1,32 @@
+package aws
+
+import "one-api/relay/channel/claude"
+
+// AwsClaudeRequest Bedrock 上 Claude 的请求体，模型 ID 和是否流式由请求地址决定
+type AwsClaudeRequest struct {
+	AnthropicVersion string                 `json:"anthropic_version"`
+	System           any                    `json:"system,omitempty"`
+	Messages         []claude.ClaudeMessage `json:"messages"`
+	MaxTokens        uint                   `json:"max_tokens"`
+	StopSequences    []string               `json:"stop_sequences,omitempty"`
+	Temperature      float64                `json:"temperature,omitempty"`
+	TopP             float64                `json:"top_p,omitempty"`
+	TopK             int                    `json:"top_k,omitempty"`
+	Tools            []claude.ClaudeTool    `json:"tools,omitempty"`
+	ToolChoice       any                    `json:"tool_choice,omitempty"`
+}
+
+func copyRequest(req *claude.ClaudeRequest) *AwsClaudeRequest {
+	return &AwsClaudeRequest{
+		AnthropicVersion: "bedrock-2023-05-31",
+		System:           req.System,
+		Messages:         req.Messages,
+		MaxTokens:        req.MaxTokens,
+		StopSequences:    req.StopSequences,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		TopK:             req.TopK,
+		Tools:            req.Tools,
+		ToolChoice:       req.ToolChoice,
+	}
+}
@@ -0,0 +1,148 @@
+package aws
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	relaycommon "one-api/relay/common"
+)
+
+// eventStreamMaxMessageSize 单条消息的最大长度，超过时视为数据损坏
+const eventStreamMaxMessageSize = 16 * 1024 * 1024
+
+// eventStreamDecoder 解析 invoke-with-response-stream 返回的 AWS event stream 二进制分帧：
+// 每条消息依次为总长度(4)、头部长度(4)、前导 CRC(4)、头部、负载和消息 CRC(4)。
+// chunk 事件的负载为 {"bytes":"<base64>"}，解码后即为一条 Claude 流式事件
+type eventStreamDecoder struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+}
+
+func newEventStreamDecoder(body io.ReadCloser) relaycommon.StreamDecoder {
+	return &eventStreamDecoder{
+		body:   body,
+		reader: bufio.NewReader(body),
+	}
+}
+
+type eventStreamChunk struct {
+	Bytes   string `json:"bytes"`
+	Message string `json:"message"`
+}
+
+func (d *eventStreamDecoder) Decode() (relaycommon.StreamEvent, error) {
+	for {
+		headers, payload, err := d.readMessage()
+		if err != nil {
+			return relaycommon.StreamEvent{}, err
+		}
+		var chunk eventStreamChunk
+		_ = json.Unmarshal(payload, &chunk)
+		switch headers[":message-type"] {
+		case "exception", "error":
+			errorType := headers[":exception-type"]
+			if errorType == "" {
+				errorType = headers[":error-code"]
+			}
+			message := chunk.Message
+			if message == "" {
+				message = headers[":error-message"]
+			}
+			return relaycommon.StreamEvent{}, fmt.Errorf("aws event stream %s: %s", errorType, message)
+		}
+		if headers[":event-type"] != "chunk" {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(chunk.Bytes)
+		if err != nil {
+			return relaycommon.StreamEvent{}, fmt.Errorf("decode event stream chunk failed: %w", err)
+		}
+		return relaycommon.StreamEvent{Event: headers[":event-type"], Data: string(data)}, nil
+	}
+}
+
+// readMessage 读取一条消息，校验 CRC 后返回字符串类型的头部和负载
+func (d *eventStreamDecoder) readMessage() (map[string]string, []byte, error) {
+	prelude := make([]byte, 12)
+	if _, err := io.ReadFull(d.reader, prelude); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, nil, errors.New("event stream message truncated")
+		}
+		return nil, nil, err
+	}
+	totalLength := binary.BigEndian.Uint32(prelude[0:4])
+	headersLength := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[0:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, nil, errors.New("event stream prelude checksum mismatch")
+	}
+	if totalLength < 16 || totalLength > eventStreamMaxMessageSize || headersLength > totalLength-16 {
+		return nil, nil, fmt.Errorf("invalid event stream message length %d", totalLength)
+	}
+	message := make([]byte, totalLength)
+	copy(message, prelude)
+	if _, err := io.ReadFull(d.reader, message[12:]); err != nil {
+		return nil, nil, errors.New("event stream message truncated")
+	}
+	if crc32.ChecksumIEEE(message[:totalLength-4]) != binary.BigEndian.Uint32(message[totalLength-4:]) {
+		return nil, nil, errors.New("event stream message checksum mismatch")
+	}
+	headers, err := parseEventStreamHeaders(message[12 : 12+headersLength])
+	if err != nil {
+		return nil, nil, err
+	}
+	return headers, message[12+headersLength : totalLength-4], nil
+}
+
+// parseEventStreamHeaders 解析消息头部，只保留字符串类型的值，其他类型的值跳过
+func parseEventStreamHeaders(data []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	for len(data) > 0 {
+		nameLength := int(data[0])
+		if len(data) < 1+nameLength+1 {
+			return nil, errors.New("invalid event stream header")
+		}
+		name := string(data[1 : 1+nameLength])
+		valueType := data[1+nameLength]
+		data = data[2+nameLength:]
+		var valueLength int
+		switch valueType {
+		case 0, 1: // bool
+			valueLength = 0
+		case 2: // byte
+			valueLength = 1
+		case 3: // short
+			valueLength = 2
+		case 4: // int
+			valueLength = 4
+		case 5, 8: // long, timestamp
+			valueLength = 8
+		case 9: // uuid
+			valueLength = 16
+		case 6, 7: // bytes, string
+			if len(data) < 2 {
+				return nil, errors.New("invalid event stream header")
+			}
+			valueLength = int(binary.BigEndian.Uint16(data[0:2]))
+			data = data[2:]
+		default:
+			return nil, fmt.Errorf("unknown event stream header type %d", valueType)
+		}
+		if len(data) < valueLength {
+			return nil, errors.New("invalid event stream header")
+		}
+		if valueType == 7 {
+			headers[name] = string(data[:valueLength])
+		}
+		data = data[valueLength:]
+	}
+	return headers, nil
+}
+
+func (d *eventStreamDecoder) Close() error {
+	return d.body.Close()
+}
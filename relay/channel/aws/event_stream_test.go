@@ -0,0 +1,145 @@
+package aws
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+)
+
+type eventStreamHeader struct {
+	name  string
+	value string
+}
+
+// encodeEventStreamMessage 按 AWS event stream 分帧编码一条消息，头部全部为字符串类型
+func encodeEventStreamMessage(headers []eventStreamHeader, payload []byte) []byte {
+	var headerBytes bytes.Buffer
+	for _, header := range headers {
+		headerBytes.WriteByte(byte(len(header.name)))
+		headerBytes.WriteString(header.name)
+		headerBytes.WriteByte(7)
+		_ = binary.Write(&headerBytes, binary.BigEndian, uint16(len(header.value)))
+		headerBytes.WriteString(header.value)
+	}
+	totalLength := 12 + headerBytes.Len() + len(payload) + 4
+	message := make([]byte, totalLength)
+	binary.BigEndian.PutUint32(message[0:4], uint32(totalLength))
+	binary.BigEndian.PutUint32(message[4:8], uint32(headerBytes.Len()))
+	binary.BigEndian.PutUint32(message[8:12], crc32.ChecksumIEEE(message[0:8]))
+	copy(message[12:], headerBytes.Bytes())
+	copy(message[12+headerBytes.Len():], payload)
+	binary.BigEndian.PutUint32(message[totalLength-4:], crc32.ChecksumIEEE(message[:totalLength-4]))
+	return message
+}
+
+func chunkMessage(data string) []byte {
+	payload := `{"bytes":"` + base64.StdEncoding.EncodeToString([]byte(data)) + `","p":"abcdefgh"}`
+	return encodeEventStreamMessage([]eventStreamHeader{
+		{name: ":event-type", value: "chunk"},
+		{name: ":content-type", value: "application/json"},
+		{name: ":message-type", value: "event"},
+	}, []byte(payload))
+}
+
+func TestEventStreamDecoder(t *testing.T) {
+	messageStart := `{"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":10}}}`
+	contentDelta := `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`
+	exception := encodeEventStreamMessage([]eventStreamHeader{
+		{name: ":exception-type", value: "throttlingException"},
+		{name: ":content-type", value: "application/json"},
+		{name: ":message-type", value: "exception"},
+	}, []byte(`{"message":"Too many requests"}`))
+	badPrelude := chunkMessage(contentDelta)
+	badPrelude[8] ^= 0xFF
+	badMessage := chunkMessage(contentDelta)
+	badMessage[len(badMessage)-6] ^= 0xFF
+	hugeLength := chunkMessage(contentDelta)
+	binary.BigEndian.PutUint32(hugeLength[0:4], eventStreamMaxMessageSize+1)
+	binary.BigEndian.PutUint32(hugeLength[8:12], crc32.ChecksumIEEE(hugeLength[0:8]))
+
+	tests := []struct {
+		name    string
+		stream  []byte
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "chunks",
+			stream: bytes.Join([][]byte{chunkMessage(messageStart), chunkMessage(contentDelta)}, nil),
+			want:   []string{messageStart, contentDelta},
+		},
+		{
+			name: "non-chunk events are skipped",
+			stream: bytes.Join([][]byte{
+				encodeEventStreamMessage([]eventStreamHeader{{name: ":event-type", value: "initial-response"}, {name: ":message-type", value: "event"}}, []byte(`{}`)),
+				chunkMessage(contentDelta),
+			}, nil),
+			want: []string{contentDelta},
+		},
+		{
+			name:    "exception",
+			stream:  bytes.Join([][]byte{chunkMessage(messageStart), exception}, nil),
+			want:    []string{messageStart},
+			wantErr: "aws event stream throttlingException: Too many requests",
+		},
+		{
+			name:    "prelude checksum mismatch",
+			stream:  badPrelude,
+			wantErr: "event stream prelude checksum mismatch",
+		},
+		{
+			name:    "message checksum mismatch",
+			stream:  bytes.Join([][]byte{chunkMessage(messageStart), badMessage}, nil),
+			want:    []string{messageStart},
+			wantErr: "event stream message checksum mismatch",
+		},
+		{
+			name:    "message too long",
+			stream:  hugeLength,
+			wantErr: "invalid event stream message length",
+		},
+		{
+			name:    "truncated message",
+			stream:  chunkMessage(contentDelta)[:40],
+			wantErr: "event stream message truncated",
+		},
+		{
+			name:    "truncated prelude",
+			stream:  chunkMessage(contentDelta)[:6],
+			wantErr: "event stream message truncated",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoder := newEventStreamDecoder(io.NopCloser(bytes.NewReader(test.stream)))
+			defer decoder.Close()
+			var got []string
+			var err error
+			for {
+				event, decodeErr := decoder.Decode()
+				if decodeErr != nil {
+					err = decodeErr
+					break
+				}
+				if event.Event != "chunk" {
+					t.Errorf("event = %q, want chunk", event.Event)
+				}
+				got = append(got, event.Data)
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("events = %q, want %q", got, test.want)
+			}
+			if test.wantErr == "" {
+				if err != io.EOF {
+					t.Errorf("error = %v, want io.EOF", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
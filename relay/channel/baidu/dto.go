@@ -5,15 +5,25 @@ import (
 	"time"
 )
 
+type BaiduFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Thoughts  string `json:"thoughts,omitempty"`
+}
+
 type BaiduMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role         string             `json:"role"`
+	Content      string             `json:"content"`
+	Name         string             `json:"name,omitempty"`
+	FunctionCall *BaiduFunctionCall `json:"function_call,omitempty"`
 }
 
 type BaiduChatRequest struct {
-	Messages []BaiduMessage `json:"messages"`
-	Stream   bool           `json:"stream"`
-	UserId   string         `json:"user_id,omitempty"`
+	Messages   []BaiduMessage       `json:"messages"`
+	Stream     bool                 `json:"stream"`
+	UserId     string               `json:"user_id,omitempty"`
+	Functions  []dto.OpenAIFunction `json:"functions,omitempty"`
+	ToolChoice any                  `json:"tool_choice,omitempty"`
 }
 
 type Error struct {
@@ -22,13 +32,15 @@ type Error struct {
 }
 
 type BaiduChatResponse struct {
-	Id               string    `json:"id"`
-	Object           string    `json:"object"`
-	Created          int64     `json:"created"`
-	Result           string    `json:"result"`
-	IsTruncated      bool      `json:"is_truncated"`
-	NeedClearHistory bool      `json:"need_clear_history"`
-	Usage            dto.Usage `json:"usage"`
+	Id               string             `json:"id"`
+	Object           string             `json:"object"`
+	Created          int64              `json:"created"`
+	Result           string             `json:"result"`
+	IsTruncated      bool               `json:"is_truncated"`
+	NeedClearHistory bool               `json:"need_clear_history"`
+	FinishReason     string             `json:"finish_reason"`
+	FunctionCall     *BaiduFunctionCall `json:"function_call,omitempty"`
+	Usage            dto.Usage          `json:"usage"`
 	Error
 }
 
@@ -1,15 +1,14 @@
 package baidu
 
 import (
-	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
 	"net/http"
-	"one-api/common"
 	"one-api/dto"
+	"one-api/relay/channel"
 	relaycommon "one-api/relay/common"
 	"one-api/service"
 	"strings"
@@ -23,27 +22,65 @@ var baiduTokenStore sync.Map
 
 func requestOpenAI2Baidu(request dto.GeneralOpenAIRequest) *BaiduChatRequest {
 	messages := make([]BaiduMessage, 0, len(request.Messages))
+	toolCallNames := channel.ToolCallNames(request.Messages)
 	for _, message := range request.Messages {
-		messages = append(messages, BaiduMessage{
+		baiduMessage := BaiduMessage{
 			Role:    message.Role,
 			Content: message.StringContent(),
-		})
+		}
+		switch message.Role {
+		case "assistant":
+			// 文心一言每轮只支持一个函数调用
+			if toolCalls := message.ParseToolCalls(); len(toolCalls) > 0 {
+				baiduMessage.FunctionCall = &BaiduFunctionCall{
+					Name:      toolCalls[0].Function.Name,
+					Arguments: toolCalls[0].Function.Arguments,
+				}
+			}
+		case "tool":
+			baiduMessage.Role = "function"
+			baiduMessage.Name = toolCallNames[message.ToolCallId]
+		}
+		messages = append(messages, baiduMessage)
 	}
-	return &BaiduChatRequest{
+	baiduRequest := BaiduChatRequest{
 		Messages: messages,
 		Stream:   request.Stream,
 	}
+	mode, name := channel.ParseToolChoice(request.ToolChoice)
+	if mode != channel.ToolChoiceNone {
+		baiduRequest.Functions = channel.ParseToolFunctions(request)
+	}
+	if mode == channel.ToolChoiceFunction {
+		baiduRequest.ToolChoice = map[string]any{
+			"type":     "function",
+			"function": map[string]any{"name": name},
+		}
+	}
+	return &baiduRequest
+}
+
+// toolCallsBaidu2OpenAI 将文心一言返回的函数调用转换为 tool_calls
+func toolCallsBaidu2OpenAI(functionCall *BaiduFunctionCall) []dto.ToolCall {
+	if functionCall == nil {
+		return nil
+	}
+	return []dto.ToolCall{channel.NewToolCall("", functionCall.Name, functionCall.Arguments)}
 }
 
 func responseBaidu2OpenAI(response *BaiduChatResponse) *dto.OpenAITextResponse {
 	content, _ := json.Marshal(response.Result)
+	toolCalls := toolCallsBaidu2OpenAI(response.FunctionCall)
 	choice := dto.OpenAITextResponseChoice{
 		Index: 0,
 		Message: dto.Message{
 			Role:    "assistant",
 			Content: content,
 		},
-		FinishReason: "stop",
+		FinishReason: channel.FinishReasonWithToolCalls("stop", len(toolCalls) > 0),
+	}
+	if len(toolCalls) > 0 {
+		choice.Message.ToolCalls = toolCalls
 	}
 	fullTextResponse := dto.OpenAITextResponse{
 		Id:      response.Id,
@@ -55,11 +92,15 @@ func responseBaidu2OpenAI(response *BaiduChatResponse) *dto.OpenAITextResponse {
 	return &fullTextResponse
 }
 
-func streamResponseBaidu2OpenAI(baiduResponse *BaiduChatStreamResponse) *dto.ChatCompletionsStreamResponse {
+func streamResponseBaidu2OpenAI(baiduResponse *BaiduChatStreamResponse, toolCallStream *channel.ToolCallStream) *dto.ChatCompletionsStreamResponse {
 	var choice dto.ChatCompletionsStreamResponseChoice
 	choice.Delta.Content = baiduResponse.Result
+	if toolCalls := toolCallsBaidu2OpenAI(baiduResponse.FunctionCall); len(toolCalls) > 0 {
+		choice.Delta.ToolCalls = toolCallStream.Append(toolCalls)
+	}
 	if baiduResponse.IsEnd {
-		choice.FinishReason = &relaycommon.StopFinishReason
+		finishReason := toolCallStream.FinishReason(relaycommon.StopFinishReason)
+		choice.FinishReason = &finishReason
 	}
 	response := dto.ChatCompletionsStreamResponse{
 		Id:      baiduResponse.Id,
@@ -94,67 +135,25 @@ func embeddingResponseBaidu2OpenAI(response *BaiduEmbeddingResponse) *dto.OpenAI
 	return &openAIEmbeddingResponse
 }
 
-func baiduStreamHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
-	var usage dto.Usage
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		if atEOF && len(data) == 0 {
-			return 0, nil, nil
-		}
-		if i := strings.Index(string(data), "\n"); i >= 0 {
-			return i + 1, data[0:i], nil
-		}
-		if atEOF {
-			return len(data), data, nil
+func baiduStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	var toolCallStream channel.ToolCallStream
+	stream := relaycommon.NewStream(c, info, relaycommon.NewSSEDecoder(resp.Body))
+	usage := stream.Run(func(event relaycommon.StreamEvent) error {
+		var baiduResponse BaiduChatStreamResponse
+		err := json.Unmarshal([]byte(event.Data), &baiduResponse)
+		if err != nil {
+			return err
 		}
-		return 0, nil, nil
-	})
-	dataChan := make(chan string)
-	stopChan := make(chan bool)
-	go func() {
-		for scanner.Scan() {
-			data := scanner.Text()
-			if len(data) < 6 { // ignore blank line or wrong format
-				continue
+		if baiduResponse.Usage.TotalTokens != 0 {
+			stream.Usage = &dto.Usage{
+				PromptTokens:     baiduResponse.Usage.PromptTokens,
+				CompletionTokens: baiduResponse.Usage.TotalTokens - baiduResponse.Usage.PromptTokens,
+				TotalTokens:      baiduResponse.Usage.TotalTokens,
 			}
-			data = data[6:]
-			dataChan <- data
-		}
-		stopChan <- true
-	}()
-	service.SetEventStreamHeaders(c)
-	c.Stream(func(w io.Writer) bool {
-		select {
-		case data := <-dataChan:
-			var baiduResponse BaiduChatStreamResponse
-			err := json.Unmarshal([]byte(data), &baiduResponse)
-			if err != nil {
-				common.SysError("error unmarshalling stream response: " + err.Error())
-				return true
-			}
-			if baiduResponse.Usage.TotalTokens != 0 {
-				usage.TotalTokens = baiduResponse.Usage.TotalTokens
-				usage.PromptTokens = baiduResponse.Usage.PromptTokens
-				usage.CompletionTokens = baiduResponse.Usage.TotalTokens - baiduResponse.Usage.PromptTokens
-			}
-			response := streamResponseBaidu2OpenAI(&baiduResponse)
-			jsonResponse, err := json.Marshal(response)
-			if err != nil {
-				common.SysError("error marshalling stream response: " + err.Error())
-				return true
-			}
-			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonResponse)})
-			return true
-		case <-stopChan:
-			c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
-			return false
 		}
+		return stream.SendResponse(streamResponseBaidu2OpenAI(&baiduResponse, &toolCallStream))
 	})
-	err := resp.Body.Close()
-	if err != nil {
-		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
-	}
-	return nil, &usage
+	return nil, usage
 }
 
 func baiduHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
@@ -0,0 +1,148 @@
+package baidu
+
+import (
+	"encoding/json"
+	"one-api/dto"
+	"one-api/relay/channel"
+	"strings"
+	"testing"
+)
+
+const baiduToolsRequest = `{
+	"model": "ERNIE-Bot-4",
+	"messages": [
+		{"role": "user", "content": "What is the weather in Paris?"},
+		{"role": "assistant", "content": "", "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]},
+		{"role": "tool", "tool_call_id": "call_1", "content": "{\"temperature\":20}"}
+	],
+	"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}]
+}`
+
+func TestRequestOpenAI2BaiduTools(t *testing.T) {
+	tests := []struct {
+		name           string
+		toolChoice     string
+		wantFunctions  bool
+		wantToolChoice string
+	}{
+		{name: "no tool choice", wantFunctions: true},
+		{name: "auto", toolChoice: `"auto"`, wantFunctions: true},
+		{name: "none", toolChoice: `"none"`, wantFunctions: false},
+		{name: "function", toolChoice: `{"type":"function","function":{"name":"get_weather"}}`, wantFunctions: true, wantToolChoice: `{"function":{"name":"get_weather"},"type":"function"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var request dto.GeneralOpenAIRequest
+			if err := json.Unmarshal([]byte(baiduToolsRequest), &request); err != nil {
+				t.Fatal(err)
+			}
+			if test.toolChoice != "" {
+				if err := json.Unmarshal([]byte(test.toolChoice), &request.ToolChoice); err != nil {
+					t.Fatal(err)
+				}
+			}
+			baiduRequest := requestOpenAI2Baidu(request)
+			if test.wantFunctions {
+				if len(baiduRequest.Functions) != 1 || baiduRequest.Functions[0].Name != "get_weather" {
+					t.Errorf("functions = %+v, want get_weather", baiduRequest.Functions)
+				}
+			} else if len(baiduRequest.Functions) != 0 {
+				t.Errorf("functions = %+v, want none", baiduRequest.Functions)
+			}
+			toolChoice := ""
+			if baiduRequest.ToolChoice != nil {
+				data, _ := json.Marshal(baiduRequest.ToolChoice)
+				toolChoice = string(data)
+			}
+			if toolChoice != test.wantToolChoice {
+				t.Errorf("tool_choice = %s, want %s", toolChoice, test.wantToolChoice)
+			}
+
+			assistant := baiduRequest.Messages[1]
+			if assistant.FunctionCall == nil || assistant.FunctionCall.Name != "get_weather" || assistant.FunctionCall.Arguments != `{"city":"Paris"}` {
+				t.Errorf("assistant function_call = %+v", assistant.FunctionCall)
+			}
+			result := baiduRequest.Messages[2]
+			if result.Role != "function" || result.Name != "get_weather" || result.Content != `{"temperature":20}` {
+				t.Errorf("tool result = %+v, want function message named get_weather", result)
+			}
+		})
+	}
+}
+
+func TestResponseBaidu2OpenAIToolCalls(t *testing.T) {
+	tests := []struct {
+		name             string
+		response         string
+		wantFinishReason string
+		wantToolCall     string
+	}{
+		{
+			name:             "function call",
+			response:         `{"id":"as-1","result":"","function_call":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}","thoughts":"need weather"},"usage":{"prompt_tokens":10,"total_tokens":20}}`,
+			wantFinishReason: channel.ToolCallsFinishReason,
+			wantToolCall:     "get_weather",
+		},
+		{
+			name:             "text",
+			response:         `{"id":"as-2","result":"It is sunny.","usage":{"prompt_tokens":10,"total_tokens":20}}`,
+			wantFinishReason: "stop",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var baiduResponse BaiduChatResponse
+			if err := json.Unmarshal([]byte(test.response), &baiduResponse); err != nil {
+				t.Fatal(err)
+			}
+			choice := responseBaidu2OpenAI(&baiduResponse).Choices[0]
+			if choice.FinishReason != test.wantFinishReason {
+				t.Errorf("finish_reason = %q, want %q", choice.FinishReason, test.wantFinishReason)
+			}
+			toolCalls := choice.Message.ParseToolCalls()
+			if test.wantToolCall == "" {
+				if len(toolCalls) != 0 {
+					t.Errorf("tool_calls = %+v, want none", toolCalls)
+				}
+				return
+			}
+			if len(toolCalls) != 1 {
+				t.Fatalf("tool_calls = %+v, want one call", toolCalls)
+			}
+			toolCall := toolCalls[0]
+			if !strings.HasPrefix(toolCall.Id, "call_") || toolCall.Type != "function" || toolCall.Function.Name != test.wantToolCall || toolCall.Function.Arguments != `{"city":"Paris"}` {
+				t.Errorf("tool call = %+v", toolCall)
+			}
+		})
+	}
+}
+
+func TestStreamResponseBaidu2OpenAIToolCalls(t *testing.T) {
+	chunks := []string{
+		`{"id":"as-1","sentence_id":0,"is_end":false,"result":"","function_call":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}`,
+		`{"id":"as-1","sentence_id":1,"is_end":true,"result":"","usage":{"prompt_tokens":10,"total_tokens":20}}`,
+	}
+	var toolCallStream channel.ToolCallStream
+	var toolCalls []dto.ToolCall
+	var finishReason string
+	for _, chunk := range chunks {
+		var baiduResponse BaiduChatStreamResponse
+		if err := json.Unmarshal([]byte(chunk), &baiduResponse); err != nil {
+			t.Fatal(err)
+		}
+		choice := streamResponseBaidu2OpenAI(&baiduResponse, &toolCallStream).Choices[0]
+		toolCalls = append(toolCalls, dto.ParseToolCalls(choice.Delta.ToolCalls)...)
+		if choice.FinishReason != nil {
+			finishReason = *choice.FinishReason
+		}
+	}
+	if len(toolCalls) != 1 {
+		t.Fatalf("tool_calls = %+v, want one call", toolCalls)
+	}
+	if toolCalls[0].Index == nil || *toolCalls[0].Index != 0 || toolCalls[0].Id == "" || toolCalls[0].Function.Name != "get_weather" || toolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("tool call = %+v", toolCalls[0])
+	}
+	if finishReason != channel.ToolCallsFinishReason {
+		t.Errorf("finish_reason = %q, want %q", finishReason, channel.ToolCallsFinishReason)
+	}
+}
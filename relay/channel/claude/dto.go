@@ -5,17 +5,28 @@ type ClaudeMetadata struct {
 }
 
 type ClaudeMediaMessage struct {
-	Type       string               `json:"type"`
+	Type       string               `json:"type,omitempty"`
 	Text       string               `json:"text,omitempty"`
 	Source     *ClaudeMessageSource `json:"source,omitempty"`
 	Usage      *ClaudeUsage         `json:"usage,omitempty"`
 	StopReason *string              `json:"stop_reason,omitempty"`
+	// tool_use
+	Id    string `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Input any    `json:"input,omitempty"`
+	// tool_result
+	ToolUseId string `json:"tool_use_id,omitempty"`
+	Content   any    `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+	// stream only: input_json_delta
+	PartialJson string `json:"partial_json,omitempty"`
 }
 
 type ClaudeMessageSource struct {
 	Type      string `json:"type"`
 	MediaType string `json:"media_type"`
 	Data      string `json:"data"`
+	Url       string `json:"url,omitempty"`
 }
 
 type ClaudeMessage struct {
@@ -23,10 +34,16 @@ type ClaudeMessage struct {
 	Content any    `json:"content"`
 }
 
+type ClaudeTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
 type ClaudeRequest struct {
 	Model             string          `json:"model"`
 	Prompt            string          `json:"prompt,omitempty"`
-	System            string          `json:"system,omitempty"`
+	System            any             `json:"system,omitempty"`
 	Messages          []ClaudeMessage `json:"messages,omitempty"`
 	MaxTokensToSample uint            `json:"max_tokens_to_sample,omitempty"`
 	MaxTokens         uint            `json:"max_tokens,omitempty"`
@@ -34,6 +51,8 @@ type ClaudeRequest struct {
 	Temperature       float64         `json:"temperature,omitempty"`
 	TopP              float64         `json:"top_p,omitempty"`
 	TopK              int             `json:"top_k,omitempty"`
+	Tools             []ClaudeTool    `json:"tools,omitempty"`
+	ToolChoice        any             `json:"tool_choice,omitempty"`
 	//ClaudeMetadata    `json:"metadata,omitempty"`
 	Stream bool `json:"stream,omitempty"`
 }
@@ -44,17 +63,19 @@ type ClaudeError struct {
 }
 
 type ClaudeResponse struct {
-	Id         string               `json:"id"`
-	Type       string               `json:"type"`
-	Content    []ClaudeMediaMessage `json:"content"`
-	Completion string               `json:"completion"`
-	StopReason string               `json:"stop_reason"`
-	Model      string               `json:"model"`
-	Error      ClaudeError          `json:"error"`
-	Usage      ClaudeUsage          `json:"usage"`
-	Index      int                  `json:"index"`   // stream only
-	Delta      *ClaudeMediaMessage  `json:"delta"`   // stream only
-	Message    *ClaudeResponse      `json:"message"` // stream only: message_start
+	Id           string               `json:"id,omitempty"`
+	Type         string               `json:"type"`
+	Role         string               `json:"role,omitempty"`
+	Content      []ClaudeMediaMessage `json:"content"`
+	Completion   string               `json:"completion,omitempty"`
+	StopReason   string               `json:"stop_reason,omitempty"`
+	Model        string               `json:"model,omitempty"`
+	Error        *ClaudeError         `json:"error,omitempty"`
+	Usage        ClaudeUsage          `json:"usage"`
+	Index        int                  `json:"index,omitempty"`         // stream only
+	Delta        *ClaudeMediaMessage  `json:"delta,omitempty"`         // stream only
+	Message      *ClaudeResponse      `json:"message,omitempty"`       // stream only: message_start
+	ContentBlock *ClaudeMediaMessage  `json:"content_block,omitempty"` // stream only: content_block_start
 }
 
 //type ClaudeResponseChoice struct {
@@ -66,3 +87,13 @@ type ClaudeUsage struct {
 	InputTokens  int `json:"input_tokens"`
 	OutputTokens int `json:"output_tokens"`
 }
+
+// ClaudeStreamEvent 用于向 /v1/messages 的客户端输出 Claude 格式的流式事件
+type ClaudeStreamEvent struct {
+	Type         string          `json:"type"`
+	Message      *ClaudeResponse `json:"message,omitempty"`
+	Index        *int            `json:"index,omitempty"`
+	ContentBlock any             `json:"content_block,omitempty"`
+	Delta        any             `json:"delta,omitempty"`
+	Usage        *ClaudeUsage    `json:"usage,omitempty"`
+}
@@ -0,0 +1,417 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"strings"
+)
+
+// 本文件用于 /v1/messages 入口：将 Claude Messages 格式的请求转换为 OpenAI 格式，
+// 交给任意渠道处理后，再将 OpenAI 格式的响应转换回 Claude 格式。
+
+func parseClaudeContent(content any) []ClaudeMediaMessage {
+	if content == nil {
+		return nil
+	}
+	if text, ok := content.(string); ok {
+		return []ClaudeMediaMessage{{Type: "text", Text: text}}
+	}
+	var blocks []ClaudeMediaMessage
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil
+	}
+	_ = json.Unmarshal(data, &blocks)
+	return blocks
+}
+
+func claudeContentText(content any) string {
+	var text strings.Builder
+	for _, block := range parseClaudeContent(content) {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	return text.String()
+}
+
+func stopReasonOpenAI2Claude(reason string) string {
+	switch reason {
+	case "stop":
+		return "end_turn"
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	default:
+		return "end_turn"
+	}
+}
+
+func toolChoiceClaude2OpenAI(toolChoice any) any {
+	choice, ok := toolChoice.(map[string]any)
+	if !ok {
+		return nil
+	}
+	switch choice["type"] {
+	case "auto":
+		return "auto"
+	case "any":
+		return "required"
+	case "none":
+		return "none"
+	case "tool":
+		return map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name": choice["name"],
+			},
+		}
+	}
+	return nil
+}
+
+// RequestClaude2OpenAI 将 Claude Messages 格式的请求转换为 OpenAI 对话补全请求
+func RequestClaude2OpenAI(claudeRequest *ClaudeRequest) (*dto.GeneralOpenAIRequest, error) {
+	textRequest := dto.GeneralOpenAIRequest{
+		Model:       claudeRequest.Model,
+		Stream:      claudeRequest.Stream,
+		MaxTokens:   claudeRequest.MaxTokens,
+		Temperature: claudeRequest.Temperature,
+		TopP:        claudeRequest.TopP,
+		TopK:        claudeRequest.TopK,
+	}
+	if len(claudeRequest.StopSequences) > 0 {
+		textRequest.Stop = claudeRequest.StopSequences
+	}
+	if len(claudeRequest.Tools) > 0 {
+		tools := make([]dto.OpenAITool, 0, len(claudeRequest.Tools))
+		for _, tool := range claudeRequest.Tools {
+			tools = append(tools, dto.OpenAITool{
+				Type: "function",
+				Function: dto.OpenAIFunction{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  tool.InputSchema,
+				},
+			})
+		}
+		textRequest.Tools = tools
+		textRequest.ToolChoice = toolChoiceClaude2OpenAI(claudeRequest.ToolChoice)
+	}
+
+	messages := make([]dto.Message, 0, len(claudeRequest.Messages)+1)
+	if system := claudeContentText(claudeRequest.System); system != "" {
+		content, _ := json.Marshal(system)
+		messages = append(messages, dto.Message{
+			Role:    "system",
+			Content: content,
+		})
+	}
+	for _, claudeMessage := range claudeRequest.Messages {
+		blocks := parseClaudeContent(claudeMessage.Content)
+		if claudeMessage.Role == "assistant" {
+			var text strings.Builder
+			toolCalls := make([]dto.ToolCall, 0)
+			for _, block := range blocks {
+				switch block.Type {
+				case "text":
+					text.WriteString(block.Text)
+				case "tool_use":
+					arguments, _ := json.Marshal(block.Input)
+					toolCalls = append(toolCalls, dto.ToolCall{
+						Id:   block.Id,
+						Type: "function",
+						Function: dto.FunctionCall{
+							Name:      block.Name,
+							Arguments: string(arguments),
+						},
+					})
+				}
+			}
+			message := dto.Message{
+				Role: "assistant",
+			}
+			if text.Len() > 0 || len(toolCalls) == 0 {
+				message.Content, _ = json.Marshal(text.String())
+			}
+			if len(toolCalls) > 0 {
+				message.ToolCalls = toolCalls
+			}
+			messages = append(messages, message)
+			continue
+		}
+
+		// user 消息：tool_result 转换为 tool 消息，其余内容合并为一条 user 消息
+		contentParts := make([]map[string]any, 0)
+		for _, block := range blocks {
+			switch block.Type {
+			case "tool_result":
+				content, _ := json.Marshal(claudeContentText(block.Content))
+				messages = append(messages, dto.Message{
+					Role:       "tool",
+					Content:    content,
+					ToolCallId: block.ToolUseId,
+				})
+			case "text":
+				contentParts = append(contentParts, map[string]any{
+					"type": dto.ContentTypeText,
+					"text": block.Text,
+				})
+			case "image":
+				if block.Source == nil {
+					continue
+				}
+				url := block.Source.Url
+				if block.Source.Type == "base64" {
+					url = fmt.Sprintf("data:%s;base64,%s", block.Source.MediaType, block.Source.Data)
+				}
+				contentParts = append(contentParts, map[string]any{
+					"type": dto.ContentTypeImageURL,
+					"image_url": map[string]any{
+						"url": url,
+					},
+				})
+			}
+		}
+		if len(contentParts) == 0 {
+			continue
+		}
+		message := dto.Message{
+			Role: claudeMessage.Role,
+		}
+		if len(contentParts) == 1 && contentParts[0]["type"] == dto.ContentTypeText {
+			message.Content, _ = json.Marshal(contentParts[0]["text"])
+		} else {
+			message.Content, _ = json.Marshal(contentParts)
+		}
+		messages = append(messages, message)
+	}
+	textRequest.Messages = messages
+	return &textRequest, nil
+}
+
+func toolArguments2Input(arguments string) any {
+	var input any
+	if err := json.Unmarshal([]byte(arguments), &input); err != nil || input == nil {
+		return map[string]any{}
+	}
+	return input
+}
+
+func claudeStreamEvent(event ClaudeStreamEvent) string {
+	jsonStr, err := json.Marshal(event)
+	if err != nil {
+		common.SysError("error marshalling claude stream event: " + err.Error())
+		return ""
+	}
+	return fmt.Sprintf("event: %s\ndata: %s\n\n", event.Type, jsonStr)
+}
+
+type openAI2ClaudeConverter struct {
+	model        string
+	promptTokens int
+
+	// 以下字段仅用于流式响应
+	id             string
+	started        bool
+	blockIndex     int
+	blockType      string
+	toolCallBlocks map[int]int
+	stopReason     string
+}
+
+// NewOpenAI2ClaudeConverter 返回将 OpenAI 格式响应转换为 Claude Messages 格式的转换器
+func NewOpenAI2ClaudeConverter(model string, promptTokens int) relaycommon.ResponseConverter {
+	return &openAI2ClaudeConverter{
+		model:          model,
+		promptTokens:   promptTokens,
+		id:             fmt.Sprintf("msg_%s", common.GetUUID()),
+		blockIndex:     -1,
+		toolCallBlocks: make(map[int]int),
+		stopReason:     "end_turn",
+	}
+}
+
+func (r *openAI2ClaudeConverter) ConvertResponse(body []byte) ([]byte, error) {
+	var textResponse dto.OpenAITextResponse
+	err := json.Unmarshal(body, &textResponse)
+	if err != nil {
+		return nil, err
+	}
+	claudeResponse := ClaudeResponse{
+		Id:         r.id,
+		Type:       "message",
+		Role:       "assistant",
+		Model:      r.model,
+		Content:    make([]ClaudeMediaMessage, 0),
+		StopReason: "end_turn",
+		Usage: ClaudeUsage{
+			InputTokens:  textResponse.PromptTokens,
+			OutputTokens: textResponse.CompletionTokens,
+		},
+	}
+	if len(textResponse.Choices) > 0 {
+		choice := textResponse.Choices[0]
+		claudeResponse.StopReason = stopReasonOpenAI2Claude(choice.FinishReason)
+		if text := choice.Message.StringContent(); text != "" && text != "null" {
+			claudeResponse.Content = append(claudeResponse.Content, ClaudeMediaMessage{
+				Type: "text",
+				Text: text,
+			})
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			claudeResponse.Content = append(claudeResponse.Content, ClaudeMediaMessage{
+				Type:  "tool_use",
+				Id:    toolCall.Id,
+				Name:  toolCall.Function.Name,
+				Input: toolArguments2Input(toolCall.Function.Arguments),
+			})
+		}
+	}
+	return json.Marshal(claudeResponse)
+}
+
+func (r *openAI2ClaudeConverter) messageStart() string {
+	r.started = true
+	return claudeStreamEvent(ClaudeStreamEvent{
+		Type: "message_start",
+		Message: &ClaudeResponse{
+			Id:      r.id,
+			Type:    "message",
+			Role:    "assistant",
+			Model:   r.model,
+			Content: make([]ClaudeMediaMessage, 0),
+			Usage: ClaudeUsage{
+				InputTokens: r.promptTokens,
+			},
+		},
+	})
+}
+
+func (r *openAI2ClaudeConverter) startBlock(blockType string, contentBlock any) string {
+	out := r.stopBlock()
+	r.blockIndex++
+	r.blockType = blockType
+	index := r.blockIndex
+	return out + claudeStreamEvent(ClaudeStreamEvent{
+		Type:         "content_block_start",
+		Index:        &index,
+		ContentBlock: contentBlock,
+	})
+}
+
+func (r *openAI2ClaudeConverter) stopBlock() string {
+	if r.blockType == "" {
+		return ""
+	}
+	r.blockType = ""
+	index := r.blockIndex
+	return claudeStreamEvent(ClaudeStreamEvent{
+		Type:  "content_block_stop",
+		Index: &index,
+	})
+}
+
+func (r *openAI2ClaudeConverter) ConvertStreamData(data string) string {
+	if strings.HasPrefix(data, "[DONE]") {
+		return ""
+	}
+	var streamResponse dto.ChatCompletionsStreamResponse
+	err := json.Unmarshal([]byte(data), &streamResponse)
+	if err != nil {
+		common.SysError("error unmarshalling stream response: " + err.Error())
+		return ""
+	}
+	var out strings.Builder
+	if !r.started {
+		out.WriteString(r.messageStart())
+	}
+	for _, choice := range streamResponse.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if choice.Delta.Content != "" {
+			if r.blockType != "text" {
+				out.WriteString(r.startBlock("text", map[string]any{
+					"type": "text",
+					"text": "",
+				}))
+			}
+			index := r.blockIndex
+			out.WriteString(claudeStreamEvent(ClaudeStreamEvent{
+				Type:  "content_block_delta",
+				Index: &index,
+				Delta: map[string]any{
+					"type": "text_delta",
+					"text": choice.Delta.Content,
+				},
+			}))
+		}
+		for _, toolCall := range dto.ParseToolCalls(choice.Delta.ToolCalls) {
+			toolCallIndex := 0
+			if toolCall.Index != nil {
+				toolCallIndex = *toolCall.Index
+			}
+			blockIndex, ok := r.toolCallBlocks[toolCallIndex]
+			if !ok {
+				id := toolCall.Id
+				if id == "" {
+					id = fmt.Sprintf("toolu_%s", common.GetUUID())
+				}
+				out.WriteString(r.startBlock("tool_use", map[string]any{
+					"type":  "tool_use",
+					"id":    id,
+					"name":  toolCall.Function.Name,
+					"input": map[string]any{},
+				}))
+				blockIndex = r.blockIndex
+				r.toolCallBlocks[toolCallIndex] = blockIndex
+			}
+			if toolCall.Function.Arguments != "" {
+				out.WriteString(claudeStreamEvent(ClaudeStreamEvent{
+					Type:  "content_block_delta",
+					Index: &blockIndex,
+					Delta: map[string]any{
+						"type":         "input_json_delta",
+						"partial_json": toolCall.Function.Arguments,
+					},
+				}))
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			r.stopReason = stopReasonOpenAI2Claude(*choice.FinishReason)
+		}
+	}
+	return out.String()
+}
+
+func (r *openAI2ClaudeConverter) FinishStream(usage *dto.Usage) string {
+	var out strings.Builder
+	if !r.started {
+		out.WriteString(r.messageStart())
+	}
+	out.WriteString(r.stopBlock())
+	claudeUsage := ClaudeUsage{
+		InputTokens: r.promptTokens,
+	}
+	if usage != nil {
+		claudeUsage.InputTokens = usage.PromptTokens
+		claudeUsage.OutputTokens = usage.CompletionTokens
+	}
+	out.WriteString(claudeStreamEvent(ClaudeStreamEvent{
+		Type: "message_delta",
+		Delta: map[string]any{
+			"stop_reason":   r.stopReason,
+			"stop_sequence": nil,
+		},
+		Usage: &claudeUsage,
+	}))
+	out.WriteString(claudeStreamEvent(ClaudeStreamEvent{
+		Type: "message_stop",
+	}))
+	return out.String()
+}
@@ -0,0 +1,185 @@
+package claude
+
+import (
+	"encoding/json"
+	"one-api/dto"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRequestClaude2OpenAI(t *testing.T) {
+	tests := []struct {
+		name           string
+		request        string
+		wantMessages   string
+		wantToolChoice string
+	}{
+		{
+			name:         "system text",
+			request:      `{"model":"claude-3-5-sonnet","system":"Be brief.","messages":[{"role":"user","content":"Hi"}]}`,
+			wantMessages: `[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]`,
+		},
+		{
+			name:         "system blocks",
+			request:      `{"model":"claude-3-5-sonnet","system":[{"type":"text","text":"Be "},{"type":"text","text":"brief."}],"messages":[{"role":"user","content":[{"type":"text","text":"Hi"}]}]}`,
+			wantMessages: `[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]`,
+		},
+		{
+			name:         "image",
+			request:      `{"model":"claude-3-5-sonnet","messages":[{"role":"user","content":[{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBO"}},{"type":"text","text":"What is this?"}]}]}`,
+			wantMessages: `[{"role":"user","content":[{"image_url":{"url":"data:image/png;base64,iVBO"},"type":"image_url"},{"text":"What is this?","type":"text"}]}]`,
+		},
+		{
+			name: "tool use and result",
+			request: `{"model":"claude-3-5-sonnet","tools":[{"name":"get_weather","input_schema":{"type":"object"}}],"tool_choice":{"type":"any"},"messages":[
+				{"role":"user","content":"Weather in Paris?"},
+				{"role":"assistant","content":[{"type":"text","text":"Checking."},{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}]},
+				{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"20C"}]}]}
+			]}`,
+			wantMessages: `[{"role":"user","content":"Weather in Paris?"},` +
+				`{"role":"assistant","content":"Checking.","tool_calls":[{"id":"toolu_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},` +
+				`{"role":"tool","content":"20C","tool_call_id":"toolu_1"}]`,
+			wantToolChoice: `"required"`,
+		},
+		{
+			name:           "tool choice by name",
+			request:        `{"model":"claude-3-5-sonnet","tools":[{"name":"get_weather","input_schema":{"type":"object"}}],"tool_choice":{"type":"tool","name":"get_weather"},"messages":[{"role":"user","content":"Hi"}]}`,
+			wantMessages:   `[{"role":"user","content":"Hi"}]`,
+			wantToolChoice: `{"function":{"name":"get_weather"},"type":"function"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var claudeRequest ClaudeRequest
+			if err := json.Unmarshal([]byte(test.request), &claudeRequest); err != nil {
+				t.Fatal(err)
+			}
+			textRequest, err := RequestClaude2OpenAI(&claudeRequest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages, _ := json.Marshal(textRequest.Messages)
+			if string(messages) != test.wantMessages {
+				t.Errorf("messages = %s, want %s", messages, test.wantMessages)
+			}
+			toolChoice := ""
+			if textRequest.ToolChoice != nil {
+				data, _ := json.Marshal(textRequest.ToolChoice)
+				toolChoice = string(data)
+			}
+			if toolChoice != test.wantToolChoice {
+				t.Errorf("tool_choice = %s, want %s", toolChoice, test.wantToolChoice)
+			}
+		})
+	}
+}
+
+func TestOpenAI2ClaudeConverterResponse(t *testing.T) {
+	body := `{"id":"chatcmpl-1","object":"chat.completion","created":1,"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Checking.","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`
+	converter := NewOpenAI2ClaudeConverter("claude-3-5-sonnet", 10)
+	data, err := converter.ConvertResponse([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response ClaudeResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Model != "claude-3-5-sonnet" || response.StopReason != "tool_use" {
+		t.Errorf("model = %s, stop_reason = %s, want claude-3-5-sonnet tool_use", response.Model, response.StopReason)
+	}
+	if response.Usage.InputTokens != 10 || response.Usage.OutputTokens != 5 {
+		t.Errorf("usage = %+v, want 10 input and 5 output tokens", response.Usage)
+	}
+	content, _ := json.Marshal(response.Content)
+	want := `[{"type":"text","text":"Checking."},{"type":"tool_use","id":"call_1","name":"get_weather","input":{"city":"Paris"}}]`
+	if string(content) != want {
+		t.Errorf("content = %s, want %s", content, want)
+	}
+}
+
+func TestOpenAI2ClaudeConverterStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		usage  *dto.Usage
+		// want 每个事件的类型和内容块序号，message_delta 后面是 stop_reason
+		want []string
+	}{
+		{
+			name: "text",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`,
+			},
+			usage: &dto.Usage{PromptTokens: 10, CompletionTokens: 2},
+			want: []string{
+				"message_start", "content_block_start 0", "content_block_delta 0", "content_block_delta 0",
+				"content_block_stop 0", "message_delta max_tokens", "message_stop",
+			},
+		},
+		{
+			name: "text then tool calls",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","content":"Checking."}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":\"Paris\"}"}}]}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"get_time","arguments":"{}"}}]}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+				`[DONE]`,
+			},
+			want: []string{
+				"message_start", "content_block_start 0", "content_block_delta 0",
+				"content_block_stop 0", "content_block_start 1", "content_block_delta 1",
+				"content_block_stop 1", "content_block_start 2", "content_block_delta 2",
+				"content_block_stop 2", "message_delta tool_use", "message_stop",
+			},
+		},
+		{
+			name: "empty stream",
+			want: []string{"message_start", "message_delta end_turn", "message_stop"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			converter := NewOpenAI2ClaudeConverter("claude-3-5-sonnet", 10)
+			var out strings.Builder
+			for _, chunk := range test.chunks {
+				out.WriteString(converter.ConvertStreamData(chunk))
+			}
+			out.WriteString(converter.FinishStream(test.usage))
+
+			var got []string
+			for _, block := range strings.Split(strings.TrimSpace(out.String()), "\n\n") {
+				lines := strings.SplitN(block, "\n", 2)
+				if len(lines) != 2 || !strings.HasPrefix(lines[0], "event: ") || !strings.HasPrefix(lines[1], "data: ") {
+					t.Fatalf("malformed event %q", block)
+				}
+				var event ClaudeStreamEvent
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &event); err != nil {
+					t.Fatal(err)
+				}
+				if event.Type != strings.TrimPrefix(lines[0], "event: ") {
+					t.Errorf("event %s has type %s", lines[0], event.Type)
+				}
+				description := event.Type
+				if event.Index != nil {
+					description += " " + strconv.Itoa(*event.Index)
+				}
+				if event.Type == "message_delta" {
+					delta, _ := event.Delta.(map[string]any)
+					description += " " + delta["stop_reason"].(string)
+					if test.usage != nil && (event.Usage == nil || event.Usage.OutputTokens != test.usage.CompletionTokens) {
+						t.Errorf("message_delta usage = %+v, want %d output tokens", event.Usage, test.usage.CompletionTokens)
+					}
+				}
+				got = append(got, description)
+			}
+			if strings.Join(got, ", ") != strings.Join(test.want, ", ") {
+				t.Errorf("events = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package claude
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -10,6 +9,8 @@ import (
 	"one-api/common"
 	"one-api/constant"
 	"one-api/dto"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
 	"one-api/service"
 	"strings"
 )
@@ -22,11 +23,67 @@ func stopReasonClaude2OpenAI(reason string) string {
 		return "stop"
 	case "max_tokens":
 		return "length"
+	case "tool_use":
+		return "tool_calls"
 	default:
 		return reason
 	}
 }
 
+func toolChoiceOpenAI2Claude(toolChoice any) any {
+	mode, name := channel.ParseToolChoice(toolChoice)
+	switch mode {
+	case channel.ToolChoiceAuto:
+		return map[string]any{"type": "auto"}
+	case channel.ToolChoiceRequired:
+		return map[string]any{"type": "any"}
+	case channel.ToolChoiceNone:
+		return map[string]any{"type": "none"}
+	case channel.ToolChoiceFunction:
+		return map[string]any{"type": "tool", "name": name}
+	}
+	return nil
+}
+
+// openAIMessageText 返回消息中的文本内容，多模态内容只保留文本部分
+func openAIMessageText(message dto.Message) string {
+	if message.IsStringContent() {
+		return message.StringContent()
+	}
+	var text strings.Builder
+	for _, mediaMessage := range message.ParseContent() {
+		if mediaMessage.Type == dto.ContentTypeText {
+			text.WriteString(mediaMessage.Text)
+		}
+	}
+	return text.String()
+}
+
+// claudeContentBlocks 将 string 或 []ClaudeMediaMessage 形式的消息内容统一转换为内容块列表，忽略空文本
+func claudeContentBlocks(content any) []ClaudeMediaMessage {
+	switch content := content.(type) {
+	case string:
+		if content == "" {
+			return nil
+		}
+		return []ClaudeMediaMessage{{Type: "text", Text: content}}
+	case []ClaudeMediaMessage:
+		return content
+	}
+	return nil
+}
+
+// appendClaudeMessage 追加消息，Claude 要求 user 与 assistant 消息交替出现，相同角色的相邻消息会被合并，
+// 例如多个连续的 tool 消息会合并为一条包含多个 tool_result 的 user 消息
+func appendClaudeMessage(claudeMessages []ClaudeMessage, claudeMessage ClaudeMessage) []ClaudeMessage {
+	if len(claudeMessages) == 0 || claudeMessages[len(claudeMessages)-1].Role != claudeMessage.Role {
+		return append(claudeMessages, claudeMessage)
+	}
+	last := &claudeMessages[len(claudeMessages)-1]
+	last.Content = append(claudeContentBlocks(last.Content), claudeContentBlocks(claudeMessage.Content)...)
+	return claudeMessages
+}
+
 func requestOpenAI2ClaudeComplete(textRequest dto.GeneralOpenAIRequest) *ClaudeRequest {
 	claudeRequest := ClaudeRequest{
 		Model:             textRequest.Model,
@@ -57,7 +114,8 @@ func requestOpenAI2ClaudeComplete(textRequest dto.GeneralOpenAIRequest) *ClaudeR
 	return &claudeRequest
 }
 
-func requestOpenAI2ClaudeMessage(textRequest dto.GeneralOpenAIRequest) (*ClaudeRequest, error) {
+// RequestOpenAI2ClaudeMessage 将 OpenAI 格式的请求转换为 Claude Messages 格式
+func RequestOpenAI2ClaudeMessage(textRequest dto.GeneralOpenAIRequest) (*ClaudeRequest, error) {
 	claudeRequest := ClaudeRequest{
 		Model:         textRequest.Model,
 		MaxTokens:     textRequest.MaxTokens,
@@ -69,10 +127,41 @@ func requestOpenAI2ClaudeMessage(textRequest dto.GeneralOpenAIRequest) (*ClaudeR
 	if claudeRequest.MaxTokens == 0 {
 		claudeRequest.MaxTokens = 4096
 	}
+	if tools := channel.ParseTools(textRequest); len(tools) > 0 {
+		claudeTools := make([]ClaudeTool, 0, len(tools))
+		for _, tool := range tools {
+			inputSchema := tool.Function.Parameters
+			if inputSchema == nil {
+				inputSchema = map[string]any{
+					"type":       "object",
+					"properties": map[string]any{},
+				}
+			}
+			claudeTools = append(claudeTools, ClaudeTool{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				InputSchema: inputSchema,
+			})
+		}
+		claudeRequest.Tools = claudeTools
+		claudeRequest.ToolChoice = toolChoiceOpenAI2Claude(textRequest.ToolChoice)
+	}
 	claudeMessages := make([]ClaudeMessage, 0)
 	for _, message := range textRequest.Messages {
 		if message.Role == "system" {
 			claudeRequest.System = message.StringContent()
+		} else if message.Role == "tool" {
+			// tool 消息转换为 user 消息中的 tool_result 块
+			claudeMessages = appendClaudeMessage(claudeMessages, ClaudeMessage{
+				Role: "user",
+				Content: []ClaudeMediaMessage{
+					{
+						Type:      "tool_result",
+						ToolUseId: message.ToolCallId,
+						Content:   openAIMessageText(message),
+					},
+				},
+			})
 		} else {
 			claudeMessage := ClaudeMessage{
 				Role: message.Role,
@@ -112,7 +201,20 @@ func requestOpenAI2ClaudeMessage(textRequest dto.GeneralOpenAIRequest) (*ClaudeR
 				}
 				claudeMessage.Content = claudeMediaMessages
 			}
-			claudeMessages = append(claudeMessages, claudeMessage)
+			// assistant 消息中的 tool_calls 转换为 tool_use 块
+			if toolCalls := message.ParseToolCalls(); len(toolCalls) > 0 {
+				contentBlocks := claudeContentBlocks(claudeMessage.Content)
+				for _, toolCall := range toolCalls {
+					contentBlocks = append(contentBlocks, ClaudeMediaMessage{
+						Type:  "tool_use",
+						Id:    toolCall.Id,
+						Name:  toolCall.Function.Name,
+						Input: channel.ToolArgumentsObject(toolCall.Function.Arguments),
+					})
+				}
+				claudeMessage.Content = contentBlocks
+			}
+			claudeMessages = appendClaudeMessage(claudeMessages, claudeMessage)
 		}
 	}
 	claudeRequest.Prompt = ""
@@ -121,7 +223,8 @@ func requestOpenAI2ClaudeMessage(textRequest dto.GeneralOpenAIRequest) (*ClaudeR
 	return &claudeRequest, nil
 }
 
-func streamResponseClaude2OpenAI(reqMode int, claudeResponse *ClaudeResponse) (*dto.ChatCompletionsStreamResponse, *ClaudeUsage) {
+// streamResponseClaude2OpenAI 转换一条 Claude 流式事件，toolCallIndexes 记录 tool_use 内容块下标到 OpenAI tool_calls 下标的映射
+func streamResponseClaude2OpenAI(reqMode int, claudeResponse *ClaudeResponse, toolCallIndexes map[int]int) (*dto.ChatCompletionsStreamResponse, *ClaudeUsage) {
 	var response dto.ChatCompletionsStreamResponse
 	var claudeUsage *ClaudeUsage
 	response.Object = "chat.completion.chunk"
@@ -139,9 +242,36 @@ func streamResponseClaude2OpenAI(reqMode int, claudeResponse *ClaudeResponse) (*
 			response.Id = claudeResponse.Message.Id
 			response.Model = claudeResponse.Message.Model
 			claudeUsage = &claudeResponse.Message.Usage
+		} else if claudeResponse.Type == "content_block_start" {
+			if claudeResponse.ContentBlock != nil && claudeResponse.ContentBlock.Type == "tool_use" {
+				toolCallIndex := len(toolCallIndexes)
+				toolCallIndexes[claudeResponse.Index] = toolCallIndex
+				choice.Delta.ToolCalls = []dto.ToolCall{
+					{
+						Index: &toolCallIndex,
+						Id:    claudeResponse.ContentBlock.Id,
+						Type:  "function",
+						Function: dto.FunctionCall{
+							Name:      claudeResponse.ContentBlock.Name,
+							Arguments: "",
+						},
+					},
+				}
+			}
 		} else if claudeResponse.Type == "content_block_delta" {
-			choice.Index = claudeResponse.Index
-			choice.Delta.Content = claudeResponse.Delta.Text
+			if claudeResponse.Delta.Type == "input_json_delta" {
+				toolCallIndex := toolCallIndexes[claudeResponse.Index]
+				choice.Delta.ToolCalls = []dto.ToolCall{
+					{
+						Index: &toolCallIndex,
+						Function: dto.FunctionCall{
+							Arguments: claudeResponse.Delta.PartialJson,
+						},
+					},
+				}
+			} else {
+				choice.Delta.Content = claudeResponse.Delta.Text
+			}
 		} else if claudeResponse.Type == "message_delta" {
 			finishReason := stopReasonClaude2OpenAI(*claudeResponse.Delta.StopReason)
 			if finishReason != "null" {
@@ -178,120 +308,95 @@ func responseClaude2OpenAI(reqMode int, claudeResponse *ClaudeResponse) *dto.Ope
 		choices = append(choices, choice)
 	} else {
 		fullTextResponse.Id = claudeResponse.Id
-		for i, message := range claudeResponse.Content {
-			content, _ := json.Marshal(message.Text)
-			choice := dto.OpenAITextResponseChoice{
-				Index: i,
-				Message: dto.Message{
-					Role:    "assistant",
-					Content: content,
-				},
-				FinishReason: stopReasonClaude2OpenAI(claudeResponse.StopReason),
+		// 所有文本块合并为一条消息，tool_use 块转换为 tool_calls
+		var text strings.Builder
+		toolCalls := make([]dto.ToolCall, 0)
+		for _, message := range claudeResponse.Content {
+			if message.Type == "tool_use" {
+				arguments, _ := json.Marshal(message.Input)
+				toolCalls = append(toolCalls, dto.ToolCall{
+					Id:   message.Id,
+					Type: "function",
+					Function: dto.FunctionCall{
+						Name:      message.Name,
+						Arguments: string(arguments),
+					},
+				})
+			} else {
+				text.WriteString(message.Text)
 			}
-			choices = append(choices, choice)
 		}
+		content, _ := json.Marshal(text.String())
+		choice := dto.OpenAITextResponseChoice{
+			Index: 0,
+			Message: dto.Message{
+				Role:    "assistant",
+				Content: content,
+			},
+			FinishReason: stopReasonClaude2OpenAI(claudeResponse.StopReason),
+		}
+		if len(toolCalls) > 0 {
+			choice.Message.ToolCalls = toolCalls
+		}
+		choices = append(choices, choice)
 	}
 
 	fullTextResponse.Choices = choices
 	return &fullTextResponse
 }
 
-func claudeStreamHandler(requestMode int, modelName string, promptTokens int, c *gin.Context, resp *http.Response) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+// ClaudeStreamHandler 将 decoder 读出的 Claude 流式事件转换为 OpenAI 格式的数据块写给客户端，
+// 上游的事件分帧方式由 decoder 决定，如 Anthropic 的 SSE 和 AWS Bedrock 的 event stream
+func ClaudeStreamHandler(requestMode int, c *gin.Context, decoder relaycommon.StreamDecoder, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	modelName := info.UpstreamModelName
 	responseId := fmt.Sprintf("chatcmpl-%s", common.GetUUID())
-	var usage *dto.Usage
-	usage = &dto.Usage{}
-	responseText := ""
+	usage := &dto.Usage{}
 	createdTime := common.GetTimestamp()
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		if atEOF && len(data) == 0 {
-			return 0, nil, nil
-		}
-		if i := strings.Index(string(data), "\n"); i >= 0 {
-			return i + 1, data[0:i], nil
-		}
-		if atEOF {
-			return len(data), data, nil
-		}
-		return 0, nil, nil
-	})
-	dataChan := make(chan string)
-	stopChan := make(chan bool)
-	go func() {
-		for scanner.Scan() {
-			data := scanner.Text()
-			if !strings.HasPrefix(data, "data: ") {
-				continue
-			}
-			data = strings.TrimPrefix(data, "data: ")
-			dataChan <- data
+	toolCallIndexes := make(map[int]int)
+	stream := relaycommon.NewStream(c, info, decoder)
+	stream.Usage = usage
+	return nil, stream.Run(func(event relaycommon.StreamEvent) error {
+		var claudeResponse ClaudeResponse
+		err := json.Unmarshal([]byte(event.Data), &claudeResponse)
+		if err != nil {
+			return err
 		}
-		stopChan <- true
-	}()
-	service.SetEventStreamHeaders(c)
-	c.Stream(func(w io.Writer) bool {
-		select {
-		case data := <-dataChan:
-			// some implementations may add \r at the end of data
-			data = strings.TrimSuffix(data, "\r")
-			var claudeResponse ClaudeResponse
-			err := json.Unmarshal([]byte(data), &claudeResponse)
-			if err != nil {
-				common.SysError("error unmarshalling stream response: " + err.Error())
-				return true
-			}
 
-			response, claudeUsage := streamResponseClaude2OpenAI(requestMode, &claudeResponse)
-			if requestMode == RequestModeCompletion {
-				responseText += claudeResponse.Completion
-				responseId = response.Id
-			} else {
-				if claudeResponse.Type == "message_start" {
-					// message_start, 获取usage
-					responseId = claudeResponse.Message.Id
-					modelName = claudeResponse.Message.Model
+		response, claudeUsage := streamResponseClaude2OpenAI(requestMode, &claudeResponse, toolCallIndexes)
+		if requestMode == RequestModeCompletion {
+			responseId = response.Id
+		} else {
+			switch claudeResponse.Type {
+			case "message_start":
+				// message_start, 获取usage
+				responseId = claudeResponse.Message.Id
+				modelName = claudeResponse.Message.Model
+				usage.PromptTokens = claudeUsage.InputTokens
+			case "content_block_start":
+				if response.Choices[0].Delta.ToolCalls == nil {
+					return nil
+				}
+			case "content_block_delta":
+				// 文本和工具调用参数的增量直接转发
+			case "message_delta":
+				// message_delta 中的 output_tokens 是累计值
+				if claudeUsage.InputTokens > 0 {
 					usage.PromptTokens = claudeUsage.InputTokens
-				} else if claudeResponse.Type == "content_block_delta" {
-					responseText += claudeResponse.Delta.Text
-				} else if claudeResponse.Type == "message_delta" {
-					usage.CompletionTokens = claudeUsage.OutputTokens
-					usage.TotalTokens = claudeUsage.InputTokens + claudeUsage.OutputTokens
-				} else {
-					return true
 				}
+				usage.CompletionTokens = claudeUsage.OutputTokens
+				usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+			default:
+				return nil
 			}
-			//response.Id = responseId
-			response.Id = responseId
-			response.Created = createdTime
-			response.Model = modelName
-
-			jsonStr, err := json.Marshal(response)
-			if err != nil {
-				common.SysError("error marshalling stream response: " + err.Error())
-				return true
-			}
-			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonStr)})
-			return true
-		case <-stopChan:
-			c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
-			return false
 		}
+		response.Id = responseId
+		response.Created = createdTime
+		response.Model = modelName
+		return stream.SendResponse(response)
 	})
-	err := resp.Body.Close()
-	if err != nil {
-		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
-	}
-	if requestMode == RequestModeCompletion {
-		usage, _ = service.ResponseText2Usage(responseText, modelName, promptTokens)
-	} else {
-		if usage.CompletionTokens == 0 {
-			usage, _ = service.ResponseText2Usage(responseText, modelName, usage.PromptTokens)
-		}
-	}
-	return nil, usage
 }
 
-func claudeHandler(requestMode int, c *gin.Context, resp *http.Response, promptTokens int, model string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+func ClaudeHandler(requestMode int, c *gin.Context, resp *http.Response, promptTokens int, model string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
@@ -305,7 +410,7 @@ func claudeHandler(requestMode int, c *gin.Context, resp *http.Response, promptT
 	if err != nil {
 		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
 	}
-	if claudeResponse.Error.Type != "" {
+	if claudeResponse.Error != nil && claudeResponse.Error.Type != "" {
 		return &dto.OpenAIErrorWithStatusCode{
 			Error: dto.OpenAIError{
 				Message: claudeResponse.Error.Message,
@@ -0,0 +1,18 @@
+package cohere
+
+var ModelList = []string{
+	"command-r",
+	"command-r-plus",
+	"command",
+	"command-light",
+	"embed-english-v3.0",
+	"embed-multilingual-v3.0",
+	"embed-english-light-v3.0",
+	"embed-multilingual-light-v3.0",
+	"rerank-english-v3.0",
+	"rerank-multilingual-v3.0",
+	"rerank-english-v2.0",
+	"rerank-multilingual-v2.0",
+}
+
+var ChannelName = "cohere"
@@ -0,0 +1,90 @@
+package cohere
+
+type CohereChatMessage struct {
+	Role    string `json:"role"`
+	Message string `json:"message"`
+}
+
+type CohereRequest struct {
+	Model         string              `json:"model,omitempty"`
+	Message       string              `json:"message"`
+	ChatHistory   []CohereChatMessage `json:"chat_history,omitempty"`
+	Preamble      string              `json:"preamble,omitempty"`
+	Stream        bool                `json:"stream,omitempty"`
+	MaxTokens     uint                `json:"max_tokens,omitempty"`
+	Temperature   float64             `json:"temperature,omitempty"`
+	P             float64             `json:"p,omitempty"`
+	K             int                 `json:"k,omitempty"`
+	Seed          float64             `json:"seed,omitempty"`
+	StopSequences any                 `json:"stop_sequences,omitempty"`
+}
+
+type CohereTokens struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type CohereMeta struct {
+	BilledUnits struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+		SearchUnits  int `json:"search_units"`
+	} `json:"billed_units"`
+	Tokens *CohereTokens `json:"tokens,omitempty"`
+}
+
+type CohereResponse struct {
+	ResponseId   string      `json:"response_id"`
+	GenerationId string      `json:"generation_id"`
+	Text         string      `json:"text"`
+	FinishReason string      `json:"finish_reason"`
+	Meta         *CohereMeta `json:"meta"`
+	Message      string      `json:"message"` // 出错时的错误信息
+}
+
+// CohereStreamResponse 流式响应的一行，stream-end 事件中带有完整的响应
+type CohereStreamResponse struct {
+	IsFinished   bool            `json:"is_finished"`
+	EventType    string          `json:"event_type"`
+	GenerationId string          `json:"generation_id"`
+	Text         string          `json:"text"`
+	FinishReason string          `json:"finish_reason"`
+	Response     *CohereResponse `json:"response"`
+}
+
+type CohereEmbeddingRequest struct {
+	Model     string   `json:"model"`
+	Texts     []string `json:"texts"`
+	InputType string   `json:"input_type"`
+}
+
+type CohereEmbeddingResponse struct {
+	Id         string      `json:"id"`
+	Embeddings [][]float64 `json:"embeddings"`
+	Meta       *CohereMeta `json:"meta"`
+	Message    string      `json:"message"`
+}
+
+type CohereRerankRequest struct {
+	Model           string `json:"model"`
+	Query           string `json:"query"`
+	Documents       []any  `json:"documents"`
+	TopN            int    `json:"top_n,omitempty"`
+	ReturnDocuments bool   `json:"return_documents"`
+	MaxChunksPerDoc int    `json:"max_chunks_per_doc,omitempty"`
+}
+
+type CohereRerankResult struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+	Document       *struct {
+		Text string `json:"text"`
+	} `json:"document,omitempty"`
+}
+
+type CohereRerankResponse struct {
+	Id      string               `json:"id"`
+	Results []CohereRerankResult `json:"results"`
+	Meta    *CohereMeta          `json:"meta"`
+	Message string               `json:"message"`
+}
@@ -0,0 +1,283 @@
+package cohere
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+)
+
+func stopReasonCohere2OpenAI(reason string) string {
+	switch reason {
+	case "COMPLETE":
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	default:
+		return reason
+	}
+}
+
+// requestOpenAI2Cohere 最后一条消息作为 message，之前的消息作为 chat_history，system 消息作为 preamble
+func requestOpenAI2Cohere(textRequest dto.GeneralOpenAIRequest) *CohereRequest {
+	cohereRequest := CohereRequest{
+		Model:       textRequest.Model,
+		Stream:      textRequest.Stream,
+		MaxTokens:   textRequest.MaxTokens,
+		Temperature: textRequest.Temperature,
+		P:           textRequest.TopP,
+		K:           textRequest.TopK,
+		Seed:        textRequest.Seed,
+	}
+	switch stop := textRequest.Stop.(type) {
+	case string:
+		cohereRequest.StopSequences = []string{stop}
+	case []any:
+		cohereRequest.StopSequences = stop
+	}
+	chatHistory := make([]CohereChatMessage, 0, len(textRequest.Messages))
+	for _, message := range textRequest.Messages {
+		switch message.Role {
+		case "system":
+			cohereRequest.Preamble = message.StringContent()
+		case "assistant":
+			chatHistory = append(chatHistory, CohereChatMessage{Role: "CHATBOT", Message: message.StringContent()})
+		default:
+			chatHistory = append(chatHistory, CohereChatMessage{Role: "USER", Message: message.StringContent()})
+		}
+	}
+	if len(chatHistory) > 0 {
+		cohereRequest.Message = chatHistory[len(chatHistory)-1].Message
+		chatHistory = chatHistory[:len(chatHistory)-1]
+	}
+	cohereRequest.ChatHistory = chatHistory
+	return &cohereRequest
+}
+
+func embeddingRequestOpenAI2Cohere(request dto.GeneralOpenAIRequest) *CohereEmbeddingRequest {
+	return &CohereEmbeddingRequest{
+		Model:     request.Model,
+		Texts:     request.ParseInput(),
+		InputType: "search_document",
+	}
+}
+
+func rerankRequestOpenAI2Cohere(request dto.RerankRequest) *CohereRerankRequest {
+	cohereRequest := CohereRerankRequest{
+		Model:           request.Model,
+		Query:           request.Query,
+		Documents:       request.Documents,
+		TopN:            request.TopN,
+		ReturnDocuments: true,
+		MaxChunksPerDoc: request.MaxChunksPerDoc,
+	}
+	if request.ReturnDocuments != nil {
+		cohereRequest.ReturnDocuments = *request.ReturnDocuments
+	}
+	return &cohereRequest
+}
+
+// usageCohere2OpenAI 优先使用计费的 token 数，没有时使用 meta.tokens
+func usageCohere2OpenAI(meta *CohereMeta) *dto.Usage {
+	if meta == nil {
+		return nil
+	}
+	inputTokens, outputTokens := meta.BilledUnits.InputTokens, meta.BilledUnits.OutputTokens
+	if inputTokens+outputTokens == 0 && meta.Tokens != nil {
+		inputTokens, outputTokens = meta.Tokens.InputTokens, meta.Tokens.OutputTokens
+	}
+	if inputTokens+outputTokens == 0 {
+		return nil
+	}
+	return &dto.Usage{
+		PromptTokens:     inputTokens,
+		CompletionTokens: outputTokens,
+		TotalTokens:      inputTokens + outputTokens,
+	}
+}
+
+func readResponseBody(resp *http.Response) ([]byte, *dto.OpenAIErrorWithStatusCode) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return nil, service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+	return responseBody, nil
+}
+
+func cohereError(message string, statusCode int) *dto.OpenAIErrorWithStatusCode {
+	return &dto.OpenAIErrorWithStatusCode{
+		Error: dto.OpenAIError{
+			Message: message,
+			Type:    "cohere_error",
+			Code:    "cohere_error",
+		},
+		StatusCode: statusCode,
+	}
+}
+
+func writeJSON(c *gin.Context, statusCode int, response any) *dto.OpenAIErrorWithStatusCode {
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError)
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(statusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+	return nil
+}
+
+func cohereHandler(c *gin.Context, resp *http.Response, promptTokens int, model string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, openaiErr := readResponseBody(resp)
+	if openaiErr != nil {
+		return openaiErr, nil
+	}
+	var cohereResponse CohereResponse
+	err := json.Unmarshal(responseBody, &cohereResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if cohereResponse.Message != "" && cohereResponse.Text == "" {
+		return cohereError(cohereResponse.Message, resp.StatusCode), nil
+	}
+	usage := usageCohere2OpenAI(cohereResponse.Meta)
+	if usage == nil {
+		completionTokens, _, _ := service.CountTokenText(cohereResponse.Text, model, false)
+		usage = &dto.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		}
+	}
+	content, _ := json.Marshal(cohereResponse.Text)
+	fullTextResponse := dto.OpenAITextResponse{
+		Id:      fmt.Sprintf("chatcmpl-%s", cohereResponse.ResponseId),
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Choices: []dto.OpenAITextResponseChoice{
+			{
+				Index: 0,
+				Message: dto.Message{
+					Role:    "assistant",
+					Content: content,
+				},
+				FinishReason: stopReasonCohere2OpenAI(cohereResponse.FinishReason),
+			},
+		},
+		Usage: *usage,
+	}
+	return writeJSON(c, resp.StatusCode, fullTextResponse), usage
+}
+
+// cohereStreamHandler Cohere 的流式响应每行一个 JSON 事件，stream-end 事件带有结束原因和用量
+func cohereStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseId := fmt.Sprintf("chatcmpl-%s", common.GetUUID())
+	createdTime := common.GetTimestamp()
+	stream := relaycommon.NewStream(c, info, relaycommon.NewLineDecoder(resp.Body))
+	return nil, stream.Run(func(event relaycommon.StreamEvent) error {
+		if event.Data == "" {
+			return nil
+		}
+		var cohereResponse CohereStreamResponse
+		err := json.Unmarshal([]byte(event.Data), &cohereResponse)
+		if err != nil {
+			return err
+		}
+		var choice dto.ChatCompletionsStreamResponseChoice
+		switch cohereResponse.EventType {
+		case "text-generation":
+			choice.Delta.Content = cohereResponse.Text
+		case "stream-end":
+			finishReason := stopReasonCohere2OpenAI(cohereResponse.FinishReason)
+			choice.FinishReason = &finishReason
+			if cohereResponse.Response != nil {
+				if usage := usageCohere2OpenAI(cohereResponse.Response.Meta); usage != nil {
+					stream.Usage = usage
+				}
+			}
+		default:
+			return nil
+		}
+		return stream.SendResponse(&dto.ChatCompletionsStreamResponse{
+			Id:      responseId,
+			Object:  "chat.completion.chunk",
+			Created: createdTime,
+			Model:   info.UpstreamModelName,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{choice},
+		})
+	})
+}
+
+func cohereEmbeddingHandler(c *gin.Context, resp *http.Response, promptTokens int, model string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, openaiErr := readResponseBody(resp)
+	if openaiErr != nil {
+		return openaiErr, nil
+	}
+	var cohereResponse CohereEmbeddingResponse
+	err := json.Unmarshal(responseBody, &cohereResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if cohereResponse.Message != "" && len(cohereResponse.Embeddings) == 0 {
+		return cohereError(cohereResponse.Message, resp.StatusCode), nil
+	}
+	usage := usageCohere2OpenAI(cohereResponse.Meta)
+	if usage == nil {
+		usage = &dto.Usage{PromptTokens: promptTokens, TotalTokens: promptTokens}
+	}
+	embeddingResponse := dto.OpenAIEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.OpenAIEmbeddingResponseItem, 0, len(cohereResponse.Embeddings)),
+		Model:  model,
+		Usage:  *usage,
+	}
+	for i, embedding := range cohereResponse.Embeddings {
+		embeddingResponse.Data = append(embeddingResponse.Data, dto.OpenAIEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: embedding,
+		})
+	}
+	return writeJSON(c, resp.StatusCode, embeddingResponse), usage
+}
+
+// cohereRerankHandler 将 Cohere 的 rerank 响应转换为 Jina 格式，Cohere 按搜索次数计费，没有 token 用量，按估算的 prompt token 数记录
+func cohereRerankHandler(c *gin.Context, resp *http.Response, promptTokens int, model string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, openaiErr := readResponseBody(resp)
+	if openaiErr != nil {
+		return openaiErr, nil
+	}
+	var cohereResponse CohereRerankResponse
+	err := json.Unmarshal(responseBody, &cohereResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if cohereResponse.Message != "" && cohereResponse.Results == nil {
+		return cohereError(cohereResponse.Message, resp.StatusCode), nil
+	}
+	usage := &dto.Usage{PromptTokens: promptTokens, TotalTokens: promptTokens}
+	rerankResponse := dto.RerankResponse{
+		Model:   model,
+		Results: make([]dto.RerankResult, 0, len(cohereResponse.Results)),
+		Usage:   *usage,
+	}
+	for _, result := range cohereResponse.Results {
+		rerankResult := dto.RerankResult{
+			Index:          result.Index,
+			RelevanceScore: result.RelevanceScore,
+		}
+		if result.Document != nil {
+			rerankResult.Document = &dto.RerankDocument{Text: result.Document.Text}
+		}
+		rerankResponse.Results = append(rerankResponse.Results, rerankResult)
+	}
+	return writeJSON(c, resp.StatusCode, rerankResponse), usage
+}
@@ -9,23 +9,28 @@ import (
 	"one-api/dto"
 	"one-api/relay/channel"
 	relaycommon "one-api/relay/common"
-	"one-api/service"
+	"one-api/relay/constant"
 )
 
 type Adaptor struct {
+	ImageResponseFormat string
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo, request dto.GeneralOpenAIRequest) {
 }
 
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	if info.RelayMode == constant.RelayModeImagesGenerations {
+		// Imagen 只在 v1beta 版本中提供
+		return fmt.Sprintf("%s/v1beta/models/%s:predict", info.BaseUrl, info.UpstreamModelName), nil
+	}
 	version := "v1"
 	if info.ApiVersion != "" {
 		version = info.ApiVersion
 	}
 	action := "generateContent"
 	if info.IsStream {
-		action = "streamGenerateContent"
+		action = "streamGenerateContent?alt=sse"
 	}
 	return fmt.Sprintf("%s/%s/models/%s:%s", info.BaseUrl, version, info.UpstreamModelName, action), nil
 }
@@ -43,17 +48,22 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *dto.Gen
 	return CovertGemini2OpenAI(*request), nil
 }
 
+func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
+	a.ImageResponseFormat = request.ResponseFormat
+	return imageRequestOpenAI2Gemini(request), nil
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	return channel.DoApiRequest(a, c, info, requestBody)
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode, sensitiveResp *dto.SensitiveResponse) {
-	if info.IsStream {
-		var responseText string
-		err, responseText = geminiChatStreamHandler(c, resp)
-		usage, _ = service.ResponseText2Usage(responseText, info.UpstreamModelName, info.PromptTokens)
+	if info.RelayMode == constant.RelayModeImagesGenerations {
+		err, usage = geminiImageHandler(c, resp, a.ImageResponseFormat)
+	} else if info.IsStream {
+		err, usage = GeminiChatStreamHandler(c, resp, info)
 	} else {
-		err, usage = geminiChatHandler(c, resp, info.PromptTokens, info.UpstreamModelName)
+		err, usage = GeminiChatHandler(c, resp, info.PromptTokens, info.UpstreamModelName)
 	}
 	return
 }
@@ -7,6 +7,7 @@ const (
 var ModelList = []string{
 	"gemini-pro",
 	"gemini-pro-vision",
+	"imagen-3.0-generate-002", "imagen-3.0-fast-generate-001",
 }
 
 var ChannelName = "google gemini"
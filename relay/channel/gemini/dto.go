@@ -1,10 +1,12 @@
 package gemini
 
 type GeminiChatRequest struct {
-	Contents         []GeminiChatContent        `json:"contents"`
-	SafetySettings   []GeminiChatSafetySettings `json:"safety_settings,omitempty"`
-	GenerationConfig GeminiChatGenerationConfig `json:"generation_config,omitempty"`
-	Tools            []GeminiChatTools          `json:"tools,omitempty"`
+	Contents          []GeminiChatContent        `json:"contents"`
+	SafetySettings    []GeminiChatSafetySettings `json:"safetySettings,omitempty"`
+	GenerationConfig  GeminiChatGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []GeminiChatTools          `json:"tools,omitempty"`
+	ToolConfig        *GeminiToolConfig          `json:"toolConfig,omitempty"`
+	SystemInstruction *GeminiChatContent         `json:"systemInstruction,omitempty"`
 }
 
 type GeminiInlineData struct {
@@ -12,9 +14,29 @@ type GeminiInlineData struct {
 	Data     string `json:"data"`
 }
 
+type GeminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileUri  string `json:"fileUri"`
+}
+
+type GeminiFunctionCall struct {
+	Id        string `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Arguments any    `json:"args"`
+}
+
+type GeminiFunctionResponse struct {
+	Id       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Response any    `json:"response"`
+}
+
 type GeminiPart struct {
-	Text       string            `json:"text,omitempty"`
-	InlineData *GeminiInlineData `json:"inlineData,omitempty"`
+	Text             string                  `json:"text,omitempty"`
+	InlineData       *GeminiInlineData       `json:"inlineData,omitempty"`
+	FileData         *GeminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
 }
 
 type GeminiChatContent struct {
@@ -31,6 +53,15 @@ type GeminiChatTools struct {
 	FunctionDeclarations any `json:"functionDeclarations,omitempty"`
 }
 
+type GeminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type GeminiToolConfig struct {
+	FunctionCallingConfig GeminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
 type GeminiChatGenerationConfig struct {
 	Temperature     float64  `json:"temperature,omitempty"`
 	TopP            float64  `json:"topP,omitempty"`
@@ -42,9 +73,9 @@ type GeminiChatGenerationConfig struct {
 
 type GeminiChatCandidate struct {
 	Content       GeminiChatContent        `json:"content"`
-	FinishReason  string                   `json:"finishReason"`
+	FinishReason  string                   `json:"finishReason,omitempty"`
 	Index         int64                    `json:"index"`
-	SafetyRatings []GeminiChatSafetyRating `json:"safetyRatings"`
+	SafetyRatings []GeminiChatSafetyRating `json:"safetyRatings,omitempty"`
 }
 
 type GeminiChatSafetyRating struct {
@@ -56,7 +87,38 @@ type GeminiChatPromptFeedback struct {
 	SafetyRatings []GeminiChatSafetyRating `json:"safetyRatings"`
 }
 
+type GeminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
 type GeminiChatResponse struct {
-	Candidates     []GeminiChatCandidate    `json:"candidates"`
-	PromptFeedback GeminiChatPromptFeedback `json:"promptFeedback"`
+	Candidates     []GeminiChatCandidate     `json:"candidates"`
+	PromptFeedback *GeminiChatPromptFeedback `json:"promptFeedback,omitempty"`
+	UsageMetadata  *GeminiUsageMetadata      `json:"usageMetadata,omitempty"`
+}
+
+type GeminiImageInstance struct {
+	Prompt string `json:"prompt"`
+}
+
+type GeminiImageParameters struct {
+	SampleCount int    `json:"sampleCount,omitempty"`
+	AspectRatio string `json:"aspectRatio,omitempty"`
+}
+
+// GeminiImageRequest Imagen 模型 predict 接口的请求
+type GeminiImageRequest struct {
+	Instances  []GeminiImageInstance `json:"instances"`
+	Parameters GeminiImageParameters `json:"parameters"`
+}
+
+type GeminiImagePrediction struct {
+	BytesBase64Encoded string `json:"bytesBase64Encoded"`
+	MimeType           string `json:"mimeType"`
+}
+
+type GeminiImageResponse struct {
+	Predictions []GeminiImagePrediction `json:"predictions"`
 }
@@ -0,0 +1,104 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"math"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/service"
+	"strconv"
+	"strings"
+)
+
+// https://ai.google.dev/gemini-api/docs/imagen
+
+// imagenAspectRatios Imagen 支持的宽高比
+var imagenAspectRatios = []string{"1:1", "3:4", "4:3", "9:16", "16:9"}
+
+// sizeToAspectRatio Imagen 不支持指定尺寸，按 OpenAI 的 size 选择最接近的宽高比
+func sizeToAspectRatio(size string) string {
+	width, height, found := strings.Cut(size, "x")
+	w, err1 := strconv.ParseFloat(width, 64)
+	h, err2 := strconv.ParseFloat(height, 64)
+	if !found || err1 != nil || err2 != nil || w <= 0 || h <= 0 {
+		return "1:1"
+	}
+	aspectRatio := imagenAspectRatios[0]
+	minDiff := math.MaxFloat64
+	for _, ratio := range imagenAspectRatios {
+		rw, rh, _ := strings.Cut(ratio, ":")
+		x, _ := strconv.ParseFloat(rw, 64)
+		y, _ := strconv.ParseFloat(rh, 64)
+		if diff := math.Abs(w/h - x/y); diff < minDiff {
+			minDiff = diff
+			aspectRatio = ratio
+		}
+	}
+	return aspectRatio
+}
+
+func imageRequestOpenAI2Gemini(request dto.ImageRequest) *GeminiImageRequest {
+	return &GeminiImageRequest{
+		Instances: []GeminiImageInstance{
+			{Prompt: request.Prompt},
+		},
+		Parameters: GeminiImageParameters{
+			SampleCount: request.N,
+			AspectRatio: sizeToAspectRatio(request.Size),
+		},
+	}
+}
+
+// geminiImageHandler Imagen 只返回图片数据，response_format 为 url 时以 data URL 的形式返回
+func geminiImageHandler(c *gin.Context, resp *http.Response, responseFormat string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var geminiResponse GeminiImageResponse
+	err = json.Unmarshal(responseBody, &geminiResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if len(geminiResponse.Predictions) == 0 {
+		// 提示词被安全过滤时不返回任何图片
+		return &dto.OpenAIErrorWithStatusCode{
+			Error: dto.OpenAIError{
+				Message: "No images returned",
+				Type:    "server_error",
+				Param:   "",
+				Code:    500,
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	imageResponse := dto.ImageResponse{
+		Created: int(common.GetTimestamp()),
+		Data:    make([]dto.ImageData, 0, len(geminiResponse.Predictions)),
+	}
+	for _, prediction := range geminiResponse.Predictions {
+		if responseFormat == "b64_json" {
+			imageResponse.Data = append(imageResponse.Data, dto.ImageData{B64Json: prediction.BytesBase64Encoded})
+		} else {
+			imageResponse.Data = append(imageResponse.Data, dto.ImageData{
+				Url: fmt.Sprintf("data:%s;base64,%s", prediction.MimeType, prediction.BytesBase64Encoded),
+			})
+		}
+	}
+	jsonResponse, err := json.Marshal(imageResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+	return nil, nil
+}
@@ -0,0 +1,334 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"strings"
+)
+
+// 本文件用于 /v1beta/models/{model}:generateContent 入口：将 Gemini 格式的请求转换为 OpenAI 格式，
+// 交给任意渠道处理后，再将 OpenAI 格式的响应转换回 Gemini 格式。
+
+func geminiPartsText(parts []GeminiPart) string {
+	var text strings.Builder
+	for _, part := range parts {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
+
+func finishReasonOpenAI2Gemini(reason string) string {
+	switch reason {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+func functionArguments2Args(arguments string) any {
+	var args any
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil || args == nil {
+		return map[string]any{}
+	}
+	return args
+}
+
+// RequestGemini2OpenAI 将 Gemini generateContent 格式的请求转换为 OpenAI 对话补全请求，
+// 模型名称与是否流式由请求路径决定
+func RequestGemini2OpenAI(geminiRequest *GeminiChatRequest, modelName string, stream bool) (*dto.GeneralOpenAIRequest, error) {
+	config := geminiRequest.GenerationConfig
+	textRequest := dto.GeneralOpenAIRequest{
+		Model:       modelName,
+		Stream:      stream,
+		MaxTokens:   config.MaxOutputTokens,
+		Temperature: config.Temperature,
+		TopP:        config.TopP,
+		TopK:        int(config.TopK),
+		N:           config.CandidateCount,
+	}
+	if len(config.StopSequences) > 0 {
+		textRequest.Stop = config.StopSequences
+	}
+	tools := make([]dto.OpenAITool, 0)
+	for _, tool := range geminiRequest.Tools {
+		var declarations []dto.OpenAIFunction
+		data, err := json.Marshal(tool.FunctionDeclarations)
+		if err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal(data, &declarations)
+		for _, declaration := range declarations {
+			tools = append(tools, dto.OpenAITool{
+				Type:     "function",
+				Function: declaration,
+			})
+		}
+	}
+	if len(tools) > 0 {
+		textRequest.Tools = tools
+	}
+
+	messages := make([]dto.Message, 0, len(geminiRequest.Contents)+1)
+	if geminiRequest.SystemInstruction != nil {
+		if system := geminiPartsText(geminiRequest.SystemInstruction.Parts); system != "" {
+			content, _ := json.Marshal(system)
+			messages = append(messages, dto.Message{
+				Role:    "system",
+				Content: content,
+			})
+		}
+	}
+	// Gemini 的函数调用没有 id，按函数名依次为调用和结果分配 id 以便配对
+	pendingCallIds := make(map[string][]string)
+	for _, content := range geminiRequest.Contents {
+		if content.Role == "model" {
+			toolCalls := make([]dto.ToolCall, 0)
+			for _, part := range content.Parts {
+				if part.FunctionCall == nil {
+					continue
+				}
+				id := part.FunctionCall.Id
+				if id == "" {
+					id = fmt.Sprintf("call_%s", common.GetUUID())
+				}
+				pendingCallIds[part.FunctionCall.Name] = append(pendingCallIds[part.FunctionCall.Name], id)
+				arguments, _ := json.Marshal(part.FunctionCall.Arguments)
+				toolCalls = append(toolCalls, dto.ToolCall{
+					Id:   id,
+					Type: "function",
+					Function: dto.FunctionCall{
+						Name:      part.FunctionCall.Name,
+						Arguments: string(arguments),
+					},
+				})
+			}
+			message := dto.Message{
+				Role: "assistant",
+			}
+			text := geminiPartsText(content.Parts)
+			if text != "" || len(toolCalls) == 0 {
+				message.Content, _ = json.Marshal(text)
+			}
+			if len(toolCalls) > 0 {
+				message.ToolCalls = toolCalls
+			}
+			messages = append(messages, message)
+			continue
+		}
+
+		// user 消息：functionResponse 转换为 tool 消息，其余内容合并为一条 user 消息
+		contentParts := make([]map[string]any, 0)
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionResponse != nil:
+				name := part.FunctionResponse.Name
+				id := part.FunctionResponse.Id
+				if ids := pendingCallIds[name]; id == "" && len(ids) > 0 {
+					id = ids[0]
+					pendingCallIds[name] = ids[1:]
+				}
+				response, _ := json.Marshal(part.FunctionResponse.Response)
+				toolContent, _ := json.Marshal(string(response))
+				messages = append(messages, dto.Message{
+					Role:       "tool",
+					Content:    toolContent,
+					ToolCallId: id,
+				})
+			case part.InlineData != nil:
+				contentParts = append(contentParts, map[string]any{
+					"type": dto.ContentTypeImageURL,
+					"image_url": map[string]any{
+						"url": fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data),
+					},
+				})
+			case part.FileData != nil:
+				contentParts = append(contentParts, map[string]any{
+					"type": dto.ContentTypeImageURL,
+					"image_url": map[string]any{
+						"url": part.FileData.FileUri,
+					},
+				})
+			case part.Text != "":
+				contentParts = append(contentParts, map[string]any{
+					"type": dto.ContentTypeText,
+					"text": part.Text,
+				})
+			}
+		}
+		if len(contentParts) == 0 {
+			continue
+		}
+		message := dto.Message{
+			Role: "user",
+		}
+		if len(contentParts) == 1 && contentParts[0]["type"] == dto.ContentTypeText {
+			message.Content, _ = json.Marshal(contentParts[0]["text"])
+		} else {
+			message.Content, _ = json.Marshal(contentParts)
+		}
+		messages = append(messages, message)
+	}
+	textRequest.Messages = messages
+	return &textRequest, nil
+}
+
+type openAI2GeminiConverter struct {
+	promptTokens int
+
+	// 以下字段仅用于流式响应，函数调用的参数是分片传输的，需要拼接完整后在结尾一次性输出
+	toolCalls    map[int]*dto.ToolCall
+	toolCallIdx  []int
+	finishReason string
+}
+
+// NewOpenAI2GeminiConverter 返回将 OpenAI 格式响应转换为 Gemini generateContent 格式的转换器，
+// 流式响应以 SSE（alt=sse）格式输出
+func NewOpenAI2GeminiConverter(promptTokens int) relaycommon.ResponseConverter {
+	return &openAI2GeminiConverter{
+		promptTokens: promptTokens,
+		toolCalls:    make(map[int]*dto.ToolCall),
+		finishReason: "STOP",
+	}
+}
+
+func (r *openAI2GeminiConverter) ConvertResponse(body []byte) ([]byte, error) {
+	var textResponse dto.OpenAITextResponse
+	err := json.Unmarshal(body, &textResponse)
+	if err != nil {
+		return nil, err
+	}
+	geminiResponse := GeminiChatResponse{
+		Candidates: make([]GeminiChatCandidate, 0, len(textResponse.Choices)),
+		UsageMetadata: &GeminiUsageMetadata{
+			PromptTokenCount:     textResponse.PromptTokens,
+			CandidatesTokenCount: textResponse.CompletionTokens,
+			TotalTokenCount:      textResponse.TotalTokens,
+		},
+	}
+	for _, choice := range textResponse.Choices {
+		parts := make([]GeminiPart, 0)
+		if text := choice.Message.StringContent(); text != "" && text != "null" {
+			parts = append(parts, GeminiPart{
+				Text: text,
+			})
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			parts = append(parts, GeminiPart{
+				FunctionCall: &GeminiFunctionCall{
+					Name:      toolCall.Function.Name,
+					Arguments: functionArguments2Args(toolCall.Function.Arguments),
+				},
+			})
+		}
+		geminiResponse.Candidates = append(geminiResponse.Candidates, GeminiChatCandidate{
+			Content: GeminiChatContent{
+				Role:  "model",
+				Parts: parts,
+			},
+			FinishReason: finishReasonOpenAI2Gemini(choice.FinishReason),
+			Index:        int64(choice.Index),
+		})
+	}
+	return json.Marshal(geminiResponse)
+}
+
+func geminiStreamData(response GeminiChatResponse) string {
+	jsonStr, err := json.Marshal(response)
+	if err != nil {
+		common.SysError("error marshalling gemini stream response: " + err.Error())
+		return ""
+	}
+	return fmt.Sprintf("data: %s\r\n\r\n", jsonStr)
+}
+
+func (r *openAI2GeminiConverter) ConvertStreamData(data string) string {
+	if strings.HasPrefix(data, "[DONE]") {
+		return ""
+	}
+	var streamResponse dto.ChatCompletionsStreamResponse
+	err := json.Unmarshal([]byte(data), &streamResponse)
+	if err != nil {
+		common.SysError("error unmarshalling stream response: " + err.Error())
+		return ""
+	}
+	var out strings.Builder
+	for _, choice := range streamResponse.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		for _, toolCall := range dto.ParseToolCalls(choice.Delta.ToolCalls) {
+			toolCallIndex := 0
+			if toolCall.Index != nil {
+				toolCallIndex = *toolCall.Index
+			}
+			if existing, ok := r.toolCalls[toolCallIndex]; ok {
+				existing.Function.Arguments += toolCall.Function.Arguments
+				continue
+			}
+			call := toolCall
+			r.toolCalls[toolCallIndex] = &call
+			r.toolCallIdx = append(r.toolCallIdx, toolCallIndex)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			r.finishReason = finishReasonOpenAI2Gemini(*choice.FinishReason)
+		}
+		if choice.Delta.Content == "" {
+			continue
+		}
+		out.WriteString(geminiStreamData(GeminiChatResponse{
+			Candidates: []GeminiChatCandidate{
+				{
+					Content: GeminiChatContent{
+						Role: "model",
+						Parts: []GeminiPart{
+							{
+								Text: choice.Delta.Content,
+							},
+						},
+					},
+				},
+			},
+		}))
+	}
+	return out.String()
+}
+
+func (r *openAI2GeminiConverter) FinishStream(usage *dto.Usage) string {
+	parts := make([]GeminiPart, 0, len(r.toolCallIdx))
+	for _, index := range r.toolCallIdx {
+		toolCall := r.toolCalls[index]
+		parts = append(parts, GeminiPart{
+			FunctionCall: &GeminiFunctionCall{
+				Name:      toolCall.Function.Name,
+				Arguments: functionArguments2Args(toolCall.Function.Arguments),
+			},
+		})
+	}
+	usageMetadata := GeminiUsageMetadata{
+		PromptTokenCount: r.promptTokens,
+		TotalTokenCount:  r.promptTokens,
+	}
+	if usage != nil {
+		usageMetadata.PromptTokenCount = usage.PromptTokens
+		usageMetadata.CandidatesTokenCount = usage.CompletionTokens
+		usageMetadata.TotalTokenCount = usage.TotalTokens
+	}
+	return geminiStreamData(GeminiChatResponse{
+		Candidates: []GeminiChatCandidate{
+			{
+				Content: GeminiChatContent{
+					Role:  "model",
+					Parts: parts,
+				},
+				FinishReason: r.finishReason,
+			},
+		},
+		UsageMetadata: &usageMetadata,
+	})
+}
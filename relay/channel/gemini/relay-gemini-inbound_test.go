@@ -0,0 +1,163 @@
+package gemini
+
+import (
+	"encoding/json"
+	"one-api/dto"
+	"strings"
+	"testing"
+)
+
+func TestRequestGemini2OpenAI(t *testing.T) {
+	tests := []struct {
+		name         string
+		request      string
+		wantMessages string
+		wantTools    string
+	}{
+		{
+			name:         "system instruction",
+			request:      `{"systemInstruction":{"parts":[{"text":"Be "},{"text":"brief."}]},"contents":[{"role":"user","parts":[{"text":"Hi"}]}]}`,
+			wantMessages: `[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]`,
+		},
+		{
+			name:         "inline and file data",
+			request:      `{"contents":[{"role":"user","parts":[{"inlineData":{"mimeType":"image/png","data":"iVBO"}},{"fileData":{"fileUri":"https://example.com/a.png"}},{"text":"Compare"}]}]}`,
+			wantMessages: `[{"role":"user","content":[{"image_url":{"url":"data:image/png;base64,iVBO"},"type":"image_url"},{"image_url":{"url":"https://example.com/a.png"},"type":"image_url"},{"text":"Compare","type":"text"}]}]`,
+		},
+		{
+			name: "function call and response with ids",
+			request: `{"tools":[{"functionDeclarations":[{"name":"get_weather","parameters":{"type":"object"}}]}],"contents":[
+				{"role":"user","parts":[{"text":"Weather in Paris?"}]},
+				{"role":"model","parts":[{"functionCall":{"id":"call_1","name":"get_weather","args":{"city":"Paris"}}}]},
+				{"role":"user","parts":[{"functionResponse":{"id":"call_1","name":"get_weather","response":{"temperature":20}}}]}
+			]}`,
+			wantMessages: `[{"role":"user","content":"Weather in Paris?"},` +
+				`{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},` +
+				`{"role":"tool","content":"{\"temperature\":20}","tool_call_id":"call_1"}]`,
+			wantTools: `[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}]`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var geminiRequest GeminiChatRequest
+			if err := json.Unmarshal([]byte(test.request), &geminiRequest); err != nil {
+				t.Fatal(err)
+			}
+			textRequest, err := RequestGemini2OpenAI(&geminiRequest, "gemini-1.5-pro", true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if textRequest.Model != "gemini-1.5-pro" || !textRequest.Stream {
+				t.Errorf("model = %s, stream = %v, want gemini-1.5-pro from the path", textRequest.Model, textRequest.Stream)
+			}
+			messages, _ := json.Marshal(textRequest.Messages)
+			if string(messages) != test.wantMessages {
+				t.Errorf("messages = %s, want %s", messages, test.wantMessages)
+			}
+			tools := ""
+			if textRequest.Tools != nil {
+				data, _ := json.Marshal(textRequest.Tools)
+				tools = string(data)
+			}
+			if tools != test.wantTools {
+				t.Errorf("tools = %s, want %s", tools, test.wantTools)
+			}
+		})
+	}
+}
+
+func TestRequestGemini2OpenAIPairsCallsWithoutIds(t *testing.T) {
+	request := `{"contents":[
+		{"role":"user","parts":[{"text":"Weather in Paris and Rome?"}]},
+		{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}},{"functionCall":{"name":"get_weather","args":{"city":"Rome"}}}]},
+		{"role":"user","parts":[{"functionResponse":{"name":"get_weather","response":{"city":"Paris"}}},{"functionResponse":{"name":"get_weather","response":{"city":"Rome"}}}]}
+	]}`
+	var geminiRequest GeminiChatRequest
+	if err := json.Unmarshal([]byte(request), &geminiRequest); err != nil {
+		t.Fatal(err)
+	}
+	textRequest, err := RequestGemini2OpenAI(&geminiRequest, "gemini-1.5-pro", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(textRequest.Messages) != 4 {
+		t.Fatalf("got %d messages, want 4", len(textRequest.Messages))
+	}
+	// 同名函数的结果按调用的顺序配对
+	toolCalls := textRequest.Messages[1].ParseToolCalls()
+	for i, city := range []string{"Paris", "Rome"} {
+		result := textRequest.Messages[2+i]
+		if !strings.Contains(toolCalls[i].Function.Arguments, city) || !strings.Contains(result.StringContent(), city) {
+			t.Errorf("call %d = %s, result = %s, want both for %s", i, toolCalls[i].Function.Arguments, result.StringContent(), city)
+		}
+		if result.Role != "tool" || toolCalls[i].Id == "" || result.ToolCallId != toolCalls[i].Id {
+			t.Errorf("result %d tool_call_id = %q, want %q", i, result.ToolCallId, toolCalls[i].Id)
+		}
+	}
+}
+
+func TestOpenAI2GeminiConverterResponse(t *testing.T) {
+	body := `{"id":"chatcmpl-1","object":"chat.completion","created":1,"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Checking.","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"length"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`
+	data, err := NewOpenAI2GeminiConverter(10).ConvertResponse([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"candidates":[{"content":{"role":"model","parts":[{"text":"Checking."},{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]},"finishReason":"MAX_TOKENS","index":0}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"totalTokenCount":15}}`
+	if string(data) != want {
+		t.Errorf("response = %s, want %s", data, want)
+	}
+}
+
+func TestOpenAI2GeminiConverterStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		usage  *dto.Usage
+		want   []string
+	}{
+		{
+			name: "text",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+				`[DONE]`,
+			},
+			usage: &dto.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12},
+			want: []string{
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]},"index":0}]}`,
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},"index":0}]}`,
+				`{"candidates":[{"content":{"role":"model","parts":[]},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":2,"totalTokenCount":12}}`,
+			},
+		},
+		{
+			// 函数调用的参数分片拼接完整后在结尾一次性输出
+			name: "tool call fragments",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"ci"}}]}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"ty\":\"Paris\"}"}}]}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			},
+			want: []string{
+				`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":0,"totalTokenCount":10}}`,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			converter := NewOpenAI2GeminiConverter(10)
+			var out strings.Builder
+			for _, chunk := range test.chunks {
+				out.WriteString(converter.ConvertStreamData(chunk))
+			}
+			out.WriteString(converter.FinishStream(test.usage))
+			var got []string
+			for _, event := range strings.Split(strings.TrimSpace(out.String()), "\r\n\r\n") {
+				got = append(got, strings.TrimPrefix(event, "data: "))
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("events = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package gemini
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,6 +8,7 @@ import (
 	"one-api/common"
 	"one-api/constant"
 	"one-api/dto"
+	"one-api/relay/channel"
 	relaycommon "one-api/relay/common"
 	"one-api/service"
 	"strings"
@@ -44,15 +44,40 @@ func CovertGemini2OpenAI(textRequest dto.GeneralOpenAIRequest) *GeminiChatReques
 			MaxOutputTokens: textRequest.MaxTokens,
 		},
 	}
-	if textRequest.Functions != nil {
+	if functions := channel.ParseToolFunctions(textRequest); len(functions) > 0 {
 		geminiRequest.Tools = []GeminiChatTools{
 			{
-				FunctionDeclarations: textRequest.Functions,
+				FunctionDeclarations: functions,
 			},
 		}
+		geminiRequest.ToolConfig = toolChoiceOpenAI2Gemini(textRequest.ToolChoice)
 	}
+	toolCallNames := channel.ToolCallNames(textRequest.Messages)
 	shouldAddDummyModelMessage := false
+	lastIsFunctionResponse := false
 	for _, message := range textRequest.Messages {
+		if message.Role == "tool" {
+			// 工具结果转换为 functionResponse，同一轮的多个工具结果需要放在同一条消息中
+			part := GeminiPart{
+				FunctionResponse: &GeminiFunctionResponse{
+					Name:     toolCallNames[message.ToolCallId],
+					Response: functionResponseOpenAI2Gemini(message.StringContent()),
+				},
+			}
+			if lastIsFunctionResponse {
+				last := &geminiRequest.Contents[len(geminiRequest.Contents)-1]
+				last.Parts = append(last.Parts, part)
+			} else {
+				geminiRequest.Contents = append(geminiRequest.Contents, GeminiChatContent{
+					Role:  "user",
+					Parts: []GeminiPart{part},
+				})
+			}
+			lastIsFunctionResponse = true
+			continue
+		}
+		lastIsFunctionResponse = false
+		toolCalls := message.ParseToolCalls()
 		content := GeminiChatContent{
 			Role: message.Role,
 			Parts: []GeminiPart{
@@ -67,6 +92,9 @@ func CovertGemini2OpenAI(textRequest dto.GeneralOpenAIRequest) *GeminiChatReques
 		for _, part := range openaiContent {
 
 			if part.Type == dto.ContentTypeText {
+				if part.Text == "" && len(toolCalls) > 0 {
+					continue
+				}
 				parts = append(parts, GeminiPart{
 					Text: part.Text,
 				})
@@ -84,6 +112,14 @@ func CovertGemini2OpenAI(textRequest dto.GeneralOpenAIRequest) *GeminiChatReques
 				})
 			}
 		}
+		for _, toolCall := range toolCalls {
+			parts = append(parts, GeminiPart{
+				FunctionCall: &GeminiFunctionCall{
+					Name:      toolCall.Function.Name,
+					Arguments: channel.ToolArgumentsObject(toolCall.Function.Arguments),
+				},
+			})
+		}
 		content.Parts = parts
 
 		// there's no assistant role in gemini and API shall vomit if Role is not user or model
@@ -114,14 +150,68 @@ func CovertGemini2OpenAI(textRequest dto.GeneralOpenAIRequest) *GeminiChatReques
 	return &geminiRequest
 }
 
+func toolChoiceOpenAI2Gemini(toolChoice any) *GeminiToolConfig {
+	mode, name := channel.ParseToolChoice(toolChoice)
+	config := GeminiFunctionCallingConfig{}
+	switch mode {
+	case channel.ToolChoiceAuto:
+		config.Mode = "AUTO"
+	case channel.ToolChoiceNone:
+		config.Mode = "NONE"
+	case channel.ToolChoiceRequired:
+		config.Mode = "ANY"
+	case channel.ToolChoiceFunction:
+		config.Mode = "ANY"
+		config.AllowedFunctionNames = []string{name}
+	default:
+		return nil
+	}
+	return &GeminiToolConfig{FunctionCallingConfig: config}
+}
+
+// functionResponseOpenAI2Gemini Gemini 要求函数结果为 JSON 对象，非对象的工具结果包装在 content 字段中
+func functionResponseOpenAI2Gemini(content string) any {
+	var response map[string]any
+	if err := json.Unmarshal([]byte(content), &response); err == nil && response != nil {
+		return response
+	}
+	return map[string]any{"content": content}
+}
+
+func finishReasonGemini2OpenAI(reason string) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "content_filter"
+	default:
+		return relaycommon.StopFinishReason
+	}
+}
+
+// candidateGemini2OpenAI 返回候选结果中的文本和函数调用
+func candidateGemini2OpenAI(candidate *GeminiChatCandidate) (string, []dto.ToolCall) {
+	var text strings.Builder
+	var toolCalls []dto.ToolCall
+	for _, part := range candidate.Content.Parts {
+		if part.FunctionCall != nil {
+			toolCalls = append(toolCalls, channel.NewToolCall(part.FunctionCall.Id, part.FunctionCall.Name, part.FunctionCall.Arguments))
+		} else {
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String(), toolCalls
+}
+
 func (g *GeminiChatResponse) GetResponseText() string {
-	if g == nil {
+	if g == nil || len(g.Candidates) == 0 {
 		return ""
 	}
-	if len(g.Candidates) > 0 && len(g.Candidates[0].Content.Parts) > 0 {
-		return g.Candidates[0].Content.Parts[0].Text
+	text, toolCalls := candidateGemini2OpenAI(&g.Candidates[0])
+	for _, toolCall := range toolCalls {
+		text += toolCall.Function.Name + toolCall.Function.Arguments
 	}
-	return ""
+	return text
 }
 
 func responseGeminiChat2OpenAI(response *GeminiChatResponse) *dto.OpenAITextResponse {
@@ -131,29 +221,39 @@ func responseGeminiChat2OpenAI(response *GeminiChatResponse) *dto.OpenAITextResp
 		Created: common.GetTimestamp(),
 		Choices: make([]dto.OpenAITextResponseChoice, 0, len(response.Candidates)),
 	}
-	content, _ := json.Marshal("")
 	for i, candidate := range response.Candidates {
+		text, toolCalls := candidateGemini2OpenAI(&candidate)
+		content, _ := json.Marshal(text)
 		choice := dto.OpenAITextResponseChoice{
 			Index: i,
 			Message: dto.Message{
 				Role:    "assistant",
 				Content: content,
 			},
-			FinishReason: relaycommon.StopFinishReason,
+			FinishReason: channel.FinishReasonWithToolCalls(finishReasonGemini2OpenAI(candidate.FinishReason), len(toolCalls) > 0),
 		}
-		if len(candidate.Content.Parts) > 0 {
-			content, _ = json.Marshal(candidate.Content.Parts[0].Text)
-			choice.Message.Content = content
+		if len(toolCalls) > 0 {
+			choice.Message.ToolCalls = toolCalls
 		}
 		fullTextResponse.Choices = append(fullTextResponse.Choices, choice)
 	}
 	return &fullTextResponse
 }
 
-func streamResponseGeminiChat2OpenAI(geminiResponse *GeminiChatResponse) *dto.ChatCompletionsStreamResponse {
+func streamResponseGeminiChat2OpenAI(geminiResponse *GeminiChatResponse, toolCallStream *channel.ToolCallStream) *dto.ChatCompletionsStreamResponse {
 	var choice dto.ChatCompletionsStreamResponseChoice
-	choice.Delta.Content = geminiResponse.GetResponseText()
-	choice.FinishReason = &relaycommon.StopFinishReason
+	if len(geminiResponse.Candidates) > 0 {
+		candidate := &geminiResponse.Candidates[0]
+		text, toolCalls := candidateGemini2OpenAI(candidate)
+		choice.Delta.Content = text
+		if len(toolCalls) > 0 {
+			choice.Delta.ToolCalls = toolCallStream.Append(toolCalls)
+		}
+		if candidate.FinishReason != "" {
+			finishReason := toolCallStream.FinishReason(finishReasonGemini2OpenAI(candidate.FinishReason))
+			choice.FinishReason = &finishReason
+		}
+	}
 	var response dto.ChatCompletionsStreamResponse
 	response.Object = "chat.completion.chunk"
 	response.Model = "gemini"
@@ -161,77 +261,44 @@ func streamResponseGeminiChat2OpenAI(geminiResponse *GeminiChatResponse) *dto.Ch
 	return &response
 }
 
-func geminiChatStreamHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErrorWithStatusCode, string) {
-	responseText := ""
-	dataChan := make(chan string)
-	stopChan := make(chan bool)
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		if atEOF && len(data) == 0 {
-			return 0, nil, nil
-		}
-		if i := strings.Index(string(data), "\n"); i >= 0 {
-			return i + 1, data[0:i], nil
-		}
-		if atEOF {
-			return len(data), data, nil
-		}
-		return 0, nil, nil
-	})
-	go func() {
-		for scanner.Scan() {
-			data := scanner.Text()
-			data = strings.TrimSpace(data)
-			if !strings.HasPrefix(data, "\"text\": \"") {
-				continue
-			}
-			data = strings.TrimPrefix(data, "\"text\": \"")
-			data = strings.TrimSuffix(data, "\"")
-			dataChan <- data
+// usageGemini2OpenAI 转换 Gemini 返回的用量，没有返回时返回 nil
+func usageGemini2OpenAI(usageMetadata *GeminiUsageMetadata) *dto.Usage {
+	if usageMetadata == nil || usageMetadata.TotalTokenCount == 0 {
+		return nil
+	}
+	return &dto.Usage{
+		PromptTokens:     usageMetadata.PromptTokenCount,
+		CompletionTokens: usageMetadata.TotalTokenCount - usageMetadata.PromptTokenCount,
+		TotalTokens:      usageMetadata.TotalTokenCount,
+	}
+}
+
+func GeminiChatStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseId := fmt.Sprintf("chatcmpl-%s", common.GetUUID())
+	createdTime := common.GetTimestamp()
+	var toolCallStream channel.ToolCallStream
+	// 使用 alt=sse 请求，每行 data 为一个完整的 GeminiChatResponse
+	stream := relaycommon.NewStream(c, info, relaycommon.NewSSEDecoder(resp.Body))
+	usage := stream.Run(func(event relaycommon.StreamEvent) error {
+		var geminiResponse GeminiChatResponse
+		err := json.Unmarshal([]byte(event.Data), &geminiResponse)
+		if err != nil {
+			return err
 		}
-		stopChan <- true
-	}()
-	service.SetEventStreamHeaders(c)
-	c.Stream(func(w io.Writer) bool {
-		select {
-		case data := <-dataChan:
-			// this is used to prevent annoying \ related format bug
-			data = fmt.Sprintf("{\"content\": \"%s\"}", data)
-			type dummyStruct struct {
-				Content string `json:"content"`
-			}
-			var dummy dummyStruct
-			err := json.Unmarshal([]byte(data), &dummy)
-			responseText += dummy.Content
-			var choice dto.ChatCompletionsStreamResponseChoice
-			choice.Delta.Content = dummy.Content
-			response := dto.ChatCompletionsStreamResponse{
-				Id:      fmt.Sprintf("chatcmpl-%s", common.GetUUID()),
-				Object:  "chat.completion.chunk",
-				Created: common.GetTimestamp(),
-				Model:   "gemini-pro",
-				Choices: []dto.ChatCompletionsStreamResponseChoice{choice},
-			}
-			jsonResponse, err := json.Marshal(response)
-			if err != nil {
-				common.SysError("error marshalling stream response: " + err.Error())
-				return true
-			}
-			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonResponse)})
-			return true
-		case <-stopChan:
-			c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
-			return false
+		response := streamResponseGeminiChat2OpenAI(&geminiResponse, &toolCallStream)
+		response.Id = responseId
+		response.Created = createdTime
+		response.Model = "gemini-pro"
+		// 每个数据块都带有截至当前的累计用量，以最后一个为准
+		if geminiUsage := usageGemini2OpenAI(geminiResponse.UsageMetadata); geminiUsage != nil {
+			stream.Usage = geminiUsage
 		}
+		return stream.SendResponse(response)
 	})
-	err := resp.Body.Close()
-	if err != nil {
-		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), ""
-	}
-	return nil, responseText
+	return nil, usage
 }
 
-func geminiChatHandler(c *gin.Context, resp *http.Response, promptTokens int, model string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+func GeminiChatHandler(c *gin.Context, resp *http.Response, promptTokens int, model string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
@@ -257,11 +324,16 @@ func geminiChatHandler(c *gin.Context, resp *http.Response, promptTokens int, mo
 		}, nil
 	}
 	fullTextResponse := responseGeminiChat2OpenAI(&geminiResponse)
-	completionTokens, _, _ := service.CountTokenText(geminiResponse.GetResponseText(), model, constant.ShouldCheckCompletionSensitive())
-	usage := dto.Usage{
-		PromptTokens:     promptTokens,
-		CompletionTokens: completionTokens,
-		TotalTokens:      promptTokens + completionTokens,
+	var usage dto.Usage
+	if geminiUsage := usageGemini2OpenAI(geminiResponse.UsageMetadata); geminiUsage != nil {
+		usage = *geminiUsage
+	} else {
+		completionTokens, _, _ := service.CountTokenText(geminiResponse.GetResponseText(), model, constant.ShouldCheckCompletionSensitive())
+		usage = dto.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		}
 	}
 	fullTextResponse.Usage = usage
 	jsonResponse, err := json.Marshal(fullTextResponse)
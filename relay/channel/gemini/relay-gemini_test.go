@@ -0,0 +1,208 @@
+package gemini
+
+import (
+	"encoding/json"
+	"one-api/dto"
+	"one-api/relay/channel"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCovertGemini2OpenAITools(t *testing.T) {
+	tests := []struct {
+		name       string
+		toolChoice string
+		want       *GeminiToolConfig
+	}{
+		{name: "no tool choice"},
+		{name: "auto", toolChoice: `"auto"`, want: &GeminiToolConfig{FunctionCallingConfig: GeminiFunctionCallingConfig{Mode: "AUTO"}}},
+		{name: "none", toolChoice: `"none"`, want: &GeminiToolConfig{FunctionCallingConfig: GeminiFunctionCallingConfig{Mode: "NONE"}}},
+		{name: "required", toolChoice: `"required"`, want: &GeminiToolConfig{FunctionCallingConfig: GeminiFunctionCallingConfig{Mode: "ANY"}}},
+		{
+			name:       "function",
+			toolChoice: `{"type":"function","function":{"name":"get_weather"}}`,
+			want:       &GeminiToolConfig{FunctionCallingConfig: GeminiFunctionCallingConfig{Mode: "ANY", AllowedFunctionNames: []string{"get_weather"}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var request dto.GeneralOpenAIRequest
+			err := json.Unmarshal([]byte(`{"model":"gemini-pro","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}]}`), &request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.toolChoice != "" {
+				if err := json.Unmarshal([]byte(test.toolChoice), &request.ToolChoice); err != nil {
+					t.Fatal(err)
+				}
+			}
+			geminiRequest := CovertGemini2OpenAI(request)
+			if len(geminiRequest.Tools) != 1 {
+				t.Fatalf("tools = %+v, want one function declarations entry", geminiRequest.Tools)
+			}
+			data, _ := json.Marshal(geminiRequest.Tools[0].FunctionDeclarations)
+			var functions []dto.FunctionCall
+			if err := json.Unmarshal(data, &functions); err != nil {
+				t.Fatal(err)
+			}
+			if len(functions) != 1 || functions[0].Name != "get_weather" {
+				t.Errorf("functionDeclarations = %s, want get_weather", data)
+			}
+			if !reflect.DeepEqual(geminiRequest.ToolConfig, test.want) {
+				t.Errorf("toolConfig = %+v, want %+v", geminiRequest.ToolConfig, test.want)
+			}
+		})
+	}
+}
+
+func TestCovertGemini2OpenAIToolMessages(t *testing.T) {
+	var request dto.GeneralOpenAIRequest
+	err := json.Unmarshal([]byte(`{"model":"gemini-pro","messages":[
+		{"role":"user","content":"What is the weather and time in Paris?"},
+		{"role":"assistant","content":"","tool_calls":[
+			{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}},
+			{"id":"call_2","type":"function","function":{"name":"get_time","arguments":""}}
+		]},
+		{"role":"tool","tool_call_id":"call_1","content":"{\"temperature\":20}"},
+		{"role":"tool","tool_call_id":"call_2","content":"12:00"}
+	]}`), &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := CovertGemini2OpenAI(request).Contents
+	if len(contents) != 3 {
+		t.Fatalf("contents = %+v, want 3 contents", contents)
+	}
+
+	model := contents[1]
+	if model.Role != "model" || len(model.Parts) != 2 {
+		t.Fatalf("model content = %+v, want two functionCall parts", model)
+	}
+	wantCalls := []GeminiFunctionCall{
+		{Name: "get_weather", Arguments: map[string]any{"city": "Paris"}},
+		{Name: "get_time", Arguments: map[string]any{}},
+	}
+	for i, want := range wantCalls {
+		if got := model.Parts[i].FunctionCall; got == nil || !reflect.DeepEqual(*got, want) {
+			t.Errorf("functionCall %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	results := contents[2]
+	if results.Role != "user" || len(results.Parts) != 2 {
+		t.Fatalf("tool results = %+v, want one user content with two functionResponse parts", results)
+	}
+	wantResponses := []GeminiFunctionResponse{
+		{Name: "get_weather", Response: map[string]any{"temperature": float64(20)}},
+		{Name: "get_time", Response: map[string]any{"content": "12:00"}},
+	}
+	for i, want := range wantResponses {
+		if got := results.Parts[i].FunctionResponse; got == nil || !reflect.DeepEqual(*got, want) {
+			t.Errorf("functionResponse %d = %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestResponseGeminiChat2OpenAIToolCalls(t *testing.T) {
+	tests := []struct {
+		name             string
+		response         string
+		wantFinishReason string
+		wantContent      string
+		wantToolCalls    []dto.FunctionCall
+	}{
+		{
+			name:             "function calls",
+			response:         `{"candidates":[{"index":0,"finishReason":"STOP","content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}},{"functionCall":{"name":"get_time","args":{}}}]}}]}`,
+			wantFinishReason: channel.ToolCallsFinishReason,
+			wantToolCalls:    []dto.FunctionCall{{Name: "get_weather", Arguments: `{"city":"Paris"}`}, {Name: "get_time", Arguments: `{}`}},
+		},
+		{
+			name:             "text",
+			response:         `{"candidates":[{"index":0,"finishReason":"STOP","content":{"role":"model","parts":[{"text":"It is sunny."}]}}]}`,
+			wantFinishReason: "stop",
+			wantContent:      "It is sunny.",
+		},
+		{
+			name:             "max tokens",
+			response:         `{"candidates":[{"index":0,"finishReason":"MAX_TOKENS","content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]}}]}`,
+			wantFinishReason: "length",
+			wantToolCalls:    []dto.FunctionCall{{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var geminiResponse GeminiChatResponse
+			if err := json.Unmarshal([]byte(test.response), &geminiResponse); err != nil {
+				t.Fatal(err)
+			}
+			choice := responseGeminiChat2OpenAI(&geminiResponse).Choices[0]
+			if choice.FinishReason != test.wantFinishReason {
+				t.Errorf("finish_reason = %q, want %q", choice.FinishReason, test.wantFinishReason)
+			}
+			if content := choice.Message.StringContent(); content != test.wantContent {
+				t.Errorf("content = %q, want %q", content, test.wantContent)
+			}
+			toolCalls := choice.Message.ParseToolCalls()
+			if len(toolCalls) != len(test.wantToolCalls) {
+				t.Fatalf("tool_calls = %+v, want %d calls", toolCalls, len(test.wantToolCalls))
+			}
+			for i, toolCall := range toolCalls {
+				if !strings.HasPrefix(toolCall.Id, "call_") || toolCall.Type != "function" || toolCall.Function != test.wantToolCalls[i] {
+					t.Errorf("tool call %d = %+v, want %+v", i, toolCall, test.wantToolCalls[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStreamResponseGeminiChat2OpenAIToolCalls(t *testing.T) {
+	chunks := []string{
+		`{"candidates":[{"index":0,"content":{"role":"model","parts":[{"text":"Let me check."}]}}]}`,
+		`{"candidates":[{"index":0,"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]}}]}`,
+		`{"candidates":[{"index":0,"content":{"role":"model","parts":[{"functionCall":{"id":"fc_2","name":"get_time","args":{}}},{"functionCall":{"name":"get_date","args":{"tz":"CET"}}}]}}]}`,
+		`{"candidates":[{"index":0,"finishReason":"STOP","content":{"role":"model","parts":[{"text":""}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"totalTokenCount":15}}`,
+	}
+	wantCalls := []struct {
+		index     int
+		id        string
+		name      string
+		arguments string
+	}{
+		{index: 0, id: "call_", name: "get_weather", arguments: `{"city":"Paris"}`},
+		{index: 1, id: "fc_2", name: "get_time", arguments: `{}`},
+		{index: 2, id: "call_", name: "get_date", arguments: `{"tz":"CET"}`},
+	}
+
+	var toolCallStream channel.ToolCallStream
+	var toolCalls []dto.ToolCall
+	var content, finishReason string
+	for _, chunk := range chunks {
+		var geminiResponse GeminiChatResponse
+		if err := json.Unmarshal([]byte(chunk), &geminiResponse); err != nil {
+			t.Fatal(err)
+		}
+		choice := streamResponseGeminiChat2OpenAI(&geminiResponse, &toolCallStream).Choices[0]
+		content += choice.Delta.Content
+		toolCalls = append(toolCalls, dto.ParseToolCalls(choice.Delta.ToolCalls)...)
+		if choice.FinishReason != nil {
+			finishReason = *choice.FinishReason
+		}
+	}
+	if content != "Let me check." {
+		t.Errorf("content = %q, want %q", content, "Let me check.")
+	}
+	if len(toolCalls) != len(wantCalls) {
+		t.Fatalf("tool_calls = %+v, want %d calls", toolCalls, len(wantCalls))
+	}
+	for i, want := range wantCalls {
+		toolCall := toolCalls[i]
+		if toolCall.Index == nil || *toolCall.Index != want.index || !strings.HasPrefix(toolCall.Id, want.id) || toolCall.Function.Name != want.name || toolCall.Function.Arguments != want.arguments {
+			t.Errorf("tool call %d = %+v, want index %d id %s* %s %s", i, toolCall, want.index, want.id, want.name, want.arguments)
+		}
+	}
+	if finishReason != channel.ToolCallsFinishReason {
+		t.Errorf("finish_reason = %q, want %q", finishReason, channel.ToolCallsFinishReason)
+	}
+}
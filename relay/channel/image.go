@@ -0,0 +1,31 @@
+package channel
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+)
+
+// ImageUrls2Response 将上游返回的图片地址转换为 OpenAI 格式的图片响应，
+// response_format 为 b64_json 时下载图片并以 base64 编码返回
+func ImageUrls2Response(urls []string, responseFormat string) (*dto.ImageResponse, error) {
+	imageResponse := dto.ImageResponse{
+		Created: int(common.GetTimestamp()),
+		Data:    make([]dto.ImageData, 0, len(urls)),
+	}
+	for _, url := range urls {
+		if responseFormat != "b64_json" {
+			imageResponse.Data = append(imageResponse.Data, dto.ImageData{Url: url})
+			continue
+		}
+		_, data, err := common.GetImageFromUrl(url)
+		if err != nil {
+			return nil, err
+		}
+		if data == "" {
+			return nil, fmt.Errorf("failed to download image: %s", url)
+		}
+		imageResponse.Data = append(imageResponse.Data, dto.ImageData{B64Json: data})
+	}
+	return &imageResponse, nil
+}
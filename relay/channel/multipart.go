@@ -0,0 +1,99 @@
+package channel
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// MultipartField multipart 请求体中的一个字段，File 不为空时为文件字段
+type MultipartField struct {
+	Name  string
+	Value string
+	File  *multipart.FileHeader
+}
+
+// MultipartFormFields 按客户端上传的表单生成转发给上游的字段，模型替换为映射后的模型，
+// 其他字段原样保留，以支持上游新增的参数
+func MultipartFormFields(form *multipart.Form, model string) []MultipartField {
+	fields := []MultipartField{{Name: "model", Value: model}}
+	names := make([]string, 0, len(form.Value))
+	for name := range form.Value {
+		if name != "model" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range form.Value[name] {
+			fields = append(fields, MultipartField{Name: name, Value: value})
+		}
+	}
+	names = names[:0]
+	for name := range form.File {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, fileHeader := range form.File[name] {
+			fields = append(fields, MultipartField{Name: name, File: fileHeader})
+		}
+	}
+	return fields
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// NewMultipartBody 以流的方式生成 multipart 请求体：在单独的 goroutine 中边读取文件边写入管道，
+// 不在内存中缓存整个请求体。返回请求体和对应的 Content-Type，请求体读取方关闭后 goroutine 随之退出
+func NewMultipartBody(fields []MultipartField) (io.ReadCloser, string) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		_ = pw.CloseWithError(writeMultipartFields(writer, fields))
+	}()
+	return pr, writer.FormDataContentType()
+}
+
+func writeMultipartFields(writer *multipart.Writer, fields []MultipartField) error {
+	for _, field := range fields {
+		if field.File == nil {
+			err := writer.WriteField(field.Name, field.Value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := writeMultipartFile(writer, field.Name, field.File)
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// writeMultipartFile 写入一个文件字段，保留上传时的文件名和 Content-Type
+func writeMultipartFile(writer *multipart.Writer, name string, fileHeader *multipart.FileHeader) error {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	contentType := fileHeader.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(name), quoteEscaper.Replace(fileHeader.Filename)))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, file)
+	return err
+}
@@ -8,9 +8,8 @@ import (
 	"net/http"
 	"one-api/dto"
 	"one-api/relay/channel"
-	"one-api/relay/channel/openai"
 	relaycommon "one-api/relay/common"
-	"one-api/service"
+	relayconstant "one-api/relay/constant"
 )
 
 type Adaptor struct {
@@ -20,7 +19,12 @@ func (a *Adaptor) Init(info *relaycommon.RelayInfo, request dto.GeneralOpenAIReq
 }
 
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
-	return fmt.Sprintf("%s/api/chat", info.BaseUrl), nil
+	switch info.RelayMode {
+	case relayconstant.RelayModeEmbeddings:
+		return fmt.Sprintf("%s/api/embed", info.BaseUrl), nil
+	default:
+		return fmt.Sprintf("%s/api/chat", info.BaseUrl), nil
+	}
 }
 
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.RelayInfo) error {
@@ -32,7 +36,12 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *dto.Gen
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
-	return requestOpenAI2Ollama(*request), nil
+	switch relayMode {
+	case relayconstant.RelayModeEmbeddings:
+		return embeddingRequestOpenAI2Ollama(*request), nil
+	default:
+		return requestOpenAI2Ollama(*request)
+	}
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
@@ -40,12 +49,15 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode, sensitiveResp *dto.SensitiveResponse) {
-	if info.IsStream {
-		var responseText string
-		err, responseText = openai.OpenaiStreamHandler(c, resp, info.RelayMode)
-		usage, _ = service.ResponseText2Usage(responseText, info.UpstreamModelName, info.PromptTokens)
-	} else {
-		err, usage, sensitiveResp = openai.OpenaiHandler(c, resp, info.PromptTokens, info.UpstreamModelName)
+	switch info.RelayMode {
+	case relayconstant.RelayModeEmbeddings:
+		err, usage = ollamaEmbeddingHandler(c, resp, info.PromptTokens, info.UpstreamModelName)
+	default:
+		if info.IsStream {
+			err, usage = ollamaStreamHandler(c, resp, info)
+		} else {
+			err, usage = ollamaHandler(c, resp, info.PromptTokens, info.UpstreamModelName)
+		}
 	}
 	return
 }
@@ -1,12 +1,16 @@
 package ollama
 
-import "one-api/dto"
+type OllamaMessage struct {
+	Role    string   `json:"role"`
+	Content string   `json:"content"`
+	Images  []string `json:"images,omitempty"` // base64 编码的图片，用于 llava 等多模态模型
+}
 
 type OllamaRequest struct {
-	Model    string         `json:"model,omitempty"`
-	Messages []dto.Message  `json:"messages,omitempty"`
-	Stream   bool           `json:"stream,omitempty"`
-	Options  *OllamaOptions `json:"options,omitempty"`
+	Model    string          `json:"model,omitempty"`
+	Messages []OllamaMessage `json:"messages,omitempty"`
+	Stream   bool            `json:"stream"` // Ollama 默认流式输出，非流式请求需要显式传 false
+	Options  *OllamaOptions  `json:"options,omitempty"`
 }
 
 type OllamaOptions struct {
@@ -15,4 +19,36 @@ type OllamaOptions struct {
 	Topp        float64 `json:"top_p,omitempty"`
 	TopK        int     `json:"top_k,omitempty"`
 	Stop        any     `json:"stop,omitempty"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+}
+
+// OllamaResponse /api/chat 的响应，流式响应的每一行也是这个格式，最后一行 done 为 true 并带有用量
+type OllamaResponse struct {
+	Model           string        `json:"model"`
+	CreatedAt       string        `json:"created_at"`
+	Message         OllamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+	EvalCount       int           `json:"eval_count,omitempty"`
+	Error           string        `json:"error,omitempty"`
+}
+
+type OllamaEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type OllamaEmbeddingResponse struct {
+	Model           string      `json:"model"`
+	Embeddings      [][]float64 `json:"embeddings"`
+	PromptEvalCount int         `json:"prompt_eval_count,omitempty"`
+	Error           string      `json:"error,omitempty"`
+}
+
+type OllamaTagsResponse struct {
+	Models []struct {
+		Name  string `json:"name"`
+		Model string `json:"model"`
+	} `json:"models"`
 }
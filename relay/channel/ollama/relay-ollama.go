@@ -1,23 +1,69 @@
 package ollama
 
-import "one-api/dto"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+	"strings"
+)
 
-func requestOpenAI2Ollama(request dto.GeneralOpenAIRequest) *OllamaRequest {
-	messages := make([]dto.Message, 0, len(request.Messages))
+func requestOpenAI2Ollama(request dto.GeneralOpenAIRequest) (*OllamaRequest, error) {
+	messages := make([]OllamaMessage, 0, len(request.Messages))
 	for _, message := range request.Messages {
-		messages = append(messages, dto.Message{
-			Role:    message.Role,
-			Content: message.Content,
-		})
+		ollamaMessage := OllamaMessage{
+			Role: message.Role,
+		}
+		if message.IsStringContent() {
+			ollamaMessage.Content = message.StringContent()
+		} else {
+			// Ollama 的图片放在消息的 images 字段中，只支持 base64 编码的数据
+			var texts []string
+			for _, mediaMessage := range message.ParseContent() {
+				if mediaMessage.Type == dto.ContentTypeText {
+					texts = append(texts, mediaMessage.Text)
+					continue
+				}
+				imageUrl, ok := mediaMessage.ImageUrl.(dto.MessageImageUrl)
+				if !ok {
+					continue
+				}
+				if strings.HasPrefix(imageUrl.Url, "http") {
+					_, data, err := common.GetImageFromUrl(imageUrl.Url)
+					if err != nil {
+						return nil, err
+					}
+					ollamaMessage.Images = append(ollamaMessage.Images, data)
+				} else {
+					_, _, base64String, err := common.DecodeBase64ImageData(imageUrl.Url)
+					if err != nil {
+						return nil, err
+					}
+					ollamaMessage.Images = append(ollamaMessage.Images, base64String)
+				}
+			}
+			ollamaMessage.Content = strings.Join(texts, "\n")
+		}
+		messages = append(messages, ollamaMessage)
 	}
-	str, ok := request.Stop.(string)
 	var Stop []string
-	if ok {
-		Stop = []string{str}
-	} else {
-		Stop, _ = request.Stop.([]string)
+	switch stop := request.Stop.(type) {
+	case string:
+		Stop = []string{stop}
+	case []any:
+		for _, item := range stop {
+			if str, ok := item.(string); ok {
+				Stop = append(Stop, str)
+			}
+		}
 	}
-	return &OllamaRequest{
+	ollamaRequest := OllamaRequest{
 		Model:    request.Model,
 		Messages: messages,
 		Stream:   request.Stream,
@@ -26,7 +72,209 @@ func requestOpenAI2Ollama(request dto.GeneralOpenAIRequest) *OllamaRequest {
 			Seed:        request.Seed,
 			Topp:        request.TopP,
 			TopK:        request.TopK,
-			Stop:        Stop,
+			NumPredict:  int(request.MaxTokens),
 		},
 	}
+	if len(Stop) > 0 {
+		ollamaRequest.Options.Stop = Stop
+	}
+	return &ollamaRequest, nil
+}
+
+func embeddingRequestOpenAI2Ollama(request dto.GeneralOpenAIRequest) *OllamaEmbeddingRequest {
+	return &OllamaEmbeddingRequest{
+		Model: request.Model,
+		Input: request.ParseInput(),
+	}
+}
+
+func stopReasonOllama2OpenAI(reason string) string {
+	switch reason {
+	case "", "stop":
+		return "stop"
+	case "length":
+		return "length"
+	default:
+		return reason
+	}
+}
+
+// usageOllama2OpenAI prompt_eval_count 和 eval_count 分别为输入和输出的 token 数，
+// 命中上下文缓存时 Ollama 可能不返回 prompt_eval_count，此时使用估算的 prompt token 数
+func usageOllama2OpenAI(response *OllamaResponse, promptTokens int) *dto.Usage {
+	if response.PromptEvalCount > 0 {
+		promptTokens = response.PromptEvalCount
+	}
+	return &dto.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: response.EvalCount,
+		TotalTokens:      promptTokens + response.EvalCount,
+	}
+}
+
+func readResponseBody(resp *http.Response) ([]byte, *dto.OpenAIErrorWithStatusCode) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return nil, service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError)
+	}
+	return responseBody, nil
+}
+
+func ollamaError(message string, statusCode int) *dto.OpenAIErrorWithStatusCode {
+	return &dto.OpenAIErrorWithStatusCode{
+		Error: dto.OpenAIError{
+			Message: message,
+			Type:    "ollama_error",
+			Code:    "ollama_error",
+		},
+		StatusCode: statusCode,
+	}
+}
+
+func writeJSON(c *gin.Context, statusCode int, response any) *dto.OpenAIErrorWithStatusCode {
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError)
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(statusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+	return nil
+}
+
+func ollamaHandler(c *gin.Context, resp *http.Response, promptTokens int, model string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, openaiErr := readResponseBody(resp)
+	if openaiErr != nil {
+		return openaiErr, nil
+	}
+	var ollamaResponse OllamaResponse
+	err := json.Unmarshal(responseBody, &ollamaResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if ollamaResponse.Error != "" {
+		return ollamaError(ollamaResponse.Error, resp.StatusCode), nil
+	}
+	usage := usageOllama2OpenAI(&ollamaResponse, promptTokens)
+	if ollamaResponse.EvalCount == 0 {
+		usage.CompletionTokens, _, _ = service.CountTokenText(ollamaResponse.Message.Content, model, false)
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	content, _ := json.Marshal(ollamaResponse.Message.Content)
+	fullTextResponse := dto.OpenAITextResponse{
+		Id:      fmt.Sprintf("chatcmpl-%s", common.GetUUID()),
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Choices: []dto.OpenAITextResponseChoice{
+			{
+				Index: 0,
+				Message: dto.Message{
+					Role:    "assistant",
+					Content: content,
+				},
+				FinishReason: stopReasonOllama2OpenAI(ollamaResponse.DoneReason),
+			},
+		},
+		Usage: *usage,
+	}
+	return writeJSON(c, resp.StatusCode, fullTextResponse), usage
+}
+
+// ollamaStreamHandler Ollama 的流式响应每行一个 JSON 对象，最后一行 done 为 true，带有结束原因和用量
+func ollamaStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseId := fmt.Sprintf("chatcmpl-%s", common.GetUUID())
+	createdTime := common.GetTimestamp()
+	stream := relaycommon.NewStream(c, info, relaycommon.NewLineDecoder(resp.Body))
+	return nil, stream.Run(func(event relaycommon.StreamEvent) error {
+		if event.Data == "" {
+			return nil
+		}
+		var ollamaResponse OllamaResponse
+		err := json.Unmarshal([]byte(event.Data), &ollamaResponse)
+		if err != nil {
+			return err
+		}
+		if ollamaResponse.Error != "" {
+			return errors.New(ollamaResponse.Error)
+		}
+		var choice dto.ChatCompletionsStreamResponseChoice
+		choice.Delta.Content = ollamaResponse.Message.Content
+		if ollamaResponse.Done {
+			finishReason := stopReasonOllama2OpenAI(ollamaResponse.DoneReason)
+			choice.FinishReason = &finishReason
+			if ollamaResponse.EvalCount > 0 {
+				stream.Usage = usageOllama2OpenAI(&ollamaResponse, info.PromptTokens)
+			}
+		}
+		return stream.SendResponse(&dto.ChatCompletionsStreamResponse{
+			Id:      responseId,
+			Object:  "chat.completion.chunk",
+			Created: createdTime,
+			Model:   info.UpstreamModelName,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{choice},
+		})
+	})
+}
+
+func ollamaEmbeddingHandler(c *gin.Context, resp *http.Response, promptTokens int, model string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, openaiErr := readResponseBody(resp)
+	if openaiErr != nil {
+		return openaiErr, nil
+	}
+	var ollamaResponse OllamaEmbeddingResponse
+	err := json.Unmarshal(responseBody, &ollamaResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if ollamaResponse.Error != "" {
+		return ollamaError(ollamaResponse.Error, resp.StatusCode), nil
+	}
+	if ollamaResponse.PromptEvalCount > 0 {
+		promptTokens = ollamaResponse.PromptEvalCount
+	}
+	usage := &dto.Usage{PromptTokens: promptTokens, TotalTokens: promptTokens}
+	embeddingResponse := dto.OpenAIEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.OpenAIEmbeddingResponseItem, 0, len(ollamaResponse.Embeddings)),
+		Model:  model,
+		Usage:  *usage,
+	}
+	for i, embedding := range ollamaResponse.Embeddings {
+		embeddingResponse.Data = append(embeddingResponse.Data, dto.OpenAIEmbeddingResponseItem{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: embedding,
+		})
+	}
+	return writeJSON(c, resp.StatusCode, embeddingResponse), usage
+}
+
+// FetchModels 从 Ollama 的 /api/tags 接口获取本地已下载的模型列表
+func FetchModels(baseUrl string) ([]string, error) {
+	resp, err := service.GetImpatientHttpClient().Get(fmt.Sprintf("%s/api/tags", strings.TrimSuffix(baseUrl, "/")))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+	var tagsResponse OllamaTagsResponse
+	err = json.NewDecoder(resp.Body).Decode(&tagsResponse)
+	if err != nil {
+		return nil, err
+	}
+	models := make([]string, 0, len(tagsResponse.Models))
+	for _, model := range tagsResponse.Models {
+		name := model.Name
+		if name == "" {
+			name = model.Model
+		}
+		models = append(models, name)
+	}
+	return models, nil
 }
@@ -12,12 +12,13 @@ import (
 	"one-api/relay/channel/ai360"
 	"one-api/relay/channel/moonshot"
 	relaycommon "one-api/relay/common"
-	"one-api/service"
+	"one-api/relay/constant"
 	"strings"
 )
 
 type Adaptor struct {
-	ChannelType int
+	ChannelType        int
+	RequestContentType string // 请求体由适配器生成时（如 multipart 请求）使用的 Content-Type
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo, request dto.GeneralOpenAIRequest) {
@@ -45,6 +46,9 @@ func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.RelayInfo) error {
 	channel.SetupApiRequestHeader(info, c, req)
+	if a.RequestContentType != "" {
+		req.Header.Set("Content-Type", a.RequestContentType)
+	}
 	if info.ChannelType == common.ChannelTypeAzure {
 		req.Header.Set("api-key", info.ApiKey)
 		return nil
@@ -67,6 +71,20 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *dto.Gen
 	return request, nil
 }
 
+func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
+	return request, nil
+}
+
+func (a *Adaptor) ConvertImageEditRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageEditRequest) (io.ReadCloser, error) {
+	fields, err := imageEditRequestFields(c, request)
+	if err != nil {
+		return nil, err
+	}
+	body, contentType := channel.NewMultipartBody(fields)
+	a.RequestContentType = contentType
+	return body, nil
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	return channel.DoApiRequest(a, c, info, requestBody)
 }
@@ -83,12 +101,13 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 // *dto.OpenAIErrorWithStatusCode - OpenAI请求过程中发生的错误，包含HTTP状态码。
 // *dto.SensitiveResponse - 可能包含敏感信息的响应内容。
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode, sensitiveResp *dto.SensitiveResponse) {
-	if info.IsStream {
+	if info.RelayMode == constant.RelayModeRerank {
+		err, usage = RerankHandler(c, resp, info.PromptTokens)
+	} else if info.RelayMode == constant.RelayModeImagesEdits || info.RelayMode == constant.RelayModeImagesVariations {
+		err, usage = ImageHandler(c, resp)
+	} else if info.IsStream {
 		// 处理流式响应
-		var responseText string
-		err, responseText = OpenaiStreamHandler(c, resp, info.RelayMode)
-		// 从响应文本中提取使用信息
-		usage, _ = service.ResponseText2Usage(responseText, info.UpstreamModelName, info.PromptTokens)
+		err, usage = OpenaiStreamHandler(c, resp, info)
 	} else {
 		// 处理非流式响应
 		err, usage, sensitiveResp = OpenaiHandler(c, resp, info.PromptTokens, info.UpstreamModelName)
@@ -0,0 +1,101 @@
+package openai
+
+type ResponsesTool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type ResponsesTextFormat struct {
+	Type string `json:"type"`
+}
+
+type ResponsesText struct {
+	Format *ResponsesTextFormat `json:"format,omitempty"`
+}
+
+type ResponsesRequest struct {
+	Model              string          `json:"model"`
+	Input              any             `json:"input,omitempty"`
+	Instructions       string          `json:"instructions,omitempty"`
+	PreviousResponseId string          `json:"previous_response_id,omitempty"`
+	Tools              []ResponsesTool `json:"tools,omitempty"`
+	ToolChoice         any             `json:"tool_choice,omitempty"`
+	MaxOutputTokens    uint            `json:"max_output_tokens,omitempty"`
+	Temperature        float64         `json:"temperature,omitempty"`
+	TopP               float64         `json:"top_p,omitempty"`
+	Text               *ResponsesText  `json:"text,omitempty"`
+	Store              *bool           `json:"store,omitempty"` // 是否保存对话状态，默认保存
+	Stream             bool            `json:"stream,omitempty"`
+	User               string          `json:"user,omitempty"`
+}
+
+// ResponsesInputItem input 数组中的一项，可以是消息、function_call 或 function_call_output
+type ResponsesInputItem struct {
+	Type    string `json:"type,omitempty"`
+	Role    string `json:"role,omitempty"`
+	Content any    `json:"content,omitempty"`
+	// function_call
+	CallId    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	// function_call_output
+	Output any `json:"output,omitempty"`
+}
+
+type ResponsesContent struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	ImageUrl    string `json:"image_url,omitempty"`
+	Detail      string `json:"detail,omitempty"`
+	Annotations []any  `json:"annotations"`
+}
+
+type ResponsesOutputItem struct {
+	Type   string `json:"type"`
+	Id     string `json:"id"`
+	Status string `json:"status"`
+	// message
+	Role    string `json:"role,omitempty"`
+	Content any    `json:"content,omitempty"`
+	// function_call
+	CallId    string  `json:"call_id,omitempty"`
+	Name      string  `json:"name,omitempty"`
+	Arguments *string `json:"arguments,omitempty"`
+}
+
+type ResponsesUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+type ResponsesIncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+type ResponsesResponse struct {
+	Id                string                      `json:"id"`
+	Object            string                      `json:"object"`
+	CreatedAt         int64                       `json:"created_at"`
+	Status            string                      `json:"status"`
+	Model             string                      `json:"model"`
+	Output            []ResponsesOutputItem       `json:"output"`
+	IncompleteDetails *ResponsesIncompleteDetails `json:"incomplete_details"`
+	Usage             *ResponsesUsage             `json:"usage"`
+}
+
+type ResponsesStreamEvent struct {
+	Type           string               `json:"type"`
+	SequenceNumber int                  `json:"sequence_number"`
+	Response       *ResponsesResponse   `json:"response,omitempty"`
+	OutputIndex    *int                 `json:"output_index,omitempty"`
+	ContentIndex   *int                 `json:"content_index,omitempty"`
+	ItemId         string               `json:"item_id,omitempty"`
+	Item           *ResponsesOutputItem `json:"item,omitempty"`
+	Part           *ResponsesContent    `json:"part,omitempty"`
+	Delta          string               `json:"delta,omitempty"`
+	Text           *string              `json:"text,omitempty"`
+	Arguments      *string              `json:"arguments,omitempty"`
+}
@@ -0,0 +1,47 @@
+package openai
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"one-api/common"
+	relaycommon "one-api/relay/common"
+	"strings"
+)
+
+// defaultRealtimeApiVersion Azure 渠道没有配置 API 版本时使用的实时 API 版本
+const defaultRealtimeApiVersion = "2024-10-01-preview"
+
+// GetRealtimeURL 返回上游实时 API 的 WebSocket 地址，Azure 渠道使用部署名称
+func GetRealtimeURL(info *relaycommon.RelayInfo) string {
+	var requestURL string
+	if info.ChannelType == common.ChannelTypeAzure {
+		apiVersion := info.ApiVersion
+		if apiVersion == "" {
+			apiVersion = defaultRealtimeApiVersion
+		}
+		deployment := strings.Replace(info.UpstreamModelName, ".", "", -1)
+		requestURL = fmt.Sprintf("%s/openai/realtime?api-version=%s&deployment=%s", info.BaseUrl, apiVersion, url.QueryEscape(deployment))
+	} else {
+		requestURL = fmt.Sprintf("%s/v1/realtime?model=%s", info.BaseUrl, url.QueryEscape(info.UpstreamModelName))
+	}
+	if strings.HasPrefix(requestURL, "https://") {
+		return "wss://" + strings.TrimPrefix(requestURL, "https://")
+	}
+	return "ws://" + strings.TrimPrefix(requestURL, "http://")
+}
+
+// GetRealtimeHeader 返回连接上游实时 API 时使用的请求头
+func GetRealtimeHeader(info *relaycommon.RelayInfo) http.Header {
+	header := make(http.Header)
+	if info.ChannelType == common.ChannelTypeAzure {
+		header.Set("api-key", info.ApiKey)
+		return header
+	}
+	header.Set("Authorization", "Bearer "+info.ApiKey)
+	header.Set("OpenAI-Beta", "realtime=v1")
+	if info.Organization != "" {
+		header.Set("OpenAI-Organization", info.Organization)
+	}
+	return header
+}
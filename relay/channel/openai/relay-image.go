@@ -0,0 +1,51 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"one-api/dto"
+	"one-api/relay/channel"
+	"one-api/service"
+)
+
+// imageEditRequestFields 按客户端上传的表单生成转发给上游的字段
+func imageEditRequestFields(c *gin.Context, request dto.ImageEditRequest) ([]channel.MultipartField, error) {
+	form := c.Request.MultipartForm
+	if form == nil {
+		return nil, errors.New("multipart form is not parsed")
+	}
+	return channel.MultipartFormFields(form, request.Model), nil
+}
+
+// ImageHandler 处理图片编辑和变体请求的响应，响应体原样返回给客户端
+func ImageHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var imageResponse struct {
+		dto.ImageResponse
+		Error *dto.OpenAIError `json:"error,omitempty"`
+	}
+	err = json.Unmarshal(responseBody, &imageResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if imageResponse.Error != nil {
+		return &dto.OpenAIErrorWithStatusCode{
+			Error:      *imageResponse.Error,
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(responseBody)
+	return nil, nil
+}
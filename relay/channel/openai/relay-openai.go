@@ -1,7 +1,6 @@
 package openai
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -13,11 +12,10 @@ import (
 	"one-api/common"
 	"one-api/constant"
 	"one-api/dto"
+	relaycommon "one-api/relay/common"
 	relayconstant "one-api/relay/constant"
 	"one-api/service"
 	"strings"
-	"sync"
-	"time"
 )
 
 // OpenaiStreamHandler 处理OpenAI的流式响应数据。
@@ -25,123 +23,88 @@ import (
 // 参数:
 // c *gin.Context: Gin框架的上下文对象，用于HTTP请求的处理。
 // resp *http.Response: HTTP响应对象，包含了从OpenAI获取的原始数据。
-// relayMode int: 传递模式，决定如何处理和转发收到的数据。
+// info *relaycommon.RelayInfo: 中继信息，决定如何处理和转发收到的数据。
 //
 // 返回值:
 // *dto.OpenAIErrorWithStatusCode: 如果处理过程中遇到错误，返回包含错误信息和状态码的DTO。
-// string: 处理后的响应文本，如果没有错误发生，将包含流式数据的聚合结果。
-func OpenaiStreamHandler(c *gin.Context, resp *http.Response, relayMode int) (*dto.OpenAIErrorWithStatusCode, string) {
-	// 检查是否需要对完成敏感词进行检查
-	checkSensitive := constant.ShouldCheckCompletionSensitive()
-	var responseTextBuilder strings.Builder
-	scanner := bufio.NewScanner(resp.Body)
-	// 自定义分割逻辑，以换行符分隔响应体
-	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		if atEOF && len(data) == 0 {
-			return 0, nil, nil
+// *dto.Usage: 上游返回的用量，上游没有返回时根据流式数据的聚合结果估算。
+func OpenaiStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	stream := relaycommon.NewStream(c, info, relaycommon.NewSSEDecoder(resp.Body))
+	usage := stream.Run(func(event relaycommon.StreamEvent) error {
+		data := event.Data
+		// java项目中com.theokanning.openai.completion.chat.ChatMessage;设置了role为NonNull，
+		// 如果这里role返回null的话在下游的java项目中会报错
+		// 所以统一都替换为"assistant"
+		data = strings.Replace(data, `"role":null`, `"role":"assistant"`, -1)
+		streamResponse, err := parseStreamResponse(info.RelayMode, data)
+		if err != nil {
+			// 无法解析的数据块原样转发
+			stream.Send(data)
+			return err
 		}
-		if i := strings.Index(string(data), "\n"); i >= 0 {
-			return i + 1, data[0:i], nil
+		stream.AppendText(streamResponse.text)
+		if streamResponse.Id != "" {
+			stream.Id, stream.Created, stream.Model = streamResponse.Id, streamResponse.Created, streamResponse.Model
 		}
-		if atEOF {
-			return len(data), data, nil
+		// 记录上游返回的 usage，choices 为空的 usage 数据块只在客户端要求时转发
+		if streamResponse.Usage != nil && streamResponse.Usage.TotalTokens > 0 {
+			stream.Usage = streamResponse.Usage
+			if streamResponse.choices == 0 && !info.ShouldIncludeUsage {
+				return nil
+			}
+			stream.UsageSent = info.ShouldIncludeUsage
 		}
-		return 0, nil, nil
+		stream.Send(data)
+		return nil
 	})
-	dataChan := make(chan string, 5) // 数据通道，用于异步处理流数据
-	stopChan := make(chan bool, 2)   // 停止通道，用于控制异步处理的结束
-	defer close(stopChan)
-	defer close(dataChan)
-	var wg sync.WaitGroup
-	go func() {
-		wg.Add(1)
-		defer wg.Done()
-		var streamItems []string // 用于存储流数据项
-		for scanner.Scan() {
-			data := scanner.Text()
-			if len(data) < 6 { // 忽略空白行或格式错误的数据
-				continue
-			}
-			// 校验接收到的数据的格式，必须是data:开头或者[DONE]字符串
-			if data[:6] != "data: " && data[:6] != "[DONE]" {
-				continue
-			}
-			sensitive := false
-			if checkSensitive {
-				// 检查敏感词
-				sensitive, _, data = service.SensitiveWordReplace(data, false)
-			}
-			// java项目中com.theokanning.openai.completion.chat.ChatMessage;设置了role为NonNull，
-			// 如果这里role返回null的话在下游的java项目中会报错
-			// 所以统一都替换为"assistant"
-			data = strings.Replace(data, `"role":null`, `"role":"assistant"`, -1)
+	return nil, usage
+}
 
-			dataChan <- data
-			data = data[6:]
-			if !strings.HasPrefix(data, "[DONE]") {
-				streamItems = append(streamItems, data)
-			}
-			if sensitive && constant.StopOnSensitiveEnabled {
-				dataChan <- "data: [DONE]"
-				break
-			}
+// openaiStreamResponse 流式数据块中用于统计用量的部分
+type openaiStreamResponse struct {
+	Id      string     `json:"id"`
+	Created int64      `json:"created"`
+	Model   string     `json:"model"`
+	Usage   *dto.Usage `json:"usage,omitempty"`
+	text    string
+	choices int
+}
+
+// parseStreamResponse 解析一个流式数据块，取出其中的响应文本和用量
+func parseStreamResponse(relayMode int, data string) (*openaiStreamResponse, error) {
+	var streamResponse openaiStreamResponse
+	err := json.Unmarshal(common.StringToByteSlice(data), &streamResponse)
+	if err != nil {
+		return nil, err
+	}
+	switch relayMode {
+	case relayconstant.RelayModeChatCompletions:
+		var chatResponse dto.ChatCompletionsStreamResponseSimple
+		err = json.Unmarshal(common.StringToByteSlice(data), &chatResponse)
+		if err != nil {
+			return nil, err
 		}
-		streamResp := "[" + strings.Join(streamItems, ",") + "]"
-		switch relayMode {
-		case relayconstant.RelayModeChatCompletions:
-			var streamResponses []dto.ChatCompletionsStreamResponseSimple
-			err := json.Unmarshal(common.StringToByteSlice(streamResp), &streamResponses)
-			if err != nil {
-				common.SysError("error unmarshalling stream response: " + err.Error())
-				return // 出错时忽略该错误
-			}
-			// 处理聊天完成的流响应
-			for _, streamResponse := range streamResponses {
-				for _, choice := range streamResponse.Choices {
-					responseTextBuilder.WriteString(choice.Delta.Content)
-				}
-			}
-		case relayconstant.RelayModeCompletions:
-			var streamResponses []dto.CompletionsStreamResponse
-			err := json.Unmarshal(common.StringToByteSlice(streamResp), &streamResponses)
-			if err != nil {
-				common.SysError("error unmarshalling stream response: " + err.Error())
-				return // 出错时忽略该错误
-			}
-			// 处理完成的流响应
-			for _, streamResponse := range streamResponses {
-				for _, choice := range streamResponse.Choices {
-					responseTextBuilder.WriteString(choice.Text)
-				}
+		// 处理聊天完成的流响应
+		for _, choice := range chatResponse.Choices {
+			streamResponse.text += choice.Delta.Content
+			for _, toolCall := range dto.ParseToolCalls(choice.Delta.ToolCalls) {
+				streamResponse.text += toolCall.Function.Arguments
 			}
 		}
-		if len(dataChan) > 0 {
-			// 等待数据耗尽
-			time.Sleep(2 * time.Second)
+		streamResponse.choices = len(chatResponse.Choices)
+	case relayconstant.RelayModeCompletions:
+		var completionsResponse dto.CompletionsStreamResponse
+		err = json.Unmarshal(common.StringToByteSlice(data), &completionsResponse)
+		if err != nil {
+			return nil, err
 		}
-		common.SafeSend(stopChan, true)
-	}()
-	service.SetEventStreamHeaders(c) // 设置事件流的HTTP头
-	c.Stream(func(w io.Writer) bool {
-		select {
-		case data := <-dataChan:
-			if strings.HasPrefix(data, "data: [DONE]") {
-				data = data[:12]
-			}
-			// 移除数据末尾可能的\r字符
-			data = strings.TrimSuffix(data, "\r")
-			c.Render(-1, common.CustomEvent{Data: data}) // 渲染并发送数据
-			return true
-		case <-stopChan:
-			return false
+		// 处理完成的流响应
+		for _, choice := range completionsResponse.Choices {
+			streamResponse.text += choice.Text
 		}
-	})
-	err := resp.Body.Close()
-	if err != nil {
-		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), ""
+		streamResponse.choices = len(completionsResponse.Choices)
 	}
-	wg.Wait()
-	return nil, responseTextBuilder.String() // 返回处理后的响应文本
+	return &streamResponse, nil
 }
 
 func OpenaiHandler(c *gin.Context, resp *http.Response, promptTokens int, model string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage, *dto.SensitiveResponse) {
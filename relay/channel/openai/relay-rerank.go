@@ -0,0 +1,50 @@
+package openai
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"one-api/dto"
+	"one-api/service"
+)
+
+// RerankHandler 处理 Jina 格式上游的 rerank 响应，响应体原样返回给客户端，
+// 上游没有返回用量时按估算的 prompt token 数计费
+func RerankHandler(c *gin.Context, resp *http.Response, promptTokens int) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var rerankResponse struct {
+		dto.RerankResponse
+		Error *dto.OpenAIError `json:"error,omitempty"`
+	}
+	err = json.Unmarshal(responseBody, &rerankResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if rerankResponse.Error != nil {
+		return &dto.OpenAIErrorWithStatusCode{
+			Error:      *rerankResponse.Error,
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	usage := rerankResponse.Usage
+	if usage.TotalTokens == 0 {
+		usage = dto.Usage{
+			PromptTokens: promptTokens,
+			TotalTokens:  promptTokens,
+		}
+	} else if usage.PromptTokens == 0 {
+		usage.PromptTokens = usage.TotalTokens
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(responseBody)
+	return nil, &usage
+}
@@ -0,0 +1,559 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+	"strings"
+)
+
+// 本文件用于 /v1/responses 入口：将 Responses API 格式的请求转换为 OpenAI 对话补全格式，
+// 交给任意渠道处理后，再将对话补全格式的响应转换回 Responses 格式。
+
+// parseResponsesInput 将 input 解析为输入项列表，字符串输入视为一条 user 消息
+func parseResponsesInput(input any) []ResponsesInputItem {
+	if input == nil {
+		return nil
+	}
+	if text, ok := input.(string); ok {
+		return []ResponsesInputItem{{Type: "message", Role: "user", Content: text}}
+	}
+	var items []ResponsesInputItem
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil
+	}
+	_ = json.Unmarshal(data, &items)
+	return items
+}
+
+func parseResponsesContent(content any) []ResponsesContent {
+	if content == nil {
+		return nil
+	}
+	if text, ok := content.(string); ok {
+		return []ResponsesContent{{Type: "input_text", Text: text}}
+	}
+	var parts []ResponsesContent
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil
+	}
+	_ = json.Unmarshal(data, &parts)
+	return parts
+}
+
+// responsesContent2Message 将消息的内容转换为 OpenAI 格式，只有一段文本时使用字符串
+func responsesContent2Message(role string, content any) dto.Message {
+	contentParts := make([]map[string]any, 0)
+	for _, part := range parseResponsesContent(content) {
+		switch part.Type {
+		case "input_text", "output_text", "text":
+			contentParts = append(contentParts, map[string]any{
+				"type": dto.ContentTypeText,
+				"text": part.Text,
+			})
+		case "input_image":
+			imageUrl := map[string]any{
+				"url": part.ImageUrl,
+			}
+			if part.Detail != "" {
+				imageUrl["detail"] = part.Detail
+			}
+			contentParts = append(contentParts, map[string]any{
+				"type":      dto.ContentTypeImageURL,
+				"image_url": imageUrl,
+			})
+		}
+	}
+	message := dto.Message{
+		Role: role,
+	}
+	if len(contentParts) == 1 && contentParts[0]["type"] == dto.ContentTypeText {
+		message.Content, _ = json.Marshal(contentParts[0]["text"])
+	} else {
+		message.Content, _ = json.Marshal(contentParts)
+	}
+	return message
+}
+
+func responsesOutput2Text(output any) string {
+	if text, ok := output.(string); ok {
+		return text
+	}
+	var text strings.Builder
+	for _, part := range parseResponsesContent(output) {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
+
+func toolChoiceResponses2OpenAI(toolChoice any) any {
+	switch choice := toolChoice.(type) {
+	case string:
+		return choice
+	case map[string]any:
+		if choice["type"] == "function" {
+			return map[string]any{
+				"type": "function",
+				"function": map[string]any{
+					"name": choice["name"],
+				},
+			}
+		}
+	}
+	return nil
+}
+
+// ResponsesInput2Messages 将 Responses API 的 input 转换为 OpenAI 格式的 messages。
+// 连续的 function_call 合并到同一条 assistant 消息的 tool_calls 中，function_call_output 转换为 tool 消息
+func ResponsesInput2Messages(input any) []dto.Message {
+	items := parseResponsesInput(input)
+	messages := make([]dto.Message, 0, len(items))
+	for _, item := range items {
+		switch item.Type {
+		case "function_call":
+			toolCall := dto.ToolCall{
+				Id:   item.CallId,
+				Type: "function",
+				Function: dto.FunctionCall{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			}
+			if n := len(messages); n > 0 && messages[n-1].Role == "assistant" {
+				messages[n-1].ToolCalls = append(messages[n-1].ParseToolCalls(), toolCall)
+				continue
+			}
+			messages = append(messages, dto.Message{
+				Role:      "assistant",
+				ToolCalls: []dto.ToolCall{toolCall},
+			})
+		case "function_call_output":
+			content, _ := json.Marshal(responsesOutput2Text(item.Output))
+			messages = append(messages, dto.Message{
+				Role:       "tool",
+				Content:    content,
+				ToolCallId: item.CallId,
+			})
+		case "", "message":
+			role := item.Role
+			if role == "developer" {
+				role = "system"
+			}
+			messages = append(messages, responsesContent2Message(role, item.Content))
+		}
+	}
+	return messages
+}
+
+// RequestResponses2OpenAI 将 Responses API 格式的请求转换为 OpenAI 对话补全请求。
+// history 为 previous_response_id 对应的历史对话，instructions 作为第一条 system 消息，不会保存到历史对话中
+func RequestResponses2OpenAI(responsesRequest *ResponsesRequest, history []dto.Message) (*dto.GeneralOpenAIRequest, error) {
+	textRequest := dto.GeneralOpenAIRequest{
+		Model:       responsesRequest.Model,
+		Stream:      responsesRequest.Stream,
+		MaxTokens:   responsesRequest.MaxOutputTokens,
+		Temperature: responsesRequest.Temperature,
+		TopP:        responsesRequest.TopP,
+		User:        responsesRequest.User,
+	}
+	if responsesRequest.Text != nil && responsesRequest.Text.Format != nil && responsesRequest.Text.Format.Type == "json_object" {
+		textRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
+	}
+	tools := make([]dto.OpenAITool, 0, len(responsesRequest.Tools))
+	for _, tool := range responsesRequest.Tools {
+		// 只支持自定义函数，web_search 等内置工具没有对应的对话补全参数
+		if tool.Type != "function" {
+			continue
+		}
+		tools = append(tools, dto.OpenAITool{
+			Type: "function",
+			Function: dto.OpenAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	if len(tools) > 0 {
+		textRequest.Tools = tools
+		textRequest.ToolChoice = toolChoiceResponses2OpenAI(responsesRequest.ToolChoice)
+	}
+
+	messages := make([]dto.Message, 0, len(history)+2)
+	if responsesRequest.Instructions != "" {
+		content, _ := json.Marshal(responsesRequest.Instructions)
+		messages = append(messages, dto.Message{
+			Role:    "system",
+			Content: content,
+		})
+	}
+	messages = append(messages, history...)
+	messages = append(messages, ResponsesInput2Messages(responsesRequest.Input)...)
+	textRequest.Messages = messages
+	return &textRequest, nil
+}
+
+func responsesStatus(finishReason string) (string, *ResponsesIncompleteDetails) {
+	if finishReason == "length" {
+		return "incomplete", &ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+	}
+	return "completed", nil
+}
+
+// responsesItem 转换过程中的一个输出项，message 记录文本，function_call 记录参数
+type responsesItem struct {
+	itemType  string
+	id        string
+	callId    string
+	name      string
+	text      strings.Builder
+	arguments strings.Builder
+	done      bool
+}
+
+func (item *responsesItem) outputItem() *ResponsesOutputItem {
+	status := "in_progress"
+	if item.done {
+		status = "completed"
+	}
+	outputItem := &ResponsesOutputItem{
+		Type:   item.itemType,
+		Id:     item.id,
+		Status: status,
+	}
+	if item.itemType == "message" {
+		outputItem.Role = "assistant"
+		content := make([]ResponsesContent, 0, 1)
+		if item.done {
+			content = append(content, item.outputText())
+		}
+		outputItem.Content = content
+		return outputItem
+	}
+	arguments := item.arguments.String()
+	outputItem.CallId = item.callId
+	outputItem.Name = item.name
+	outputItem.Arguments = &arguments
+	return outputItem
+}
+
+func (item *responsesItem) outputText() ResponsesContent {
+	return ResponsesContent{
+		Type:        "output_text",
+		Text:        item.text.String(),
+		Annotations: make([]any, 0),
+	}
+}
+
+// OpenAI2ResponsesConverter 将 OpenAI 格式响应转换为 Responses API 格式，同时记录输出内容用于保存对话状态
+type OpenAI2ResponsesConverter struct {
+	id           string
+	model        string
+	createdAt    int64
+	promptTokens int
+
+	items        []*responsesItem
+	finishReason string
+
+	// 以下字段仅用于流式响应
+	started        bool
+	sequenceNumber int
+	current        *responsesItem
+	toolCallItems  map[int]*responsesItem
+}
+
+// NewOpenAI2ResponsesConverter 返回将 OpenAI 格式响应转换为 Responses API 格式的转换器
+func NewOpenAI2ResponsesConverter(model string, promptTokens int) *OpenAI2ResponsesConverter {
+	return &OpenAI2ResponsesConverter{
+		id:            fmt.Sprintf("resp_%s", common.GetUUID()),
+		model:         model,
+		createdAt:     common.GetTimestamp(),
+		promptTokens:  promptTokens,
+		toolCallItems: make(map[int]*responsesItem),
+	}
+}
+
+// Id 返回本次响应的 id
+func (r *OpenAI2ResponsesConverter) Id() string {
+	return r.id
+}
+
+// OutputMessages 返回本次响应输出的 assistant 消息，用于保存对话状态
+func (r *OpenAI2ResponsesConverter) OutputMessages() []dto.Message {
+	var text strings.Builder
+	toolCalls := make([]dto.ToolCall, 0)
+	for _, item := range r.items {
+		if item.itemType == "message" {
+			text.WriteString(item.text.String())
+			continue
+		}
+		toolCalls = append(toolCalls, dto.ToolCall{
+			Id:   item.callId,
+			Type: "function",
+			Function: dto.FunctionCall{
+				Name:      item.name,
+				Arguments: item.arguments.String(),
+			},
+		})
+	}
+	message := dto.Message{
+		Role: "assistant",
+	}
+	if text.Len() > 0 || len(toolCalls) == 0 {
+		message.Content, _ = json.Marshal(text.String())
+	}
+	if len(toolCalls) > 0 {
+		message.ToolCalls = toolCalls
+	}
+	return []dto.Message{message}
+}
+
+func (r *OpenAI2ResponsesConverter) newItem(itemType string) *responsesItem {
+	item := &responsesItem{
+		itemType: itemType,
+	}
+	if itemType == "message" {
+		item.id = fmt.Sprintf("msg_%s", common.GetUUID())
+	} else {
+		item.id = fmt.Sprintf("fc_%s", common.GetUUID())
+	}
+	r.items = append(r.items, item)
+	return item
+}
+
+func (r *OpenAI2ResponsesConverter) response(status string, usage *dto.Usage) *ResponsesResponse {
+	response := &ResponsesResponse{
+		Id:        r.id,
+		Object:    "response",
+		CreatedAt: r.createdAt,
+		Status:    status,
+		Model:     r.model,
+		Output:    make([]ResponsesOutputItem, 0, len(r.items)),
+	}
+	if status != "in_progress" {
+		for _, item := range r.items {
+			response.Output = append(response.Output, *item.outputItem())
+		}
+		status, response.IncompleteDetails = responsesStatus(r.finishReason)
+		response.Status = status
+	}
+	if usage != nil {
+		response.Usage = &ResponsesUsage{
+			InputTokens:  usage.PromptTokens,
+			OutputTokens: usage.CompletionTokens,
+			TotalTokens:  usage.TotalTokens,
+		}
+	}
+	return response
+}
+
+func (r *OpenAI2ResponsesConverter) ConvertResponse(body []byte) ([]byte, error) {
+	var textResponse dto.OpenAITextResponse
+	err := json.Unmarshal(body, &textResponse)
+	if err != nil {
+		return nil, err
+	}
+	if len(textResponse.Choices) > 0 {
+		choice := textResponse.Choices[0]
+		r.finishReason = choice.FinishReason
+		toolCalls := choice.Message.ParseToolCalls()
+		if text := choice.Message.StringContent(); (text != "" && text != "null") || len(toolCalls) == 0 {
+			item := r.newItem("message")
+			item.text.WriteString(text)
+			item.done = true
+		}
+		for _, toolCall := range toolCalls {
+			item := r.newItem("function_call")
+			item.callId = toolCall.Id
+			item.name = toolCall.Function.Name
+			item.arguments.WriteString(toolCall.Function.Arguments)
+			item.done = true
+		}
+	}
+	return json.Marshal(r.response("completed", &textResponse.Usage))
+}
+
+func (r *OpenAI2ResponsesConverter) streamEvent(event ResponsesStreamEvent) string {
+	event.SequenceNumber = r.sequenceNumber
+	r.sequenceNumber++
+	jsonStr, err := json.Marshal(event)
+	if err != nil {
+		common.SysError("error marshalling responses stream event: " + err.Error())
+		return ""
+	}
+	return fmt.Sprintf("event: %s\ndata: %s\n\n", event.Type, jsonStr)
+}
+
+func (r *OpenAI2ResponsesConverter) responseCreated() string {
+	r.started = true
+	return r.streamEvent(ResponsesStreamEvent{
+		Type:     "response.created",
+		Response: r.response("in_progress", nil),
+	}) + r.streamEvent(ResponsesStreamEvent{
+		Type:     "response.in_progress",
+		Response: r.response("in_progress", nil),
+	})
+}
+
+// startItem 结束当前的输出项并开始一个新的输出项
+func (r *OpenAI2ResponsesConverter) startItem(itemType string) string {
+	out := r.stopItem()
+	r.current = r.newItem(itemType)
+	outputIndex := len(r.items) - 1
+	out += r.streamEvent(ResponsesStreamEvent{
+		Type:        "response.output_item.added",
+		OutputIndex: &outputIndex,
+		Item:        r.current.outputItem(),
+	})
+	if itemType == "message" {
+		contentIndex := 0
+		part := r.current.outputText()
+		out += r.streamEvent(ResponsesStreamEvent{
+			Type:         "response.content_part.added",
+			ItemId:       r.current.id,
+			OutputIndex:  &outputIndex,
+			ContentIndex: &contentIndex,
+			Part:         &part,
+		})
+	}
+	return out
+}
+
+func (r *OpenAI2ResponsesConverter) stopItem() string {
+	item := r.current
+	if item == nil {
+		return ""
+	}
+	r.current = nil
+	item.done = true
+	outputIndex := len(r.items) - 1
+	var out strings.Builder
+	if item.itemType == "message" {
+		contentIndex := 0
+		text := item.text.String()
+		part := item.outputText()
+		out.WriteString(r.streamEvent(ResponsesStreamEvent{
+			Type:         "response.output_text.done",
+			ItemId:       item.id,
+			OutputIndex:  &outputIndex,
+			ContentIndex: &contentIndex,
+			Text:         &text,
+		}))
+		out.WriteString(r.streamEvent(ResponsesStreamEvent{
+			Type:         "response.content_part.done",
+			ItemId:       item.id,
+			OutputIndex:  &outputIndex,
+			ContentIndex: &contentIndex,
+			Part:         &part,
+		}))
+	} else {
+		arguments := item.arguments.String()
+		out.WriteString(r.streamEvent(ResponsesStreamEvent{
+			Type:        "response.function_call_arguments.done",
+			ItemId:      item.id,
+			OutputIndex: &outputIndex,
+			Arguments:   &arguments,
+		}))
+	}
+	out.WriteString(r.streamEvent(ResponsesStreamEvent{
+		Type:        "response.output_item.done",
+		OutputIndex: &outputIndex,
+		Item:        item.outputItem(),
+	}))
+	return out.String()
+}
+
+func (r *OpenAI2ResponsesConverter) ConvertStreamData(data string) string {
+	if strings.HasPrefix(data, "[DONE]") {
+		return ""
+	}
+	var streamResponse dto.ChatCompletionsStreamResponse
+	err := json.Unmarshal([]byte(data), &streamResponse)
+	if err != nil {
+		common.SysError("error unmarshalling stream response: " + err.Error())
+		return ""
+	}
+	var out strings.Builder
+	if !r.started {
+		out.WriteString(r.responseCreated())
+	}
+	for _, choice := range streamResponse.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if choice.Delta.Content != "" {
+			if r.current == nil || r.current.itemType != "message" {
+				out.WriteString(r.startItem("message"))
+			}
+			r.current.text.WriteString(choice.Delta.Content)
+			outputIndex := len(r.items) - 1
+			contentIndex := 0
+			out.WriteString(r.streamEvent(ResponsesStreamEvent{
+				Type:         "response.output_text.delta",
+				ItemId:       r.current.id,
+				OutputIndex:  &outputIndex,
+				ContentIndex: &contentIndex,
+				Delta:        choice.Delta.Content,
+			}))
+		}
+		for _, toolCall := range dto.ParseToolCalls(choice.Delta.ToolCalls) {
+			toolCallIndex := 0
+			if toolCall.Index != nil {
+				toolCallIndex = *toolCall.Index
+			}
+			item, ok := r.toolCallItems[toolCallIndex]
+			if !ok {
+				out.WriteString(r.startItem("function_call"))
+				item = r.current
+				item.callId = toolCall.Id
+				if item.callId == "" {
+					item.callId = fmt.Sprintf("call_%s", common.GetUUID())
+				}
+				item.name = toolCall.Function.Name
+				r.toolCallItems[toolCallIndex] = item
+			}
+			// 上游交替输出多个 tool call 的参数时只转发当前输出项的参数增量，已经结束的输出项的完整参数在最终的响应中返回
+			item.arguments.WriteString(toolCall.Function.Arguments)
+			if item == r.current && toolCall.Function.Arguments != "" {
+				outputIndex := len(r.items) - 1
+				out.WriteString(r.streamEvent(ResponsesStreamEvent{
+					Type:        "response.function_call_arguments.delta",
+					ItemId:      item.id,
+					OutputIndex: &outputIndex,
+					Delta:       toolCall.Function.Arguments,
+				}))
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			r.finishReason = *choice.FinishReason
+		}
+	}
+	return out.String()
+}
+
+func (r *OpenAI2ResponsesConverter) FinishStream(usage *dto.Usage) string {
+	var out strings.Builder
+	if !r.started {
+		out.WriteString(r.responseCreated())
+	}
+	out.WriteString(r.stopItem())
+	if usage == nil {
+		usage = &dto.Usage{
+			PromptTokens: r.promptTokens,
+			TotalTokens:  r.promptTokens,
+		}
+	}
+	response := r.response("completed", usage)
+	eventType := "response.completed"
+	if response.Status == "incomplete" {
+		eventType = "response.incomplete"
+	}
+	out.WriteString(r.streamEvent(ResponsesStreamEvent{
+		Type:     eventType,
+		Response: response,
+	}))
+	return out.String()
+}
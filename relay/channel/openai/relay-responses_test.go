@@ -0,0 +1,253 @@
+package openai
+
+import (
+	"encoding/json"
+	"one-api/dto"
+	"strings"
+	"testing"
+)
+
+func TestRequestResponses2OpenAI(t *testing.T) {
+	history := []dto.Message{
+		{Role: "user", Content: json.RawMessage(`"Hi"`)},
+		{Role: "assistant", Content: json.RawMessage(`"Hello!"`)},
+	}
+	tests := []struct {
+		name           string
+		request        string
+		history        []dto.Message
+		wantMessages   string
+		wantTools      string
+		wantToolChoice string
+	}{
+		{
+			name:         "string input",
+			request:      `{"model":"gpt-4o","input":"Hi"}`,
+			wantMessages: `[{"role":"user","content":"Hi"}]`,
+		},
+		{
+			// instructions 在历史对话之前，不属于历史对话
+			name:         "instructions and history",
+			request:      `{"model":"gpt-4o","instructions":"Be brief.","previous_response_id":"resp_1","input":"Again"}`,
+			history:      history,
+			wantMessages: `[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"},{"role":"assistant","content":"Hello!"},{"role":"user","content":"Again"}]`,
+		},
+		{
+			name:         "developer message and content parts",
+			request:      `{"model":"gpt-4o","input":[{"role":"developer","content":"Be brief."},{"type":"message","role":"user","content":[{"type":"input_text","text":"What is this?"},{"type":"input_image","image_url":"https://example.com/a.png"}]}]}`,
+			wantMessages: `[{"role":"system","content":"Be brief."},{"role":"user","content":[{"text":"What is this?","type":"text"},{"image_url":{"url":"https://example.com/a.png"},"type":"image_url"}]}]`,
+		},
+		{
+			name: "function calls and outputs",
+			request: `{"model":"gpt-4o","tools":[{"type":"function","name":"get_weather","parameters":{"type":"object"}},{"type":"web_search"}],"tool_choice":"required","input":[
+				{"role":"user","content":"Weather in Paris and Rome?"},
+				{"type":"function_call","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Paris\"}"},
+				{"type":"function_call","call_id":"call_2","name":"get_weather","arguments":"{\"city\":\"Rome\"}"},
+				{"type":"function_call_output","call_id":"call_1","output":"20C"},
+				{"type":"function_call_output","call_id":"call_2","output":"25C"}
+			]}`,
+			wantMessages: `[{"role":"user","content":"Weather in Paris and Rome?"},` +
+				`{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}},{"id":"call_2","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Rome\"}"}}]},` +
+				`{"role":"tool","content":"20C","tool_call_id":"call_1"},{"role":"tool","content":"25C","tool_call_id":"call_2"}]`,
+			wantTools:      `[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}]`,
+			wantToolChoice: `"required"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var responsesRequest ResponsesRequest
+			if err := json.Unmarshal([]byte(test.request), &responsesRequest); err != nil {
+				t.Fatal(err)
+			}
+			textRequest, err := RequestResponses2OpenAI(&responsesRequest, test.history)
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages, _ := json.Marshal(textRequest.Messages)
+			if string(messages) != test.wantMessages {
+				t.Errorf("messages = %s, want %s", messages, test.wantMessages)
+			}
+			tools, toolChoice := "", ""
+			if textRequest.Tools != nil {
+				data, _ := json.Marshal(textRequest.Tools)
+				tools = string(data)
+			}
+			if textRequest.ToolChoice != nil {
+				data, _ := json.Marshal(textRequest.ToolChoice)
+				toolChoice = string(data)
+			}
+			if tools != test.wantTools || toolChoice != test.wantToolChoice {
+				t.Errorf("tools = %s, tool_choice = %s, want %s, %s", tools, toolChoice, test.wantTools, test.wantToolChoice)
+			}
+		})
+	}
+}
+
+func TestOpenAI2ResponsesConverterResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantStatus   string
+		wantOutput   string
+		wantMessages string
+	}{
+		{
+			name:         "text",
+			body:         `{"choices":[{"index":0,"message":{"role":"assistant","content":"Hello!"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`,
+			wantStatus:   "completed",
+			wantOutput:   `message Hello!`,
+			wantMessages: `[{"role":"assistant","content":"Hello!"}]`,
+		},
+		{
+			name:         "truncated",
+			body:         `{"choices":[{"index":0,"message":{"role":"assistant","content":"Hel"},"finish_reason":"length"}],"usage":{"prompt_tokens":10,"completion_tokens":1,"total_tokens":11}}`,
+			wantStatus:   "incomplete",
+			wantOutput:   `message Hel`,
+			wantMessages: `[{"role":"assistant","content":"Hel"}]`,
+		},
+		{
+			name:         "tool calls",
+			body:         `{"choices":[{"index":0,"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+			wantStatus:   "completed",
+			wantOutput:   `function_call call_1 get_weather {}`,
+			wantMessages: `[{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{}"}}]}]`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			converter := NewOpenAI2ResponsesConverter("gpt-4o", 10)
+			data, err := converter.ConvertResponse([]byte(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var response ResponsesResponse
+			if err := json.Unmarshal(data, &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Id != converter.Id() || response.Status != test.wantStatus {
+				t.Errorf("id = %s, status = %s, want %s, %s", response.Id, response.Status, converter.Id(), test.wantStatus)
+			}
+			if response.Usage == nil || response.Usage.InputTokens != 10 {
+				t.Errorf("usage = %+v, want 10 input tokens", response.Usage)
+			}
+			if got := responsesTestOutput(response.Output); got != test.wantOutput {
+				t.Errorf("output = %s, want %s", got, test.wantOutput)
+			}
+			messages, _ := json.Marshal(converter.OutputMessages())
+			if string(messages) != test.wantMessages {
+				t.Errorf("OutputMessages() = %s, want %s", messages, test.wantMessages)
+			}
+		})
+	}
+}
+
+// responsesTestOutput 将输出项简写为一行，message 为文本，function_call 为 call_id、名称和参数
+func responsesTestOutput(output []ResponsesOutputItem) string {
+	items := make([]string, 0, len(output))
+	for _, item := range output {
+		if item.Type == "message" {
+			data, _ := json.Marshal(item.Content)
+			var content []ResponsesContent
+			_ = json.Unmarshal(data, &content)
+			var text strings.Builder
+			for _, part := range content {
+				text.WriteString(part.Text)
+			}
+			items = append(items, "message "+text.String())
+			continue
+		}
+		items = append(items, strings.Join([]string{item.Type, item.CallId, item.Name, *item.Arguments}, " "))
+	}
+	return strings.Join(items, ", ")
+}
+
+func TestOpenAI2ResponsesConverterStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		chunks     []string
+		wantEvents []string
+		wantOutput string
+	}{
+		{
+			name: "text",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+				`[DONE]`,
+			},
+			wantEvents: []string{
+				"response.created", "response.in_progress", "response.output_item.added", "response.content_part.added",
+				"response.output_text.delta", "response.output_text.delta", "response.output_text.done",
+				"response.content_part.done", "response.output_item.done", "response.completed",
+			},
+			wantOutput: "message Hello",
+		},
+		{
+			// 交替输出的参数只转发当前输出项的增量，最终的响应中包含完整参数
+			name: "interleaved tool calls",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":"}}]}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"get_time","arguments":"{}"}}]}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			},
+			wantEvents: []string{
+				"response.created", "response.in_progress", "response.output_item.added", "response.function_call_arguments.delta",
+				"response.function_call_arguments.done", "response.output_item.done",
+				"response.output_item.added", "response.function_call_arguments.delta",
+				"response.function_call_arguments.done", "response.output_item.done", "response.completed",
+			},
+			wantOutput: `function_call call_1 get_weather {"city":"Paris"}, function_call call_2 get_time {}`,
+		},
+		{
+			name: "truncated",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"content":"Hel"},"finish_reason":"length"}]}`,
+			},
+			wantEvents: []string{
+				"response.created", "response.in_progress", "response.output_item.added", "response.content_part.added",
+				"response.output_text.delta", "response.output_text.done", "response.content_part.done",
+				"response.output_item.done", "response.incomplete",
+			},
+			wantOutput: "message Hel",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			converter := NewOpenAI2ResponsesConverter("gpt-4o", 10)
+			var out strings.Builder
+			for _, chunk := range test.chunks {
+				out.WriteString(converter.ConvertStreamData(chunk))
+			}
+			out.WriteString(converter.FinishStream(&dto.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12}))
+
+			var got []string
+			var final *ResponsesResponse
+			for i, block := range strings.Split(strings.TrimSpace(out.String()), "\n\n") {
+				lines := strings.SplitN(block, "\n", 2)
+				if len(lines) != 2 || !strings.HasPrefix(lines[0], "event: ") || !strings.HasPrefix(lines[1], "data: ") {
+					t.Fatalf("malformed event %q", block)
+				}
+				var event ResponsesStreamEvent
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &event); err != nil {
+					t.Fatal(err)
+				}
+				if event.SequenceNumber != i {
+					t.Errorf("event %d %s has sequence_number %d", i, event.Type, event.SequenceNumber)
+				}
+				got = append(got, event.Type)
+				final = event.Response
+			}
+			if strings.Join(got, ", ") != strings.Join(test.wantEvents, ", ") {
+				t.Errorf("events = %v, want %v", got, test.wantEvents)
+			}
+			if final == nil || final.Usage == nil || final.Usage.TotalTokens != 12 {
+				t.Fatalf("final response = %+v, want usage of 12 total tokens", final)
+			}
+			if output := responsesTestOutput(final.Output); output != test.wantOutput {
+				t.Errorf("output = %s, want %s", output, test.wantOutput)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package channel
+
+import (
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"one-api/dto"
+)
+
+// 各渠道共用的工具调用转换：请求中的 tools / tool_choice 解析，以及上游返回的函数调用转换为 OpenAI 格式的 tool_calls
+
+const (
+	ToolChoiceAuto     = "auto"
+	ToolChoiceNone     = "none"
+	ToolChoiceRequired = "required"
+	ToolChoiceFunction = "function"
+
+	ToolCallsFinishReason = "tool_calls"
+)
+
+// ParseTools 返回请求中的工具定义，兼容旧版的 functions 字段
+func ParseTools(request dto.GeneralOpenAIRequest) []dto.OpenAITool {
+	tools := request.ParseTools()
+	if len(tools) > 0 || request.Functions == nil {
+		return tools
+	}
+	var functions []dto.OpenAIFunction
+	data, err := json.Marshal(request.Functions)
+	if err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &functions); err != nil {
+		return nil
+	}
+	for _, function := range functions {
+		tools = append(tools, dto.OpenAITool{
+			Type:     "function",
+			Function: function,
+		})
+	}
+	return tools
+}
+
+// ParseToolFunctions 返回请求中所有工具的函数定义
+func ParseToolFunctions(request dto.GeneralOpenAIRequest) []dto.OpenAIFunction {
+	tools := ParseTools(request)
+	if len(tools) == 0 {
+		return nil
+	}
+	functions := make([]dto.OpenAIFunction, 0, len(tools))
+	for _, tool := range tools {
+		functions = append(functions, tool.Function)
+	}
+	return functions
+}
+
+// ParseToolChoice 将 tool_choice 解析为模式和指定的函数名，未指定时返回空字符串
+func ParseToolChoice(toolChoice any) (mode string, name string) {
+	switch choice := toolChoice.(type) {
+	case string:
+		return choice, ""
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			name, _ = function["name"].(string)
+			return ToolChoiceFunction, name
+		}
+	}
+	return "", ""
+}
+
+// ToolCallNames 返回消息中 tool_call_id 到函数名的映射，用于只能按函数名回传工具结果的上游
+func ToolCallNames(messages []dto.Message) map[string]string {
+	names := make(map[string]string)
+	for _, message := range messages {
+		for _, toolCall := range message.ParseToolCalls() {
+			names[toolCall.Id] = toolCall.Function.Name
+		}
+	}
+	return names
+}
+
+// ToolArgumentsObject 将 OpenAI 的函数参数字符串解析为 JSON 对象，供要求参数为对象的上游使用
+func ToolArgumentsObject(arguments string) map[string]any {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil || args == nil {
+		return map[string]any{}
+	}
+	return args
+}
+
+// ToolCallArguments 将上游返回的函数参数转换为 OpenAI 要求的 JSON 字符串
+func ToolCallArguments(arguments any) string {
+	switch arguments := arguments.(type) {
+	case nil:
+		return "{}"
+	case string:
+		return arguments
+	}
+	data, err := json.Marshal(arguments)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// NewToolCall 构造 OpenAI 格式的工具调用，上游没有返回调用 id 时生成一个
+func NewToolCall(id string, name string, arguments any) dto.ToolCall {
+	if id == "" {
+		id = fmt.Sprintf("call_%s", common.GetUUID())
+	}
+	return dto.ToolCall{
+		Id:   id,
+		Type: "function",
+		Function: dto.FunctionCall{
+			Name:      name,
+			Arguments: ToolCallArguments(arguments),
+		},
+	}
+}
+
+// FinishReasonWithToolCalls 存在工具调用且上游正常结束时，将结束原因统一为 tool_calls
+func FinishReasonWithToolCalls(finishReason string, hasToolCalls bool) string {
+	if !hasToolCalls {
+		return finishReason
+	}
+	switch finishReason {
+	case "", "null", "stop", "normal", "function_call", ToolCallsFinishReason:
+		return ToolCallsFinishReason
+	}
+	return finishReason
+}
+
+// ToolCallStream 记录流式响应中已输出的工具调用，为每个调用分配 OpenAI 要求的 index
+type ToolCallStream struct {
+	count int
+}
+
+// Append 为一批流式工具调用补全 index，上游已给出 index 时保持不变；
+// 没有 index、id 和函数名的片段视为上一个调用的参数续传
+func (s *ToolCallStream) Append(toolCalls []dto.ToolCall) []dto.ToolCall {
+	for i := range toolCalls {
+		toolCall := &toolCalls[i]
+		if toolCall.Index != nil {
+			if *toolCall.Index >= s.count {
+				s.count = *toolCall.Index + 1
+			}
+			continue
+		}
+		index := s.count
+		if toolCall.Id == "" && toolCall.Function.Name == "" && s.count > 0 {
+			index = s.count - 1
+		} else {
+			s.count++
+		}
+		toolCall.Index = &index
+	}
+	return toolCalls
+}
+
+// HasToolCalls 返回是否已经输出过工具调用
+func (s *ToolCallStream) HasToolCalls() bool {
+	return s.count > 0
+}
+
+// FinishReason 返回流式响应最后的结束原因，参见 FinishReasonWithToolCalls
+func (s *ToolCallStream) FinishReason(finishReason string) string {
+	return FinishReasonWithToolCalls(finishReason, s.HasToolCalls())
+}
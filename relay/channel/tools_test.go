@@ -0,0 +1,179 @@
+package channel
+
+import (
+	"encoding/json"
+	"one-api/dto"
+	"testing"
+)
+
+func TestParseToolChoice(t *testing.T) {
+	tests := []struct {
+		name       string
+		toolChoice string
+		mode       string
+		function   string
+	}{
+		{name: "missing", toolChoice: `null`, mode: "", function: ""},
+		{name: "auto", toolChoice: `"auto"`, mode: ToolChoiceAuto},
+		{name: "none", toolChoice: `"none"`, mode: ToolChoiceNone},
+		{name: "required", toolChoice: `"required"`, mode: ToolChoiceRequired},
+		{name: "function", toolChoice: `{"type":"function","function":{"name":"get_weather"}}`, mode: ToolChoiceFunction, function: "get_weather"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var toolChoice any
+			if err := json.Unmarshal([]byte(test.toolChoice), &toolChoice); err != nil {
+				t.Fatal(err)
+			}
+			mode, function := ParseToolChoice(toolChoice)
+			if mode != test.mode || function != test.function {
+				t.Errorf("ParseToolChoice() = %q, %q, want %q, %q", mode, function, test.mode, test.function)
+			}
+		})
+	}
+}
+
+func TestParseTools(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    []string
+	}{
+		{
+			name:    "tools",
+			request: `{"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}},{"type":"function","function":{"name":"get_time"}}]}`,
+			want:    []string{"get_weather", "get_time"},
+		},
+		{
+			name:    "legacy functions",
+			request: `{"functions":[{"name":"get_weather","parameters":{"type":"object"}}]}`,
+			want:    []string{"get_weather"},
+		},
+		{
+			name:    "no tools",
+			request: `{}`,
+			want:    nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var request dto.GeneralOpenAIRequest
+			if err := json.Unmarshal([]byte(test.request), &request); err != nil {
+				t.Fatal(err)
+			}
+			tools := ParseTools(request)
+			if len(tools) != len(test.want) {
+				t.Fatalf("ParseTools() returned %d tools, want %d", len(tools), len(test.want))
+			}
+			for i, tool := range tools {
+				if tool.Type != "function" || tool.Function.Name != test.want[i] {
+					t.Errorf("tool %d = %s %s, want function %s", i, tool.Type, tool.Function.Name, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFinishReasonWithToolCalls(t *testing.T) {
+	tests := []struct {
+		finishReason string
+		hasToolCalls bool
+		want         string
+	}{
+		{finishReason: "stop", hasToolCalls: false, want: "stop"},
+		{finishReason: "stop", hasToolCalls: true, want: ToolCallsFinishReason},
+		{finishReason: "normal", hasToolCalls: true, want: ToolCallsFinishReason},
+		{finishReason: "function_call", hasToolCalls: true, want: ToolCallsFinishReason},
+		{finishReason: "", hasToolCalls: true, want: ToolCallsFinishReason},
+		{finishReason: "length", hasToolCalls: true, want: "length"},
+		{finishReason: "content_filter", hasToolCalls: true, want: "content_filter"},
+	}
+	for _, test := range tests {
+		if got := FinishReasonWithToolCalls(test.finishReason, test.hasToolCalls); got != test.want {
+			t.Errorf("FinishReasonWithToolCalls(%q, %v) = %q, want %q", test.finishReason, test.hasToolCalls, got, test.want)
+		}
+	}
+}
+
+func TestToolCallArguments(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments any
+		want      string
+	}{
+		{name: "nil", arguments: nil, want: "{}"},
+		{name: "string", arguments: `{"city":"Paris"}`, want: `{"city":"Paris"}`},
+		{name: "object", arguments: map[string]any{"city": "Paris"}, want: `{"city":"Paris"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ToolCallArguments(test.arguments); got != test.want {
+				t.Errorf("ToolCallArguments() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestToolCallStream(t *testing.T) {
+	type chunk struct {
+		toolCalls []dto.ToolCall
+		indexes   []int
+	}
+	tests := []struct {
+		name   string
+		chunks []chunk
+	}{
+		{
+			name: "one call with argument fragments",
+			chunks: []chunk{
+				{toolCalls: []dto.ToolCall{{Id: "call_1", Function: dto.FunctionCall{Name: "get_weather", Arguments: `{"ci`}}}, indexes: []int{0}},
+				{toolCalls: []dto.ToolCall{{Function: dto.FunctionCall{Arguments: `ty":"Paris"}`}}}, indexes: []int{0}},
+			},
+		},
+		{
+			name: "calls in separate chunks",
+			chunks: []chunk{
+				{toolCalls: []dto.ToolCall{{Id: "call_1", Function: dto.FunctionCall{Name: "get_weather"}}}, indexes: []int{0}},
+				{toolCalls: []dto.ToolCall{{Id: "call_2", Function: dto.FunctionCall{Name: "get_time"}}}, indexes: []int{1}},
+				{toolCalls: []dto.ToolCall{{Function: dto.FunctionCall{Arguments: `{}`}}}, indexes: []int{1}},
+			},
+		},
+		{
+			name: "several calls in one chunk",
+			chunks: []chunk{
+				{toolCalls: []dto.ToolCall{{Id: "call_1", Function: dto.FunctionCall{Name: "get_weather"}}, {Id: "call_2", Function: dto.FunctionCall{Name: "get_time"}}}, indexes: []int{0, 1}},
+			},
+		},
+		{
+			name: "upstream indexes are kept",
+			chunks: []chunk{
+				{toolCalls: []dto.ToolCall{{Index: intPtr(0), Id: "call_1", Function: dto.FunctionCall{Name: "get_weather"}}}, indexes: []int{0}},
+				{toolCalls: []dto.ToolCall{{Index: intPtr(0), Function: dto.FunctionCall{Arguments: `{}`}}}, indexes: []int{0}},
+				{toolCalls: []dto.ToolCall{{Id: "call_2", Function: dto.FunctionCall{Name: "get_time"}}}, indexes: []int{1}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stream ToolCallStream
+			if stream.HasToolCalls() || stream.FinishReason("stop") != "stop" {
+				t.Fatal("empty stream should keep the finish reason")
+			}
+			for i, chunk := range test.chunks {
+				toolCalls := stream.Append(chunk.toolCalls)
+				for j, toolCall := range toolCalls {
+					if toolCall.Index == nil || *toolCall.Index != chunk.indexes[j] {
+						t.Errorf("chunk %d call %d index = %v, want %d", i, j, toolCall.Index, chunk.indexes[j])
+					}
+				}
+			}
+			if got := stream.FinishReason("stop"); got != ToolCallsFinishReason {
+				t.Errorf("FinishReason() = %q, want %q", got, ToolCallsFinishReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package vertex
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"one-api/dto"
+	"one-api/relay/channel"
+	"one-api/relay/channel/claude"
+	"one-api/relay/channel/gemini"
+	relaycommon "one-api/relay/common"
+	"strings"
+)
+
+const (
+	RequestModeGemini = 1
+	RequestModeClaude = 2
+)
+
+const defaultRegion = "us-central1"
+
+type Adaptor struct {
+	RequestMode int
+	account     *ServiceAccount
+}
+
+func (a *Adaptor) Init(info *relaycommon.RelayInfo, request dto.GeneralOpenAIRequest) {
+	if strings.HasPrefix(info.UpstreamModelName, "claude") {
+		a.RequestMode = RequestModeClaude
+	} else {
+		a.RequestMode = RequestModeGemini
+	}
+}
+
+func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	account, err := parseServiceAccount(info.ApiKey)
+	if err != nil {
+		return "", err
+	}
+	a.account = account
+	region := info.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	baseUrl := info.BaseUrl
+	if baseUrl == "" {
+		baseUrl = fmt.Sprintf("https://%s-aiplatform.googleapis.com", region)
+	}
+	var publisher, modelId, action string
+	if a.RequestMode == RequestModeClaude {
+		publisher = "anthropic"
+		modelId = info.UpstreamModelName
+		if id, ok := claudeModelMap[modelId]; ok {
+			modelId = id
+		}
+		action = "rawPredict"
+		if info.IsStream {
+			action = "streamRawPredict"
+		}
+	} else {
+		publisher = "google"
+		modelId = info.UpstreamModelName
+		action = "generateContent"
+		if info.IsStream {
+			action = "streamGenerateContent?alt=sse"
+		}
+	}
+	return fmt.Sprintf("%s/v1/projects/%s/locations/%s/publishers/%s/models/%s:%s",
+		baseUrl, account.ProjectId, region, publisher, modelId, action), nil
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.RelayInfo) error {
+	channel.SetupApiRequestHeader(info, c, req)
+	accessToken, err := getAccessToken(a.account)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return nil
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *dto.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	if a.RequestMode == RequestModeClaude {
+		claudeRequest, err := claude.RequestOpenAI2ClaudeMessage(*request)
+		if err != nil {
+			return nil, err
+		}
+		return copyRequest(claudeRequest), nil
+	}
+	return gemini.CovertGemini2OpenAI(*request), nil
+}
+
+func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
+	return channel.DoApiRequest(a, c, info, requestBody)
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode, sensitiveResp *dto.SensitiveResponse) {
+	if a.RequestMode == RequestModeClaude {
+		if info.IsStream {
+			err, usage = claude.ClaudeStreamHandler(claude.RequestModeMessage, c, relaycommon.NewSSEDecoder(resp.Body), info)
+		} else {
+			err, usage = claude.ClaudeHandler(claude.RequestModeMessage, c, resp, info.PromptTokens, info.UpstreamModelName)
+		}
+		return
+	}
+	if info.IsStream {
+		err, usage = gemini.GeminiChatStreamHandler(c, resp, info)
+	} else {
+		err, usage = gemini.GeminiChatHandler(c, resp, info.PromptTokens, info.UpstreamModelName)
+	}
+	return
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return ChannelName
+}
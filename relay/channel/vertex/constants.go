@@ -0,0 +1,20 @@
+package vertex
+
+// claudeModelMap Claude 模型名称到 Vertex AI 模型 ID 的映射，不在其中的模型名称原样使用
+var claudeModelMap = map[string]string{
+	"claude-3-sonnet-20240229": "claude-3-sonnet@20240229",
+	"claude-3-opus-20240229":   "claude-3-opus@20240229",
+	"claude-3-haiku-20240307":  "claude-3-haiku@20240307",
+}
+
+var ModelList = []string{
+	"gemini-pro",
+	"gemini-pro-vision",
+	"gemini-1.0-pro",
+	"gemini-1.5-pro",
+	"claude-3-sonnet-20240229",
+	"claude-3-opus-20240229",
+	"claude-3-haiku-20240307",
+}
+
+var ChannelName = "vertex-ai"
@@ -0,0 +1,52 @@
+package vertex
+
+import "one-api/relay/channel/claude"
+
+// ServiceAccount 渠道密钥中的服务账号 JSON，只用到其中签发令牌所需的字段
+type ServiceAccount struct {
+	Type         string `json:"type"`
+	ProjectId    string `json:"project_id"`
+	PrivateKeyId string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenUri     string `json:"token_uri"`
+}
+
+type VertexAccessToken struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	TokenType        string `json:"token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// VertexClaudeRequest Vertex AI 上 Claude 的请求体，模型 ID 由请求地址决定
+type VertexClaudeRequest struct {
+	AnthropicVersion string                 `json:"anthropic_version"`
+	System           any                    `json:"system,omitempty"`
+	Messages         []claude.ClaudeMessage `json:"messages"`
+	MaxTokens        uint                   `json:"max_tokens"`
+	StopSequences    []string               `json:"stop_sequences,omitempty"`
+	Temperature      float64                `json:"temperature,omitempty"`
+	TopP             float64                `json:"top_p,omitempty"`
+	TopK             int                    `json:"top_k,omitempty"`
+	Tools            []claude.ClaudeTool    `json:"tools,omitempty"`
+	ToolChoice       any                    `json:"tool_choice,omitempty"`
+	Stream           bool                   `json:"stream,omitempty"`
+}
+
+func copyRequest(req *claude.ClaudeRequest) *VertexClaudeRequest {
+	return &VertexClaudeRequest{
+		AnthropicVersion: "vertex-2023-10-16",
+		System:           req.System,
+		Messages:         req.Messages,
+		MaxTokens:        req.MaxTokens,
+		StopSequences:    req.StopSequences,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		TopK:             req.TopK,
+		Tools:            req.Tools,
+		ToolChoice:       req.ToolChoice,
+		Stream:           req.Stream,
+	}
+}
@@ -0,0 +1,111 @@
+package vertex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"net/http"
+	"net/url"
+	"one-api/service"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTokenUri = "https://oauth2.googleapis.com/token"
+	vertexScope     = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+type cachedAccessToken struct {
+	AccessToken string
+	ExpiresAt   time.Time
+}
+
+// vertexTokenStore 以服务账号和私钥 ID 为键缓存访问令牌
+var vertexTokenStore sync.Map
+
+func parseServiceAccount(key string) (*ServiceAccount, error) {
+	var account ServiceAccount
+	if err := json.Unmarshal([]byte(key), &account); err != nil {
+		return nil, fmt.Errorf("invalid vertex ai service account json: %w", err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" || account.ProjectId == "" {
+		return nil, errors.New("vertex ai service account json must contain project_id, client_email and private_key")
+	}
+	if account.TokenUri == "" {
+		account.TokenUri = defaultTokenUri
+	}
+	return &account, nil
+}
+
+// getAccessToken 返回服务账号的访问令牌，缓存的令牌在过期前 5 分钟内重新签发
+func getAccessToken(account *ServiceAccount) (string, error) {
+	cacheKey := account.ClientEmail + "|" + account.PrivateKeyId + "|" + account.TokenUri
+	if val, ok := vertexTokenStore.Load(cacheKey); ok {
+		if accessToken, ok := val.(cachedAccessToken); ok && time.Now().Add(5*time.Minute).Before(accessToken.ExpiresAt) {
+			return accessToken.AccessToken, nil
+		}
+	}
+	accessToken, err := getAccessTokenHelper(account)
+	if err != nil {
+		return "", err
+	}
+	vertexTokenStore.Store(cacheKey, *accessToken)
+	return accessToken.AccessToken, nil
+}
+
+// getAccessTokenHelper 使用服务账号私钥签名 JWT，通过 JWT bearer 授权向 token_uri 换取访问令牌
+func getAccessTokenHelper(account *ServiceAccount) (*cachedAccessToken, error) {
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid vertex ai private key: %w", err)
+	}
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   account.ClientEmail,
+		"scope": vertexScope,
+		"aud":   account.TokenUri,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if account.PrivateKeyId != "" {
+		token.Header["kid"] = account.PrivateKeyId
+	}
+	assertion, err := token.SignedString(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequest("POST", account.TokenUri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	res, err := service.GetImpatientHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var accessToken VertexAccessToken
+	err = json.NewDecoder(res.Body).Decode(&accessToken)
+	if err != nil {
+		return nil, err
+	}
+	if accessToken.Error != "" {
+		return nil, errors.New(accessToken.Error + ": " + accessToken.ErrorDescription)
+	}
+	if accessToken.AccessToken == "" {
+		return nil, errors.New("get vertex ai access token failed: empty access token")
+	}
+	return &cachedAccessToken{
+		AccessToken: accessToken.AccessToken,
+		ExpiresAt:   now.Add(time.Duration(accessToken.ExpiresIn) * time.Second),
+	}, nil
+}
@@ -0,0 +1,169 @@
+package vertex
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// newTestTokenServer 模拟 Google 的 OAuth 令牌接口：校验 JWT bearer 授权，每次签发一个新的访问令牌
+func newTestTokenServer(t *testing.T, privateKey *rsa.PrivateKey, expiresIn int64) (*httptest.Server, *int32) {
+	var issued int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		if grantType := r.PostForm.Get("grant_type"); grantType != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("grant_type = %q", grantType)
+		}
+		token, err := jwt.Parse(r.PostForm.Get("assertion"), func(token *jwt.Token) (any, error) {
+			if token.Method != jwt.SigningMethodRS256 {
+				return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+			}
+			return &privateKey.PublicKey, nil
+		})
+		if err != nil {
+			t.Errorf("verify assertion: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant","error_description":"bad assertion"}`))
+			return
+		}
+		claims := token.Claims.(jwt.MapClaims)
+		if token.Header["kid"] != "key-1" {
+			t.Errorf("kid = %v, want key-1", token.Header["kid"])
+		}
+		wantClaims := map[string]any{
+			"iss":   "vertex@project.iam.gserviceaccount.com",
+			"scope": vertexScope,
+			"aud":   "http://" + r.Host + r.URL.Path,
+		}
+		for name, want := range wantClaims {
+			if claims[name] != want {
+				t.Errorf("claim %s = %v, want %v", name, claims[name], want)
+			}
+		}
+		iat, _ := claims["iat"].(float64)
+		exp, _ := claims["exp"].(float64)
+		if now := float64(time.Now().Unix()); iat > now || iat < now-60 || exp-iat != 3600 {
+			t.Errorf("iat = %v, exp = %v, want a one hour token issued now", iat, exp)
+		}
+		n := atomic.AddInt32(&issued, 1)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": fmt.Sprintf("token-%d", n),
+			"expires_in":   expiresIn,
+			"token_type":   "Bearer",
+		})
+	}))
+	return server, &issued
+}
+
+func newTestServiceAccount(t *testing.T, tokenUri string, privateKey *rsa.PrivateKey) *ServiceAccount {
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "project",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})),
+		"client_email":   "vertex@project.iam.gserviceaccount.com",
+		"token_uri":      tokenUri,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := parseServiceAccount(string(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account
+}
+
+func TestGetAccessToken(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		expiresIn int64
+		// want 依次调用 getAccessToken 得到的令牌
+		want       []string
+		wantIssued int32
+	}{
+		{name: "cached before the expiry margin", expiresIn: 3600, want: []string{"token-1", "token-1", "token-1"}, wantIssued: 1},
+		{name: "re-minted within the expiry margin", expiresIn: 240, want: []string{"token-1", "token-2", "token-3"}, wantIssued: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, issued := newTestTokenServer(t, privateKey, test.expiresIn)
+			defer server.Close()
+			account := newTestServiceAccount(t, server.URL+"/token", privateKey)
+			for i, want := range test.want {
+				got, err := getAccessToken(account)
+				if err != nil {
+					t.Fatalf("call %d: getAccessToken() error = %v", i, err)
+				}
+				if got != want {
+					t.Errorf("call %d: getAccessToken() = %s, want %s", i, got, want)
+				}
+			}
+			if n := atomic.LoadInt32(issued); n != test.wantIssued {
+				t.Errorf("token endpoint issued %d tokens, want %d", n, test.wantIssued)
+			}
+		})
+	}
+}
+
+func TestGetAccessTokenRefreshesNearExpiry(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, issued := newTestTokenServer(t, privateKey, 3600)
+	defer server.Close()
+	account := newTestServiceAccount(t, server.URL+"/token", privateKey)
+	if got, err := getAccessToken(account); err != nil || got != "token-1" {
+		t.Fatalf("getAccessToken() = %s, %v, want token-1", got, err)
+	}
+
+	// 缓存的令牌剩余有效期不足 5 分钟时重新签发
+	cacheKey := account.ClientEmail + "|" + account.PrivateKeyId + "|" + account.TokenUri
+	vertexTokenStore.Store(cacheKey, cachedAccessToken{AccessToken: "token-1", ExpiresAt: time.Now().Add(4 * time.Minute)})
+	if got, err := getAccessToken(account); err != nil || got != "token-2" {
+		t.Fatalf("getAccessToken() = %s, %v, want token-2", got, err)
+	}
+	if got, err := getAccessToken(account); err != nil || got != "token-2" {
+		t.Fatalf("getAccessToken() = %s, %v, want cached token-2", got, err)
+	}
+	if n := atomic.LoadInt32(issued); n != 2 {
+		t.Errorf("token endpoint issued %d tokens, want 2", n)
+	}
+}
+
+func TestGetAccessTokenError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant","error_description":"Invalid JWT Signature."}`))
+	}))
+	defer server.Close()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := newTestServiceAccount(t, server.URL+"/token", privateKey)
+	if _, err := getAccessToken(account); err == nil || err.Error() != "invalid_grant: Invalid JWT Signature." {
+		t.Errorf("getAccessToken() error = %v, want invalid_grant", err)
+	}
+}
@@ -52,7 +52,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 		return nil, service.OpenAIErrorWrapper(errors.New("request is nil"), "request_is_nil", http.StatusBadRequest), nil
 	}
 	if info.IsStream {
-		err, usage = xunfeiStreamHandler(c, *a.request, splits[0], splits[1], splits[2])
+		err, usage = xunfeiStreamHandler(c, info, *a.request, splits[0], splits[1], splits[2])
 	} else {
 		err, usage = xunfeiHandler(c, *a.request, splits[0], splits[1], splits[2])
 	}
@@ -126,34 +126,51 @@ func buildXunfeiAuthUrl(hostUrl string, apiKey, apiSecret string) string {
 	return callUrl
 }
 
-func xunfeiStreamHandler(c *gin.Context, textRequest dto.GeneralOpenAIRequest, appId string, apiSecret string, apiKey string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+// xunfeiStreamDecoder 从讯飞的 websocket 连接中逐条读取响应，收到最后一条消息后结束
+type xunfeiStreamDecoder struct {
+	conn     *websocket.Conn
+	finished bool
+}
+
+func (d *xunfeiStreamDecoder) Decode() (relaycommon.StreamEvent, error) {
+	if d.finished {
+		return relaycommon.StreamEvent{}, io.EOF
+	}
+	_, msg, err := d.conn.ReadMessage()
+	if err != nil {
+		return relaycommon.StreamEvent{}, err
+	}
+	var response XunfeiChatResponse
+	if err := json.Unmarshal(msg, &response); err == nil && response.Payload.Choices.Status == 2 {
+		d.finished = true
+	}
+	return relaycommon.StreamEvent{Data: string(msg)}, nil
+}
+
+func (d *xunfeiStreamDecoder) Close() error {
+	return d.conn.Close()
+}
+
+func xunfeiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, textRequest dto.GeneralOpenAIRequest, appId string, apiSecret string, apiKey string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
 	domain, authUrl := getXunfeiAuthUrl(c, apiKey, apiSecret, textRequest.Model)
-	dataChan, stopChan, err := xunfeiMakeRequest(textRequest, domain, authUrl, appId)
+	conn, err := xunfeiDial(textRequest, domain, authUrl, appId)
 	if err != nil {
 		return service.OpenAIErrorWrapper(err, "make xunfei request err", http.StatusInternalServerError), nil
 	}
-	service.SetEventStreamHeaders(c)
-	var usage dto.Usage
-	c.Stream(func(w io.Writer) bool {
-		select {
-		case xunfeiResponse := <-dataChan:
-			usage.PromptTokens += xunfeiResponse.Payload.Usage.Text.PromptTokens
-			usage.CompletionTokens += xunfeiResponse.Payload.Usage.Text.CompletionTokens
-			usage.TotalTokens += xunfeiResponse.Payload.Usage.Text.TotalTokens
-			response := streamResponseXunfei2OpenAI(&xunfeiResponse)
-			jsonResponse, err := json.Marshal(response)
-			if err != nil {
-				common.SysError("error marshalling stream response: " + err.Error())
-				return true
-			}
-			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonResponse)})
-			return true
-		case <-stopChan:
-			c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
-			return false
+	usage := &dto.Usage{}
+	stream := relaycommon.NewStream(c, info, &xunfeiStreamDecoder{conn: conn})
+	stream.Usage = usage
+	return nil, stream.Run(func(event relaycommon.StreamEvent) error {
+		var xunfeiResponse XunfeiChatResponse
+		err := json.Unmarshal([]byte(event.Data), &xunfeiResponse)
+		if err != nil {
+			return err
 		}
+		usage.PromptTokens += xunfeiResponse.Payload.Usage.Text.PromptTokens
+		usage.CompletionTokens += xunfeiResponse.Payload.Usage.Text.CompletionTokens
+		usage.TotalTokens += xunfeiResponse.Payload.Usage.Text.TotalTokens
+		return stream.SendResponse(streamResponseXunfei2OpenAI(&xunfeiResponse))
 	})
-	return nil, &usage
 }
 
 func xunfeiHandler(c *gin.Context, textRequest dto.GeneralOpenAIRequest, appId string, apiSecret string, apiKey string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
@@ -192,16 +209,26 @@ func xunfeiHandler(c *gin.Context, textRequest dto.GeneralOpenAIRequest, appId s
 	return nil, &usage
 }
 
-func xunfeiMakeRequest(textRequest dto.GeneralOpenAIRequest, domain, authUrl, appId string) (chan XunfeiChatResponse, chan bool, error) {
+// xunfeiDial 建立 websocket 连接并发送请求
+func xunfeiDial(textRequest dto.GeneralOpenAIRequest, domain, authUrl, appId string) (*websocket.Conn, error) {
 	d := websocket.Dialer{
 		HandshakeTimeout: 5 * time.Second,
 	}
 	conn, resp, err := d.Dial(authUrl, nil)
 	if err != nil || resp.StatusCode != 101 {
-		return nil, nil, err
+		return nil, err
 	}
 	data := requestOpenAI2Xunfei(textRequest, appId, domain)
 	err = conn.WriteJSON(data)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func xunfeiMakeRequest(textRequest dto.GeneralOpenAIRequest, domain, authUrl, appId string) (chan XunfeiChatResponse, chan bool, error) {
+	conn, err := xunfeiDial(textRequest, domain, authUrl, appId)
 	if err != nil {
 		return nil, nil, err
 	}
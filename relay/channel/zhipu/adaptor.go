@@ -48,7 +48,7 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode, sensitiveResp *dto.SensitiveResponse) {
 	if info.IsStream {
-		err, usage = zhipuStreamHandler(c, resp)
+		err, usage = zhipuStreamHandler(c, resp, info)
 	} else {
 		err, usage = zhipuHandler(c, resp)
 	}
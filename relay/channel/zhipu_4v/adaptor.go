@@ -10,16 +10,20 @@ import (
 	"one-api/relay/channel"
 	"one-api/relay/channel/openai"
 	relaycommon "one-api/relay/common"
-	"one-api/service"
+	"one-api/relay/constant"
 )
 
 type Adaptor struct {
+	ImageResponseFormat string
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo, request dto.GeneralOpenAIRequest) {
 }
 
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	if info.RelayMode == constant.RelayModeImagesGenerations {
+		return fmt.Sprintf("%s/api/paas/v4/images/generations", info.BaseUrl), nil
+	}
 	return fmt.Sprintf("%s/api/paas/v4/chat/completions", info.BaseUrl), nil
 }
 
@@ -40,15 +44,20 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *dto.Gen
 	return requestOpenAI2Zhipu(*request), nil
 }
 
+func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
+	a.ImageResponseFormat = request.ResponseFormat
+	return imageRequestOpenAI2Zhipu(request)
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
 	return channel.DoApiRequest(a, c, info, requestBody)
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage *dto.Usage, err *dto.OpenAIErrorWithStatusCode, sensitiveResp *dto.SensitiveResponse) {
-	if info.IsStream {
-		var responseText string
-		err, responseText = openai.OpenaiStreamHandler(c, resp, info.RelayMode)
-		usage, _ = service.ResponseText2Usage(responseText, info.UpstreamModelName, info.PromptTokens)
+	if info.RelayMode == constant.RelayModeImagesGenerations {
+		err, usage = zhipuImageHandler(c, resp, a.ImageResponseFormat)
+	} else if info.IsStream {
+		err, usage = zhipuStreamHandler(c, resp, info)
 	} else {
 		err, usage, sensitiveResp = openai.OpenaiHandler(c, resp, info.PromptTokens, info.UpstreamModelName)
 	}
@@ -2,6 +2,7 @@ package zhipu_4v
 
 var ModelList = []string{
 	"glm-4", "glm-4v", "glm-3-turbo",
+	"cogview-3", "cogview-3-plus",
 }
 
 var ChannelName = "zhipu_4v"
@@ -57,3 +57,18 @@ type tokenData struct {
 	Token      string
 	ExpiryTime time.Time
 }
+
+type ZhipuImageRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+	Size   string `json:"size,omitempty"`
+	UserId string `json:"user_id,omitempty"`
+}
+
+type ZhipuImageResponse struct {
+	Created int64 `json:"created"`
+	Data    []struct {
+		Url string `json:"url"`
+	} `json:"data"`
+	Error dto.OpenAIError `json:"error"`
+}
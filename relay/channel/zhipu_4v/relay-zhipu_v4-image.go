@@ -0,0 +1,63 @@
+package zhipu_4v
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"one-api/dto"
+	"one-api/relay/channel"
+	"one-api/service"
+)
+
+// https://open.bigmodel.cn/dev/api#cogview
+
+func imageRequestOpenAI2Zhipu(request dto.ImageRequest) (*ZhipuImageRequest, error) {
+	// CogView 每次只生成一张图片
+	if request.N > 1 {
+		return nil, errors.New("n must be 1")
+	}
+	return &ZhipuImageRequest{
+		Model:  request.Model,
+		Prompt: request.Prompt,
+		Size:   request.Size,
+		UserId: request.User,
+	}, nil
+}
+
+func zhipuImageHandler(c *gin.Context, resp *http.Response, responseFormat string) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	var zhipuResponse ZhipuImageResponse
+	err := json.NewDecoder(resp.Body).Decode(&zhipuResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if zhipuResponse.Error.Message != "" {
+		return &dto.OpenAIErrorWithStatusCode{
+			Error:      zhipuResponse.Error,
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	urls := make([]string, 0, len(zhipuResponse.Data))
+	for _, data := range zhipuResponse.Data {
+		urls = append(urls, data.Url)
+	}
+	imageResponse, err := channel.ImageUrls2Response(urls, responseFormat)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "download_image_failed", http.StatusInternalServerError), nil
+	}
+	if zhipuResponse.Created != 0 {
+		imageResponse.Created = int(zhipuResponse.Created)
+	}
+	jsonResponse, err := json.Marshal(imageResponse)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+	return nil, nil
+}
@@ -1,7 +1,6 @@
 package zhipu_4v
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"github.com/gin-gonic/gin"
@@ -10,6 +9,8 @@ import (
 	"net/http"
 	"one-api/common"
 	"one-api/dto"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
 	"one-api/service"
 	"strings"
 	"sync"
@@ -88,7 +89,7 @@ func requestOpenAI2Zhipu(request dto.GeneralOpenAIRequest) *dto.GeneralOpenAIReq
 	} else {
 		Stop, _ = request.Stop.([]string)
 	}
-	return &dto.GeneralOpenAIRequest{
+	zhipuRequest := dto.GeneralOpenAIRequest{
 		Model:       request.Model,
 		Stream:      request.Stream,
 		Messages:    messages,
@@ -96,9 +97,14 @@ func requestOpenAI2Zhipu(request dto.GeneralOpenAIRequest) *dto.GeneralOpenAIReq
 		TopP:        request.TopP,
 		MaxTokens:   request.MaxTokens,
 		Stop:        Stop,
-		Tools:       request.Tools,
-		ToolChoice:  request.ToolChoice,
 	}
+	// 智谱的 tool_choice 只支持 auto，tool_choice 为 none 时不传工具
+	mode, _ := channel.ParseToolChoice(request.ToolChoice)
+	if tools := channel.ParseTools(request); len(tools) > 0 && mode != channel.ToolChoiceNone {
+		zhipuRequest.Tools = tools
+		zhipuRequest.ToolChoice = channel.ToolChoiceAuto
+	}
+	return &zhipuRequest
 }
 
 //func responseZhipu2OpenAI(response *dto.OpenAITextResponse) *dto.OpenAITextResponse {
@@ -127,13 +133,18 @@ func requestOpenAI2Zhipu(request dto.GeneralOpenAIRequest) *dto.GeneralOpenAIReq
 //	return &fullTextResponse
 //}
 
-func streamResponseZhipu2OpenAI(zhipuResponse *ZhipuV4StreamResponse) *dto.ChatCompletionsStreamResponse {
+func streamResponseZhipu2OpenAI(zhipuResponse *ZhipuV4StreamResponse, toolCallStream *channel.ToolCallStream) *dto.ChatCompletionsStreamResponse {
 	var choice dto.ChatCompletionsStreamResponseChoice
 	choice.Delta.Content = zhipuResponse.Choices[0].Delta.Content
 	choice.Delta.Role = zhipuResponse.Choices[0].Delta.Role
-	choice.Delta.ToolCalls = zhipuResponse.Choices[0].Delta.ToolCalls
+	if toolCalls := dto.ParseToolCalls(zhipuResponse.Choices[0].Delta.ToolCalls); len(toolCalls) > 0 {
+		choice.Delta.ToolCalls = toolCallStream.Append(toolCalls)
+	}
 	choice.Index = zhipuResponse.Choices[0].Index
-	choice.FinishReason = zhipuResponse.Choices[0].FinishReason
+	if zhipuResponse.Choices[0].FinishReason != nil {
+		finishReason := toolCallStream.FinishReason(*zhipuResponse.Choices[0].FinishReason)
+		choice.FinishReason = &finishReason
+	}
 	response := dto.ChatCompletionsStreamResponse{
 		Id:      zhipuResponse.Id,
 		Object:  "chat.completion.chunk",
@@ -144,77 +155,31 @@ func streamResponseZhipu2OpenAI(zhipuResponse *ZhipuV4StreamResponse) *dto.ChatC
 	return &response
 }
 
-func lastStreamResponseZhipuV42OpenAI(zhipuResponse *ZhipuV4StreamResponse) (*dto.ChatCompletionsStreamResponse, *dto.Usage) {
-	response := streamResponseZhipu2OpenAI(zhipuResponse)
+func lastStreamResponseZhipuV42OpenAI(zhipuResponse *ZhipuV4StreamResponse, toolCallStream *channel.ToolCallStream) (*dto.ChatCompletionsStreamResponse, *dto.Usage) {
+	response := streamResponseZhipu2OpenAI(zhipuResponse, toolCallStream)
 	return response, &zhipuResponse.Usage
 }
 
-func zhipuStreamHandler(c *gin.Context, resp *http.Response) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
-	var usage *dto.Usage
-	scanner := bufio.NewScanner(resp.Body)
-	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		if atEOF && len(data) == 0 {
-			return 0, nil, nil
-		}
-		if i := strings.Index(string(data), "\n"); i >= 0 {
-			return i + 1, data[0:i], nil
-		}
-		if atEOF {
-			return len(data), data, nil
+func zhipuStreamHandler(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (*dto.OpenAIErrorWithStatusCode, *dto.Usage) {
+	var toolCallStream channel.ToolCallStream
+	stream := relaycommon.NewStream(c, info, relaycommon.NewSSEDecoder(resp.Body))
+	usage := stream.Run(func(event relaycommon.StreamEvent) error {
+		var streamResponse ZhipuV4StreamResponse
+		err := json.Unmarshal([]byte(event.Data), &streamResponse)
+		if err != nil {
+			return err
 		}
-		return 0, nil, nil
-	})
-	dataChan := make(chan string)
-	stopChan := make(chan bool)
-	go func() {
-		for scanner.Scan() {
-			data := scanner.Text()
-			if len(data) < 6 { // ignore blank line or wrong format
-				continue
-			}
-			if data[:6] != "data: " && data[:6] != "[DONE]" {
-				continue
-			}
-			dataChan <- data
+		if len(streamResponse.Choices) == 0 {
+			return nil
 		}
-		stopChan <- true
-	}()
-	service.SetEventStreamHeaders(c)
-	c.Stream(func(w io.Writer) bool {
-		select {
-		case data := <-dataChan:
-			if strings.HasPrefix(data, "data: [DONE]") {
-				data = data[:12]
-			}
-			// some implementations may add \r at the end of data
-			data = strings.TrimSuffix(data, "\r")
-
-			var streamResponse ZhipuV4StreamResponse
-			err := json.Unmarshal([]byte(data), &streamResponse)
-			if err != nil {
-				common.SysError("error unmarshalling stream response: " + err.Error())
-			}
-			var response *dto.ChatCompletionsStreamResponse
-			if strings.Contains(data, "prompt_tokens") {
-				response, usage = lastStreamResponseZhipuV42OpenAI(&streamResponse)
-			} else {
-				response = streamResponseZhipu2OpenAI(&streamResponse)
-			}
-			jsonResponse, err := json.Marshal(response)
-			if err != nil {
-				common.SysError("error marshalling stream response: " + err.Error())
-				return true
-			}
-			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonResponse)})
-			return true
-		case <-stopChan:
-			return false
+		var response *dto.ChatCompletionsStreamResponse
+		if strings.Contains(event.Data, "prompt_tokens") {
+			response, stream.Usage = lastStreamResponseZhipuV42OpenAI(&streamResponse, &toolCallStream)
+		} else {
+			response = streamResponseZhipu2OpenAI(&streamResponse, &toolCallStream)
 		}
+		return stream.SendResponse(response)
 	})
-	err := resp.Body.Close()
-	if err != nil {
-		return service.OpenAIErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
-	}
 	return nil, usage
 }
 
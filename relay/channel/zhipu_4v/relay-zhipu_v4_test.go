@@ -0,0 +1,184 @@
+package zhipu_4v
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestOpenAI2ZhipuTools(t *testing.T) {
+	tests := []struct {
+		name           string
+		request        string
+		wantTools      []string
+		wantToolChoice any
+	}{
+		{
+			name:           "tools",
+			request:        `{"model":"glm-4","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"get_weather"}}]}`,
+			wantTools:      []string{"get_weather"},
+			wantToolChoice: channel.ToolChoiceAuto,
+		},
+		{
+			name:           "legacy functions",
+			request:        `{"model":"glm-4","messages":[{"role":"user","content":"hi"}],"functions":[{"name":"get_weather"}]}`,
+			wantTools:      []string{"get_weather"},
+			wantToolChoice: channel.ToolChoiceAuto,
+		},
+		{
+			name:           "required falls back to auto",
+			request:        `{"model":"glm-4","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"get_weather"}}],"tool_choice":"required"}`,
+			wantTools:      []string{"get_weather"},
+			wantToolChoice: channel.ToolChoiceAuto,
+		},
+		{
+			name:    "none",
+			request: `{"model":"glm-4","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"get_weather"}}],"tool_choice":"none"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var request dto.GeneralOpenAIRequest
+			if err := json.Unmarshal([]byte(test.request), &request); err != nil {
+				t.Fatal(err)
+			}
+			zhipuRequest := requestOpenAI2Zhipu(request)
+			var tools []dto.ToolCall
+			if zhipuRequest.Tools != nil {
+				data, _ := json.Marshal(zhipuRequest.Tools)
+				if err := json.Unmarshal(data, &tools); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(tools) != len(test.wantTools) {
+				t.Fatalf("tools = %+v, want %v", tools, test.wantTools)
+			}
+			for i, tool := range tools {
+				if tool.Type != "function" || tool.Function.Name != test.wantTools[i] {
+					t.Errorf("tool %d = %+v, want function %s", i, tool, test.wantTools[i])
+				}
+			}
+			if zhipuRequest.ToolChoice != test.wantToolChoice {
+				t.Errorf("tool_choice = %v, want %v", zhipuRequest.ToolChoice, test.wantToolChoice)
+			}
+		})
+	}
+}
+
+func TestStreamResponseZhipu2OpenAIToolCalls(t *testing.T) {
+	tests := []struct {
+		name          string
+		chunks        []string
+		wantIndexes   []int
+		wantIds       []string
+		wantArguments []string
+	}{
+		{
+			name: "argument fragments",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"id":"call_a","type":"function","function":{"name":"get_weather","arguments":"{\"ci"}}]}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"function":{"arguments":"ty\":\"Paris\"}"}}]}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+			},
+			wantIndexes:   []int{0},
+			wantIds:       []string{"call_a"},
+			wantArguments: []string{`{"city":"Paris"}`},
+		},
+		{
+			name: "calls in separate chunks without index",
+			chunks: []string{
+				`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"id":"call_a","type":"function","function":{"name":"get_weather","arguments":"{}"}}]}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{"tool_calls":[{"id":"call_b","type":"function","function":{"name":"get_time","arguments":"{}"}}]}}]}`,
+				`{"id":"1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			},
+			wantIndexes:   []int{0, 1},
+			wantIds:       []string{"call_a", "call_b"},
+			wantArguments: []string{"{}", "{}"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var toolCallStream channel.ToolCallStream
+			arguments := make(map[int]string)
+			ids := make(map[int]string)
+			finishReason := ""
+			for _, chunk := range test.chunks {
+				var zhipuResponse ZhipuV4StreamResponse
+				if err := json.Unmarshal([]byte(chunk), &zhipuResponse); err != nil {
+					t.Fatal(err)
+				}
+				choice := streamResponseZhipu2OpenAI(&zhipuResponse, &toolCallStream).Choices[0]
+				for _, toolCall := range dto.ParseToolCalls(choice.Delta.ToolCalls) {
+					if toolCall.Index == nil {
+						t.Fatalf("tool call %+v has no index", toolCall)
+					}
+					if toolCall.Id != "" {
+						ids[*toolCall.Index] = toolCall.Id
+					}
+					arguments[*toolCall.Index] += toolCall.Function.Arguments
+				}
+				if choice.FinishReason != nil {
+					finishReason = *choice.FinishReason
+				}
+			}
+			if len(arguments) != len(test.wantIndexes) {
+				t.Fatalf("got %d tool calls, want %d", len(arguments), len(test.wantIndexes))
+			}
+			for i, index := range test.wantIndexes {
+				if ids[index] != test.wantIds[i] || arguments[index] != test.wantArguments[i] {
+					t.Errorf("tool call %d = %s %s, want %s %s", index, ids[index], arguments[index], test.wantIds[i], test.wantArguments[i])
+				}
+			}
+			if finishReason != channel.ToolCallsFinishReason {
+				t.Errorf("finish_reason = %q, want %q", finishReason, channel.ToolCallsFinishReason)
+			}
+		})
+	}
+}
+
+func TestZhipuResponseToolCalls(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// 响应带有用量并且关闭敏感词检查时不需要加载分词器，响应原样写回
+	checkSensitive, stopOnSensitive := constant.CheckSensitiveOnCompletionEnabled, constant.StopOnSensitiveEnabled
+	constant.CheckSensitiveOnCompletionEnabled, constant.StopOnSensitiveEnabled = false, false
+	defer func() {
+		constant.CheckSensitiveOnCompletionEnabled, constant.StopOnSensitiveEnabled = checkSensitive, stopOnSensitive
+	}()
+	body := `{"id":"1","created":1,"model":"glm-4","choices":[{"index":0,"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_a","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+	adaptor := &Adaptor{}
+	usage, openaiErr, _ := adaptor.DoResponse(c, resp, &relaycommon.RelayInfo{UpstreamModelName: "glm-4"})
+	if openaiErr != nil {
+		t.Fatalf("DoResponse() error = %+v", openaiErr.Error)
+	}
+	if usage == nil || usage.TotalTokens != 15 {
+		t.Errorf("usage = %+v, want 15 total tokens", usage)
+	}
+	var response dto.TextResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	choice := response.Choices[0]
+	if choice.FinishReason != channel.ToolCallsFinishReason {
+		t.Errorf("finish_reason = %q, want %q", choice.FinishReason, channel.ToolCallsFinishReason)
+	}
+	toolCalls := choice.Message.ParseToolCalls()
+	if len(toolCalls) != 1 || toolCalls[0].Id != "call_a" || toolCalls[0].Function.Name != "get_weather" || toolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("tool_calls = %+v", toolCalls)
+	}
+}
@@ -9,23 +9,38 @@ import (
 )
 
 type RelayInfo struct {
-	ChannelType       int
-	ChannelId         int
-	TokenId           int
-	UserId            int
-	Group             string
-	TokenUnlimited    bool
-	StartTime         time.Time
-	ApiType           int
-	IsStream          bool
-	RelayMode         int
-	UpstreamModelName string
-	RequestURLPath    string
-	ApiVersion        string
-	PromptTokens      int
-	ApiKey            string
-	Organization      string
-	BaseUrl           string
+	ChannelType          int
+	ChannelId            int
+	TokenId              int
+	UserId               int
+	Group                string
+	TokenUnlimited       bool
+	StartTime            time.Time
+	ApiType              int
+	IsStream             bool
+	ClientStream         bool // 客户端是否请求流式响应，按流式模式设置改变了上游的请求方式时与 IsStream 不同
+	RelayMode            int
+	RelayFormat          int
+	UpstreamModelName    string
+	RequestURLPath       string
+	ApiVersion           string
+	Region               string // 渠道所在区域，如 Vertex AI 的 location
+	PromptTokens         int
+	ApiKey               string
+	Organization         string
+	BaseUrl              string
+	ShouldIncludeUsage   bool // 客户端通过 stream_options.include_usage 要求在流式响应最后返回 usage
+	SupportStreamOptions bool // 渠道支持 stream_options 参数，可以从上游获取流式响应的 usage
+	FirstTokenTimeout    time.Duration
+	IdleTimeout          time.Duration
+	TotalTimeout         time.Duration
+	FirstResponseTime    time.Time // 流式响应第一个数据块发给客户端的时间
+}
+
+// streamSupportedChannels 支持 stream_options 参数的渠道类型
+var streamSupportedChannels = map[int]bool{
+	common.ChannelTypeOpenAI:     true,
+	common.ChannelTypeOpenRouter: true,
 }
 
 func GenRelayInfo(c *gin.Context) *RelayInfo {
@@ -41,6 +56,7 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 
 	info := &RelayInfo{
 		RelayMode:      constant.Path2RelayMode(c.Request.URL.Path),
+		RelayFormat:    constant.Path2RelayFormat(c.Request.URL.Path),
 		BaseUrl:        c.GetString("base_url"),
 		RequestURLPath: c.Request.URL.String(),
 		ChannelType:    channelType,
@@ -52,8 +68,20 @@ func GenRelayInfo(c *gin.Context) *RelayInfo {
 		StartTime:      startTime,
 		ApiType:        apiType,
 		ApiVersion:     c.GetString("api_version"),
+		Region:         c.GetString("region"),
 		ApiKey:         strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "),
 		Organization:   c.GetString("channel_organization"),
+		// 超时时间由 SetupContextForSelectedChannel 按渠道设置写入，单位秒
+		FirstTokenTimeout: time.Duration(c.GetInt("first_token_timeout")) * time.Second,
+		IdleTimeout:       time.Duration(c.GetInt("idle_timeout")) * time.Second,
+		TotalTimeout:      time.Duration(c.GetInt("total_timeout")) * time.Second,
+	}
+	if info.RelayFormat != constant.RelayFormatOpenAI {
+		// 其他格式的请求已被转换为 OpenAI 对话补全格式
+		info.RequestURLPath = "/v1/chat/completions"
+	}
+	if streamSupportedChannels[info.ChannelType] {
+		info.SupportStreamOptions = true
 	}
 	if info.BaseUrl == "" {
 		info.BaseUrl = common.ChannelBaseURLs[channelType]
@@ -0,0 +1,236 @@
+package common
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"strings"
+)
+
+// ResponseConverter 将适配器输出的 OpenAI 格式响应转换为客户端请求的格式
+type ResponseConverter interface {
+	// ConvertResponse 转换非流式响应体
+	ConvertResponse(body []byte) ([]byte, error)
+	// ConvertStreamData 转换一条流式数据（"data: " 之后的内容），返回需要写给客户端的内容
+	ConvertStreamData(data string) string
+	// FinishStream 在流结束后调用，返回需要写给客户端的结尾内容
+	FinishStream(usage *dto.Usage) string
+}
+
+// ConvertResponseWriter 包装 gin.ResponseWriter，拦截适配器写出的 OpenAI 格式响应并交给
+// ResponseConverter 转换。流式响应按行转换后立即写出，非流式响应缓存到 Finish 时一次性转换写出。
+type ConvertResponseWriter struct {
+	gin.ResponseWriter
+	converter  ResponseConverter
+	isStream   bool
+	buffer     bytes.Buffer
+	statusCode int
+	started    bool
+	finished   bool
+}
+
+func NewConvertResponseWriter(writer gin.ResponseWriter, converter ResponseConverter, isStream bool) *ConvertResponseWriter {
+	return &ConvertResponseWriter{
+		ResponseWriter: writer,
+		converter:      converter,
+		isStream:       isStream,
+	}
+}
+
+// Converter 返回使用的响应转换器
+func (w *ConvertResponseWriter) Converter() ResponseConverter {
+	return w.converter
+}
+
+func (w *ConvertResponseWriter) WriteHeader(code int) {
+	if w.isStream {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 {
+		w.statusCode = code
+	}
+}
+
+func (w *ConvertResponseWriter) WriteHeaderNow() {
+	if w.isStream {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *ConvertResponseWriter) Write(data []byte) (int, error) {
+	w.started = true
+	w.buffer.Write(data)
+	if w.isStream {
+		w.convertStreamLines(false)
+	}
+	return len(data), nil
+}
+
+func (w *ConvertResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *ConvertResponseWriter) Written() bool {
+	return w.started || w.ResponseWriter.Written()
+}
+
+// convertStreamLines 转换缓冲区中所有完整的行，atEOF 为 true 时最后不完整的行也会被处理
+func (w *ConvertResponseWriter) convertStreamLines(atEOF bool) {
+	for {
+		data := w.buffer.String()
+		i := strings.Index(data, "\n")
+		if i < 0 {
+			if !atEOF || data == "" {
+				return
+			}
+			i = len(data)
+			w.buffer.Reset()
+		} else {
+			w.buffer.Next(i + 1)
+		}
+		line := strings.TrimSuffix(data[:i], "\r")
+		if strings.HasPrefix(line, ":") {
+			// 心跳等注释原样写出
+			_, _ = w.ResponseWriter.WriteString(line + "\n\n")
+			continue
+		}
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if out := w.converter.ConvertStreamData(line); out != "" {
+			_, _ = w.ResponseWriter.WriteString(out)
+		}
+	}
+}
+
+// Finish 结束响应转换，非流式响应在此时转换并写出，流式响应写出结尾事件。
+// 如果适配器没有写出任何内容（如请求失败），则不做任何处理。
+func (w *ConvertResponseWriter) Finish(usage *dto.Usage) {
+	if !w.started || w.finished {
+		return
+	}
+	w.finished = true
+	if w.isStream {
+		w.convertStreamLines(true)
+		if out := w.converter.FinishStream(usage); out != "" {
+			_, _ = w.ResponseWriter.WriteString(out)
+		}
+		w.ResponseWriter.Flush()
+		return
+	}
+	body := w.buffer.Bytes()
+	converted, err := w.converter.ConvertResponse(body)
+	if err != nil {
+		common.SysError("error converting response: " + err.Error())
+		converted = body
+	}
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	_, _ = w.ResponseWriter.Write(converted)
+}
+
+// MaxRecordedResponseSize RecordResponseWriter 最多记录的响应体大小，超过时放弃记录
+const MaxRecordedResponseSize = 4 << 20
+
+// RecordResponseWriter 包装 gin.ResponseWriter，在正常写出响应的同时记录响应体，用于缓存非流式响应
+type RecordResponseWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func NewRecordResponseWriter(writer gin.ResponseWriter) *RecordResponseWriter {
+	return &RecordResponseWriter{
+		ResponseWriter: writer,
+	}
+}
+
+func (w *RecordResponseWriter) Write(data []byte) (int, error) {
+	if !w.overflow {
+		if w.body.Len()+len(data) > MaxRecordedResponseSize {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(data)
+		}
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *RecordResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Body 返回记录的响应体，响应体超过 MaxRecordedResponseSize 时返回 false
+func (w *RecordResponseWriter) Body() ([]byte, bool) {
+	if w.overflow {
+		return nil, false
+	}
+	return w.body.Bytes(), true
+}
+
+// BufferResponseWriter 包装 gin.ResponseWriter，将适配器写出的响应头和响应体全部缓存而不写给客户端，
+// 用于上游和客户端的流式模式不同时，先取得完整的响应再转换写出
+type BufferResponseWriter struct {
+	gin.ResponseWriter
+	header     http.Header
+	body       bytes.Buffer
+	statusCode int
+}
+
+func NewBufferResponseWriter(writer gin.ResponseWriter) *BufferResponseWriter {
+	return &BufferResponseWriter{
+		ResponseWriter: writer,
+		header:         make(http.Header),
+	}
+}
+
+func (w *BufferResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *BufferResponseWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.statusCode = code
+	}
+}
+
+func (w *BufferResponseWriter) WriteHeaderNow() {}
+
+func (w *BufferResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *BufferResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *BufferResponseWriter) Flush() {}
+
+func (w *BufferResponseWriter) Status() int {
+	if w.statusCode == 0 {
+		return http.StatusOK
+	}
+	return w.statusCode
+}
+
+func (w *BufferResponseWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *BufferResponseWriter) Written() bool {
+	return w.body.Len() > 0 || w.statusCode != 0
+}
+
+// Body 返回缓存的响应体
+func (w *BufferResponseWriter) Body() []byte {
+	return w.body.Bytes()
+}
@@ -0,0 +1,223 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/service"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stream 统一的流式响应转发：从上游读取事件，交给适配器转换为 OpenAI 格式的数据块，经过敏感词过滤后写给客户端。
+// 同时统计用量和首字时间，长时间没有数据时发送心跳注释，客户端断开时停止读取上游，
+// 上游中途超时时告知客户端，最后按需补充 usage 数据块并以 [DONE] 结束
+type Stream struct {
+	c       *gin.Context
+	info    *RelayInfo
+	decoder StreamDecoder
+
+	// 最后一个数据块的 id、created 和 model，用于补充的 usage 数据块
+	Id      string
+	Created int64
+	Model   string
+	// Usage 上游返回的用量，为空或没有 completion 用量时在结束后根据响应文本估算
+	Usage *dto.Usage
+	// UsageSent 上游的 usage 数据块已经转发给客户端，结束时不再补充
+	UsageSent bool
+	// ClientGone 客户端在上游结束之前断开了连接
+	ClientGone bool
+
+	responseText strings.Builder
+	stopped      bool
+}
+
+func NewStream(c *gin.Context, info *RelayInfo, decoder StreamDecoder) *Stream {
+	return &Stream{
+		c:       c,
+		info:    info,
+		decoder: decoder,
+	}
+}
+
+// AppendText 记录响应文本，上游没有返回用量时用于估算
+func (s *Stream) AppendText(text string) {
+	s.responseText.WriteString(text)
+}
+
+// Send 将一个数据块（"data: " 之后的内容）写给客户端。开启完成内容敏感词检查时先替换敏感词，
+// 开启 StopOnSensitiveEnabled 时命中敏感词后结束转发
+func (s *Stream) Send(data string) {
+	if s.info.FirstResponseTime.IsZero() {
+		s.info.FirstResponseTime = time.Now()
+		// 按延迟选择渠道时，流式请求按首字时间计算延迟
+		s.c.Set("first_response_time", s.info.FirstResponseTime)
+	}
+	if constant.ShouldCheckCompletionSensitive() {
+		var sensitive bool
+		sensitive, _, data = service.SensitiveWordReplace(data, false)
+		if sensitive && constant.StopOnSensitiveEnabled {
+			s.stopped = true
+		}
+	}
+	s.c.Render(-1, common.CustomEvent{Data: "data: " + data})
+	s.c.Writer.Flush()
+}
+
+// SendResponse 将转换后的数据块写给客户端，并记录其中的响应文本和 id、created、model
+func (s *Stream) SendResponse(response *dto.ChatCompletionsStreamResponse) error {
+	if response.Id != "" {
+		s.Id = response.Id
+	}
+	if response.Created != 0 {
+		s.Created = response.Created
+	}
+	if response.Model != "" {
+		s.Model = response.Model
+	}
+	for _, choice := range response.Choices {
+		s.AppendText(choice.Delta.Content)
+		for _, toolCall := range dto.ParseToolCalls(choice.Delta.ToolCalls) {
+			s.AppendText(toolCall.Function.Arguments)
+		}
+	}
+	if response.Usage != nil {
+		s.UsageSent = true
+	}
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	s.Send(string(jsonResponse))
+	return nil
+}
+
+// Run 转发上游的流式响应直到结束，transform 处理每个上游事件，返回错误时记录日志并跳过该事件。
+// 返回本次响应的用量，上游没有返回时根据响应文本估算
+func (s *Stream) Run(transform func(event StreamEvent) error) *dto.Usage {
+	service.SetEventStreamHeaders(s.c)
+	events := make(chan StreamEvent)
+	errChan := make(chan error, 1)
+	stopChan := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			event, err := s.decoder.Decode()
+			if err != nil {
+				errChan <- err
+				return
+			}
+			select {
+			case events <- event:
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+
+	// 每收到一个上游事件重新计时，超过心跳间隔没有事件时发送心跳注释
+	var keepAlive <-chan time.Time
+	resetKeepAlive := func() {}
+	keepAliveInterval := time.Duration(common.StreamKeepAliveInterval) * time.Second
+	if keepAliveInterval > 0 {
+		timer := time.NewTimer(keepAliveInterval)
+		defer timer.Stop()
+		keepAlive = timer.C
+		resetKeepAlive = func() {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(keepAliveInterval)
+		}
+	}
+	var readErr error
+loop:
+	for !s.stopped {
+		select {
+		case event := <-events:
+			if event.Data == "[DONE]" {
+				break loop
+			}
+			if err := transform(event); err != nil {
+				common.LogError(s.c, "error processing stream response: "+err.Error())
+			}
+			resetKeepAlive()
+		case readErr = <-errChan:
+			break loop
+		case <-keepAlive:
+			_, _ = s.c.Writer.WriteString(": keepalive\n\n")
+			s.c.Writer.Flush()
+			resetKeepAlive()
+		case <-s.c.Request.Context().Done():
+			break loop
+		}
+	}
+	close(stopChan)
+	_ = s.decoder.Close()
+	wg.Wait()
+
+	// 上游请求的上下文来自客户端请求，客户端断开时读取上游也会出错，以客户端请求的状态为准
+	if s.c.Request.Context().Err() != nil {
+		s.ClientGone = true
+	} else if readErr != nil && readErr != io.EOF {
+		common.LogError(s.c, "error reading stream response: "+readErr.Error())
+	}
+	s.completeUsage()
+	if s.ClientGone {
+		return s.Usage
+	}
+	if s.info.ShouldIncludeUsage && !s.UsageSent {
+		s.sendUsage()
+	}
+	if errors.Is(readErr, ErrFirstTokenTimeout) || errors.Is(readErr, ErrIdleTimeout) {
+		// 上游中途超时，告知客户端后正常结束流
+		s.c.Render(-1, common.CustomEvent{Data: streamTimeoutEvent(readErr)})
+	}
+	s.c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
+	s.c.Writer.Flush()
+	return s.Usage
+}
+
+// completeUsage 上游没有返回 completion 用量时根据响应文本估算，上游返回了 prompt 用量时以上游为准
+func (s *Stream) completeUsage() {
+	if s.Usage != nil && s.Usage.CompletionTokens > 0 {
+		return
+	}
+	promptTokens := s.info.PromptTokens
+	if s.Usage != nil && s.Usage.PromptTokens > 0 {
+		promptTokens = s.Usage.PromptTokens
+	}
+	s.Usage, _ = service.ResponseText2Usage(s.responseText.String(), s.info.UpstreamModelName, promptTokens)
+}
+
+// sendUsage 补充 choices 为空的 usage 数据块
+func (s *Stream) sendUsage() {
+	if s.Id == "" {
+		s.Id = fmt.Sprintf("chatcmpl-%s", common.GetUUID())
+	}
+	if s.Created == 0 {
+		s.Created = common.GetTimestamp()
+	}
+	if s.Model == "" {
+		s.Model = s.info.UpstreamModelName
+	}
+	response := service.GenerateFinalUsageResponse(s.Id, s.Created, s.Model, *s.Usage)
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		common.LogError(s.c, "error marshalling stream response: "+err.Error())
+		return
+	}
+	s.c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonResponse)})
+}
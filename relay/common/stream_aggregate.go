@@ -0,0 +1,150 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"one-api/common"
+	"one-api/dto"
+	"sort"
+	"strings"
+)
+
+// aggregateChoice 按 index 聚合的一个 choice
+type aggregateChoice struct {
+	role         string
+	content      strings.Builder
+	toolCalls    []dto.ToolCall
+	finishReason string
+}
+
+// AggregateStreamResponse 将 OpenAI 格式的聊天补全流式响应（SSE）聚合为一个 chat.completion 响应。
+// 按 index 合并各个 choice 的内容和 tool_calls，usage 为空时使用数据块中的 usage
+func AggregateStreamResponse(body []byte, usage *dto.Usage, modelName string) ([]byte, error) {
+	var id, model string
+	var created int64
+	choices := make(map[int]*aggregateChoice)
+	decoder := NewSSEDecoder(io.NopCloser(bytes.NewReader(body)))
+	for {
+		event, err := decoder.Decode()
+		if err != nil {
+			break
+		}
+		if event.Data == "[DONE]" {
+			break
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := json.Unmarshal(common.StringToByteSlice(event.Data), &chunk); err != nil {
+			continue
+		}
+		if chunk.Id != "" {
+			id = chunk.Id
+		}
+		if chunk.Created != 0 {
+			created = chunk.Created
+		}
+		if chunk.Model != "" {
+			model = chunk.Model
+		}
+		if chunk.Usage != nil && usage == nil {
+			usage = chunk.Usage
+		}
+		for _, streamChoice := range chunk.Choices {
+			choice, ok := choices[streamChoice.Index]
+			if !ok {
+				choice = &aggregateChoice{}
+				choices[streamChoice.Index] = choice
+			}
+			if streamChoice.Delta.Role != "" {
+				choice.role = streamChoice.Delta.Role
+			}
+			choice.content.WriteString(streamChoice.Delta.Content)
+			for i, toolCall := range dto.ParseToolCalls(streamChoice.Delta.ToolCalls) {
+				choice.appendToolCall(i, toolCall)
+			}
+			if streamChoice.FinishReason != nil && *streamChoice.FinishReason != "" {
+				choice.finishReason = *streamChoice.FinishReason
+			}
+		}
+	}
+	if len(choices) == 0 {
+		return nil, errors.New("no choices in stream response")
+	}
+
+	if id == "" {
+		id = fmt.Sprintf("chatcmpl-%s", common.GetUUID())
+	}
+	if created == 0 {
+		created = common.GetTimestamp()
+	}
+	if model == "" {
+		model = modelName
+	}
+	response := struct {
+		dto.OpenAITextResponse
+		Model string `json:"model"`
+	}{
+		OpenAITextResponse: dto.OpenAITextResponse{
+			Id:      id,
+			Object:  "chat.completion",
+			Created: created,
+			Choices: make([]dto.OpenAITextResponseChoice, 0, len(choices)),
+		},
+		Model: model,
+	}
+	if usage != nil {
+		response.Usage = *usage
+	}
+	indexes := make([]int, 0, len(choices))
+	for index := range choices {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		choice := choices[index]
+		role := choice.role
+		if role == "" {
+			role = "assistant"
+		}
+		content, _ := json.Marshal(choice.content.String())
+		message := dto.Message{
+			Role:    role,
+			Content: content,
+		}
+		if len(choice.toolCalls) > 0 {
+			message.ToolCalls = choice.toolCalls
+		}
+		response.Choices = append(response.Choices, dto.OpenAITextResponseChoice{
+			Index:        index,
+			Message:      message,
+			FinishReason: choice.finishReason,
+		})
+	}
+	return json.Marshal(response)
+}
+
+// appendToolCall 合并一个流式的 tool call：同一 index 的 tool call 拼接 arguments，
+// 数据块没有 index 时以在 tool_calls 中的位置作为 index
+func (choice *aggregateChoice) appendToolCall(position int, toolCall dto.ToolCall) {
+	index := position
+	if toolCall.Index != nil {
+		index = *toolCall.Index
+	}
+	toolCall.Index = nil
+	for index >= len(choice.toolCalls) {
+		choice.toolCalls = append(choice.toolCalls, dto.ToolCall{Type: "function"})
+	}
+	merged := &choice.toolCalls[index]
+	if toolCall.Id != "" {
+		merged.Id = toolCall.Id
+	}
+	if toolCall.Type != "" {
+		merged.Type = toolCall.Type
+	}
+	if toolCall.Function.Name != "" {
+		merged.Function.Name = toolCall.Function.Name
+	}
+	merged.Function.Arguments += toolCall.Function.Arguments
+}
@@ -0,0 +1,121 @@
+package common
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// StreamEvent 上游流式响应中的一个事件
+type StreamEvent struct {
+	Event string // SSE 的 event 字段，没有时为空
+	Data  string
+}
+
+// StreamDecoder 从上游响应中依次读取事件
+type StreamDecoder interface {
+	// Decode 返回下一个事件，上游正常结束时返回 io.EOF
+	Decode() (StreamEvent, error)
+	// Close 关闭上游响应，阻塞中的 Decode 随之返回
+	Close() error
+}
+
+// sseDecoder 解析 SSE 格式的响应。每个 data 行作为一个事件，兼容数据块之间没有空行的上游；
+// 不带 data: 前缀的 [DONE] 同样视为结束标记
+type sseDecoder struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	event  string
+}
+
+func NewSSEDecoder(body io.ReadCloser) StreamDecoder {
+	return &sseDecoder{
+		body:   body,
+		reader: bufio.NewReader(body),
+	}
+}
+
+func (d *sseDecoder) Decode() (StreamEvent, error) {
+	for {
+		line, err := d.reader.ReadString('\n')
+		if line == "" && err != nil {
+			return StreamEvent{}, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			d.event = ""
+			continue
+		}
+		if line == "[DONE]" {
+			return StreamEvent{Data: line}, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			d.event = value
+		case "data":
+			return StreamEvent{Event: d.event, Data: value}, nil
+		}
+	}
+}
+
+func (d *sseDecoder) Close() error {
+	return d.body.Close()
+}
+
+// lineDecoder 每一行作为一个事件，包括空行，用于 NDJSON 等按行分隔的响应
+type lineDecoder struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+}
+
+func NewLineDecoder(body io.ReadCloser) StreamDecoder {
+	return &lineDecoder{
+		body:   body,
+		reader: bufio.NewReader(body),
+	}
+}
+
+func (d *lineDecoder) Decode() (StreamEvent, error) {
+	line, err := d.reader.ReadString('\n')
+	if line == "" && err != nil {
+		return StreamEvent{}, err
+	}
+	return StreamEvent{Data: strings.TrimRight(line, "\r\n")}, nil
+}
+
+func (d *lineDecoder) Close() error {
+	return d.body.Close()
+}
+
+// bodyDecoder 将整个响应体作为一个事件，用于不支持流式输出的上游
+type bodyDecoder struct {
+	body io.ReadCloser
+	read bool
+}
+
+func NewBodyDecoder(body io.ReadCloser) StreamDecoder {
+	return &bodyDecoder{
+		body: body,
+	}
+}
+
+func (d *bodyDecoder) Decode() (StreamEvent, error) {
+	if d.read {
+		return StreamEvent{}, io.EOF
+	}
+	d.read = true
+	data, err := io.ReadAll(d.body)
+	if err != nil {
+		return StreamEvent{}, err
+	}
+	return StreamEvent{Data: string(data)}, nil
+}
+
+func (d *bodyDecoder) Close() error {
+	return d.body.Close()
+}
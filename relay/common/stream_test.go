@@ -0,0 +1,191 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const streamTestChunk = `{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"delta":{"content":"Hi"}}]}`
+
+// streamTestUpstream 模拟上游响应：依次写入 chunks，每次写入前等待 delay，stall 为真时写完后不再结束
+type streamTestUpstream struct {
+	chunks []string
+	delay  time.Duration
+	stall  bool
+}
+
+func (u streamTestUpstream) body() (*io.PipeReader, *io.PipeWriter) {
+	reader, writer := io.Pipe()
+	go func() {
+		for _, chunk := range u.chunks {
+			time.Sleep(u.delay)
+			if _, err := writer.Write([]byte(chunk)); err != nil {
+				return
+			}
+		}
+		if !u.stall {
+			_ = writer.Close()
+		}
+	}()
+	return reader, writer
+}
+
+// streamTestEvents 返回写给客户端的事件，心跳注释也作为一个事件
+func streamTestEvents(body string) []string {
+	var events []string
+	for _, event := range strings.Split(body, "\n\n") {
+		if event = strings.TrimSpace(event); event != "" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func TestStreamRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// 关闭敏感词检查时不需要加载分词器
+	checkSensitive, stopOnSensitive := constant.CheckSensitiveOnCompletionEnabled, constant.StopOnSensitiveEnabled
+	constant.CheckSensitiveOnCompletionEnabled, constant.StopOnSensitiveEnabled = false, false
+	keepAliveInterval := common.StreamKeepAliveInterval
+	defer func() {
+		constant.CheckSensitiveOnCompletionEnabled, constant.StopOnSensitiveEnabled = checkSensitive, stopOnSensitive
+		common.StreamKeepAliveInterval = keepAliveInterval
+	}()
+	usageChunk := `{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`
+	timeoutEvent := streamTimeoutEvent(ErrIdleTimeout)
+
+	tests := []struct {
+		name     string
+		upstream streamTestUpstream
+		// keepAlive 心跳间隔，单位为秒，0 表示不发送心跳
+		keepAlive    int
+		includeUsage bool
+		// firstToken、idle 不为 0 时按流式超时读取上游
+		firstToken time.Duration
+		idle       time.Duration
+		// cancelAfter 转发这么多个数据块后客户端断开
+		cancelAfter    int
+		want           []string
+		wantClientGone bool
+	}{
+		{
+			name:     "done",
+			upstream: streamTestUpstream{chunks: []string{"data: " + streamTestChunk + "\n\n", "data: " + usageChunk + "\n\n", "data: [DONE]\n\n"}},
+			want:     []string{"data: " + streamTestChunk, "data: " + usageChunk, "data: [DONE]"},
+		},
+		{
+			name:     "eof without done",
+			upstream: streamTestUpstream{chunks: []string{"data: " + streamTestChunk + "\n\n", "data: " + usageChunk + "\n\n"}},
+			want:     []string{"data: " + streamTestChunk, "data: " + usageChunk, "data: [DONE]"},
+		},
+		{
+			name:     "events after done are ignored",
+			upstream: streamTestUpstream{chunks: []string{"data: " + usageChunk + "\n\n", "data: [DONE]\n\n", "data: " + streamTestChunk + "\n\n"}},
+			want:     []string{"data: " + usageChunk, "data: [DONE]"},
+		},
+		{
+			name:      "keepalive",
+			upstream:  streamTestUpstream{chunks: []string{"data: " + usageChunk + "\n\n", "data: [DONE]\n\n"}, delay: 1200 * time.Millisecond},
+			keepAlive: 1,
+			want:      []string{": keepalive", "data: " + usageChunk, ": keepalive", "data: [DONE]"},
+		},
+		{
+			name:         "usage injected",
+			upstream:     streamTestUpstream{chunks: []string{"data: " + streamTestChunk + "\n\n", "data: [DONE]\n\n"}},
+			includeUsage: true,
+			want: []string{
+				"data: " + streamTestChunk,
+				"data: " + usageChunk,
+				"data: [DONE]",
+			},
+		},
+		{
+			name:         "upstream usage not injected twice",
+			upstream:     streamTestUpstream{chunks: []string{"data: " + streamTestChunk + "\n\n", "data: " + usageChunk + "\n\n", "data: [DONE]\n\n"}},
+			includeUsage: true,
+			want:         []string{"data: " + streamTestChunk, "data: " + usageChunk, "data: [DONE]"},
+		},
+		{
+			name:       "first token timeout",
+			upstream:   streamTestUpstream{stall: true},
+			firstToken: 50 * time.Millisecond,
+			want:       []string{streamTimeoutEvent(ErrFirstTokenTimeout), "data: [DONE]"},
+		},
+		{
+			name:       "idle timeout",
+			upstream:   streamTestUpstream{chunks: []string{"data: " + streamTestChunk + "\n\n"}, stall: true},
+			firstToken: time.Second,
+			idle:       50 * time.Millisecond,
+			want:       []string{"data: " + streamTestChunk, timeoutEvent, "data: [DONE]"},
+		},
+		{
+			name:           "client gone",
+			upstream:       streamTestUpstream{chunks: []string{"data: " + streamTestChunk + "\n\n"}, stall: true},
+			cancelAfter:    1,
+			want:           []string{"data: " + streamTestChunk},
+			wantClientGone: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			common.StreamKeepAliveInterval = test.keepAlive
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			ctx, cancelClient := context.WithCancel(context.Background())
+			defer cancelClient()
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil).WithContext(ctx)
+
+			reader, writer := test.upstream.body()
+			var body io.ReadCloser = reader
+			if test.firstToken > 0 {
+				// 取消上游请求时中断读取，与真实请求中取消上下文后读取响应体出错一致
+				_, timeout := NewStreamTimeout(context.Background(), func() {
+					_ = writer.CloseWithError(errors.New("context canceled"))
+				}, test.firstToken, test.idle)
+				body = timeout.Body(reader)
+			}
+			info := &RelayInfo{UpstreamModelName: "gpt-4o", PromptTokens: 3, ShouldIncludeUsage: test.includeUsage}
+			stream := NewStream(c, info, NewSSEDecoder(body))
+			// 模拟在其他事件中返回用量但不转发的上游，结束时不需要根据响应文本估算
+			stream.Usage = &dto.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}
+			sent := 0
+			usage := stream.Run(func(event StreamEvent) error {
+				var response dto.ChatCompletionsStreamResponse
+				if err := json.Unmarshal([]byte(event.Data), &response); err != nil {
+					return err
+				}
+				if err := stream.SendResponse(&response); err != nil {
+					return err
+				}
+				sent++
+				if sent == test.cancelAfter {
+					cancelClient()
+				}
+				return nil
+			})
+
+			if stream.ClientGone != test.wantClientGone {
+				t.Errorf("ClientGone = %v, want %v", stream.ClientGone, test.wantClientGone)
+			}
+			if usage == nil || usage.TotalTokens != 5 {
+				t.Errorf("usage = %+v, want 5 total tokens", usage)
+			}
+			got := streamTestEvents(recorder.Body.String())
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("events = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
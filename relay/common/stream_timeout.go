@@ -0,0 +1,154 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"one-api/dto"
+	"sync"
+	"time"
+)
+
+var (
+	ErrFirstTokenTimeout = errors.New("upstream first token timeout")
+	ErrIdleTimeout       = errors.New("upstream idle timeout")
+)
+
+type streamTimeoutKey struct{}
+
+// StreamTimeout 流式请求的超时控制：发出请求后 firstToken 时间内没有收到第一个数据，
+// 或者收到数据后 idle 时间内没有新的数据时取消上游请求
+type StreamTimeout struct {
+	cancel     context.CancelFunc
+	idle       time.Duration
+	firstTimer *time.Timer
+	idleTimer  *time.Timer
+	lock       sync.Mutex
+	err        error
+	stopped    bool
+}
+
+// NewStreamTimeout 创建超时控制并开始计时，返回的上下文用于发出上游请求
+func NewStreamTimeout(ctx context.Context, cancel context.CancelFunc, firstToken time.Duration, idle time.Duration) (context.Context, *StreamTimeout) {
+	t := &StreamTimeout{
+		cancel: cancel,
+		idle:   idle,
+	}
+	if firstToken > 0 {
+		t.firstTimer = time.AfterFunc(firstToken, func() {
+			t.fire(ErrFirstTokenTimeout)
+		})
+	}
+	return context.WithValue(ctx, streamTimeoutKey{}, t), t
+}
+
+func (t *StreamTimeout) fire(err error) {
+	t.lock.Lock()
+	if t.stopped || t.err != nil {
+		t.lock.Unlock()
+		return
+	}
+	t.err = err
+	t.lock.Unlock()
+	t.cancel()
+}
+
+// received 收到上游数据后调用，之后按空闲超时计时
+func (t *StreamTimeout) received() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.stopped || t.err != nil {
+		return
+	}
+	if t.firstTimer != nil {
+		t.firstTimer.Stop()
+		t.firstTimer = nil
+	}
+	if t.idle <= 0 {
+		return
+	}
+	if t.idleTimer == nil {
+		t.idleTimer = time.AfterFunc(t.idle, func() {
+			t.fire(ErrIdleTimeout)
+		})
+	} else {
+		t.idleTimer.Reset(t.idle)
+	}
+}
+
+// Stop 停止计时，响应读取完毕后调用
+func (t *StreamTimeout) Stop() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.stopped = true
+	if t.firstTimer != nil {
+		t.firstTimer.Stop()
+	}
+	if t.idleTimer != nil {
+		t.idleTimer.Stop()
+	}
+}
+
+// Err 返回触发的超时错误，没有超时时返回 nil
+func (t *StreamTimeout) Err() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.err
+}
+
+// Body 包装响应体，读到数据时重新计时，超时后读取返回对应的超时错误
+func (t *StreamTimeout) Body(body io.ReadCloser) io.ReadCloser {
+	return &streamTimeoutBody{
+		ReadCloser: body,
+		timeout:    t,
+	}
+}
+
+type streamTimeoutBody struct {
+	io.ReadCloser
+	timeout *StreamTimeout
+}
+
+func (b *streamTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timeout.received()
+	}
+	if err != nil && err != io.EOF {
+		if timeoutErr := b.timeout.Err(); timeoutErr != nil {
+			err = timeoutErr
+		}
+	}
+	return n, err
+}
+
+func (b *streamTimeoutBody) Close() error {
+	b.timeout.Stop()
+	return b.ReadCloser.Close()
+}
+
+// GetStreamTimeoutError 返回上游响应触发的流式超时错误，没有超时时返回 nil
+func GetStreamTimeoutError(resp *http.Response) error {
+	if resp == nil || resp.Request == nil {
+		return nil
+	}
+	t, ok := resp.Request.Context().Value(streamTimeoutKey{}).(*StreamTimeout)
+	if !ok {
+		return nil
+	}
+	return t.Err()
+}
+
+// streamTimeoutEvent 上游流式响应中途超时时，返回需要在 [DONE] 之前发给客户端的错误事件
+func streamTimeoutEvent(err error) string {
+	jsonResponse, _ := json.Marshal(map[string]dto.OpenAIError{
+		"error": {
+			Message: err.Error(),
+			Type:    "upstream_error",
+			Code:    "stream_timeout",
+		},
+	})
+	return "data: " + string(jsonResponse)
+}
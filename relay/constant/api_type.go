@@ -18,6 +18,9 @@ const (
 	APITypeZhipu_v4
 	APITypeOllama
 	APITypePerplexity
+	APITypeAws
+	APITypeVertexAi
+	APITypeCohere
 
 	APITypeDummy // this one is only for count, do not add any channel after this
 )
@@ -49,6 +52,12 @@ func ChannelType2APIType(channelType int) int {
 		apiType = APITypeOllama
 	case common.ChannelTypePerplexity:
 		apiType = APITypePerplexity
+	case common.ChannelTypeAwsBedrock:
+		apiType = APITypeAws
+	case common.ChannelTypeVertexAi:
+		apiType = APITypeVertexAi
+	case common.ChannelTypeCohere:
+		apiType = APITypeCohere
 	}
 	return apiType
 }
@@ -26,12 +26,52 @@ const (
 	RelayModeMidjourneyModal
 	RelayModeMidjourneyShorten
 	RelayModeSwapFace
+	RelayModeRerank
+	RelayModeImagesEdits
+	RelayModeImagesVariations
 )
 
+// RelayFormat 表示客户端请求与响应所使用的协议格式，非 OpenAI 格式的请求会被转换为
+// OpenAI 格式交给各渠道适配器处理，响应再转换回对应格式
+const (
+	RelayFormatOpenAI = iota
+	RelayFormatClaude
+	RelayFormatGemini
+	RelayFormatResponses
+)
+
+func Path2RelayFormat(path string) int {
+	relayFormat := RelayFormatOpenAI
+	if strings.HasPrefix(path, "/v1/messages") {
+		relayFormat = RelayFormatClaude
+	} else if strings.HasPrefix(path, "/v1beta/models/") {
+		relayFormat = RelayFormatGemini
+	} else if strings.HasPrefix(path, "/v1/responses") {
+		relayFormat = RelayFormatResponses
+	}
+	return relayFormat
+}
+
+// GetGeminiModelAndAction 从 /v1beta/models/{model}:{action} 格式的路径中解析模型名称和动作
+func GetGeminiModelAndAction(path string) (string, string) {
+	path = strings.TrimPrefix(path, "/v1beta/models/")
+	modelName, action, _ := strings.Cut(path, ":")
+	return modelName, action
+}
+
 func Path2RelayMode(path string) int {
 	relayMode := RelayModeUnknown
 	if strings.HasPrefix(path, "/v1/chat/completions") {
 		relayMode = RelayModeChatCompletions
+	} else if strings.HasPrefix(path, "/v1/messages") {
+		// Claude Messages 格式的请求，按对话补全处理
+		relayMode = RelayModeChatCompletions
+	} else if strings.HasPrefix(path, "/v1beta/models/") {
+		// Gemini generateContent 格式的请求，按对话补全处理
+		relayMode = RelayModeChatCompletions
+	} else if strings.HasPrefix(path, "/v1/responses") {
+		// Responses API 格式的请求，按对话补全处理
+		relayMode = RelayModeChatCompletions
 	} else if strings.HasPrefix(path, "/v1/completions") {
 		relayMode = RelayModeCompletions
 	} else if strings.HasPrefix(path, "/v1/embeddings") {
@@ -42,6 +82,10 @@ func Path2RelayMode(path string) int {
 		relayMode = RelayModeModerations
 	} else if strings.HasPrefix(path, "/v1/images/generations") {
 		relayMode = RelayModeImagesGenerations
+	} else if strings.HasPrefix(path, "/v1/images/edits") {
+		relayMode = RelayModeImagesEdits
+	} else if strings.HasPrefix(path, "/v1/images/variations") {
+		relayMode = RelayModeImagesVariations
 	} else if strings.HasPrefix(path, "/v1/edits") {
 		relayMode = RelayModeEdits
 	} else if strings.HasPrefix(path, "/v1/audio/speech") {
@@ -50,6 +94,8 @@ func Path2RelayMode(path string) int {
 		relayMode = RelayModeAudioTranscription
 	} else if strings.HasPrefix(path, "/v1/audio/translations") {
 		relayMode = RelayModeAudioTranslation
+	} else if strings.HasPrefix(path, "/v1/rerank") {
+		relayMode = RelayModeRerank
 	}
 	return relayMode
 }
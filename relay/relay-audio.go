@@ -8,11 +8,14 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
+	"math"
+	"mime/multipart"
 	"net/http"
 	"one-api/common"
 	"one-api/constant"
 	"one-api/dto"
 	"one-api/model"
+	"one-api/relay/channel"
 	relaycommon "one-api/relay/common"
 	relayconstant "one-api/relay/constant"
 	"one-api/service"
@@ -38,29 +41,39 @@ func AudioHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 	startTime := time.Now()
 
 	var audioRequest dto.TextToSpeechRequest
-	if !strings.HasPrefix(c.Request.URL.Path, "/v1/audio/transcriptions") {
+	var audioForm *multipart.Form
+	if relayMode == relayconstant.RelayModeAudioSpeech {
 		err := common.UnmarshalBodyReusable(c, &audioRequest)
 		if err != nil {
-			return service.OpenAIErrorWrapper(err, "bind_request_body_failed", http.StatusBadRequest)
+			return service.OpenAIErrorWrapperLocal(err, "bind_request_body_failed", http.StatusBadRequest)
 		}
 	} else {
-		audioRequest = dto.TextToSpeechRequest{
-			Model: "whisper-1",
+		// 转录和翻译请求为 multipart 格式，在分发时已经解析为表单
+		form, err := common.ParseMultipartFormReusable(c)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "bind_request_body_failed", http.StatusBadRequest)
+		}
+		if len(form.File["file"]) == 0 {
+			return service.OpenAIErrorWrapperLocal(errors.New("file is required"), "required_field_missing", http.StatusBadRequest)
+		}
+		audioForm = form
+		audioRequest.Model = c.Request.FormValue("model")
+		if audioRequest.Model == "" {
+			audioRequest.Model = "whisper-1"
 		}
 	}
-	//err := common.UnmarshalBodyReusable(c, &audioRequest)
 
 	// request validation
 	if audioRequest.Model == "" {
-		return service.OpenAIErrorWrapper(errors.New("model is required"), "required_field_missing", http.StatusBadRequest)
+		return service.OpenAIErrorWrapperLocal(errors.New("model is required"), "required_field_missing", http.StatusBadRequest)
 	}
 
 	if strings.HasPrefix(audioRequest.Model, "tts-1") {
 		if audioRequest.Voice == "" {
-			return service.OpenAIErrorWrapper(errors.New("voice is required"), "required_field_missing", http.StatusBadRequest)
+			return service.OpenAIErrorWrapperLocal(errors.New("voice is required"), "required_field_missing", http.StatusBadRequest)
 		}
 		if !common.StringsContains(availableVoices, audioRequest.Voice) {
-			return service.OpenAIErrorWrapper(errors.New("voice must be one of "+strings.Join(availableVoices, ", ")), "invalid_field_value", http.StatusBadRequest)
+			return service.OpenAIErrorWrapperLocal(errors.New("voice must be one of "+strings.Join(availableVoices, ", ")), "invalid_field_value", http.StatusBadRequest)
 		}
 	}
 	var err error
@@ -69,7 +82,7 @@ func AudioHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 	if strings.HasPrefix(audioRequest.Model, "tts-1") {
 		promptTokens, err, _ = service.CountAudioToken(audioRequest.Input, audioRequest.Model, constant.ShouldCheckPromptSensitive())
 		if err != nil {
-			return service.OpenAIErrorWrapper(err, "count_audio_token_failed", http.StatusInternalServerError)
+			return service.OpenAIErrorWrapperLocal(err, "count_audio_token_failed", http.StatusInternalServerError)
 		}
 		preConsumedTokens = promptTokens
 	}
@@ -77,28 +90,31 @@ func AudioHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 	groupRatio := common.GetGroupRatio(group)
 	ratio := modelRatio * groupRatio
 	preConsumedQuota := int(float64(preConsumedTokens) * ratio)
-	userQuota, err := model.CacheGetUserQuota(userId)
-	if err != nil {
-		return service.OpenAIErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
-	}
-	if userQuota-preConsumedQuota < 0 {
-		return service.OpenAIErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
-	}
-	err = model.CacheDecreaseUserQuota(userId, preConsumedQuota)
-	if err != nil {
-		return service.OpenAIErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
-	}
-	if userQuota > 100*preConsumedQuota {
-		// in this case, we do not pre-consume quota
-		// because the user has enough quota
-		preConsumedQuota = 0
-	}
-	if preConsumedQuota > 0 {
-		userQuota, err = model.PreConsumeTokenQuota(tokenId, preConsumedQuota)
+
+	// 配置了音频价格的模型按音频时长计费，无法读取时长时按识别结果的 token 数计费
+	audioPrice := -1.0
+	audioDuration := 0.0
+	if audioForm != nil {
+		audioPrice = common.GetModelAudioPrice(audioRequest.Model)
+		audioDuration, err = getAudioFileDuration(audioForm.File["file"][0])
 		if err != nil {
-			return service.OpenAIErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+			common.LogWarn(c, fmt.Sprintf("get audio duration failed: %s", err.Error()))
 		}
 	}
+	durationQuota := -1
+	if audioPrice != -1 && audioDuration > 0 {
+		// 计费时长按秒向上取整
+		durationQuota = int(audioPrice * math.Ceil(audioDuration) * common.QuotaPerUnit * groupRatio)
+		if audioPrice != 0 && groupRatio != 0 && durationQuota <= 0 {
+			durationQuota = 1
+		}
+		preConsumedQuota = durationQuota
+	}
+	// 与文本请求共用预扣逻辑，渠道重试时不会重复预扣
+	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, preConsumedQuota, relaycommon.GenRelayInfo(c))
+	if openaiErr != nil {
+		return openaiErr
+	}
 
 	// map model name
 	modelMapping := c.GetString("model_mapping")
@@ -127,8 +143,13 @@ func AudioHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 	}
 
 	requestBody := c.Request.Body
+	contentType := c.Request.Header.Get("Content-Type")
+	if audioForm != nil {
+		// 重新生成请求体以替换为映射后的模型，音频文件以流的方式转发
+		requestBody, contentType = channel.NewMultipartBody(channel.MultipartFormFields(audioForm, audioRequest.Model))
+	}
 
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
 		return service.OpenAIErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
 	}
@@ -138,12 +159,11 @@ func AudioHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 		apiKey := c.Request.Header.Get("Authorization")
 		apiKey = strings.TrimPrefix(apiKey, "Bearer ")
 		req.Header.Set("api-key", apiKey)
-		req.ContentLength = c.Request.ContentLength
 	} else {
 		req.Header.Set("Authorization", c.Request.Header.Get("Authorization"))
 	}
 
-	req.Header.Set("Content-Type", c.Request.Header.Get("Content-Type"))
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
 
 	resp, err := service.GetHttpClient().Do(req)
@@ -166,18 +186,32 @@ func AudioHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 
 	var audioResponse dto.AudioResponse
 
+	// 额度将在下面结算，不再需要归还预扣额度
+	c.Set("quota_pre_consumed", false)
 	defer func(ctx context.Context) {
 		go func() {
 			useTimeSeconds := time.Now().Unix() - startTime.Unix()
 			quota := 0
-			if strings.HasPrefix(audioRequest.Model, "tts-1") {
-				quota = promptTokens
+			logContent := fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f", modelRatio, groupRatio)
+			if durationQuota != -1 {
+				quota = durationQuota
+				logContent = fmt.Sprintf("模型价格 %.6f / 秒，音频时长 %.2f 秒，分组倍率 %.2f", audioPrice, audioDuration, groupRatio)
+				// 时长读取自客户端上传的文件头，识别结果的 token 数对应的额度更高时按 token 计费
+				textTokens, _, _ := service.CountAudioToken(audioResponse.Text, audioRequest.Model, false)
+				if textQuota := int(float64(textTokens) * ratio); textQuota > quota {
+					quota = textQuota
+					logContent = fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f，音频时长 %.2f 秒，按识别结果 %d tokens 计费", modelRatio, groupRatio, audioDuration, textTokens)
+				}
 			} else {
-				quota, err, _ = service.CountAudioToken(audioResponse.Text, audioRequest.Model, constant.ShouldCheckCompletionSensitive())
-			}
-			quota = int(float64(quota) * ratio)
-			if ratio != 0 && quota <= 0 {
-				quota = 1
+				if strings.HasPrefix(audioRequest.Model, "tts-1") {
+					quota = promptTokens
+				} else {
+					quota, err, _ = service.CountAudioToken(audioResponse.Text, audioRequest.Model, constant.ShouldCheckCompletionSensitive())
+				}
+				quota = int(float64(quota) * ratio)
+				if ratio != 0 && quota <= 0 {
+					quota = 1
+				}
 			}
 			quotaDelta := quota - preConsumedQuota
 			err := model.PostConsumeTokenQuota(tokenId, userQuota, quotaDelta, preConsumedQuota, true)
@@ -190,8 +224,7 @@ func AudioHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 			}
 			if quota != 0 {
 				tokenName := c.GetString("token_name")
-				logContent := fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f", modelRatio, groupRatio)
-				model.RecordConsumeLog(ctx, userId, channelId, promptTokens, 0, audioRequest.Model, tokenName, quota, logContent, tokenId, userQuota, int(useTimeSeconds), false)
+				model.RecordConsumeLog(ctx, userId, channelId, promptTokens, 0, audioRequest.Model, tokenName, quota, logContent, tokenId, userQuota, int(useTimeSeconds), false, model.ConsumeLogExtra{AudioDuration: audioDuration})
 				model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
 				channelId := c.GetInt("channel_id")
 				model.UpdateChannelUsedQuota(channelId, quota)
@@ -213,7 +246,8 @@ func AudioHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 	} else {
 		err = json.Unmarshal(responseBody, &audioResponse)
 		if err != nil {
-			return service.OpenAIErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+			// response_format 为 text、srt 或 vtt 时响应体为纯文本
+			audioResponse.Text = string(responseBody)
 		}
 		contains, words := service.SensitiveWordContains(audioResponse.Text)
 		if contains {
@@ -238,3 +272,13 @@ func AudioHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
 	}
 	return nil
 }
+
+// getAudioFileDuration 读取上传的音频文件的时长（秒）
+func getAudioFileDuration(fileHeader *multipart.FileHeader) (float64, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return common.GetAudioDuration(file)
+}
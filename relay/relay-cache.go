@@ -0,0 +1,94 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getResponseCacheKey 返回本次请求的响应缓存键和有效期，不使用缓存时返回空字符串。
+// 只缓存 embeddings 请求和结果确定的聊天补全请求（见 isDeterministicChatRequest）；令牌启用缓存时优先使用令牌设置的有效期，
+// 其次是模型配置的有效期和默认有效期，令牌未启用时只有在 ModelCacheTTL 中配置的模型会被缓存
+func getResponseCacheKey(c *gin.Context, relayInfo *relaycommon.RelayInfo, modelName string) (string, time.Duration) {
+	if relayInfo.RelayMode != relayconstant.RelayModeChatCompletions && relayInfo.RelayMode != relayconstant.RelayModeEmbeddings {
+		return "", 0
+	}
+	ttl := common.GetModelCacheTTL(modelName)
+	if c.GetBool("token_cache_enabled") {
+		if tokenTTL := c.GetInt("token_cache_ttl"); tokenTTL > 0 {
+			ttl = tokenTTL
+		} else if ttl <= 0 {
+			ttl = common.ResponseCacheDefaultTTL
+		}
+	}
+	if ttl <= 0 {
+		return "", 0
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return "", 0
+	}
+	if relayInfo.RelayMode == relayconstant.RelayModeChatCompletions && !isDeterministicChatRequest(requestBody) {
+		return "", 0
+	}
+	key, err := service.ResponseCacheKey(relayInfo.Group, modelName, requestBody)
+	if err != nil {
+		common.LogError(c, "error generating response cache key: "+err.Error())
+		return "", 0
+	}
+	return key, time.Duration(ttl) * time.Second
+}
+
+// isDeterministicChatRequest 判断聊天补全请求是否显式设置了 temperature 为 0 并且只生成一个结果。
+// 未设置 temperature 时上游使用默认的采样温度，每次的结果不同，不能返回缓存的响应。
+// GeneralOpenAIRequest 中 temperature 为 0 和未设置无法区分，因此从原始请求体中判断
+func isDeterministicChatRequest(requestBody []byte) bool {
+	var request struct {
+		Temperature *float64 `json:"temperature"`
+		N           *int     `json:"n"`
+	}
+	if err := json.Unmarshal(requestBody, &request); err != nil {
+		return false
+	}
+	return request.Temperature != nil && *request.Temperature == 0 && (request.N == nil || *request.N <= 1)
+}
+
+// getCacheHitRatio 返回响应缓存命中的计费倍率，未命中缓存时返回 1
+func getCacheHitRatio(c *gin.Context) float64 {
+	if c.GetBool("cache_hit") {
+		return common.CacheHitRatio
+	}
+	return 1
+}
+
+// writeCachedResponse 将缓存的响应写给客户端，流式请求将缓存的聊天补全响应按数据块重新输出
+func writeCachedResponse(c *gin.Context, relayInfo *relaycommon.RelayInfo, cached *service.CachedResponse, modelName string) {
+	c.Header("X-Cache", "HIT")
+	if !relayInfo.IsStream {
+		c.Data(http.StatusOK, "application/json", cached.Body)
+		return
+	}
+	writeStreamResponse(c, relayInfo, cached.Body, cached.Usage, modelName)
+}
+
+// saveCachedResponse 缓存成功的非流式响应，响应体过大或没有用量信息时不缓存
+func saveCachedResponse(c *gin.Context, key string, ttl time.Duration, recorder *relaycommon.RecordResponseWriter, usage *dto.Usage) {
+	body, ok := recorder.Body()
+	if !ok || len(body) == 0 || usage == nil || usage.TotalTokens == 0 || recorder.Status() != http.StatusOK {
+		return
+	}
+	cached := &service.CachedResponse{
+		Body:  append([]byte(nil), body...),
+		Usage: *usage,
+	}
+	if err := service.SetCachedResponse(key, cached, ttl); err != nil {
+		common.LogError(c, "error saving cached response: "+err.Error())
+	}
+}
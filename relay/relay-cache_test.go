@@ -0,0 +1,26 @@
+package relay
+
+import "testing"
+
+func TestIsDeterministicChatRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{name: "temperature 0", body: `{"model":"gpt-4o","temperature":0,"messages":[]}`, want: true},
+		{name: "temperature 0.0 with n 1", body: `{"model":"gpt-4o","temperature":0.0,"n":1,"messages":[]}`, want: true},
+		{name: "temperature missing", body: `{"model":"gpt-4o","messages":[]}`, want: false},
+		{name: "temperature null", body: `{"model":"gpt-4o","temperature":null,"messages":[]}`, want: false},
+		{name: "temperature above 0", body: `{"model":"gpt-4o","temperature":0.7,"messages":[]}`, want: false},
+		{name: "several samples", body: `{"model":"gpt-4o","temperature":0,"n":2,"messages":[]}`, want: false},
+		{name: "invalid body", body: `{"model":`, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isDeterministicChatRequest([]byte(test.body)); got != test.want {
+				t.Errorf("isDeterministicChatRequest(%s) = %v, want %v", test.body, got, test.want)
+			}
+		})
+	}
+}
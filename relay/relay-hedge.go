@@ -0,0 +1,246 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/middleware"
+	"one-api/model"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hedgeAttempt 对冲请求中发往一个渠道的请求，每个请求使用独立的 gin.Context 副本和可取消的上下文
+type hedgeAttempt struct {
+	c         *gin.Context
+	channel   *model.Channel // 对冲渠道，第一个渠道为 nil
+	relayInfo *relaycommon.RelayInfo
+	adaptor   channel.Adaptor
+	cancel    context.CancelFunc
+	startTime time.Time
+	resp      *http.Response
+	err       error
+	// finished 请求已经返回，由 doHedgedRequest 在收到结果后设置
+	finished   bool
+	finishTime time.Time
+}
+
+// newHedgeContext 复制 gin.Context 和其中的请求，副本的请求使用可取消的上下文
+func newHedgeContext(c *gin.Context) (*gin.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	hedgeCtx := c.Copy()
+	hedgeCtx.Request = c.Request.Clone(ctx)
+	return hedgeCtx, cancel
+}
+
+// do 发送请求，流式响应等到第一个数据块到达才算作返回。
+// 对冲请求在这里计入对冲渠道的实时指标，第一个渠道的请求由调用方统计
+func (a *hedgeAttempt) do(requestBody io.Reader, done chan<- *hedgeAttempt) {
+	defer func() {
+		done <- a
+	}()
+	defer func() {
+		a.finishTime = time.Now()
+	}()
+	if a.channel != nil {
+		modelName := a.c.GetString("original_model")
+		model.ChannelRequestStarted(a.channel.Id, modelName)
+		defer func() {
+			a.recordChannelMetrics(modelName)
+		}()
+	}
+	a.resp, a.err = a.adaptor.DoRequest(a.c, a.relayInfo, requestBody)
+	if a.err != nil || a.resp.StatusCode != http.StatusOK || a.resp.Body == nil {
+		return
+	}
+	if !a.relayInfo.IsStream && !strings.HasPrefix(a.resp.Header.Get("Content-Type"), "text/event-stream") {
+		return
+	}
+	reader := bufio.NewReader(a.resp.Body)
+	if _, err := reader.Peek(1); err != nil && err != io.EOF {
+		_ = a.resp.Body.Close()
+		a.resp, a.err = nil, err
+		return
+	}
+	a.resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{reader, a.resp.Body}
+}
+
+// recordChannelMetrics 记录对冲请求的延迟和结果。落败被取消、客户端取消和请求本身有误时只结束计数，
+// 落败时的延迟由 recordLoserMetrics 记录
+func (a *hedgeAttempt) recordChannelMetrics(modelName string) {
+	if a.c.Request.Context().Err() != nil || (a.err == nil && a.resp.StatusCode == http.StatusBadRequest) {
+		model.ChannelRequestAborted(a.channel.Id, modelName)
+		return
+	}
+	model.ChannelRequestFinished(a.channel.Id, modelName, time.Since(a.startTime), a.succeeded())
+}
+
+// recordLoserMetrics 记录落败的请求的延迟，它的计数由发起请求的一方结束。
+// 还没有返回的请求以已经等待的时间作为延迟（实际延迟只会更长），慢渠道因此不会因为总被对冲而一直被当作没有延迟数据；
+// 已经失败的第一个渠道记为失败，已经返回的对冲请求在 recordChannelMetrics 中记录过
+func (a *hedgeAttempt) recordLoserMetrics(modelName string, now time.Time) {
+	switch {
+	case !a.finished:
+		model.ChannelRequestObserved(a.relayInfo.ChannelId, modelName, now.Sub(a.startTime), true)
+	case a.channel == nil && (a.err != nil || a.resp.StatusCode != http.StatusBadRequest):
+		model.ChannelRequestObserved(a.relayInfo.ChannelId, modelName, a.finishTime.Sub(a.startTime), false)
+	}
+}
+
+// succeeded 返回请求是否成功得到了上游的正常响应
+func (a *hedgeAttempt) succeeded() bool {
+	return a.err == nil && a.resp.StatusCode == http.StatusOK
+}
+
+// close 取消请求并关闭落败的响应
+func (a *hedgeAttempt) close() {
+	a.cancel()
+	if a.resp != nil && a.resp.Body != nil {
+		_ = a.resp.Body.Close()
+	}
+}
+
+// newHedgeAttempt 从同一分组中选择另一个渠道，按该渠道重新构造请求，没有可用的渠道时返回 nil
+func newHedgeAttempt(c *gin.Context, primary *hedgeAttempt, textRequest dto.GeneralOpenAIRequest, originModelName string) (*hedgeAttempt, io.Reader) {
+	originalModel := c.GetString("original_model")
+	hedgeChannel, err := model.CacheGetRandomSatisfiedChannel(c.GetString("group"), originalModel, []int{primary.relayInfo.ChannelId})
+	if err != nil || hedgeChannel == nil {
+		common.LogInfo(c.Request.Context(), fmt.Sprintf("no channel to hedge for model %s", originalModel))
+		return nil, nil
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, nil
+	}
+	hedgeCtx, cancel := newHedgeContext(c)
+	hedgeCtx.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	middleware.SetupContextForSelectedChannel(hedgeCtx, hedgeChannel, originalModel)
+
+	relayInfo := relaycommon.GenRelayInfo(hedgeCtx)
+	relayInfo.StartTime = primary.relayInfo.StartTime
+	relayInfo.IsStream = primary.relayInfo.IsStream
+	relayInfo.ClientStream = primary.relayInfo.ClientStream
+	relayInfo.ShouldIncludeUsage = primary.relayInfo.ShouldIncludeUsage
+	relayInfo.PromptTokens = primary.relayInfo.PromptTokens
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		cancel()
+		return nil, nil
+	}
+	textRequest.Model = originModelName
+	isModelMapped, openaiErr := mapTextRequestModel(hedgeCtx, &textRequest)
+	if openaiErr != nil {
+		cancel()
+		return nil, nil
+	}
+	relayInfo.UpstreamModelName = textRequest.Model
+	adaptor.Init(relayInfo, textRequest)
+	body, openaiErr := getTextRequestBody(hedgeCtx, relayInfo, adaptor, &textRequest, isModelMapped)
+	if openaiErr != nil {
+		cancel()
+		return nil, nil
+	}
+	return &hedgeAttempt{
+		c:         hedgeCtx,
+		channel:   hedgeChannel,
+		relayInfo: relayInfo,
+		adaptor:   adaptor,
+		cancel:    cancel,
+	}, body
+}
+
+// doHedgedRequest 向上游发送请求。模型配置了对冲延迟时，如果第一个渠道在延迟时间内没有返回响应头（流式请求为第一个数据块），
+// 再从同一分组中选择另一个渠道发送相同的请求，先成功返回的响应胜出，另一个请求被取消。
+// 各个请求使用 relayInfo 的副本，结束后 relayInfo 更新为返回的请求的信息；对冲请求胜出时，c 切换为胜出的渠道，
+// 并返回该渠道的适配器。返回的 cancel 需要在响应处理完之后调用。
+func doHedgedRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo, adaptor channel.Adaptor, requestBody io.Reader,
+	textRequest dto.GeneralOpenAIRequest, originModelName string) (*http.Response, channel.Adaptor, context.CancelFunc, error) {
+	delay := common.GetModelHedgeDelay(c.GetString("original_model"))
+	if _, ok := c.Get("specific_channel_id"); ok || delay <= 0 {
+		resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
+		return resp, adaptor, func() {}, err
+	}
+
+	done := make(chan *hedgeAttempt, 2)
+	primaryCtx, cancel := newHedgeContext(c)
+	primaryInfo := *relayInfo
+	primary := &hedgeAttempt{
+		c:         primaryCtx,
+		relayInfo: &primaryInfo,
+		adaptor:   adaptor,
+		cancel:    cancel,
+		startTime: time.Now(),
+	}
+	go primary.do(requestBody, done)
+	pending := 1
+
+	timer := time.NewTimer(time.Duration(delay) * time.Millisecond)
+	defer timer.Stop()
+	var hedge *hedgeAttempt
+	var result *hedgeAttempt
+	// 等到有请求成功或者所有请求都失败；对冲请求还没有发出时第一个渠道就失败了，直接返回，交给渠道重试处理
+	for pending > 0 && (result == nil || !result.succeeded()) {
+		select {
+		case <-timer.C:
+			var hedgeBody io.Reader
+			hedge, hedgeBody = newHedgeAttempt(c, primary, textRequest, originModelName)
+			if hedge == nil {
+				continue
+			}
+			common.LogInfo(c.Request.Context(), fmt.Sprintf("channel #%d has no response after %d ms, hedging to channel #%d", primaryInfo.ChannelId, delay, hedge.relayInfo.ChannelId))
+			c.Set("hedge_channel_id", hedge.relayInfo.ChannelId)
+			c.Header(common.ChannelIdsHeaderKey, fmt.Sprintf("%s,%d", c.Writer.Header().Get(common.ChannelIdsHeaderKey), hedge.relayInfo.ChannelId))
+			hedge.startTime = time.Now()
+			go hedge.do(hedgeBody, done)
+			pending++
+		case attempt := <-done:
+			pending--
+			attempt.finished = true
+			if result == nil {
+				result = attempt
+			} else if attempt.succeeded() {
+				result.close()
+				result = attempt
+			} else {
+				attempt.close()
+			}
+		}
+	}
+
+	// 取消落败的请求，并关闭它们之后返回的响应
+	now := time.Now()
+	for _, attempt := range []*hedgeAttempt{primary, hedge} {
+		if attempt != nil && attempt != result {
+			attempt.cancel()
+			if c.Request.Context().Err() == nil {
+				attempt.recordLoserMetrics(c.GetString("original_model"), now)
+			}
+		}
+	}
+	go func(pending int) {
+		for i := 0; i < pending; i++ {
+			(<-done).close()
+		}
+	}(pending)
+
+	if result.channel != nil {
+		middleware.SetupContextForSelectedChannel(c, result.channel, c.GetString("original_model"))
+		// 保留对冲请求实际使用的密钥，而不是重新选择
+		c.Request.Header.Set("Authorization", result.c.Request.Header.Get("Authorization"))
+		c.Set("channel_key_index", result.c.GetInt("channel_key_index"))
+	}
+	*relayInfo = *result.relayInfo
+	return result.resp, result.adaptor, result.cancel, result.err
+}
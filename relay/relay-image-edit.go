@@ -0,0 +1,119 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// getAndValidateImageEditRequest 解析 multipart 格式的图片编辑和变体请求，只读取表单字段，上传的图片保留在临时文件中
+func getAndValidateImageEditRequest(c *gin.Context, relayMode int) (*dto.ImageEditRequest, error) {
+	_, err := common.ParseMultipartFormReusable(c)
+	if err != nil {
+		return nil, err
+	}
+	imageEditRequest := &dto.ImageEditRequest{}
+	err = c.ShouldBindWith(imageEditRequest, binding.FormMultipart)
+	if err != nil {
+		return nil, err
+	}
+	if imageEditRequest.Model == "" {
+		imageEditRequest.Model = "dall-e-2"
+	}
+	if imageEditRequest.Size == "" {
+		imageEditRequest.Size = "1024x1024"
+	}
+	if imageEditRequest.N == 0 {
+		imageEditRequest.N = 1
+	}
+	if len(imageEditRequest.Image) == 0 {
+		return nil, errors.New("image is required")
+	}
+	if relayMode == relayconstant.RelayModeImagesEdits && imageEditRequest.Prompt == "" {
+		return nil, errors.New("prompt is required")
+	}
+	if imageEditRequest.N < 1 || imageEditRequest.N > 10 {
+		return nil, errors.New("n must be between 1 and 10")
+	}
+	if imageEditRequest.Model == "dall-e-2" && imageEditRequest.Size != "256x256" && imageEditRequest.Size != "512x512" && imageEditRequest.Size != "1024x1024" {
+		return nil, errors.New("size must be one of 256x256, 512x512, or 1024x1024")
+	}
+	return imageEditRequest, nil
+}
+
+// RelayImageEditHelper 处理 /v1/images/edits 和 /v1/images/variations 请求。上传的图片以流的方式转发给上游，
+// 计费方式与图片生成相同，按模型倍率、尺寸倍率和图片数量计算
+func RelayImageEditHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
+	startTime := time.Now()
+	relayInfo := relaycommon.GenRelayInfo(c)
+
+	imageEditRequest, err := getAndValidateImageEditRequest(c, relayMode)
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("getAndValidateImageEditRequest failed: %s", err.Error()))
+		return service.OpenAIErrorWrapperLocal(err, "invalid_image_request", http.StatusBadRequest)
+	}
+
+	// 复用文本请求的模型映射
+	textRequest := &dto.GeneralOpenAIRequest{Model: imageEditRequest.Model}
+	_, openaiErr := mapTextRequestModel(c, textRequest)
+	if openaiErr != nil {
+		return openaiErr
+	}
+	originModelName := imageEditRequest.Model
+	imageEditRequest.Model = textRequest.Model
+	relayInfo.UpstreamModelName = textRequest.Model
+
+	modelRatio := common.GetModelRatio(imageEditRequest.Model)
+	groupRatio := common.GetGroupRatio(relayInfo.Group)
+	sizeRatio := getImageSizeRatio(imageEditRequest.Size)
+	quota := int(modelRatio*groupRatio*sizeRatio*1000) * imageEditRequest.N
+	userQuota, err := model.CacheGetUserQuota(relayInfo.UserId)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota-quota < 0 {
+		return service.OpenAIErrorWrapperLocal(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapper(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+	imageEditAdaptor, ok := adaptor.(channel.ImageEditAdaptor)
+	if !ok {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("channel type %d does not support image edits", relayInfo.ChannelType), "invalid_channel_type", http.StatusBadRequest)
+	}
+	adaptor.Init(relayInfo, *textRequest)
+
+	requestBody, err := imageEditAdaptor.ConvertImageEditRequest(c, relayInfo, *imageEditRequest)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	// 上游请求失败时请求体可能没有读完，关闭请求体以结束写入请求体的 goroutine
+	defer requestBody.Close()
+
+	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return service.RelayErrorHandler(resp)
+	}
+	_, openaiErr, _ = adaptor.DoResponse(c, resp, relayInfo)
+	if openaiErr != nil {
+		return openaiErr
+	}
+	postConsumeImageQuota(c, c.Request.Context(), originModelName, quota, userQuota, modelRatio, groupRatio, startTime)
+	return nil
+}
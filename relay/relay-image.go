@@ -12,6 +12,7 @@ import (
 	"one-api/common"
 	"one-api/dto"
 	"one-api/model"
+	"one-api/relay/channel"
 	relaycommon "one-api/relay/common"
 	relayconstant "one-api/relay/constant"
 	"one-api/service"
@@ -20,9 +21,7 @@ import (
 )
 
 func RelayImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusCode {
-	tokenId := c.GetInt("token_id")
 	channelType := c.GetInt("channel")
-	channelId := c.GetInt("channel_id")
 	userId := c.GetInt("id")
 	group := c.GetString("group")
 	startTime := time.Now()
@@ -30,7 +29,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusC
 	var imageRequest dto.ImageRequest
 	err := common.UnmarshalBodyReusable(c, &imageRequest)
 	if err != nil {
-		return service.OpenAIErrorWrapper(err, "bind_request_body_failed", http.StatusBadRequest)
+		return service.OpenAIErrorWrapperLocal(err, "bind_request_body_failed", http.StatusBadRequest)
 	}
 
 	if imageRequest.Model == "" {
@@ -44,29 +43,29 @@ func RelayImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusC
 	}
 	// Prompt validation
 	if imageRequest.Prompt == "" {
-		return service.OpenAIErrorWrapper(errors.New("prompt is required"), "required_field_missing", http.StatusBadRequest)
+		return service.OpenAIErrorWrapperLocal(errors.New("prompt is required"), "required_field_missing", http.StatusBadRequest)
 	}
 
 	if strings.Contains(imageRequest.Size, "×") {
-		return service.OpenAIErrorWrapper(errors.New("size an unexpected error occurred in the parameter, please use 'x' instead of the multiplication sign '×'"), "invalid_field_value", http.StatusBadRequest)
+		return service.OpenAIErrorWrapperLocal(errors.New("size an unexpected error occurred in the parameter, please use 'x' instead of the multiplication sign '×'"), "invalid_field_value", http.StatusBadRequest)
 	}
 	// Not "256x256", "512x512", or "1024x1024"
 	if imageRequest.Model == "dall-e-2" || imageRequest.Model == "dall-e" {
 		if imageRequest.Size != "" && imageRequest.Size != "256x256" && imageRequest.Size != "512x512" && imageRequest.Size != "1024x1024" {
-			return service.OpenAIErrorWrapper(errors.New("size must be one of 256x256, 512x512, or 1024x1024, dall-e-3 1024x1792 or 1792x1024"), "invalid_field_value", http.StatusBadRequest)
+			return service.OpenAIErrorWrapperLocal(errors.New("size must be one of 256x256, 512x512, or 1024x1024, dall-e-3 1024x1792 or 1792x1024"), "invalid_field_value", http.StatusBadRequest)
 		}
 	} else if imageRequest.Model == "dall-e-3" {
 		if imageRequest.Size != "" && imageRequest.Size != "1024x1024" && imageRequest.Size != "1024x1792" && imageRequest.Size != "1792x1024" {
-			return service.OpenAIErrorWrapper(errors.New("size must be one of 256x256, 512x512, or 1024x1024, dall-e-3 1024x1792 or 1792x1024"), "invalid_field_value", http.StatusBadRequest)
+			return service.OpenAIErrorWrapperLocal(errors.New("size must be one of 256x256, 512x512, or 1024x1024, dall-e-3 1024x1792 or 1792x1024"), "invalid_field_value", http.StatusBadRequest)
 		}
 		if imageRequest.N != 1 {
-			return service.OpenAIErrorWrapper(errors.New("n must be 1"), "invalid_field_value", http.StatusBadRequest)
+			return service.OpenAIErrorWrapperLocal(errors.New("n must be 1"), "invalid_field_value", http.StatusBadRequest)
 		}
 	}
 
 	// N should between 1 and 10
 	if imageRequest.N != 0 && (imageRequest.N < 1 || imageRequest.N > 10) {
-		return service.OpenAIErrorWrapper(errors.New("n must be between 1 and 10"), "invalid_field_value", http.StatusBadRequest)
+		return service.OpenAIErrorWrapperLocal(errors.New("n must be between 1 and 10"), "invalid_field_value", http.StatusBadRequest)
 	}
 
 	// map model name
@@ -111,17 +110,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusC
 	ratio := modelRatio * groupRatio
 	userQuota, err := model.CacheGetUserQuota(userId)
 
-	sizeRatio := 1.0
-	// Size
-	if imageRequest.Size == "256x256" {
-		sizeRatio = 1
-	} else if imageRequest.Size == "512x512" {
-		sizeRatio = 1.125
-	} else if imageRequest.Size == "1024x1024" {
-		sizeRatio = 1.25
-	} else if imageRequest.Size == "1024x1792" || imageRequest.Size == "1792x1024" {
-		sizeRatio = 2.5
-	}
+	sizeRatio := getImageSizeRatio(imageRequest.Size)
 
 	qualityRatio := 1.0
 	if imageRequest.Model == "dall-e-3" && imageRequest.Quality == "hd" {
@@ -134,10 +123,22 @@ func RelayImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusC
 	quota := int(ratio*sizeRatio*qualityRatio*1000) * imageRequest.N
 
 	if userQuota-quota < 0 {
-		return service.OpenAIErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+		return service.OpenAIErrorWrapperLocal(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
 
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
+	// 非 OpenAI 格式的渠道由适配器转换请求和响应
+	relayInfo := relaycommon.GenRelayInfo(c)
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if imageAdaptor, ok := adaptor.(channel.ImageAdaptor); ok && relayMode == relayconstant.RelayModeImagesGenerations {
+		openaiErr := relayImageByAdaptor(c, relayInfo, adaptor, imageAdaptor, imageRequest)
+		if openaiErr != nil {
+			return openaiErr
+		}
+		postConsumeImageQuota(c, c.Request.Context(), imageRequest.Model, quota, userQuota, modelRatio, groupRatio, startTime)
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, fullRequestURL, requestBody)
 	if err != nil {
 		return service.OpenAIErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
 	}
@@ -172,26 +173,10 @@ func RelayImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusC
 
 	var textResponse dto.ImageResponse
 	defer func(ctx context.Context) {
-		useTimeSeconds := time.Now().Unix() - startTime.Unix()
 		if resp.StatusCode != http.StatusOK {
 			return
 		}
-		err := model.PostConsumeTokenQuota(tokenId, userQuota, quota, 0, true)
-		if err != nil {
-			common.SysError("error consuming token remain quota: " + err.Error())
-		}
-		err = model.CacheUpdateUserQuota(userId)
-		if err != nil {
-			common.SysError("error update user quota cache: " + err.Error())
-		}
-		if quota != 0 {
-			tokenName := c.GetString("token_name")
-			logContent := fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f", modelRatio, groupRatio)
-			model.RecordConsumeLog(ctx, userId, channelId, 0, 0, imageRequest.Model, tokenName, quota, logContent, tokenId, userQuota, int(useTimeSeconds), false)
-			model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
-			channelId := c.GetInt("channel_id")
-			model.UpdateChannelUsedQuota(channelId, quota)
-		}
+		postConsumeImageQuota(c, ctx, imageRequest.Model, quota, userQuota, modelRatio, groupRatio, startTime)
 	}(c.Request.Context())
 
 	responseBody, err := io.ReadAll(resp.Body)
@@ -225,3 +210,64 @@ func RelayImageHelper(c *gin.Context, relayMode int) *dto.OpenAIErrorWithStatusC
 	}
 	return nil
 }
+
+// getImageSizeRatio 图片尺寸对应的计费倍率，未知尺寸按 1 计算
+func getImageSizeRatio(size string) float64 {
+	switch size {
+	case "256x256":
+		return 1
+	case "512x512":
+		return 1.125
+	case "1024x1024":
+		return 1.25
+	case "1024x1792", "1792x1024":
+		return 2.5
+	default:
+		return 1
+	}
+}
+
+func relayImageByAdaptor(c *gin.Context, relayInfo *relaycommon.RelayInfo, adaptor channel.Adaptor, imageAdaptor channel.ImageAdaptor, imageRequest dto.ImageRequest) *dto.OpenAIErrorWithStatusCode {
+	relayInfo.UpstreamModelName = imageRequest.Model
+	adaptor.Init(relayInfo, dto.GeneralOpenAIRequest{Model: imageRequest.Model})
+	convertedRequest, err := imageAdaptor.ConvertImageRequest(c, relayInfo, imageRequest)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "convert_request_failed", http.StatusBadRequest)
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+	resp, err := adaptor.DoRequest(c, relayInfo, bytes.NewReader(jsonData))
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return relaycommon.RelayErrorHandler(resp)
+	}
+	_, openaiErr, _ := adaptor.DoResponse(c, resp, relayInfo)
+	return openaiErr
+}
+
+// postConsumeImageQuota 图片生成成功后扣除额度并记录日志
+func postConsumeImageQuota(c *gin.Context, ctx context.Context, modelName string, quota int, userQuota int, modelRatio float64, groupRatio float64, startTime time.Time) {
+	tokenId := c.GetInt("token_id")
+	channelId := c.GetInt("channel_id")
+	userId := c.GetInt("id")
+	useTimeSeconds := time.Now().Unix() - startTime.Unix()
+	err := model.PostConsumeTokenQuota(tokenId, userQuota, quota, 0, true)
+	if err != nil {
+		common.SysError("error consuming token remain quota: " + err.Error())
+	}
+	err = model.CacheUpdateUserQuota(userId)
+	if err != nil {
+		common.SysError("error update user quota cache: " + err.Error())
+	}
+	if quota != 0 {
+		tokenName := c.GetString("token_name")
+		logContent := fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f", modelRatio, groupRatio)
+		model.RecordConsumeLog(ctx, userId, channelId, 0, 0, modelName, tokenName, quota, logContent, tokenId, userQuota, int(useTimeSeconds), false, model.ConsumeLogExtra{})
+		model.UpdateUserUsedQuotaAndRequestCount(userId, quota)
+		model.UpdateChannelUsedQuota(channelId, quota)
+	}
+}
@@ -0,0 +1,405 @@
+package relay
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/relay/channel/openai"
+	relaycommon "one-api/relay/common"
+	"one-api/service"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+var realtimeUpgrader = websocket.Upgrader{
+	// 令牌鉴权已经在升级之前完成，允许浏览器从任意来源连接
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+	// 只回应 realtime 子协议，不回显客户端通过子协议传递的令牌
+	Subprotocols: []string{"realtime"},
+}
+
+// realtimeAudioTokensPerSecond 模型输出每秒音频对应的 token 数，用于估算没有完成的响应的音频输出
+const realtimeAudioTokensPerSecond = 20
+
+// realtimeAudioBytesPerSecond 返回输出音频格式每秒的字节数，pcm16 为 24kHz 16 位单声道，g711 为 8kHz 8 位单声道
+func realtimeAudioBytesPerSecond(format string) int {
+	if strings.HasPrefix(format, "g711") {
+		return 8000
+	}
+	return 48000
+}
+
+// realtimeSession 一个实时会话，在客户端和上游之间转发消息，并按 response.done 事件中的用量计费。
+// 会话在响应完成之前结束时，按已经生成的内容估算计费
+type realtimeSession struct {
+	c          *gin.Context
+	relayInfo  *relaycommon.RelayInfo
+	modelName  string
+	groupRatio float64
+
+	client    *websocket.Conn
+	upstream  *websocket.Conn
+	closeOnce sync.Once
+	// writeLock 客户端连接同时只能有一个写入者
+	writeLock sync.Mutex
+
+	// 以下字段由 lock 保护
+	lock              sync.Mutex
+	outputAudioFormat string
+	// lastInput 上一个完成的响应的输入 token，会话的上下文只会增长，用于估算进行中的响应的输入
+	lastInput dto.RealtimeTokenDetails
+	// pending 进行中的响应，键为响应 ID
+	pending map[string]*realtimeResponseEstimate
+}
+
+// realtimeResponseEstimate 进行中的响应已经生成的内容
+type realtimeResponseEstimate struct {
+	textTokens int
+	audioBytes int
+	// quotaLimit 响应开始时用户和令牌的剩余额度
+	quotaLimit int
+}
+
+// RealtimeHelper 处理 /v1/realtime 的 WebSocket 请求：连接上游成功后再升级客户端连接，之后双向转发消息。
+// 返回错误时还没有升级客户端连接，可以返回普通的错误响应
+func RealtimeHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
+	relayInfo := relaycommon.GenRelayInfo(c)
+	if relayInfo.ChannelType != common.ChannelTypeOpenAI && relayInfo.ChannelType != common.ChannelTypeAzure {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("channel type %d does not support realtime api", relayInfo.ChannelType), "invalid_channel_type", http.StatusBadRequest)
+	}
+	textRequest := dto.GeneralOpenAIRequest{
+		Model: c.Query("model"),
+	}
+	if textRequest.Model == "" {
+		return service.OpenAIErrorWrapperLocal(errors.New("model is required"), "invalid_request", http.StatusBadRequest)
+	}
+	originModelName := textRequest.Model
+	_, openaiErr := mapTextRequestModel(c, &textRequest)
+	if openaiErr != nil {
+		return openaiErr
+	}
+	relayInfo.UpstreamModelName = textRequest.Model
+
+	userQuota, err := model.CacheGetUserQuota(relayInfo.UserId)
+	if err != nil {
+		return service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota <= 0 {
+		return service.OpenAIErrorWrapperLocal(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	}
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 30 * time.Second,
+	}
+	upstream, resp, err := dialer.DialContext(c.Request.Context(), openai.GetRealtimeURL(relayInfo), openai.GetRealtimeHeader(relayInfo))
+	if err != nil {
+		statusCode := http.StatusBadGateway
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		return service.OpenAIErrorWrapper(err, "dial_upstream_failed", statusCode)
+	}
+	client, err := realtimeUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 失败时已经向客户端写出了错误响应
+		_ = upstream.Close()
+		common.LogError(c, "error upgrading realtime connection: "+err.Error())
+		return nil
+	}
+	session := &realtimeSession{
+		c:          c,
+		relayInfo:  relayInfo,
+		modelName:  originModelName,
+		groupRatio: common.GetGroupRatio(relayInfo.Group),
+		client:     client,
+		upstream:   upstream,
+
+		outputAudioFormat: "pcm16",
+		pending:           make(map[string]*realtimeResponseEstimate),
+	}
+	session.run()
+	return nil
+}
+
+func (s *realtimeSession) close() {
+	s.closeOnce.Do(func() {
+		_ = s.client.Close()
+		_ = s.upstream.Close()
+	})
+}
+
+func (s *realtimeSession) writeClient(messageType int, data []byte) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	return s.client.WriteMessage(messageType, data)
+}
+
+// closeWithError 向客户端发送错误事件后关闭会话
+func (s *realtimeSession) closeWithError(code string, message string) {
+	event, _ := json.Marshal(gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    code,
+			"code":    code,
+			"message": message,
+		},
+	})
+	_ = s.writeClient(websocket.TextMessage, event)
+	_ = s.client.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, message), time.Now().Add(time.Second))
+	s.close()
+}
+
+func (s *realtimeSession) run() {
+	defer s.consumePendingQuota()
+	defer s.close()
+	// 客户端到上游，额度不足时不再转发 response.create
+	go func() {
+		defer s.close()
+		for {
+			messageType, data, err := s.client.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType == websocket.TextMessage && strings.Contains(string(data), `"response.create"`) {
+				var event dto.RealtimeEvent
+				if err := json.Unmarshal(data, &event); err == nil && event.Type == "response.create" && !s.hasQuota() {
+					s.closeWithError("insufficient_quota", "user quota is not enough")
+					return
+				}
+			}
+			if err := s.upstream.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}()
+	// 上游到客户端
+	for {
+		messageType, data, err := s.upstream.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := s.writeClient(messageType, data); err != nil {
+			return
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+		var event dto.RealtimeEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			continue
+		}
+		if !s.handleUpstreamEvent(&event) {
+			s.closeWithError("insufficient_quota", "user quota is not enough")
+			return
+		}
+	}
+}
+
+// handleUpstreamEvent 按上游事件跟踪进行中的响应，响应完成时按实际用量计费。返回用户和令牌是否还有剩余额度
+func (s *realtimeSession) handleUpstreamEvent(event *dto.RealtimeEvent) bool {
+	switch event.Type {
+	case "session.created", "session.updated":
+		if event.Session != nil && event.Session.OutputAudioFormat != "" {
+			s.lock.Lock()
+			s.outputAudioFormat = event.Session.OutputAudioFormat
+			s.lock.Unlock()
+		}
+	case "response.created":
+		if event.Response != nil {
+			quotaLimit := s.remainQuota()
+			s.lock.Lock()
+			s.pending[event.Response.Id] = &realtimeResponseEstimate{quotaLimit: quotaLimit}
+			s.lock.Unlock()
+		}
+	case "response.text.delta", "response.audio_transcript.delta":
+		textTokens, _, _ := service.CountTokenText(event.Delta, s.modelName, false)
+		return s.addEstimate(event.ResponseId, textTokens, 0)
+	case "response.audio.delta":
+		return s.addEstimate(event.ResponseId, 0, base64.StdEncoding.DecodedLen(len(event.Delta)))
+	case "response.done":
+		if event.Response == nil {
+			break
+		}
+		s.lock.Lock()
+		delete(s.pending, event.Response.Id)
+		s.lock.Unlock()
+		if event.Response.Usage != nil {
+			return s.consumeQuota(event.Response.Usage, false)
+		}
+	}
+	return true
+}
+
+// addEstimate 累加进行中的响应已经生成的内容，估算的额度达到响应开始时的剩余额度时返回 false，
+// 避免一个很长的响应超出额度
+func (s *realtimeSession) addEstimate(responseId string, textTokens int, audioBytes int) bool {
+	s.lock.Lock()
+	estimate, ok := s.pending[responseId]
+	if !ok {
+		s.lock.Unlock()
+		return true
+	}
+	estimate.textTokens += textTokens
+	estimate.audioBytes += audioBytes
+	usage := s.estimatedUsage(estimate)
+	quotaLimit := estimate.quotaLimit
+	s.lock.Unlock()
+	quota, _, _ := s.usageQuota(usage)
+	return quota < quotaLimit
+}
+
+// estimatedUsage 估算进行中的响应的用量：输出按已经生成的文本和音频计算，输入按上一个完成的响应计算。调用方需要持有 lock
+func (s *realtimeSession) estimatedUsage(estimate *realtimeResponseEstimate) *dto.RealtimeUsage {
+	audioTokens := estimate.audioBytes * realtimeAudioTokensPerSecond / realtimeAudioBytesPerSecond(s.outputAudioFormat)
+	usage := &dto.RealtimeUsage{
+		InputTokens:  s.lastInput.TextTokens + s.lastInput.AudioTokens,
+		OutputTokens: estimate.textTokens + audioTokens,
+		InputTokenDetails: dto.RealtimeTokenDetails{
+			TextTokens:  s.lastInput.TextTokens,
+			AudioTokens: s.lastInput.AudioTokens,
+		},
+		OutputTokenDetails: dto.RealtimeTokenDetails{
+			TextTokens:  estimate.textTokens,
+			AudioTokens: audioTokens,
+		},
+	}
+	usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	return usage
+}
+
+// remainQuota 返回用户和令牌剩余额度中较小的一个，获取失败时返回 0
+func (s *realtimeSession) remainQuota() int {
+	userQuota, err := model.CacheGetUserQuota(s.relayInfo.UserId)
+	if err != nil {
+		common.LogError(s.c, "error get user quota: "+err.Error())
+		return 0
+	}
+	if s.relayInfo.TokenUnlimited {
+		return userQuota
+	}
+	token, err := model.GetTokenById(s.relayInfo.TokenId)
+	if err != nil {
+		common.LogError(s.c, "error get token: "+err.Error())
+		return 0
+	}
+	if token.RemainQuota < userQuota {
+		return token.RemainQuota
+	}
+	return userQuota
+}
+
+// hasQuota 返回剩余额度扣除进行中的响应的估算额度后是否还有剩余，转发 response.create 之前检查
+func (s *realtimeSession) hasQuota() bool {
+	s.lock.Lock()
+	usages := make([]*dto.RealtimeUsage, 0, len(s.pending))
+	for _, estimate := range s.pending {
+		usages = append(usages, s.estimatedUsage(estimate))
+	}
+	s.lock.Unlock()
+	remainQuota := s.remainQuota()
+	for _, usage := range usages {
+		quota, _, _ := s.usageQuota(usage)
+		remainQuota -= quota
+	}
+	return remainQuota > 0
+}
+
+// consumePendingQuota 会话结束时还有没完成的响应，上游已经为生成的内容计费，按估算的用量计费
+func (s *realtimeSession) consumePendingQuota() {
+	s.lock.Lock()
+	usages := make([]*dto.RealtimeUsage, 0, len(s.pending))
+	for _, estimate := range s.pending {
+		if usage := s.estimatedUsage(estimate); usage.TotalTokens > 0 {
+			usages = append(usages, usage)
+		}
+	}
+	s.pending = make(map[string]*realtimeResponseEstimate)
+	s.lock.Unlock()
+	for _, usage := range usages {
+		s.consumeQuota(usage, true)
+	}
+}
+
+// usageQuota 返回一次响应的用量对应的额度，文本和音频 token 分别按各自的倍率计费。
+// 同时返回输入和输出中文本和音频的 token 数，没有细分时全部算作文本
+func (s *realtimeSession) usageQuota(usage *dto.RealtimeUsage) (int, dto.RealtimeTokenDetails, dto.RealtimeTokenDetails) {
+	textRatio := common.GetModelRatio(s.modelName)
+	audioRatio := common.GetAudioRatio(s.modelName)
+	completionRatio := common.GetCompletionRatio(s.modelName)
+
+	input := dto.RealtimeTokenDetails{TextTokens: usage.InputTokenDetails.TextTokens, AudioTokens: usage.InputTokenDetails.AudioTokens}
+	if input.TextTokens+input.AudioTokens == 0 {
+		input.TextTokens = usage.InputTokens
+	}
+	output := dto.RealtimeTokenDetails{TextTokens: usage.OutputTokenDetails.TextTokens, AudioTokens: usage.OutputTokenDetails.AudioTokens}
+	if output.TextTokens+output.AudioTokens == 0 {
+		output.TextTokens = usage.OutputTokens
+	}
+	textQuota := (float64(input.TextTokens) + float64(output.TextTokens)*completionRatio) * textRatio
+	audioQuota := (float64(input.AudioTokens) + float64(output.AudioTokens)*completionRatio) * audioRatio
+	quota := int((textQuota + audioQuota) * s.groupRatio)
+	if quota <= 0 && usage.TotalTokens > 0 && textRatio+audioRatio != 0 {
+		quota = 1
+	}
+	return quota, input, output
+}
+
+// consumeQuota 按一次响应的用量扣除额度并记录日志，estimated 表示响应没有完成，用量是估算的。
+// 返回用户和令牌是否还有剩余额度
+func (s *realtimeSession) consumeQuota(usage *dto.RealtimeUsage, estimated bool) bool {
+	quota, input, output := s.usageQuota(usage)
+	if !estimated {
+		s.lock.Lock()
+		s.lastInput = input
+		s.lock.Unlock()
+	}
+
+	userQuota, err := model.CacheGetUserQuota(s.relayInfo.UserId)
+	if err != nil {
+		common.LogError(s.c, "error get user quota: "+err.Error())
+	}
+	if quota > 0 {
+		err = model.PostConsumeTokenQuota(s.relayInfo.TokenId, userQuota, quota, 0, true)
+		if err != nil {
+			common.LogError(s.c, "error consuming token remain quota: "+err.Error())
+		}
+		err = model.CacheUpdateUserQuota(s.relayInfo.UserId)
+		if err != nil {
+			common.LogError(s.c, "error update user quota cache: "+err.Error())
+		}
+		model.UpdateUserUsedQuotaAndRequestCount(s.relayInfo.UserId, quota)
+		model.UpdateChannelUsedQuota(s.relayInfo.ChannelId, quota)
+	}
+	logContent := fmt.Sprintf("模型倍率 %.2f，音频倍率 %.2f，分组倍率 %.2f，实时会话：文本输入 %d，音频输入 %d，文本输出 %d，音频输出 %d",
+		common.GetModelRatio(s.modelName), common.GetAudioRatio(s.modelName), s.groupRatio, input.TextTokens, input.AudioTokens, output.TextTokens, output.AudioTokens)
+	if estimated {
+		logContent += "，响应未完成，按已生成的内容估算"
+	}
+	useTimeSeconds := time.Now().Unix() - s.relayInfo.StartTime.Unix()
+	model.RecordConsumeLog(s.c, s.relayInfo.UserId, s.relayInfo.ChannelId, usage.InputTokens, usage.OutputTokens, s.modelName,
+		s.c.GetString("token_name"), quota, logContent, s.relayInfo.TokenId, userQuota, int(useTimeSeconds), true, model.ConsumeLogExtra{})
+
+	// 额度用尽时结束会话
+	if userQuota-quota <= 0 {
+		return false
+	}
+	if !s.relayInfo.TokenUnlimited {
+		token, err := model.GetTokenById(s.relayInfo.TokenId)
+		if err == nil && token.RemainQuota <= 0 {
+			return false
+		}
+	}
+	return true
+}
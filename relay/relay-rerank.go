@@ -0,0 +1,131 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/constant"
+	"one-api/dto"
+	"one-api/relay/channel"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getAndValidateRerankRequest 从请求体中获取并验证 rerank 请求
+func getAndValidateRerankRequest(c *gin.Context) (*dto.RerankRequest, error) {
+	rerankRequest := &dto.RerankRequest{}
+	err := common.UnmarshalBodyReusable(c, rerankRequest)
+	if err != nil {
+		return nil, err
+	}
+	if rerankRequest.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if rerankRequest.Query == "" {
+		return nil, errors.New("field query is required")
+	}
+	if len(rerankRequest.Documents) == 0 {
+		return nil, errors.New("field documents is required")
+	}
+	return rerankRequest, nil
+}
+
+// RerankHelper 处理 /v1/rerank 请求。配置了模型价格的模型按文档数计费（价格为每个文档的价格），
+// 否则按 token 计费，上游没有返回用量时按查询和文档的 token 数估算
+func RerankHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
+	relayInfo := relaycommon.GenRelayInfo(c)
+
+	rerankRequest, err := getAndValidateRerankRequest(c)
+	if err != nil {
+		common.LogError(c, fmt.Sprintf("getAndValidateRerankRequest failed: %s", err.Error()))
+		return service.OpenAIErrorWrapperLocal(err, "invalid_rerank_request", http.StatusBadRequest)
+	}
+
+	// 复用文本请求的模型映射和计费逻辑
+	textRequest := &dto.GeneralOpenAIRequest{Model: rerankRequest.Model}
+	isModelMapped, openaiErr := mapTextRequestModel(c, textRequest)
+	if openaiErr != nil {
+		return openaiErr
+	}
+	rerankRequest.Model = textRequest.Model
+	relayInfo.UpstreamModelName = textRequest.Model
+
+	texts := append([]string{rerankRequest.Query}, rerankRequest.DocumentTexts()...)
+	promptTokens, err, sensitiveTrigger := service.CountTokenInput(texts, textRequest.Model, constant.ShouldCheckPromptSensitive())
+	if err != nil {
+		if sensitiveTrigger {
+			return service.OpenAIErrorWrapperLocal(err, "sensitive_words_detected", http.StatusBadRequest)
+		}
+		return service.OpenAIErrorWrapperLocal(err, "count_token_messages_failed", http.StatusInternalServerError)
+	}
+	relayInfo.SetPromptTokens(promptTokens)
+
+	modelPrice := common.GetModelPrice(textRequest.Model, false)
+	groupRatio := common.GetGroupRatio(relayInfo.Group)
+	var preConsumedQuota int
+	var ratio float64
+	var modelRatio float64
+	if modelPrice == -1 {
+		modelRatio = common.GetModelRatio(textRequest.Model)
+		ratio = modelRatio * groupRatio * getBatchRatio(c)
+		preConsumedQuota = int(float64(promptTokens) * ratio)
+	} else {
+		c.Set("rerank_documents", len(rerankRequest.Documents))
+		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatio * getBatchRatio(c) * float64(len(rerankRequest.Documents)))
+	}
+	preConsumedQuota, userQuota, openaiErr := preConsumeQuota(c, preConsumedQuota, relayInfo)
+	if openaiErr != nil {
+		return openaiErr
+	}
+
+	adaptor := GetAdaptor(relayInfo.ApiType)
+	if adaptor == nil {
+		return service.OpenAIErrorWrapper(fmt.Errorf("invalid api type: %d", relayInfo.ApiType), "invalid_api_type", http.StatusBadRequest)
+	}
+	rerankAdaptor, ok := adaptor.(channel.RerankAdaptor)
+	if !ok {
+		return service.OpenAIErrorWrapperLocal(fmt.Errorf("channel type %d does not support rerank", relayInfo.ChannelType), "invalid_channel_type", http.StatusBadRequest)
+	}
+	adaptor.Init(relayInfo, *textRequest)
+
+	// OpenAI 类型的渠道没有映射模型时原样转发请求体，保留上游支持的其他参数
+	var requestBody *bytes.Reader
+	if relayInfo.ApiType == relayconstant.APITypeOpenAI && !isModelMapped {
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			return service.OpenAIErrorWrapperLocal(err, "read_request_body_failed", http.StatusBadRequest)
+		}
+		requestBody = bytes.NewReader(body)
+	} else {
+		convertedRequest, err := rerankAdaptor.ConvertRerankRequest(c, relayInfo.RelayMode, *rerankRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		jsonData, err := json.Marshal(convertedRequest)
+		if err != nil {
+			return service.OpenAIErrorWrapper(err, "json_marshal_failed", http.StatusInternalServerError)
+		}
+		requestBody = bytes.NewReader(jsonData)
+	}
+
+	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return service.RelayErrorHandler(resp)
+	}
+
+	usage, openaiErr, _ := adaptor.DoResponse(c, resp, relayInfo)
+	if openaiErr != nil {
+		return openaiErr
+	}
+	postConsumeQuota(c, relayInfo, *textRequest, usage, ratio, preConsumedQuota, userQuota, modelRatio, groupRatio, modelPrice, nil)
+	return nil
+}
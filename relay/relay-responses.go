@@ -0,0 +1,74 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"one-api/common"
+	"one-api/dto"
+	"one-api/model"
+	"one-api/relay/channel/openai"
+	relaycommon "one-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getResponsesTextRequest 将 Responses API 格式的请求转换为 OpenAI 格式，
+// 带有 previous_response_id 时从数据库中取出该用户之前的对话，展开到 messages 中
+func getResponsesTextRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo) (*dto.GeneralOpenAIRequest, error) {
+	responsesRequest := &openai.ResponsesRequest{}
+	err := common.UnmarshalBodyReusable(c, responsesRequest)
+	if err != nil {
+		return nil, err
+	}
+	var history []dto.Message
+	if responsesRequest.PreviousResponseId != "" {
+		previous, err := model.GetUserResponseById(responsesRequest.PreviousResponseId, relayInfo.UserId)
+		if err != nil {
+			return nil, errors.New("previous response not found: " + responsesRequest.PreviousResponseId)
+		}
+		err = json.Unmarshal([]byte(previous.Messages), &history)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return openai.RequestResponses2OpenAI(responsesRequest, history)
+}
+
+// saveResponseState 保存本次响应之后的完整对话，之后的请求可以通过 previous_response_id 继续对话。
+// 请求中 store 为 false 时不保存
+func saveResponseState(c *gin.Context, relayInfo *relaycommon.RelayInfo, textRequest *dto.GeneralOpenAIRequest, responseWriter *relaycommon.ConvertResponseWriter) {
+	if responseWriter == nil {
+		return
+	}
+	converter, ok := responseWriter.Converter().(*openai.OpenAI2ResponsesConverter)
+	if !ok {
+		return
+	}
+	responsesRequest := &openai.ResponsesRequest{}
+	err := common.UnmarshalBodyReusable(c, responsesRequest)
+	if err != nil || (responsesRequest.Store != nil && !*responsesRequest.Store) {
+		return
+	}
+	messages := textRequest.Messages
+	if responsesRequest.Instructions != "" && len(messages) > 0 {
+		// instructions 只对本次请求有效
+		messages = messages[1:]
+	}
+	messages = append(messages[:len(messages):len(messages)], converter.OutputMessages()...)
+	messagesJson, err := json.Marshal(messages)
+	if err != nil {
+		common.LogError(c, "error marshalling response messages: "+err.Error())
+		return
+	}
+	response := &model.Response{
+		Id:                 converter.Id(),
+		UserId:             relayInfo.UserId,
+		PreviousResponseId: responsesRequest.PreviousResponseId,
+		Model:              responsesRequest.Model,
+		Messages:           string(messagesJson),
+		CreatedAt:          common.GetTimestamp(),
+	}
+	if err := response.Insert(); err != nil {
+		common.LogError(c, "error saving response: "+err.Error())
+	}
+}
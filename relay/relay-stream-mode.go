@@ -0,0 +1,129 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/dto"
+	relaycommon "one-api/relay/common"
+	relayconstant "one-api/relay/constant"
+	"one-api/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getStreamMode 返回本次请求的流式模式，渠道设置优先于模型设置
+func getStreamMode(c *gin.Context, modelName string) string {
+	if mode := c.GetString("stream_mode"); mode != common.StreamModeDefault {
+		return mode
+	}
+	return common.GetModelStreamMode(modelName)
+}
+
+// canConvertStream 是否可以在流式和非流式响应之间转换，目前只支持聊天补全
+func canConvertStream(relayInfo *relaycommon.RelayInfo) bool {
+	return relayInfo.RelayMode == relayconstant.RelayModeChatCompletions
+}
+
+// applyStreamMode 按流式模式设置修改发往上游的请求：non_stream 时总是以非流式请求上游，
+// stream 时总是以流式请求上游。客户端的请求方式保存在 relayInfo.ClientStream 中
+func applyStreamMode(c *gin.Context, relayInfo *relaycommon.RelayInfo, textRequest *dto.GeneralOpenAIRequest, modelName string) {
+	if !canConvertStream(relayInfo) {
+		return
+	}
+	switch getStreamMode(c, modelName) {
+	case common.StreamModeNonStream:
+		relayInfo.IsStream = false
+	case common.StreamModeStream:
+		relayInfo.IsStream = true
+	default:
+		return
+	}
+	textRequest.Stream = relayInfo.IsStream
+}
+
+// writeConvertedStreamResponse 将适配器输出的响应转换为客户端请求的方式写出：
+// 客户端请求流式时将非流式响应按数据块输出，客户端请求非流式时将流式响应聚合为一个响应。
+// 聚合失败时还没有向客户端写出任何内容，返回错误以便更换渠道重试
+func writeConvertedStreamResponse(c *gin.Context, relayInfo *relaycommon.RelayInfo, body []byte, usage *dto.Usage, modelName string) *dto.OpenAIErrorWithStatusCode {
+	if relayInfo.ClientStream {
+		var streamUsage dto.Usage
+		if usage != nil {
+			streamUsage = *usage
+		}
+		writeStreamResponse(c, relayInfo, body, streamUsage, modelName)
+		return nil
+	}
+	// 客户端没有收到流式数据块，不记录首字时间
+	relayInfo.FirstResponseTime = time.Time{}
+	response, err := relaycommon.AggregateStreamResponse(body, usage, modelName)
+	if err != nil {
+		return service.OpenAIErrorWrapper(err, "aggregate_stream_response_failed", http.StatusInternalServerError)
+	}
+	c.Data(http.StatusOK, "application/json", response)
+	return nil
+}
+
+// writeStreamResponse 将非流式的聊天补全响应按数据块输出：先输出各个 choice 的内容，再输出 finish_reason，
+// 客户端要求时最后输出 usage 数据块
+func writeStreamResponse(c *gin.Context, relayInfo *relaycommon.RelayInfo, body []byte, usage dto.Usage, modelName string) {
+	var response struct {
+		dto.OpenAITextResponse
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		common.LogError(c, "error unmarshalling response: "+err.Error())
+	}
+	if response.Id == "" {
+		response.Id = fmt.Sprintf("chatcmpl-%s", common.GetUUID())
+	}
+	if response.Created == 0 {
+		response.Created = common.GetTimestamp()
+	}
+	if response.Model == "" {
+		response.Model = modelName
+	}
+	service.SetEventStreamHeaders(c)
+	c.Status(http.StatusOK)
+	renderChunk := func(choices []dto.ChatCompletionsStreamResponseChoice, usage *dto.Usage) {
+		jsonResponse, err := json.Marshal(dto.ChatCompletionsStreamResponse{
+			Id:      response.Id,
+			Object:  "chat.completion.chunk",
+			Created: response.Created,
+			Model:   response.Model,
+			Choices: choices,
+			Usage:   usage,
+		})
+		if err != nil {
+			common.LogError(c, "error marshalling stream response: "+err.Error())
+			return
+		}
+		c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonResponse)})
+	}
+	for _, choice := range response.Choices {
+		var streamChoice dto.ChatCompletionsStreamResponseChoice
+		streamChoice.Index = choice.Index
+		streamChoice.Delta.Role = choice.Role
+		streamChoice.Delta.Content = choice.StringContent()
+		if toolCalls := choice.ParseToolCalls(); len(toolCalls) > 0 {
+			for i := range toolCalls {
+				index := i
+				toolCalls[i].Index = &index
+			}
+			streamChoice.Delta.ToolCalls = toolCalls
+		}
+		renderChunk([]dto.ChatCompletionsStreamResponseChoice{streamChoice}, nil)
+	}
+	for _, choice := range response.Choices {
+		finishReason := choice.FinishReason
+		streamChoice := dto.ChatCompletionsStreamResponseChoice{Index: choice.Index, FinishReason: &finishReason}
+		renderChunk([]dto.ChatCompletionsStreamResponseChoice{streamChoice}, nil)
+	}
+	if relayInfo.ShouldIncludeUsage {
+		renderChunk(make([]dto.ChatCompletionsStreamResponseChoice, 0), &usage)
+	}
+	c.Render(-1, common.CustomEvent{Data: "data: [DONE]"})
+	c.Writer.Flush()
+}
@@ -13,6 +13,10 @@ import (
 	"one-api/constant"
 	"one-api/dto"
 	"one-api/model"
+	"one-api/relay/channel"
+	"one-api/relay/channel/claude"
+	"one-api/relay/channel/gemini"
+	"one-api/relay/channel/openai"
 	relaycommon "one-api/relay/common"
 	relayconstant "one-api/relay/constant"
 	"one-api/service"
@@ -28,8 +32,32 @@ import (
 // 返回值: 验证通过后的 GeneralOpenAIRequest 结构体指针和可能出现的错误。
 func getAndValidateTextRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo) (*dto.GeneralOpenAIRequest, error) {
 	textRequest := &dto.GeneralOpenAIRequest{}
-	// 从 HTTP 请求体中反序列化 JSON 数据到 textRequest
-	err := common.UnmarshalBodyReusable(c, textRequest)
+	var err error
+	switch relayInfo.RelayFormat {
+	case relayconstant.RelayFormatClaude:
+		// Claude Messages 格式的请求，转换为 OpenAI 格式
+		claudeRequest := &claude.ClaudeRequest{}
+		err = common.UnmarshalBodyReusable(c, claudeRequest)
+		if err != nil {
+			return nil, err
+		}
+		textRequest, err = claude.RequestClaude2OpenAI(claudeRequest)
+	case relayconstant.RelayFormatGemini:
+		// Gemini generateContent 格式的请求，模型名称和是否流式从路径中获取
+		geminiRequest := &gemini.GeminiChatRequest{}
+		err = common.UnmarshalBodyReusable(c, geminiRequest)
+		if err != nil {
+			return nil, err
+		}
+		modelName, action := relayconstant.GetGeminiModelAndAction(c.Request.URL.Path)
+		textRequest, err = gemini.RequestGemini2OpenAI(geminiRequest, modelName, action == "streamGenerateContent")
+	case relayconstant.RelayFormatResponses:
+		// Responses API 格式的请求，展开之前的对话后转换为 OpenAI 格式
+		textRequest, err = getResponsesTextRequest(c, relayInfo)
+	default:
+		// 从 HTTP 请求体中反序列化 JSON 数据到 textRequest
+		err = common.UnmarshalBodyReusable(c, textRequest)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -75,6 +103,8 @@ func getAndValidateTextRequest(c *gin.Context, relayInfo *relaycommon.RelayInfo)
 
 	// 设置是否启用流式响应
 	relayInfo.IsStream = textRequest.Stream
+	relayInfo.ClientStream = textRequest.Stream
+	relayInfo.ShouldIncludeUsage = textRequest.Stream && textRequest.StreamOptions != nil && textRequest.StreamOptions.IncludeUsage
 	return textRequest, nil
 }
 
@@ -93,23 +123,16 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 	textRequest, err := getAndValidateTextRequest(c, relayInfo)
 	if err != nil {
 		common.LogError(c, fmt.Sprintf("getAndValidateTextRequest failed: %s", err.Error()))
-		return service.OpenAIErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
+		return service.OpenAIErrorWrapperLocal(err, "invalid_text_request", http.StatusBadRequest)
 	}
 
+	// 映射前的模型名称，用于返回给非 OpenAI 格式的客户端
+	originModelName := textRequest.Model
+
 	// 映射模型名称
-	modelMapping := c.GetString("model_mapping")
-	isModelMapped := false
-	if modelMapping != "" && modelMapping != "{}" {
-		modelMap := make(map[string]string)
-		err := json.Unmarshal([]byte(modelMapping), &modelMap)
-		if err != nil {
-			return service.OpenAIErrorWrapper(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
-		}
-		if modelMap[textRequest.Model] != "" {
-			textRequest.Model = modelMap[textRequest.Model]
-			// 设置上游模型名称
-			isModelMapped = true
-		}
+	isModelMapped, openaiErr := mapTextRequestModel(c, textRequest)
+	if openaiErr != nil {
+		return openaiErr
 	}
 	relayInfo.UpstreamModelName = textRequest.Model
 	modelPrice := common.GetModelPrice(textRequest.Model, false)
@@ -125,9 +148,9 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 	// 计算prompt令牌错误
 	if err != nil {
 		if sensitiveTrigger {
-			return service.OpenAIErrorWrapper(err, "sensitive_words_detected", http.StatusBadRequest)
+			return service.OpenAIErrorWrapperLocal(err, "sensitive_words_detected", http.StatusBadRequest)
 		}
-		return service.OpenAIErrorWrapper(err, "count_token_messages_failed", http.StatusInternalServerError)
+		return service.OpenAIErrorWrapperLocal(err, "count_token_messages_failed", http.StatusInternalServerError)
 	}
 
 	// 处理模型价格未知的情况，计算预消耗的配额
@@ -137,10 +160,10 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 			preConsumedTokens = promptTokens + int(textRequest.MaxTokens)
 		}
 		modelRatio = common.GetModelRatio(textRequest.Model)
-		ratio = modelRatio * groupRatio
+		ratio = modelRatio * groupRatio * getBatchRatio(c)
 		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
 	} else {
-		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatio)
+		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatio * getBatchRatio(c))
 	}
 
 	// 预消耗配额
@@ -149,6 +172,44 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 		return openaiErr
 	}
 
+	// 非 OpenAI 格式的请求，拦截适配器输出的 OpenAI 格式响应并转换回客户端的格式
+	var responseWriter *relaycommon.ConvertResponseWriter
+	if converter := getResponseConverter(relayInfo, originModelName); converter != nil {
+		responseWriter = relaycommon.NewConvertResponseWriter(c.Writer, converter, relayInfo.IsStream)
+		c.Writer = responseWriter
+		defer func() {
+			c.Writer = responseWriter.ResponseWriter
+		}()
+	}
+
+	// 响应缓存：命中时直接返回缓存的响应并按缓存命中倍率计费，未命中时记录非流式响应供之后的相同请求使用
+	cacheKey, cacheTTL := getResponseCacheKey(c, relayInfo, originModelName)
+	var recorder *relaycommon.RecordResponseWriter
+	if cacheKey != "" {
+		if cached, ok := service.GetCachedResponse(cacheKey); ok {
+			c.Set("cache_hit", true)
+			writeCachedResponse(c, relayInfo, cached, textRequest.Model)
+			usage := cached.Usage
+			if responseWriter != nil {
+				responseWriter.Finish(&usage)
+			}
+			saveResponseState(c, relayInfo, textRequest, responseWriter)
+			postConsumeQuota(c, relayInfo, *textRequest, &usage, ratio, preConsumedQuota, userQuota, modelRatio, groupRatio, modelPrice, nil)
+			return nil
+		}
+		c.Header("X-Cache", "MISS")
+		if !relayInfo.IsStream {
+			recorder = relaycommon.NewRecordResponseWriter(c.Writer)
+			c.Writer = recorder
+			defer func() {
+				c.Writer = recorder.ResponseWriter
+			}()
+		}
+	}
+
+	// 按渠道或模型的设置决定向上游发送流式还是非流式请求，之后 relayInfo.IsStream 表示上游请求是否为流式
+	applyStreamMode(c, relayInfo, textRequest, originModelName)
+
 	// 获取适配器并初始化
 	adaptor := GetAdaptor(relayInfo.ApiType)
 	if adaptor == nil {
@@ -156,48 +217,75 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 	}
 	adaptor.Init(relayInfo, *textRequest)
 
-	var requestBody io.Reader
-	// 根据API类型准备请求体
-	if relayInfo.ApiType == relayconstant.APITypeOpenAI {
-		if isModelMapped {
-			jsonStr, err := json.Marshal(textRequest)
-			if err != nil {
-				return service.OpenAIErrorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError)
-			}
-			requestBody = bytes.NewBuffer(jsonStr)
-		} else {
-			requestBody = c.Request.Body
-		}
-	} else {
-		convertedRequest, err := adaptor.ConvertRequest(c, relayInfo.RelayMode, textRequest)
-		if err != nil {
-			return service.OpenAIErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
-		}
-		jsonData, err := json.Marshal(convertedRequest)
-		if err != nil {
-			return service.OpenAIErrorWrapper(err, "json_marshal_failed", http.StatusInternalServerError)
-		}
-		requestBody = bytes.NewBuffer(jsonData)
+	requestBody, openaiErr := getTextRequestBody(c, relayInfo, adaptor, textRequest, isModelMapped)
+	if openaiErr != nil {
+		return openaiErr
 	}
 
-	// 执行HTTP请求
-	resp, err := adaptor.DoRequest(c, relayInfo, requestBody)
+	// 执行HTTP请求，模型配置了对冲延迟时可能由另一个渠道返回响应
+	resp, adaptor, cancel, err := doHedgedRequest(c, relayInfo, adaptor, requestBody, *textRequest, originModelName)
+	defer cancel()
 	if err != nil {
+		if isClientCancelled(c) {
+			// 客户端在上游返回之前断开，上游已经处理了提示词，按提示词用量计费
+			return postConsumeCancelledQuota(c, relayInfo, *textRequest, nil, err, ratio, preConsumedQuota, userQuota, modelRatio, groupRatio, modelPrice)
+		}
+		if errors.Is(err, relaycommon.ErrFirstTokenTimeout) {
+			// 还没有向客户端写出任何内容，返回 504 以便更换渠道重试
+			return service.OpenAIErrorWrapper(err, "first_token_timeout", http.StatusGatewayTimeout)
+		}
 		return service.OpenAIErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
-	relayInfo.IsStream = relayInfo.IsStream || strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+	if !relayInfo.IsStream && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		// 上游忽略了非流式请求，直接返回了流式响应
+		relayInfo.IsStream = true
+		if !canConvertStream(relayInfo) {
+			relayInfo.ClientStream = true
+			if responseWriter != nil {
+				responseWriter = relaycommon.NewConvertResponseWriter(responseWriter.ResponseWriter, getResponseConverter(relayInfo, originModelName), true)
+				c.Writer = responseWriter
+			}
+		}
+	}
 
-	// 处理非200响应
+	// 处理非200响应，预扣的额度在最终失败时由 ReturnPreConsumedQuota 统一归还
 	if resp.StatusCode != http.StatusOK {
-		returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
 		return service.RelayErrorHandler(resp)
 	}
 
+	// 上游和客户端的流式模式不同时，缓存适配器输出的响应，转换后再写给客户端
+	var streamWriter *relaycommon.BufferResponseWriter
+	if relayInfo.IsStream != relayInfo.ClientStream {
+		streamWriter = relaycommon.NewBufferResponseWriter(c.Writer)
+		c.Writer = streamWriter
+	}
+
 	// 处理响应体
 	usage, openaiErr, sensitiveResp := adaptor.DoResponse(c, resp, relayInfo)
+	if streamWriter != nil {
+		c.Writer = streamWriter.ResponseWriter
+		if openaiErr == nil || sensitiveResp != nil {
+			if convertErr := writeConvertedStreamResponse(c, relayInfo, streamWriter.Body(), usage, textRequest.Model); convertErr != nil {
+				return convertErr
+			}
+		}
+		relayInfo.IsStream = relayInfo.ClientStream
+	}
+	if responseWriter != nil {
+		responseWriter.Finish(usage)
+	}
+	if relaycommon.GetStreamTimeoutError(resp) != nil {
+		c.Set("stream_idle_timeout", true)
+	}
+	if isClientCancelled(c) {
+		// 流式响应按断开前已经产生的用量正常结算；非流式响应读取失败时按提示词用量计费
+		c.Set("client_cancelled", true)
+		if openaiErr != nil {
+			return postConsumeCancelledQuota(c, relayInfo, *textRequest, usage, errors.New(openaiErr.Error.Message), ratio, preConsumedQuota, userQuota, modelRatio, groupRatio, modelPrice)
+		}
+	}
 	if openaiErr != nil {
 		if sensitiveResp == nil { // 没有敏感词检查结果
-			returnPreConsumedQuota(c, relayInfo.TokenId, userQuota, preConsumedQuota)
 			return openaiErr
 		} else {
 			// 有敏感词检查结果，消耗配额
@@ -208,11 +296,88 @@ func TextHelper(c *gin.Context) *dto.OpenAIErrorWithStatusCode {
 			return nil
 		}
 	}
+	if recorder != nil && !relayInfo.IsStream {
+		saveCachedResponse(c, cacheKey, cacheTTL, recorder, usage)
+	}
+	saveResponseState(c, relayInfo, textRequest, responseWriter)
 	// 消耗配额
 	postConsumeQuota(c, relayInfo, *textRequest, usage, ratio, preConsumedQuota, userQuota, modelRatio, groupRatio, modelPrice, nil)
 	return nil
 }
 
+// mapTextRequestModel 按渠道的模型映射修改请求的模型名称，返回是否发生了映射
+func mapTextRequestModel(c *gin.Context, textRequest *dto.GeneralOpenAIRequest) (bool, *dto.OpenAIErrorWithStatusCode) {
+	modelMapping := c.GetString("model_mapping")
+	if modelMapping == "" || modelMapping == "{}" {
+		return false, nil
+	}
+	modelMap := make(map[string]string)
+	err := json.Unmarshal([]byte(modelMapping), &modelMap)
+	if err != nil {
+		return false, service.OpenAIErrorWrapper(err, "unmarshal_model_mapping_failed", http.StatusInternalServerError)
+	}
+	if modelMap[textRequest.Model] == "" {
+		return false, nil
+	}
+	textRequest.Model = modelMap[textRequest.Model]
+	return true, nil
+}
+
+// getTextRequestBody 根据渠道的 API 类型准备发往上游的请求体
+func getTextRequestBody(c *gin.Context, relayInfo *relaycommon.RelayInfo, adaptor channel.Adaptor, textRequest *dto.GeneralOpenAIRequest, isModelMapped bool) (io.Reader, *dto.OpenAIErrorWithStatusCode) {
+	// 渠道支持时总是向上游请求流式 usage，按实际用量计费；不支持时去掉 stream_options 以免上游报错
+	streamOptionsChanged := false
+	if relayInfo.IsStream && relayInfo.SupportStreamOptions {
+		streamOptionsChanged = !relayInfo.ShouldIncludeUsage
+		textRequest.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	} else if textRequest.StreamOptions != nil {
+		streamOptionsChanged = true
+		textRequest.StreamOptions = nil
+	}
+
+	if relayInfo.ApiType == relayconstant.APITypeOpenAI {
+		streamChanged := relayInfo.IsStream != relayInfo.ClientStream
+		if isModelMapped || streamOptionsChanged || streamChanged || relayInfo.RelayFormat != relayconstant.RelayFormatOpenAI {
+			jsonStr, err := json.Marshal(textRequest)
+			if err != nil {
+				return nil, service.OpenAIErrorWrapper(err, "marshal_text_request_failed", http.StatusInternalServerError)
+			}
+			return bytes.NewBuffer(jsonStr), nil
+		}
+		return c.Request.Body, nil
+	}
+	convertedRequest, err := adaptor.ConvertRequest(c, relayInfo.RelayMode, textRequest)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, service.OpenAIErrorWrapper(err, "json_marshal_failed", http.StatusInternalServerError)
+	}
+	return bytes.NewBuffer(jsonData), nil
+}
+
+// getBatchRatio 返回批处理计费倍率，不是由批处理任务发起的请求返回 1
+func getBatchRatio(c *gin.Context) float64 {
+	if c.GetString("batch_id") != "" {
+		return common.BatchRatio
+	}
+	return 1
+}
+
+// getResponseConverter 根据请求格式返回响应转换器，OpenAI 格式的请求不需要转换，返回 nil
+func getResponseConverter(relayInfo *relaycommon.RelayInfo, modelName string) relaycommon.ResponseConverter {
+	switch relayInfo.RelayFormat {
+	case relayconstant.RelayFormatClaude:
+		return claude.NewOpenAI2ClaudeConverter(modelName, relayInfo.PromptTokens)
+	case relayconstant.RelayFormatGemini:
+		return gemini.NewOpenAI2GeminiConverter(relayInfo.PromptTokens)
+	case relayconstant.RelayFormatResponses:
+		return openai.NewOpenAI2ResponsesConverter(modelName, relayInfo.PromptTokens)
+	}
+	return nil
+}
+
 // getPromptTokens 根据不同的 relay 模式计算 prompt 中的 token 数量，并检查是否触发敏感内容。
 //
 // 参数:
@@ -264,24 +429,29 @@ func getPromptTokens(textRequest *dto.GeneralOpenAIRequest, info *relaycommon.Re
 // - int: 操作后用户的剩余配额。
 // - *dto.OpenAIErrorWithStatusCode: 如果有错误发生，返回错误信息和HTTP状态码。
 func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommon.RelayInfo) (int, int, *dto.OpenAIErrorWithStatusCode) {
+	// 渠道重试时复用第一次预扣的结果，保证同一个请求只预扣一次
+	if c.GetBool("quota_pre_consumed") {
+		return c.GetInt("pre_consumed_quota"), c.GetInt("pre_consumed_user_quota"), nil
+	}
+
 	// 尝试从缓存获取用户配额
 	userQuota, err := model.CacheGetUserQuota(relayInfo.UserId)
 	if err != nil {
 		// 获取用户配额失败，返回错误
-		return 0, 0, service.OpenAIErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+		return 0, 0, service.OpenAIErrorWrapperLocal(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
 
 	// 检查用户配额是否充足
 	if userQuota <= 0 || userQuota-preConsumedQuota < 0 {
 		// 用户配额不足，返回错误
-		return 0, 0, service.OpenAIErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+		return 0, 0, service.OpenAIErrorWrapperLocal(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
 
 	// 减少用户配额
 	err = model.CacheDecreaseUserQuota(relayInfo.UserId, preConsumedQuota)
 	if err != nil {
 		// 减少用户配额失败，返回错误
-		return 0, 0, service.OpenAIErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
+		return 0, 0, service.OpenAIErrorWrapperLocal(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 	}
 
 	// 用户额度充足的情况下，检查令牌额度是否充足
@@ -306,14 +476,28 @@ func preConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		userQuota, err = model.PreConsumeTokenQuota(relayInfo.TokenId, preConsumedQuota)
 		if err != nil {
 			// 预消费令牌配额失败，返回错误
-			return 0, 0, service.OpenAIErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+			return 0, 0, service.OpenAIErrorWrapperLocal(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
 	}
 
+	// 记录预扣结果，供重试和最终归还使用
+	c.Set("quota_pre_consumed", true)
+	c.Set("pre_consumed_quota", preConsumedQuota)
+	c.Set("pre_consumed_user_quota", userQuota)
+
 	// 返回预消费的配额数量和操作后的用户剩余配额
 	return preConsumedQuota, userQuota, nil
 }
 
+// ReturnPreConsumedQuota 在请求最终失败（所有重试都失败）后归还预扣的额度
+func ReturnPreConsumedQuota(c *gin.Context) {
+	if !c.GetBool("quota_pre_consumed") {
+		return
+	}
+	c.Set("quota_pre_consumed", false)
+	returnPreConsumedQuota(c, c.GetInt("token_id"), c.GetInt("pre_consumed_user_quota"), c.GetInt("pre_consumed_quota"))
+}
+
 // returnPreConsumedQuota 用于归还预先消费的配额
 // 参数:
 // c: gin上下文，用于传递请求相关的context
@@ -334,10 +518,36 @@ func returnPreConsumedQuota(c *gin.Context, tokenId int, userQuota int, preConsu
 	}
 }
 
+// clientCancelledStatusCode 客户端主动断开连接，沿用 nginx 的 499 状态码
+const clientCancelledStatusCode = 499
+
+// isClientCancelled 返回客户端是否已经断开连接，上游请求使用客户端请求的上下文，此时已被取消
+func isClientCancelled(c *gin.Context) bool {
+	return c.Request.Context().Err() != nil
+}
+
+// postConsumeCancelledQuota 客户端断开导致请求失败时结算额度，没有用量时只按提示词计费，
+// 返回本地错误，不再更换渠道重试
+func postConsumeCancelledQuota(c *gin.Context, relayInfo *relaycommon.RelayInfo, textRequest dto.GeneralOpenAIRequest, usage *dto.Usage, err error,
+	ratio float64, preConsumedQuota int, userQuota int, modelRatio float64, groupRatio float64, modelPrice float64) *dto.OpenAIErrorWithStatusCode {
+	c.Set("client_cancelled", true)
+	if usage == nil {
+		usage = &dto.Usage{
+			PromptTokens: relayInfo.PromptTokens,
+			TotalTokens:  relayInfo.PromptTokens,
+		}
+	}
+	postConsumeQuota(c, relayInfo, textRequest, usage, ratio, preConsumedQuota, userQuota, modelRatio, groupRatio, modelPrice, nil)
+	return service.OpenAIErrorWrapperLocal(err, "client_cancelled", clientCancelledStatusCode)
+}
+
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, textRequest dto.GeneralOpenAIRequest,
 	usage *dto.Usage, ratio float64, preConsumedQuota int, userQuota int, modelRatio float64, groupRatio float64,
 	modelPrice float64, sensitiveResp *dto.SensitiveResponse) {
 
+	// 额度已结算，不再需要归还预扣额度
+	ctx.Set("quota_pre_consumed", false)
+
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
@@ -345,6 +555,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, textRe
 	tokenName := ctx.GetString("token_name")
 
 	quota := 0
+	ratio *= getCacheHitRatio(ctx)
 	if modelPrice == -1 {
 		completionRatio := common.GetCompletionRatio(textRequest.Model)
 		quota = promptTokens + int(float64(completionTokens)*completionRatio)
@@ -353,7 +564,11 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, textRe
 			quota = 1
 		}
 	} else {
-		quota = int(modelPrice * common.QuotaPerUnit * groupRatio)
+		quota = int(modelPrice * common.QuotaPerUnit * groupRatio * getBatchRatio(ctx) * getCacheHitRatio(ctx))
+		if documents := ctx.GetInt("rerank_documents"); documents > 0 {
+			// rerank 模型按文档数计费
+			quota *= documents
+		}
 	}
 	totalTokens := promptTokens + completionTokens
 	var logContent string
@@ -361,6 +576,27 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, textRe
 		logContent = fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f", modelRatio, groupRatio)
 	} else {
 		logContent = fmt.Sprintf("模型价格 %.2f，分组倍率 %.2f", modelPrice, groupRatio)
+		if documents := ctx.GetInt("rerank_documents"); documents > 0 {
+			logContent = fmt.Sprintf("模型价格 %.6f / 文档，文档数 %d，分组倍率 %.2f", modelPrice, documents, groupRatio)
+		}
+	}
+	if batchId := ctx.GetString("batch_id"); batchId != "" {
+		logContent += fmt.Sprintf("，批处理倍率 %.2f，批处理 %s", common.BatchRatio, batchId)
+	}
+	if !relayInfo.FirstResponseTime.IsZero() {
+		logContent += fmt.Sprintf("，首字时间 %.2f 秒", relayInfo.FirstResponseTime.Sub(relayInfo.StartTime).Seconds())
+	}
+	if ctx.GetBool("stream_idle_timeout") {
+		logContent += "，上游流式响应空闲超时"
+	}
+	if ctx.GetBool("client_cancelled") {
+		logContent += "，客户端已断开"
+	}
+	if hedgeChannelId := ctx.GetInt("hedge_channel_id"); hedgeChannelId != 0 {
+		logContent += fmt.Sprintf("，对冲请求渠道 #%d，胜出渠道 #%d", hedgeChannelId, relayInfo.ChannelId)
+	}
+	if ctx.GetBool("cache_hit") {
+		logContent += fmt.Sprintf("，缓存命中倍率 %.2f", common.CacheHitRatio)
 	}
 
 	// record all the consume log even if quota is 0
@@ -384,7 +620,10 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, textRe
 			common.LogError(ctx, "error update user quota cache: "+err.Error())
 		}
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
-		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		// 命中响应缓存时没有请求渠道，不计入渠道的用量
+		if !ctx.GetBool("cache_hit") {
+			model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		}
 	}
 
 	logModel := textRequest.Model
@@ -392,7 +631,10 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, textRe
 		logModel = "gpt-4-gizmo-*"
 		logContent += fmt.Sprintf("，模型 %s", textRequest.Model)
 	}
-	model.RecordConsumeLog(ctx, relayInfo.UserId, relayInfo.ChannelId, promptTokens, completionTokens, logModel, tokenName, quota, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), relayInfo.IsStream)
+	model.RecordConsumeLog(ctx, relayInfo.UserId, relayInfo.ChannelId, promptTokens, completionTokens, logModel, tokenName, quota, logContent, relayInfo.TokenId, userQuota, int(useTimeSeconds), relayInfo.IsStream, model.ConsumeLogExtra{
+		CacheHit:        ctx.GetBool("cache_hit"),
+		ClientCancelled: ctx.GetBool("client_cancelled"),
+	})
 
 	//if quota != 0 {
 	//
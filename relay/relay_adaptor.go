@@ -3,14 +3,17 @@ package relay
 import (
 	"one-api/relay/channel"
 	"one-api/relay/channel/ali"
+	"one-api/relay/channel/aws"
 	"one-api/relay/channel/baidu"
 	"one-api/relay/channel/claude"
+	"one-api/relay/channel/cohere"
 	"one-api/relay/channel/gemini"
 	"one-api/relay/channel/ollama"
 	"one-api/relay/channel/openai"
 	"one-api/relay/channel/palm"
 	"one-api/relay/channel/perplexity"
 	"one-api/relay/channel/tencent"
+	"one-api/relay/channel/vertex"
 	"one-api/relay/channel/xunfei"
 	"one-api/relay/channel/zhipu"
 	"one-api/relay/channel/zhipu_4v"
@@ -45,6 +48,12 @@ func GetAdaptor(apiType int) channel.Adaptor {
 		return &ollama.Adaptor{}
 	case constant.APITypePerplexity:
 		return &perplexity.Adaptor{}
+	case constant.APITypeAws:
+		return &aws.Adaptor{}
+	case constant.APITypeVertexAi:
+		return &vertex.Adaptor{}
+	case constant.APITypeCohere:
+		return &cohere.Adaptor{}
 	}
 	return nil
 }
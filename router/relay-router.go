@@ -24,6 +24,21 @@ func SetRelayRouter(router *gin.Engine) {
 		modelsRouter.GET("/:model", controller.RetrieveModel)
 	}
 
+	// 文件与批处理路由组，只需要Token认证，不需要选择渠道
+	fileRouter := router.Group("/v1")
+	fileRouter.Use(middleware.TokenAuth())
+	{
+		fileRouter.GET("/files", controller.ListFiles)
+		fileRouter.POST("/files", controller.UploadFile)
+		fileRouter.GET("/files/:id", controller.RetrieveFile)
+		fileRouter.DELETE("/files/:id", controller.DeleteFile)
+		fileRouter.GET("/files/:id/content", controller.GetFileContent)
+		fileRouter.POST("/batches", controller.CreateBatch)
+		fileRouter.GET("/batches", controller.ListBatches)
+		fileRouter.GET("/batches/:id", controller.RetrieveBatch)
+		fileRouter.POST("/batches/:id/cancel", controller.CancelBatch)
+	}
+
 	// V1 Relay路由组，使用Token认证和分布中间件
 	relayV1Router := router.Group("/v1")
 	relayV1Router.Use(middleware.TokenAuth(), middleware.Distribute())
@@ -33,18 +48,13 @@ func SetRelayRouter(router *gin.Engine) {
 		relayV1Router.POST("/chat/completions", controller.Relay)
 		relayV1Router.POST("/edits", controller.Relay)
 		relayV1Router.POST("/images/generations", controller.Relay)
-		relayV1Router.POST("/images/edits", controller.RelayNotImplemented)
-		relayV1Router.POST("/images/variations", controller.RelayNotImplemented)
+		relayV1Router.POST("/images/edits", controller.Relay)
+		relayV1Router.POST("/images/variations", controller.Relay)
 		relayV1Router.POST("/embeddings", controller.Relay)
 		relayV1Router.POST("/engines/:model/embeddings", controller.Relay)
 		relayV1Router.POST("/audio/transcriptions", controller.Relay)
 		relayV1Router.POST("/audio/translations", controller.Relay)
 		relayV1Router.POST("/audio/speech", controller.Relay)
-		relayV1Router.GET("/files", controller.RelayNotImplemented)
-		relayV1Router.POST("/files", controller.RelayNotImplemented)
-		relayV1Router.DELETE("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id/content", controller.RelayNotImplemented)
 		relayV1Router.POST("/fine-tunes", controller.RelayNotImplemented)
 		relayV1Router.GET("/fine-tunes", controller.RelayNotImplemented)
 		relayV1Router.GET("/fine-tunes/:id", controller.RelayNotImplemented)
@@ -52,6 +62,22 @@ func SetRelayRouter(router *gin.Engine) {
 		relayV1Router.GET("/fine-tunes/:id/events", controller.RelayNotImplemented)
 		relayV1Router.DELETE("/models/:model", controller.RelayNotImplemented)
 		relayV1Router.POST("/moderations", controller.Relay)
+		// Jina / Cohere 格式的 rerank 入口
+		relayV1Router.POST("/rerank", controller.Relay)
+		// Claude Messages 格式的入口，可由任意渠道提供服务
+		relayV1Router.POST("/messages", controller.Relay)
+		// Responses API 格式的入口，可由任意渠道提供服务
+		relayV1Router.POST("/responses", controller.Relay)
+		// Realtime API 的 WebSocket 入口，只能由 OpenAI 和 Azure 渠道提供服务
+		relayV1Router.GET("/realtime", controller.RelayRealtime)
+	}
+
+	// Gemini 原生格式的路由组，可由任意渠道提供服务
+	relayGeminiRouter := router.Group("/v1beta")
+	relayGeminiRouter.Use(middleware.TokenAuth(), middleware.Distribute())
+	{
+		// {model}:generateContent 与 {model}:streamGenerateContent
+		relayGeminiRouter.POST("/models/:model", controller.Relay)
 	}
 
 	// MJ路由组，用于Midjourney相关的请求，使用Token认证和分布中间件
@@ -16,6 +16,25 @@ func DisableChannel(channelId int, channelName string, reason string) {
 	notifyRootUser(subject, content)
 }
 
+// RecordChannelKeyError 记录多密钥渠道中一个密钥的错误，disable 为 true 时禁用该密钥并通知，
+// 所有密钥都被禁用后禁用整个渠道
+func RecordChannelKeyError(channelId int, channelName string, keyIndex int, reason string, disable bool) {
+	allDisabled, err := model.RecordChannelKeyError(channelId, keyIndex, reason, disable)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to record error of channel #%d key %d: %s", channelId, keyIndex, err.Error()))
+		return
+	}
+	if !disable {
+		return
+	}
+	subject := fmt.Sprintf("通道「%s」（#%d）的第 %d 个密钥已被禁用", channelName, channelId, keyIndex+1)
+	content := fmt.Sprintf("通道「%s」（#%d）的第 %d 个密钥已被禁用，原因：%s", channelName, channelId, keyIndex+1, reason)
+	notifyRootUser(subject, content)
+	if allDisabled {
+		DisableChannel(channelId, channelName, "所有密钥均已被禁用")
+	}
+}
+
 func EnableChannel(channelId int, channelName string) {
 	model.UpdateChannelStatusById(channelId, common.ChannelStatusEnabled)
 	subject := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
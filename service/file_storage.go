@@ -0,0 +1,171 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	FileStorageLocal = "local"
+	FileStorageS3    = "s3"
+)
+
+// FileStorage 文件存储后端，key 为 "{用户 id}/{文件 id}" 形式的相对路径
+type FileStorage interface {
+	Save(key string, reader io.Reader, size int64) error
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// GetFileStorage 根据名称返回文件存储后端，名称为空时使用 FILE_STORAGE 配置的默认后端
+func GetFileStorage(name string) (FileStorage, error) {
+	if name == "" {
+		name = common.FileStorageType
+	}
+	switch name {
+	case FileStorageLocal:
+		if err := CheckLocalFileStorage(); err != nil {
+			return nil, err
+		}
+		return &localFileStorage{root: common.FileStoragePath}, nil
+	case FileStorageS3:
+		if common.S3Endpoint == "" || common.S3Bucket == "" {
+			return nil, errors.New("S3_ENDPOINT or S3_BUCKET is not configured")
+		}
+		return &s3FileStorage{
+			endpoint:        strings.TrimSuffix(common.S3Endpoint, "/"),
+			region:          common.S3Region,
+			bucket:          common.S3Bucket,
+			accessKeyId:     common.S3AccessKeyId,
+			secretAccessKey: common.S3SecretAccessKey,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown file storage: %s", name)
+}
+
+// CheckLocalFileStorage 检查本地文件存储能否在当前部署方式下使用。多节点部署时各节点的本地目录互不可见，
+// 在从节点上传的文件主节点的批处理任务读取不到，因此要求使用 s3 或者声明为共享目录
+func CheckLocalFileStorage() error {
+	if common.IsMultiNode && !common.FileStorageShared {
+		return errors.New("多节点部署（设置了 NODE_TYPE）时文件存储需要使用 s3，或者将 FILE_STORAGE_PATH 设为所有节点共享的目录并设置 FILE_STORAGE_SHARED=true")
+	}
+	return nil
+}
+
+type localFileStorage struct {
+	root string
+}
+
+func (s *localFileStorage) path(key string) (string, error) {
+	path := filepath.Join(s.root, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(s.root)+string(filepath.Separator)) {
+		return "", errors.New("invalid file key")
+	}
+	return path, nil
+}
+
+func (s *localFileStorage) Save(key string, reader io.Reader, size int64) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+	}
+	return err
+}
+
+func (s *localFileStorage) Open(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s *localFileStorage) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// s3FileStorage 使用 path-style 地址访问 S3 兼容的对象存储（AWS S3、MinIO、R2 等）
+type s3FileStorage struct {
+	endpoint        string
+	region          string
+	bucket          string
+	accessKeyId     string
+	secretAccessKey string
+}
+
+func (s *s3FileStorage) do(method string, key string, body io.Reader, size int64) (*http.Response, error) {
+	objectUrl := fmt.Sprintf("%s/%s/%s", s.endpoint, s.bucket, key)
+	req, err := http.NewRequest(method, objectUrl, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	common.SignAWSRequestV4(req, common.AWSUnsignedPayload, s.accessKeyId, s.secretAccessKey, s.region, "s3", time.Now())
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s failed: status code %d, %s", method, key, resp.StatusCode, string(message))
+	}
+	return resp, nil
+}
+
+func (s *s3FileStorage) Save(key string, reader io.Reader, size int64) error {
+	resp, err := s.do(http.MethodPut, key, reader, size)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *s3FileStorage) Open(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *s3FileStorage) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, 0)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -8,6 +8,7 @@ import (
 
 var httpClient *http.Client
 var impatientHTTPClient *http.Client
+var relayHttpClient = &http.Client{}
 
 func init() {
 	if common.RelayTimeout == 0 {
@@ -30,3 +31,9 @@ func GetHttpClient() *http.Client {
 func GetImpatientHttpClient() *http.Client {
 	return impatientHTTPClient
 }
+
+// GetRelayHttpClient 返回中继请求使用的 HTTP 客户端，不设置整体超时，
+// 超时由每个请求按渠道的设置通过上下文控制
+func GetRelayHttpClient() *http.Client {
+	return relayHttpClient
+}
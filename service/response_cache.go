@@ -0,0 +1,121 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"one-api/common"
+	"one-api/dto"
+	"sync"
+	"time"
+)
+
+// 响应缓存：分组、模型和请求体完全相同的请求直接返回之前的响应。
+// 启用 Redis 时缓存保存在 Redis 中由多个节点共享，否则保存在本机内存中。
+
+// CachedResponse 缓存的响应，Body 为 OpenAI 格式的非流式响应体
+type CachedResponse struct {
+	Body  []byte    `json:"body"`
+	Usage dto.Usage `json:"usage"`
+}
+
+type responseCacheEntry struct {
+	response  *CachedResponse
+	expiresAt time.Time
+}
+
+var responseCacheLock sync.Mutex
+var responseCacheEntries = make(map[string]responseCacheEntry)
+
+// ResponseCacheKey 计算请求的缓存键。请求体解析后重新序列化，消除字段顺序和空白的差异；
+// stream 和 stream_options 不影响响应内容，不参与计算，流式请求可以复用非流式请求缓存的响应
+func ResponseCacheKey(group string, model string, body []byte) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var request map[string]any
+	if err := decoder.Decode(&request); err != nil {
+		return "", err
+	}
+	delete(request, "stream")
+	delete(request, "stream_options")
+	normalized, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write([]byte(group + "\n" + model + "\n"))
+	hash.Write(normalized)
+	return "response_cache:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// GetCachedResponse 获取缓存的响应，不存在或已过期时返回 false
+func GetCachedResponse(key string) (*CachedResponse, bool) {
+	if common.RedisEnabled {
+		data, err := common.RedisGet(key)
+		if err != nil {
+			return nil, false
+		}
+		var response CachedResponse
+		if err := json.Unmarshal([]byte(data), &response); err != nil {
+			common.SysError("error unmarshalling cached response: " + err.Error())
+			return nil, false
+		}
+		return &response, true
+	}
+	responseCacheLock.Lock()
+	defer responseCacheLock.Unlock()
+	entry, ok := responseCacheEntries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(responseCacheEntries, key)
+		return nil, false
+	}
+	return entry.response, true
+}
+
+// SetCachedResponse 缓存响应，内存缓存达到 RESPONSE_CACHE_MAX_ENTRIES 条时先清理过期的条目，
+// 仍然超出时淘汰最早过期的条目
+func SetCachedResponse(key string, response *CachedResponse, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	if common.RedisEnabled {
+		data, err := json.Marshal(response)
+		if err != nil {
+			return err
+		}
+		return common.RedisSet(key, string(data), ttl)
+	}
+	if common.ResponseCacheMaxEntries <= 0 {
+		return nil
+	}
+	responseCacheLock.Lock()
+	defer responseCacheLock.Unlock()
+	if _, ok := responseCacheEntries[key]; !ok && len(responseCacheEntries) >= common.ResponseCacheMaxEntries {
+		now := time.Now()
+		for k, entry := range responseCacheEntries {
+			if now.After(entry.expiresAt) {
+				delete(responseCacheEntries, k)
+			}
+		}
+		for len(responseCacheEntries) >= common.ResponseCacheMaxEntries {
+			oldestKey := ""
+			var oldestExpiresAt time.Time
+			for k, entry := range responseCacheEntries {
+				if oldestKey == "" || entry.expiresAt.Before(oldestExpiresAt) {
+					oldestKey = k
+					oldestExpiresAt = entry.expiresAt
+				}
+			}
+			delete(responseCacheEntries, oldestKey)
+		}
+	}
+	responseCacheEntries[key] = responseCacheEntry{
+		response:  response,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return nil
+}
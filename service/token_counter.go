@@ -207,6 +207,15 @@ func CountTokenInput(input any, model string, check bool) (int, error, bool) {
 			text += s
 		}
 		return CountTokenText(text, model, check)
+	case []any:
+		// JSON 请求体中的字符串数组
+		text := ""
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				text += s
+			}
+		}
+		return CountTokenText(text, model, check)
 	}
 	return 0, errors.New("unsupported input type"), false
 }
@@ -24,3 +24,15 @@ func ResponseText2Usage(responseText string, modeName string, promptTokens int)
 	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 	return usage, err
 }
+
+// GenerateFinalUsageResponse 生成流式响应最后的 usage 数据块，choices 为空
+func GenerateFinalUsageResponse(id string, createdAt int64, model string, usage dto.Usage) *dto.ChatCompletionsStreamResponse {
+	return &dto.ChatCompletionsStreamResponse{
+		Id:      id,
+		Object:  "chat.completion.chunk",
+		Created: createdAt,
+		Model:   model,
+		Choices: make([]dto.ChatCompletionsStreamResponseChoice, 0),
+		Usage:   &usage,
+	}
+}
@@ -8,6 +8,7 @@ import {
     Dropdown,
     Form,
     InputNumber,
+    Modal,
     Popconfirm,
     Space,
     SplitButtonGroup,
@@ -225,6 +226,19 @@ const ChannelsTable = () => {
               setShowEdit(true);
             }
           }>编辑</Button>
+          <Button theme="light" type="tertiary" style={{ marginRight: 1 }} onClick={
+            () => {
+              loadChannelKeys(record);
+            }
+          }>密钥</Button>
+          {
+            record.type === 4 &&
+            <Button theme="light" type="tertiary" style={{ marginRight: 1 }} onClick={
+              () => {
+                fetchChannelModels(record);
+              }
+            }>获取模型</Button>
+          }
         </div>
       )
     }
@@ -249,6 +263,8 @@ const ChannelsTable = () => {
     id: undefined
   });
   const [selectedChannels, setSelectedChannels] = useState([]);
+  const [keyChannel, setKeyChannel] = useState(null);
+  const [channelKeys, setChannelKeys] = useState([]);
 
   const removeRecord = id => {
     let newDataSource = [...channels];
@@ -476,6 +492,80 @@ const ChannelsTable = () => {
     }
   };
 
+  const fetchChannelModels = async (record) => {
+    const res = await API.get(`/api/channel/fetch_models/${record.id}`);
+    const { success, message, data } = res.data;
+    if (success) {
+      record.models = data.join(',');
+      showInfo(`通道 ${record.name} 已获取到 ${data.length} 个模型！`);
+    } else {
+      showError(message);
+    }
+  };
+
+  const loadChannelKeys = async (record) => {
+    const res = await API.get(`/api/channel/keys/${record.id}`);
+    const { success, message, data } = res.data;
+    if (success) {
+      setChannelKeys(data.keys);
+      setKeyChannel(record);
+    } else {
+      showError(message);
+    }
+  };
+
+  const updateChannelKeyStatus = async (index, status) => {
+    const res = await API.put(`/api/channel/keys/${keyChannel.id}`, { index, status });
+    const { success, message } = res.data;
+    if (success) {
+      showSuccess('操作成功完成！');
+      await loadChannelKeys(keyChannel);
+    } else {
+      showError(message);
+    }
+  };
+
+  const channelKeyColumns = [
+    {
+      title: '序号',
+      dataIndex: 'index',
+      render: (text) => text + 1
+    },
+    {
+      title: '密钥',
+      dataIndex: 'key'
+    },
+    {
+      title: '状态',
+      dataIndex: 'status',
+      render: (text) => renderStatus(text)
+    },
+    {
+      title: '错误次数',
+      dataIndex: 'error_count'
+    },
+    {
+      title: '最近错误',
+      dataIndex: 'last_error',
+      render: (text, record) => (
+        text ? <Tooltip content={text}>
+          <Typography.Text ellipsis={{ showTooltip: false }} style={{ width: 200 }}>
+            {timestamp2string(record.last_error_time)} {text}
+          </Typography.Text>
+        </Tooltip> : '无'
+      )
+    },
+    {
+      title: '',
+      dataIndex: 'operate',
+      render: (text, record) => (
+        record.status === 1 ?
+          <Button theme="light" type="warning" onClick={() => updateChannelKeyStatus(record.index, 2)}>禁用</Button> :
+          <Button theme="light" type="secondary" onClick={() => updateChannelKeyStatus(record.index, 1)}>启用</Button>
+      )
+    }
+  ];
+
   const updateAllChannelsBalance = async () => {
     setUpdatingBalance(true);
     const res = await API.get(`/api/channel/update_balance`);
@@ -576,6 +666,15 @@ const ChannelsTable = () => {
   return (
     <>
       <EditChannel refresh={refresh} visible={showEdit} handleClose={closeEdit} editingChannel={editingChannel} />
+      <Modal
+        title={keyChannel ? `渠道「${keyChannel.name}」的密钥` : ''}
+        visible={keyChannel !== null}
+        onCancel={() => setKeyChannel(null)}
+        footer={null}
+        width={900}
+      >
+        <Table columns={channelKeyColumns} dataSource={channelKeys} rowKey="index" pagination={false} />
+      </Modal>
       <Form onSubmit={() => {
         searchChannels(searchKeyword, searchGroup, searchModel);
       }} labelPosition="left">
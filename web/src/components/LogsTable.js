@@ -41,6 +41,27 @@ function renderIsStream(bool) {
   }
 }
 
+function renderCacheHit(bool) {
+  if (bool) {
+    return <Tag color="green" size="large">缓存</Tag>;
+  }
+  return <></>;
+}
+
+function renderClientCancelled(bool) {
+  if (bool) {
+    return <Tag color="orange" size="large">已断开</Tag>;
+  }
+  return <></>;
+}
+
+function renderAudioDuration(duration) {
+  if (duration > 0) {
+    return <Tag color="purple" size="large">音频 {duration.toFixed(1)} s</Tag>;
+  }
+  return <></>;
+}
+
 function renderUseTime(type) {
   const time = parseInt(type);
   if (time < 101) {
@@ -105,6 +126,9 @@ const LogsTable = () => {
         <Space>
           {renderUseTime(text)}
           {renderIsStream(record.is_stream)}
+          {renderCacheHit(record.cache_hit)}
+          {renderClientCancelled(record.client_cancelled)}
+          {renderAudioDuration(record.audio_duration)}
         </Space>
       </div>);
     }
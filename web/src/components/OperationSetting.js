@@ -13,6 +13,7 @@ const OperationSetting = () => {
     StreamCacheQueueLength: 0,
     ModelRatio: '',
     ModelPrice: '',
+    ModelAudioPrice: '',
     GroupRatio: '',
     TopUpLink: '',
     ChatLink: '',
@@ -21,6 +22,14 @@ const OperationSetting = () => {
     AutomaticDisableChannelEnabled: '',
     AutomaticEnableChannelEnabled: '',
     ChannelDisableThreshold: 0,
+    ChannelBreakerEnabled: '',
+    ChannelBreakerWindow: 60,
+    ChannelBreakerMinRequests: 10,
+    ChannelBreakerErrorRate: 0.5,
+    ChannelBreakerConsecutiveFailures: 5,
+    ChannelBreakerCooldown: 30,
+    ChannelBreakerHalfOpenRatio: 0.1,
+    ChannelBreakerHalfOpenSuccesses: 3,
     LogConsumeEnabled: '',
     DisplayInCurrencyEnabled: '',
     DisplayTokenStatEnabled: '',
@@ -35,7 +44,13 @@ const OperationSetting = () => {
     DataExportDefaultTime: 'hour',
     DataExportInterval: 5,
     DefaultCollapseSidebar: '', // 默认折叠侧边栏
-    RetryTimes: 0
+    RetryTimes: 0,
+    BatchRatio: 0.5,
+    CacheHitRatio: 0.1,
+    ModelCacheTTL: '',
+    ChannelSelectStrategy: '',
+    ModelHedgeDelay: '',
+    ModelStreamMode: ''
   });
   const [originInputs, setOriginInputs] = useState({});
   let [loading, setLoading] = useState(false);
@@ -52,7 +67,7 @@ const OperationSetting = () => {
     if (success) {
       let newInputs = {};
       data.forEach((item) => {
-        if (item.key === 'ModelRatio' || item.key === 'GroupRatio' || item.key === 'ModelPrice') {
+        if (item.key === 'ModelRatio' || item.key === 'GroupRatio' || item.key === 'ModelPrice' || item.key === 'ModelAudioPrice' || item.key === 'ModelCacheTTL' || item.key === 'ModelHedgeDelay' || item.key === 'ModelStreamMode' || item.key === 'ChannelSelectStrategy') {
           item.value = JSON.stringify(JSON.parse(item.value), null, 2);
         }
         newInputs[item.key] = item.value;
@@ -112,6 +127,32 @@ const OperationSetting = () => {
         if (originInputs['QuotaRemindThreshold'] !== inputs.QuotaRemindThreshold) {
           await updateOption('QuotaRemindThreshold', inputs.QuotaRemindThreshold);
         }
+        for (const key of ['ChannelBreakerWindow', 'ChannelBreakerMinRequests', 'ChannelBreakerErrorRate', 'ChannelBreakerConsecutiveFailures', 'ChannelBreakerCooldown', 'ChannelBreakerHalfOpenRatio', 'ChannelBreakerHalfOpenSuccesses']) {
+          if (originInputs[key] !== inputs[key]) {
+            await updateOption(key, inputs[key]);
+          }
+        }
+        if (originInputs['ModelHedgeDelay'] !== inputs.ModelHedgeDelay) {
+          if (!verifyJSON(inputs.ModelHedgeDelay)) {
+            showError('模型对冲延迟不是合法的 JSON 字符串');
+            return;
+          }
+          await updateOption('ModelHedgeDelay', inputs.ModelHedgeDelay);
+        }
+        if (originInputs['ModelStreamMode'] !== inputs.ModelStreamMode) {
+          if (!verifyJSON(inputs.ModelStreamMode)) {
+            showError('模型流式模式不是合法的 JSON 字符串');
+            return;
+          }
+          await updateOption('ModelStreamMode', inputs.ModelStreamMode);
+        }
+        if (originInputs['ChannelSelectStrategy'] !== inputs.ChannelSelectStrategy) {
+          if (!verifyJSON(inputs.ChannelSelectStrategy)) {
+            showError('渠道选择策略不是合法的 JSON 字符串');
+            return;
+          }
+          await updateOption('ChannelSelectStrategy', inputs.ChannelSelectStrategy);
+        }
         break;
       case 'ratio':
         if (originInputs['ModelRatio'] !== inputs.ModelRatio) {
@@ -135,6 +176,13 @@ const OperationSetting = () => {
           }
           await updateOption('ModelPrice', inputs.ModelPrice);
         }
+        if (originInputs['ModelAudioPrice'] !== inputs.ModelAudioPrice) {
+          if (!verifyJSON(inputs.ModelAudioPrice)) {
+            showError('模型音频价格不是合法的 JSON 字符串');
+            return;
+          }
+          await updateOption('ModelAudioPrice', inputs.ModelAudioPrice);
+        }
         break;
       case 'words':
         if (originInputs['SensitiveWords'] !== inputs.SensitiveWords) {
@@ -171,6 +219,21 @@ const OperationSetting = () => {
         if (originInputs['RetryTimes'] !== inputs.RetryTimes) {
           await updateOption('RetryTimes', inputs.RetryTimes);
         }
+        if (originInputs['BatchRatio'] !== inputs.BatchRatio) {
+          await updateOption('BatchRatio', inputs.BatchRatio);
+        }
+        break;
+      case 'cache':
+        if (originInputs['CacheHitRatio'] !== inputs.CacheHitRatio) {
+          await updateOption('CacheHitRatio', inputs.CacheHitRatio);
+        }
+        if (originInputs['ModelCacheTTL'] !== inputs.ModelCacheTTL) {
+          if (!verifyJSON(inputs.ModelCacheTTL)) {
+            showError('模型缓存有效期不是合法的 JSON 字符串');
+            return;
+          }
+          await updateOption('ModelCacheTTL', inputs.ModelCacheTTL);
+        }
         break;
     }
   };
@@ -241,6 +304,17 @@ const OperationSetting = () => {
               value={inputs.RetryTimes}
               placeholder="失败重试次数"
             />
+            <Form.Input
+              label="批处理计费倍率"
+              name="BatchRatio"
+              type={'number'}
+              step="0.01"
+              min="0"
+              onChange={handleInputChange}
+              autoComplete="new-password"
+              value={inputs.BatchRatio}
+              placeholder="/v1/batches 批处理请求的计费倍率"
+            />
           </Form.Group>
           <Form.Group inline>
             <Form.Checkbox
@@ -435,6 +509,125 @@ const OperationSetting = () => {
               onChange={handleInputChange}
             />
           </Form.Group>
+          <Form.Group inline>
+            <Form.Checkbox
+              checked={inputs.ChannelBreakerEnabled === 'true'}
+              label="启用渠道熔断（按渠道和模型统计失败，熔断后暂时跳过该渠道，冷却后放行少量请求试探，成功后自动恢复，启用后失败时不再自动禁用通道）"
+              name="ChannelBreakerEnabled"
+              onChange={handleInputChange}
+            />
+          </Form.Group>
+          <Form.Group widths={4}>
+            <Form.Input
+              label="熔断统计窗口（秒）"
+              name="ChannelBreakerWindow"
+              onChange={handleInputChange}
+              autoComplete="new-password"
+              value={inputs.ChannelBreakerWindow}
+              type="number"
+              min="1"
+              placeholder="按最近这段时间内的请求计算错误率"
+            />
+            <Form.Input
+              label="熔断最少请求数"
+              name="ChannelBreakerMinRequests"
+              onChange={handleInputChange}
+              autoComplete="new-password"
+              value={inputs.ChannelBreakerMinRequests}
+              type="number"
+              min="1"
+              placeholder="窗口内请求数达到此值后才按错误率熔断"
+            />
+            <Form.Input
+              label="熔断错误率"
+              name="ChannelBreakerErrorRate"
+              onChange={handleInputChange}
+              autoComplete="new-password"
+              value={inputs.ChannelBreakerErrorRate}
+              type="number"
+              step="0.01"
+              min="0"
+              max="1"
+              placeholder="0 到 1 之间，例如 0.5"
+            />
+            <Form.Input
+              label="熔断连续失败次数"
+              name="ChannelBreakerConsecutiveFailures"
+              onChange={handleInputChange}
+              autoComplete="new-password"
+              value={inputs.ChannelBreakerConsecutiveFailures}
+              type="number"
+              min="0"
+              placeholder="0 表示不按连续失败次数熔断"
+            />
+          </Form.Group>
+          <Form.Group widths={4}>
+            <Form.Input
+              label="熔断冷却时间（秒）"
+              name="ChannelBreakerCooldown"
+              onChange={handleInputChange}
+              autoComplete="new-password"
+              value={inputs.ChannelBreakerCooldown}
+              type="number"
+              min="1"
+              placeholder="熔断后经过此时间进入半开状态"
+            />
+            <Form.Input
+              label="半开放行比例"
+              name="ChannelBreakerHalfOpenRatio"
+              onChange={handleInputChange}
+              autoComplete="new-password"
+              value={inputs.ChannelBreakerHalfOpenRatio}
+              type="number"
+              step="0.01"
+              min="0"
+              max="1"
+              placeholder="半开状态下放行的请求比例，例如 0.1"
+            />
+            <Form.Input
+              label="半开恢复成功次数"
+              name="ChannelBreakerHalfOpenSuccesses"
+              onChange={handleInputChange}
+              autoComplete="new-password"
+              value={inputs.ChannelBreakerHalfOpenSuccesses}
+              type="number"
+              min="1"
+              placeholder="半开状态下连续成功此次数后恢复"
+            />
+          </Form.Group>
+          <Form.Group widths="equal">
+            <Form.TextArea
+              label="模型对冲延迟（第一个渠道超过这个时间没有响应时，向另一个渠道发送相同的请求，先返回的响应胜出）"
+              name="ModelHedgeDelay"
+              onChange={handleInputChange}
+              style={{ minHeight: 150, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete="new-password"
+              value={inputs.ModelHedgeDelay}
+              placeholder='为一个 JSON 文本，键为模型名称，值为等待时间（毫秒），比如 "gpt-4o": 5000'
+            />
+          </Form.Group>
+          <Form.Group widths="equal">
+            <Form.TextArea
+              label="模型流式模式（non_stream 总是以非流式请求上游并为流式请求模拟流式输出，stream 总是以流式请求上游并为非流式请求聚合响应，渠道的设置优先）"
+              name="ModelStreamMode"
+              onChange={handleInputChange}
+              style={{ minHeight: 150, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete="new-password"
+              value={inputs.ModelStreamMode}
+              placeholder='为一个 JSON 文本，键为模型名称，值为 non_stream 或 stream，比如 "ERNIE-Bot-4": "non_stream"'
+            />
+          </Form.Group>
+          <Form.Group widths="equal">
+            <Form.TextArea
+              label="渠道选择策略（同一优先级的渠道之间如何选择：weighted_random 按权重随机，least_in_flight 进行中请求最少，ewma_latency 平均延迟（错误率折算为额外延迟）最低，lowest_error_rate 平均错误率最低）"
+              name="ChannelSelectStrategy"
+              onChange={handleInputChange}
+              style={{ minHeight: 150, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete="new-password"
+              value={inputs.ChannelSelectStrategy}
+              placeholder='为一个 JSON 文本，键为 "分组/模型"，分组和模型都可以写作 *，比如 "default/gpt-4o": "ewma_latency", "*": "least_in_flight"'
+            />
+          </Form.Group>
           <Form.Button onClick={() => {
             submitConfig('monitor').then();
           }}>保存监控设置</Form.Button>
@@ -502,6 +695,17 @@ const OperationSetting = () => {
               placeholder='为一个 JSON 文本，键为模型名称，值为一次调用消耗多少刀，比如 "gpt-4-gizmo-*": 0.1，一次消耗0.1刀'
             />
           </Form.Group>
+          <Form.Group widths="equal">
+            <Form.TextArea
+              label="模型音频价格（语音转文字每秒音频消耗多少刀，未配置的模型按识别结果的 token 数计费）"
+              name="ModelAudioPrice"
+              onChange={handleInputChange}
+              style={{ minHeight: 150, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete="new-password"
+              value={inputs.ModelAudioPrice}
+              placeholder='为一个 JSON 文本，键为模型名称，值为每秒音频消耗多少刀，比如 "whisper-1": 0.0001'
+            />
+          </Form.Group>
           <Form.Group widths="equal">
             <Form.TextArea
               label="模型倍率"
@@ -527,6 +731,37 @@ const OperationSetting = () => {
           <Form.Button onClick={() => {
             submitConfig('ratio').then();
           }}>保存倍率设置</Form.Button>
+          <Divider />
+          <Header as="h3">
+            响应缓存设置
+          </Header>
+          <Form.Group widths={4}>
+            <Form.Input
+              label="缓存命中计费倍率"
+              name="CacheHitRatio"
+              type={'number'}
+              step="0.01"
+              min="0"
+              onChange={handleInputChange}
+              autoComplete="new-password"
+              value={inputs.CacheHitRatio}
+              placeholder="命中响应缓存的请求的计费倍率"
+            />
+          </Form.Group>
+          <Form.Group widths="equal">
+            <Form.TextArea
+              label="模型缓存有效期（对所有令牌启用响应缓存的模型，聊天请求只在 temperature 显式设为 0 并且 n 不大于 1 时缓存）"
+              name="ModelCacheTTL"
+              onChange={handleInputChange}
+              style={{ minHeight: 150, fontFamily: 'JetBrains Mono, Consolas' }}
+              autoComplete="new-password"
+              value={inputs.ModelCacheTTL}
+              placeholder='为一个 JSON 文本，键为模型名称，值为缓存有效期（秒），比如 "text-embedding-3-small": 86400'
+            />
+          </Form.Group>
+          <Form.Button onClick={() => {
+            submitConfig('cache').then();
+          }}>保存响应缓存设置</Form.Button>
         </Form>
       </Grid.Column>
     </Grid>
@@ -4,15 +4,18 @@ export const CHANNEL_OPTIONS = [
     {key: 5, text: 'Midjourney Proxy Plus', value: 5, color: 'blue', label: 'Midjourney Proxy Plus'},
     {key: 4, text: 'Ollama', value: 4, color: 'grey', label: 'Ollama'},
     {key: 14, text: 'Anthropic Claude', value: 14, color: 'indigo', label: 'Anthropic Claude'},
+    {key: 28, text: 'AWS Bedrock Claude', value: 28, color: 'indigo', label: 'AWS Bedrock Claude'},
     {key: 3, text: 'Azure OpenAI', value: 3, color: 'teal', label: 'Azure OpenAI'},
     {key: 11, text: 'Google PaLM2', value: 11, color: 'orange', label: 'Google PaLM2'},
     {key: 24, text: 'Google Gemini', value: 24, color: 'orange', label: 'Google Gemini'},
+    {key: 29, text: 'Google Vertex AI', value: 29, color: 'orange', label: 'Google Vertex AI'},
     {key: 15, text: '百度文心千帆', value: 15, color: 'blue', label: '百度文心千帆'},
     {key: 17, text: '阿里通义千问', value: 17, color: 'orange', label: '阿里通义千问'},
     {key: 18, text: '讯飞星火认知', value: 18, color: 'blue', label: '讯飞星火认知'},
     {key: 16, text: '智谱 ChatGLM', value: 16, color: 'violet', label: '智谱 ChatGLM'},
     {key: 16, text: '智谱 GLM-4V', value: 26, color: 'purple', label: '智谱 GLM-4V'},
     {key: 16, text: 'Moonshot', value: 25, color: 'green', label: 'Moonshot'},
+    {key: 30, text: 'Cohere', value: 30, color: 'purple', label: 'Cohere'},
     {key: 19, text: '360 智脑', value: 19, color: 'blue', label: '360 智脑'},
     {key: 23, text: '腾讯混元', value: 23, color: 'teal', label: '腾讯混元'},
     {key: 8, text: '自定义渠道', value: 8, color: 'pink', label: '自定义渠道'},
@@ -22,6 +22,10 @@ function type2secretPrompt(type) {
             return '按照如下格式输入：APIKey-AppId，例如：fastgpt-0sp2gtvfdgyi4k30jwlgwf1i-64f335d84283f05518e9e041';
         case 23:
             return '按照如下格式输入：AppId|SecretId|SecretKey';
+        case 28:
+            return '按照如下格式输入：AccessKeyId|SecretAccessKey|Region';
+        case 29:
+            return '请输入服务账号的 JSON 密钥文件内容';
         default:
             return '请输入渠道对应的鉴权密钥';
     }
@@ -45,7 +49,12 @@ const EditChannel = (props) => {
         model_mapping: '',
         models: [],
         auto_ban: 1,
-        groups: ['default']
+        groups: ['default'],
+        first_token_timeout: 0,
+        idle_timeout: 0,
+        total_timeout: 0,
+        stream_mode: '',
+        multi_key_mode: ''
     };
     const [batch, setBatch] = useState(false);
     const [autoBan, setAutoBan] = useState(true);
@@ -63,6 +72,7 @@ const EditChannel = (props) => {
             let localModels = [];
             switch (value) {
                 case 14:
+                case 28:
                     localModels = ["claude-instant-1.2", "claude-2", "claude-2.0", "claude-2.1", "claude-3-opus-20240229", "claude-3-sonnet-20240229", "claude-3-haiku-20240307"];
                     break;
                 case 11:
@@ -72,7 +82,7 @@ const EditChannel = (props) => {
                     localModels = ['ERNIE-Bot', 'ERNIE-Bot-turbo', 'ERNIE-Bot-4', 'Embedding-V1'];
                     break;
                 case 17:
-                    localModels = ["qwen-turbo", "qwen-plus", "qwen-max", "qwen-max-longcontext", 'text-embedding-v1'];
+                    localModels = ["qwen-turbo", "qwen-plus", "qwen-max", "qwen-max-longcontext", 'text-embedding-v1', 'wanx-v1'];
                     break;
                 case 16:
                     localModels = ['chatglm_pro', 'chatglm_std', 'chatglm_lite'];
@@ -87,13 +97,19 @@ const EditChannel = (props) => {
                     localModels = ['hunyuan'];
                     break;
                 case 24:
-                    localModels = ['gemini-pro', 'gemini-pro-vision'];
+                    localModels = ['gemini-pro', 'gemini-pro-vision', 'imagen-3.0-generate-002', 'imagen-3.0-fast-generate-001'];
+                    break;
+                case 30:
+                    localModels = ['command-r', 'command-r-plus', 'embed-english-v3.0', 'embed-multilingual-v3.0', 'rerank-english-v3.0', 'rerank-multilingual-v3.0'];
+                    break;
+                case 29:
+                    localModels = ['gemini-pro', 'gemini-pro-vision', 'gemini-1.0-pro', 'gemini-1.5-pro', 'claude-3-sonnet-20240229', 'claude-3-opus-20240229', 'claude-3-haiku-20240307'];
                     break;
                 case 25:
                     localModels = ['moonshot-v1-8k', 'moonshot-v1-32k', 'moonshot-v1-128k'];
                     break;
                 case 26:
-                    localModels = ['glm-4', 'glm-4v', 'glm-3-turbo'];
+                    localModels = ['glm-4', 'glm-4v', 'glm-3-turbo', 'cogview-3', 'cogview-3-plus'];
                     break;
                 case 2:
                     localModels = ['mj_imagine', 'mj_variation', 'mj_reroll', 'mj_blend', 'mj_upscale', 'mj_describe'];
@@ -242,6 +258,9 @@ const EditChannel = (props) => {
             return;
         }
         localInputs.auto_ban = autoBan ? 1 : 0;
+        localInputs.first_token_timeout = parseInt(localInputs.first_token_timeout) || 0;
+        localInputs.idle_timeout = parseInt(localInputs.idle_timeout) || 0;
+        localInputs.total_timeout = parseInt(localInputs.total_timeout) || 0;
         localInputs.models = localInputs.models.join(',');
         localInputs.group = localInputs.groups.join(',');
         if (isEdit) {
@@ -425,6 +444,24 @@ const EditChannel = (props) => {
                             </>
                         )
                     }
+                    {
+                        inputs.type === 29 && (
+                            <>
+                                <div style={{marginTop: 10}}>
+                                    <Typography.Text strong>区域：</Typography.Text>
+                                </div>
+                                <Input
+                                    name='other'
+                                    placeholder={'请输入 Vertex AI 的区域，例如：us-central1，不填则为 us-central1'}
+                                    onChange={value => {
+                                        handleInputChange('other', value)
+                                    }}
+                                    value={inputs.other}
+                                    autoComplete='new-password'
+                                />
+                            </>
+                        )
+                    }
                     {
                         inputs.type === 21 && (
                             <>
@@ -511,12 +548,12 @@ const EditChannel = (props) => {
                         <Typography.Text strong>密钥：</Typography.Text>
                     </div>
                     {
-                        batch ?
+                        batch || inputs.type === 29 ?
                             <TextArea
                                 label='密钥'
                                 name='key'
                                 required
-                                placeholder={'请输入密钥，一行一个'}
+                                placeholder={batch ? '请输入密钥，一行一个，多个密钥保存在同一个渠道中' : type2secretPrompt(inputs.type)}
                                 onChange={value => {
                                     handleInputChange('key', value)
                                 }}
@@ -549,6 +586,56 @@ const EditChannel = (props) => {
                         }}
                         value={inputs.openai_organization}
                     />
+                    <div style={{marginTop: 10}}>
+                        <Typography.Text strong>超时设置（单位秒，0 表示使用默认值）：</Typography.Text>
+                    </div>
+                    <Space>
+                        <Input
+                            label='首字超时'
+                            name='first_token_timeout'
+                            type='number'
+                            placeholder='流式请求等待第一个数据块的时间，超时后更换渠道重试'
+                            onChange={value => {
+                                handleInputChange('first_token_timeout', value)
+                            }}
+                            value={inputs.first_token_timeout}
+                        />
+                        <Input
+                            label='空闲超时'
+                            name='idle_timeout'
+                            type='number'
+                            placeholder='流式响应两个数据块之间的最长间隔'
+                            onChange={value => {
+                                handleInputChange('idle_timeout', value)
+                            }}
+                            value={inputs.idle_timeout}
+                        />
+                        <Input
+                            label='总超时'
+                            name='total_timeout'
+                            type='number'
+                            placeholder='整个请求的最长时间'
+                            onChange={value => {
+                                handleInputChange('total_timeout', value)
+                            }}
+                            value={inputs.total_timeout}
+                        />
+                    </Space>
+                    <div style={{marginTop: 10}}>
+                        <Typography.Text strong>流式模式：</Typography.Text>
+                    </div>
+                    <Select
+                        name='stream_mode'
+                        onChange={value => {
+                            handleInputChange('stream_mode', value)
+                        }}
+                        value={inputs.stream_mode || ''}
+                        optionList={[
+                            {label: '默认（按模型设置，与客户端请求一致）', value: ''},
+                            {label: '非流式（上游不支持流式输出，为流式请求模拟流式输出）', value: 'non_stream'},
+                            {label: '流式（上游只支持流式输出，为非流式请求聚合响应）', value: 'stream'}
+                        ]}
+                    />
                     <div style={{marginTop: 10, display: 'flex'}}>
                         <Space>
                             <Checkbox
@@ -567,20 +654,40 @@ const EditChannel = (props) => {
                     </div>
 
                     {
-                        !isEdit && (
+                        inputs.type !== 29 && (
                             <div style={{marginTop: 10, display: 'flex'}}>
                                 <Space>
                                     <Checkbox
                                         checked={batch}
-                                        label='批量创建'
+                                        label='多密钥'
                                         name='batch'
                                         onChange={() => setBatch(!batch)}
                                     />
-                                    <Typography.Text strong>批量创建</Typography.Text>
+                                    <Typography.Text strong>多密钥</Typography.Text>
                                 </Space>
                             </div>
                         )
                     }
+                    {
+                        batch && (
+                            <>
+                                <div style={{marginTop: 10}}>
+                                    <Typography.Text strong>密钥选择方式：</Typography.Text>
+                                </div>
+                                <Select
+                                    name='multi_key_mode'
+                                    onChange={value => {
+                                        handleInputChange('multi_key_mode', value)
+                                    }}
+                                    value={inputs.multi_key_mode || ''}
+                                    optionList={[
+                                        {label: '轮询', value: ''},
+                                        {label: '随机', value: 'random'}
+                                    ]}
+                                />
+                            </>
+                        )
+                    }
                     {
                         inputs.type !== 3 && inputs.type !== 8 && inputs.type !== 22 && (
                             <>
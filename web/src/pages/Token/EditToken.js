@@ -27,10 +27,12 @@ const EditToken = (props) => {
     expired_time: -1,
     unlimited_quota: false,
     model_limits_enabled: false,
-    model_limits: []
+    model_limits: [],
+    cache_enabled: false,
+    cache_ttl: 0
   };
   const [inputs, setInputs] = useState(originInputs);
-  const { name, remain_quota, expired_time, unlimited_quota, model_limits_enabled, model_limits } = inputs;
+  const { name, remain_quota, expired_time, unlimited_quota, model_limits_enabled, model_limits, cache_enabled, cache_ttl } = inputs;
   // const [visible, setVisible] = useState(false);
   const [models, setModels] = useState({});
   const navigate = useNavigate();
@@ -137,6 +139,7 @@ const EditToken = (props) => {
       // 编辑令牌的逻辑保持不变
       let localInputs = { ...inputs };
       localInputs.remain_quota = parseInt(localInputs.remain_quota);
+      localInputs.cache_ttl = parseInt(localInputs.cache_ttl) || 0;
       if (localInputs.expired_time !== -1) {
         let time = Date.parse(localInputs.expired_time);
         if (isNaN(time)) {
@@ -166,6 +169,7 @@ const EditToken = (props) => {
           localInputs.name = `${inputs.name}-${generateRandomSuffix()}`;
         }
         localInputs.remain_quota = parseInt(localInputs.remain_quota);
+        localInputs.cache_ttl = parseInt(localInputs.cache_ttl) || 0;
 
         if (localInputs.expired_time !== -1) {
           let time = Date.parse(localInputs.expired_time);
@@ -342,6 +346,29 @@ const EditToken = (props) => {
             optionList={models}
             disabled={!model_limits_enabled}
           />
+          <Divider />
+          <div style={{ marginTop: 10, display: 'flex' }}>
+            <Space>
+              <Checkbox
+                name="cache_enabled"
+                checked={cache_enabled}
+                onChange={(e) => handleInputChange('cache_enabled', e.target.checked)}
+              >
+              </Checkbox>
+              <Typography.Text>启用响应缓存（相同的请求直接返回缓存的响应，按缓存命中倍率计费；聊天请求只在 temperature 显式设为 0 并且 n 不大于 1 时缓存）</Typography.Text>
+            </Space>
+          </div>
+          <Input
+            style={{ marginTop: 8 }}
+            label="缓存有效期"
+            name="cache_ttl"
+            placeholder={'单位秒，0 表示使用默认值'}
+            onChange={(value) => handleInputChange('cache_ttl', value)}
+            value={cache_ttl}
+            autoComplete="new-password"
+            type="number"
+            disabled={!cache_enabled}
+          />
         </Spin>
       </SideSheet>
     </>